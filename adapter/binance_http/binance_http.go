@@ -5,13 +5,15 @@ import (
 )
 
 type Adapter struct {
-	fapiBaseUrl string
-	client      *resty.Client
+	fapiBaseUrl        string
+	futuresDataBaseUrl string
+	client             *resty.Client
 }
 
-func NewAdapter(fapiBaseUrl string) *Adapter {
+func NewAdapter(fapiBaseUrl, futuresDataBaseUrl string) *Adapter {
 	return &Adapter{
-		fapiBaseUrl: fapiBaseUrl,
-		client:      resty.New(),
+		fapiBaseUrl:        fapiBaseUrl,
+		futuresDataBaseUrl: futuresDataBaseUrl,
+		client:             resty.New(),
 	}
 }
@@ -0,0 +1,359 @@
+// Package binancehttptest serves the binance futures endpoints binancehttp.Adapter
+// reads from, backed by data the test puts in.
+package binancehttptest
+
+import (
+	"encoding/json"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	binanceEntity "michaelyusak/go-quant-replay-engine.git/entity/binance"
+
+	"github.com/shopspring/decimal"
+)
+
+// binance caps every history endpoint at 1500 rows, open interest at 500
+const (
+	maxLimit             = 1500
+	maxOpenInterestLimit = 500
+)
+
+type Server struct {
+	*httptest.Server
+
+	symbols       []binanceEntity.FapiExchangeInfoSymbol
+	klines        map[string][]entity.Candle
+	priceKlines   map[entity.PriceType]map[string][]entity.PriceCandle
+	fundingRates  map[string][]entity.FundingRate
+	openInterests map[string][]entity.OpenInterest
+	requests      map[string]int
+	failures      map[string]int
+
+	mu sync.Mutex
+}
+
+func NewServer() *Server {
+	s := &Server{
+		klines: map[string][]entity.Candle{},
+		priceKlines: map[entity.PriceType]map[string][]entity.PriceCandle{
+			entity.PriceTypeMark:  {},
+			entity.PriceTypeIndex: {},
+		},
+		fundingRates:  map[string][]entity.FundingRate{},
+		openInterests: map[string][]entity.OpenInterest{},
+		requests:      map[string]int{},
+		failures:      map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fapi/v1/exchangeInfo", s.handle(s.exchangeInfo))
+	mux.HandleFunc("/fapi/v1/klines", s.handle(s.getKlines))
+	mux.HandleFunc("/fapi/v1/markPriceKlines", s.handle(s.priceKlinesOf(entity.PriceTypeMark, "symbol")))
+	mux.HandleFunc("/fapi/v1/indexPriceKlines", s.handle(s.priceKlinesOf(entity.PriceTypeIndex, "pair")))
+	mux.HandleFunc("/fapi/v1/fundingRate", s.handle(s.getFundingRates))
+	mux.HandleFunc("/futures/data/openInterestHist", s.handle(s.getOpenInterests))
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// FapiBaseUrl and FuturesDataBaseUrl go into binancehttp.NewAdapter.
+func (s *Server) FapiBaseUrl() string {
+	return s.URL + "/fapi"
+}
+
+func (s *Server) FuturesDataBaseUrl() string {
+	return s.URL + "/futures/data"
+}
+
+func (s *Server) AddSymbols(symbols ...binanceEntity.FapiExchangeInfoSymbol) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.symbols = append(s.symbols, symbols...)
+}
+
+// AddKlines serves candles as the 1m klines of their pair.
+func (s *Server) AddKlines(candles ...entity.Candle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, candle := range candles {
+		s.klines[candle.Pair] = append(s.klines[candle.Pair], candle)
+	}
+
+	for pair := range s.klines {
+		sort.Slice(s.klines[pair], func(i, j int) bool {
+			return s.klines[pair][i].Epoch < s.klines[pair][j].Epoch
+		})
+	}
+}
+
+func (s *Server) AddPriceKlines(candles ...entity.PriceCandle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, candle := range candles {
+		byPair := s.priceKlines[candle.PriceType]
+		byPair[candle.Pair] = append(byPair[candle.Pair], candle)
+		sort.Slice(byPair[candle.Pair], func(i, j int) bool {
+			return byPair[candle.Pair][i].Epoch < byPair[candle.Pair][j].Epoch
+		})
+	}
+}
+
+func (s *Server) AddFundingRates(rates ...entity.FundingRate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rate := range rates {
+		s.fundingRates[rate.Pair] = append(s.fundingRates[rate.Pair], rate)
+		sort.Slice(s.fundingRates[rate.Pair], func(i, j int) bool {
+			return s.fundingRates[rate.Pair][i].Epoch < s.fundingRates[rate.Pair][j].Epoch
+		})
+	}
+}
+
+func (s *Server) AddOpenInterests(openInterests ...entity.OpenInterest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, oi := range openInterests {
+		s.openInterests[oi.Pair] = append(s.openInterests[oi.Pair], oi)
+		sort.Slice(s.openInterests[oi.Pair], func(i, j int) bool {
+			return s.openInterests[oi.Pair][i].Epoch < s.openInterests[oi.Pair][j].Epoch
+		})
+	}
+}
+
+// Requests counts the requests made to path, e.g. "/fapi/v1/klines".
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+// FailNext answers the next n requests to path with a binance error.
+func (s *Server) FailNext(path string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[path] = n
+}
+
+func (s *Server) handle(serve func(query map[string]string) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		fail := s.failures[r.URL.Path] > 0
+		if fail {
+			s.failures[r.URL.Path]--
+		}
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if fail {
+			writeError(w, http.StatusServiceUnavailable, -1001, "Internal error; unable to process your request. Please try again.")
+			return
+		}
+
+		query := map[string]string{}
+		for key := range r.URL.Query() {
+			query[key] = r.URL.Query().Get(key)
+		}
+
+		s.mu.Lock()
+		res, err := serve(query)
+		s.mu.Unlock()
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, -1100, err.Error())
+			return
+		}
+
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+func writeError(w http.ResponseWriter, status, code int, msg string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(binanceEntity.FapiGeneralErrorResponse{Code: code, Msg: msg})
+}
+
+func (s *Server) exchangeInfo(query map[string]string) (any, error) {
+	return binanceEntity.FapiExchangeInfoResponse{Symbols: s.symbols}, nil
+}
+
+func (s *Server) getKlines(query map[string]string) (any, error) {
+	page, err := parsePage(query, maxLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]any{}
+
+	for _, candle := range s.klines[query["symbol"]] {
+		if !page.contains(candle.Epoch) {
+			continue
+		}
+
+		openTime := candle.Epoch * 1000
+		rows = append(rows, []any{
+			openTime, text(candle.Open), text(candle.High), text(candle.Low), text(candle.Close), text(candle.Volume.Total),
+			openTime + time.Minute.Milliseconds() - 1, text(candle.Close.Mul(candle.Volume.Total)), 1,
+			text(candle.Volume.Buy), text(candle.Close.Mul(candle.Volume.Buy)), "0",
+		})
+
+		if len(rows) == page.limit {
+			break
+		}
+	}
+
+	return rows, nil
+}
+
+func (s *Server) priceKlinesOf(priceType entity.PriceType, symbolParam string) func(query map[string]string) (any, error) {
+	return func(query map[string]string) (any, error) {
+		page, err := parsePage(query, maxLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		rows := [][]any{}
+
+		for _, candle := range s.priceKlines[priceType][query[symbolParam]] {
+			if !page.contains(candle.Epoch) {
+				continue
+			}
+
+			openTime := candle.Epoch * 1000
+			rows = append(rows, []any{
+				openTime, text(candle.Open), text(candle.High), text(candle.Low), text(candle.Close), "0",
+				openTime + time.Minute.Milliseconds() - 1, "0", 0, "0", "0", "0",
+			})
+
+			if len(rows) == page.limit {
+				break
+			}
+		}
+
+		return rows, nil
+	}
+}
+
+func (s *Server) getFundingRates(query map[string]string) (any, error) {
+	page, err := parsePage(query, 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []binanceEntity.FapiFundingRateResponse{}
+
+	for _, rate := range s.fundingRates[query["symbol"]] {
+		if !page.contains(rate.Epoch) {
+			continue
+		}
+
+		res = append(res, binanceEntity.FapiFundingRateResponse{
+			Symbol:      rate.Pair,
+			FundingRate: text(rate.FundingRate),
+			FundingTime: json.Number(strconv.FormatInt(rate.Epoch*1000, 10)),
+			MarkPrice:   text(rate.MarkPrice),
+		})
+
+		if len(res) == page.limit {
+			break
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Server) getOpenInterests(query map[string]string) (any, error) {
+	page, err := parsePage(query, maxOpenInterestLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []binanceEntity.FuturesDataOpenInterestHistResponse{}
+
+	for _, oi := range s.openInterests[query["symbol"]] {
+		if !page.contains(oi.Epoch) {
+			continue
+		}
+
+		res = append(res, binanceEntity.FuturesDataOpenInterestHistResponse{
+			Symbol:               oi.Pair,
+			SumOpenInterest:      text(oi.OpenInterest),
+			SumOpenInterestValue: text(oi.OpenInterestValue),
+			Timestamp:            json.Number(strconv.FormatInt(oi.Epoch*1000, 10)),
+		})
+
+		if len(res) == page.limit {
+			break
+		}
+	}
+
+	return res, nil
+}
+
+type page struct {
+	startMilli int64
+	endMilli   int64
+	limit      int
+}
+
+func parsePage(query map[string]string, max int) (page, error) {
+	p := page{limit: 500}
+
+	var err error
+
+	if v := query["limit"]; v != "" {
+		p.limit, err = strconv.Atoi(v)
+		if err != nil {
+			return page{}, err
+		}
+	}
+	if p.limit <= 0 || p.limit > max {
+		p.limit = max
+	}
+
+	if v := query["startTime"]; v != "" {
+		p.startMilli, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return page{}, err
+		}
+	}
+
+	if v := query["endTime"]; v != "" {
+		p.endMilli, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return page{}, err
+		}
+	}
+
+	return p, nil
+}
+
+func (p page) contains(epoch int64) bool {
+	milli := epoch * 1000
+
+	return milli >= p.startMilli && (p.endMilli == 0 || milli <= p.endMilli)
+}
+
+// text writes d with the places it carries, like binance does.
+func text(d decimal.Decimal) string {
+	if d.Exponent() >= 0 {
+		return d.String()
+	}
+
+	return d.StringFixed(-d.Exponent())
+}
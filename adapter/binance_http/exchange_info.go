@@ -0,0 +1,85 @@
+package binancehttp
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"time"
+
+	binanceEntity "michaelyusak/go-quant-replay-engine.git/entity/binance"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// binance puts perpetuals at a delivery date of 2100-12-25, anything earlier is a real delivery or delisting
+const fapiPerpetualDeliveryDate = 4133404800000
+
+func (a *Adapter) GetExchangeInfo(ctx context.Context) ([]entity.SymbolInfo, error) {
+	var res binanceEntity.FapiExchangeInfoResponse
+	var errRes binanceEntity.FapiGeneralErrorResponse
+
+	r, err := a.client.R().
+		SetContext(ctx).
+		SetResult(&res).
+		SetError(&errRes).
+		Get(fmt.Sprintf("%s/v1/exchangeInfo", a.fapiBaseUrl))
+	if err != nil {
+		return nil, fmt.Errorf("[adapter][BinanceHttp][GetExchangeInfo][Get] error: %w", err)
+	}
+	if r.StatusCode() >= http.StatusBadRequest {
+		return nil, fmt.Errorf("[adapter][BinanceHttp][GetExchangeInfo][StatusCode: %v] res: %+v", r.StatusCode(), errRes)
+	}
+
+	return a.normalizedSymbolInfo(res.Symbols), nil
+}
+
+func (a *Adapter) normalizedSymbolInfo(raw []binanceEntity.FapiExchangeInfoSymbol) []entity.SymbolInfo {
+	normalized := []entity.SymbolInfo{}
+	now := time.Now().UnixMilli()
+
+	for _, data := range raw {
+		tickSize := decimal.Zero
+		lotSize := decimal.Zero
+
+		for _, filter := range data.Filters {
+			var err error
+
+			switch filter.FilterType {
+			case "PRICE_FILTER":
+				tickSize, err = decimal.NewFromString(filter.TickSize)
+			case "LOT_SIZE":
+				lotSize, err = decimal.NewFromString(filter.StepSize)
+			}
+			if err != nil {
+				logrus.
+					WithField("symbol", data.Symbol).
+					WithField("filter_type", filter.FilterType).
+					Warn("[adapter][BinanceHttp][NormalizedSymbolInfo] invalid filter decimal")
+			}
+		}
+
+		delistedAt := int64(0)
+		if data.DeliveryDate > 0 && data.DeliveryDate < fapiPerpetualDeliveryDate {
+			delistedAt = data.DeliveryDate
+		}
+
+		normalized = append(normalized, entity.SymbolInfo{
+			Symbol:              fmt.Sprintf("binance:%s", data.Symbol),
+			Exchange:            "binance",
+			Pair:                data.Symbol,
+			BaseAsset:           data.BaseAsset,
+			QuoteAsset:          data.QuoteAsset,
+			TickSize:            tickSize,
+			LotSize:             lotSize,
+			ContractType:        data.ContractType,
+			Status:              data.Status,
+			ListedAtUnixMilli:   data.OnboardDate,
+			DelistedAtUnixMilli: delistedAt,
+			UpdatedAtUnixMilli:  now,
+		})
+	}
+
+	return normalized
+}
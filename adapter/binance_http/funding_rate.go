@@ -0,0 +1,90 @@
+package binancehttp
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"strconv"
+
+	binanceEntity "michaelyusak/go-quant-replay-engine.git/entity/binance"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+func (a *Adapter) GetFundingRateHistory(ctx context.Context, startTime, endTime int64, limit int, symbol string) ([]entity.FundingRate, error) {
+	var res []binanceEntity.FapiFundingRateResponse
+	var errRes binanceEntity.FapiGeneralErrorResponse
+
+	params := map[string]string{
+		"symbol":    symbol,
+		"limit":     strconv.Itoa(limit),
+		"startTime": strconv.Itoa(int(startTime)),
+	}
+	if endTime > 0 {
+		params["endTime"] = strconv.Itoa(int(endTime))
+	}
+
+	r, err := a.client.R().
+		SetContext(ctx).
+		SetResult(&res).
+		SetError(&errRes).
+		SetQueryParams(params).
+		Get(fmt.Sprintf("%s/v1/fundingRate", a.fapiBaseUrl))
+	if err != nil {
+		return nil, fmt.Errorf("[adapter][BinanceHttp][GetFundingRateHistory][Get] error: %w", err)
+	}
+	if r.StatusCode() >= http.StatusBadRequest {
+		return nil, fmt.Errorf("[adapter][BinanceHttp][GetFundingRateHistory][StatusCode: %v] res: %+v", r.StatusCode(), errRes)
+	}
+
+	return a.normalizedFundingRate(res, symbol), nil
+}
+
+func (a *Adapter) normalizedFundingRate(raw []binanceEntity.FapiFundingRateResponse, symbol string) []entity.FundingRate {
+	normalized := []entity.FundingRate{}
+
+	for i, data := range raw {
+		epochMs, err := data.FundingTime.Int64()
+		if err != nil {
+			logrus.
+				WithField("row", i).
+				WithField("funding_time", data.FundingTime).
+				Warn("[adapter][BinanceHttp][NormalizedFundingRate] invalid funding time")
+			continue
+		}
+
+		rateDec, err := decimal.NewFromString(data.FundingRate)
+		if err != nil {
+			logrus.
+				WithField("row", i).
+				WithField("funding_rate", data.FundingRate).
+				Warn("[adapter][BinanceHttp][NormalizedFundingRate] invalid funding rate decimal")
+			continue
+		}
+
+		// markPrice is absent on very old funding records
+		markPriceDec := decimal.Zero
+		if data.MarkPrice != "" {
+			markPriceDec, err = decimal.NewFromString(data.MarkPrice)
+			if err != nil {
+				logrus.
+					WithField("row", i).
+					WithField("mark_price", data.MarkPrice).
+					Warn("[adapter][BinanceHttp][NormalizedFundingRate] invalid mark price decimal")
+				continue
+			}
+		}
+
+		normalized = append(normalized, entity.FundingRate{
+			Epoch:       epochMs / 1000,
+			Pair:        symbol,
+			Exchange:    "binance",
+			FundingRate: rateDec,
+			MarkPrice:   markPriceDec,
+		})
+	}
+
+	return normalized
+}
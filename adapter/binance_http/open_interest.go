@@ -0,0 +1,87 @@
+package binancehttp
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"strconv"
+
+	binanceEntity "michaelyusak/go-quant-replay-engine.git/entity/binance"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// GetOpenInterestHistory only covers the latest 30 days, binance does not serve older open interest.
+func (a *Adapter) GetOpenInterestHistory(ctx context.Context, startTime, endTime int64, limit int, symbol, period string) ([]entity.OpenInterest, error) {
+	var res []binanceEntity.FuturesDataOpenInterestHistResponse
+	var errRes binanceEntity.FapiGeneralErrorResponse
+
+	params := map[string]string{
+		"symbol":    symbol,
+		"period":    period,
+		"limit":     strconv.Itoa(limit),
+		"startTime": strconv.Itoa(int(startTime)),
+	}
+	if endTime > 0 {
+		params["endTime"] = strconv.Itoa(int(endTime))
+	}
+
+	r, err := a.client.R().
+		SetContext(ctx).
+		SetResult(&res).
+		SetError(&errRes).
+		SetQueryParams(params).
+		Get(fmt.Sprintf("%s/openInterestHist", a.futuresDataBaseUrl))
+	if err != nil {
+		return nil, fmt.Errorf("[adapter][BinanceHttp][GetOpenInterestHistory][Get] error: %w", err)
+	}
+	if r.StatusCode() >= http.StatusBadRequest {
+		return nil, fmt.Errorf("[adapter][BinanceHttp][GetOpenInterestHistory][StatusCode: %v] res: %+v", r.StatusCode(), errRes)
+	}
+
+	return a.normalizedOpenInterest(res, symbol), nil
+}
+
+func (a *Adapter) normalizedOpenInterest(raw []binanceEntity.FuturesDataOpenInterestHistResponse, symbol string) []entity.OpenInterest {
+	normalized := []entity.OpenInterest{}
+
+	for i, data := range raw {
+		epochMs, err := data.Timestamp.Int64()
+		if err != nil {
+			logrus.
+				WithField("row", i).
+				WithField("timestamp", data.Timestamp).
+				Warn("[adapter][BinanceHttp][NormalizedOpenInterest] invalid timestamp")
+			continue
+		}
+
+		oiDec, err := decimal.NewFromString(data.SumOpenInterest)
+		if err != nil {
+			logrus.
+				WithField("row", i).
+				WithField("sum_open_interest", data.SumOpenInterest).
+				Warn("[adapter][BinanceHttp][NormalizedOpenInterest] invalid open interest decimal")
+			continue
+		}
+		oiValueDec, err := decimal.NewFromString(data.SumOpenInterestValue)
+		if err != nil {
+			logrus.
+				WithField("row", i).
+				WithField("sum_open_interest_value", data.SumOpenInterestValue).
+				Warn("[adapter][BinanceHttp][NormalizedOpenInterest] invalid open interest value decimal")
+			continue
+		}
+
+		normalized = append(normalized, entity.OpenInterest{
+			Epoch:             epochMs / 1000,
+			Pair:              symbol,
+			Exchange:          "binance",
+			OpenInterest:      oiDec,
+			OpenInterestValue: oiValueDec,
+		})
+	}
+
+	return normalized
+}
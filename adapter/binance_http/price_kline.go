@@ -0,0 +1,115 @@
+package binancehttp
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"strconv"
+
+	binanceEntity "michaelyusak/go-quant-replay-engine.git/entity/binance"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+func (a *Adapter) GetMarkPriceKlines(ctx context.Context, startTime, endTime int64, limit int, symbol, interval string) ([]entity.PriceCandle, error) {
+	return a.getPriceKlines(ctx, "markPriceKlines", "symbol", entity.PriceTypeMark, startTime, endTime, limit, symbol, interval)
+}
+
+// GetIndexPriceKlines takes the underlying pair, e.g. BTCUSDT, not the contract symbol.
+func (a *Adapter) GetIndexPriceKlines(ctx context.Context, startTime, endTime int64, limit int, pair, interval string) ([]entity.PriceCandle, error) {
+	return a.getPriceKlines(ctx, "indexPriceKlines", "pair", entity.PriceTypeIndex, startTime, endTime, limit, pair, interval)
+}
+
+func (a *Adapter) getPriceKlines(ctx context.Context, path, symbolParam string, priceType entity.PriceType, startTime, endTime int64, limit int, symbol, interval string) ([]entity.PriceCandle, error) {
+	var res [][]any
+	var errRes binanceEntity.FapiGeneralErrorResponse
+
+	params := map[string]string{
+		symbolParam: symbol,
+		"limit":     strconv.Itoa(limit),
+		"interval":  interval,
+		"startTime": strconv.Itoa(int(startTime)),
+	}
+	if endTime > 0 {
+		params["endTime"] = strconv.Itoa(int(endTime))
+	}
+
+	r, err := a.client.R().
+		SetContext(ctx).
+		SetResult(&res).
+		SetError(&errRes).
+		SetQueryParams(params).
+		Get(fmt.Sprintf("%s/v1/%s", a.fapiBaseUrl, path))
+	if err != nil {
+		return nil, fmt.Errorf("[adapter][BinanceHttp][getPriceKlines][%s][Get] error: %w", path, err)
+	}
+	if r.StatusCode() >= http.StatusBadRequest {
+		return nil, fmt.Errorf("[adapter][BinanceHttp][getPriceKlines][%s][StatusCode: %v] res: %+v", path, r.StatusCode(), errRes)
+	}
+
+	return a.normalizedPriceCandle(res, symbol, priceType), nil
+}
+
+func (a *Adapter) normalizedPriceCandle(raw [][]any, symbol string, priceType entity.PriceType) []entity.PriceCandle {
+	normalized := []entity.PriceCandle{}
+
+	for i, data := range raw {
+		if len(data) < 5 {
+			logrus.
+				WithField("row", i).
+				WithField("data", data).
+				Warn("[adapter][BinanceHttp][NormalizedPriceCandle] skipping row. not enough columns")
+			continue
+		}
+
+		epochFloat, ok := data[0].(float64)
+		if !ok {
+			logrus.
+				WithField("row", i).
+				WithField("epoch", data[0]).
+				Warn("[adapter][BinanceHttp][NormalizedPriceCandle] invalid epoch")
+			continue
+		}
+		epochMs := int64(epochFloat)
+
+		prices := make([]decimal.Decimal, 4)
+		valid := true
+		for j := range prices {
+			priceStr, ok := data[j+1].(string)
+			if !ok {
+				valid = false
+				break
+			}
+
+			priceDec, err := decimal.NewFromString(priceStr)
+			if err != nil {
+				valid = false
+				break
+			}
+
+			prices[j] = priceDec
+		}
+		if !valid {
+			logrus.
+				WithField("row", i).
+				WithField("data", data).
+				Warn("[adapter][BinanceHttp][NormalizedPriceCandle] invalid price decimal")
+			continue
+		}
+
+		normalized = append(normalized, entity.PriceCandle{
+			Epoch:     epochMs / 1000,
+			Pair:      symbol,
+			Exchange:  "binance",
+			PriceType: priceType,
+			Open:      prices[0],
+			High:      prices[1],
+			Low:       prices[2],
+			Close:     prices[3],
+		})
+	}
+
+	return normalized
+}
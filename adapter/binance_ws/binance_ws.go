@@ -0,0 +1,17 @@
+package binancews
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+type Adapter struct {
+	fstreamBaseUrl string
+	dialer         *websocket.Dialer
+}
+
+func NewAdapter(fstreamBaseUrl string) *Adapter {
+	return &Adapter{
+		fstreamBaseUrl: fstreamBaseUrl,
+		dialer:         websocket.DefaultDialer,
+	}
+}
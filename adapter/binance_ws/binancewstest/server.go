@@ -0,0 +1,154 @@
+// Package binancewstest serves the binance futures kline streams binancews.Adapter
+// subscribes to, pushing the klines the test sends.
+package binancewstest
+
+import (
+	"encoding/json"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	binanceEntity "michaelyusak/go-quant-replay-engine.git/entity/binance"
+
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+)
+
+type Server struct {
+	*httptest.Server
+
+	upgrader websocket.Upgrader
+
+	// conns maps every open connection to the streams it subscribed to
+	conns       map[*websocket.Conn][]string
+	connections int
+
+	mu sync.Mutex
+}
+
+func NewServer() *Server {
+	s := &Server{
+		conns: map[*websocket.Conn][]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", s.stream)
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// FstreamBaseUrl goes into binancews.NewAdapter.
+func (s *Server) FstreamBaseUrl() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// Connections counts the connections made so far, closed ones included.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connections
+}
+
+// Open counts the connections still open.
+func (s *Server) Open() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// SendKline pushes candle as a kline of its pair to every connection subscribed to the
+// pair, closed tells whether the kline is final. It returns how many connections got it.
+func (s *Server) SendKline(candle entity.Candle, closed bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := strings.ToLower(candle.Pair) + "@kline_"
+	sent := 0
+
+	for conn, streams := range s.conns {
+		for _, stream := range streams {
+			interval, ok := strings.CutPrefix(stream, prefix)
+			if !ok {
+				continue
+			}
+
+			startMilli := candle.Epoch * 1000
+			data, _ := json.Marshal(binanceEntity.FstreamKlineEvent{
+				EventType: "kline",
+				EventTime: startMilli,
+				Symbol:    candle.Pair,
+				Kline: binanceEntity.FstreamKline{
+					StartTime:      startMilli,
+					CloseTime:      startMilli + entity.CandleInterval(interval).Duration().Milliseconds() - 1,
+					Symbol:         candle.Pair,
+					Interval:       interval,
+					Open:           text(candle.Open),
+					Close:          text(candle.Close),
+					High:           text(candle.High),
+					Low:            text(candle.Low),
+					Volume:         text(candle.Volume.Total),
+					IsClosed:       closed,
+					TakerBuyVolume: text(candle.Volume.Buy),
+				},
+			})
+
+			err := conn.WriteJSON(binanceEntity.FstreamCombinedEvent{Stream: stream, Data: data})
+			if err == nil {
+				sent++
+			}
+		}
+	}
+
+	return sent
+}
+
+// DropConnections closes every open connection without a close frame, like a lost network.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.NetConn().Close()
+		delete(s.conns, conn)
+	}
+}
+
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.conns[conn] = strings.Split(r.URL.Query().Get("streams"), "/")
+	s.connections++
+	s.mu.Unlock()
+
+	// binance ignores what clients send, reading only notices them leaving
+	for {
+		_, _, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+// text writes d with the places it carries, like binance does.
+func text(d decimal.Decimal) string {
+	if d.Exponent() >= 0 {
+		return d.String()
+	}
+
+	return d.StringFixed(-d.Exponent())
+}
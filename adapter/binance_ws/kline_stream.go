@@ -0,0 +1,109 @@
+package binancews
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"strings"
+
+	binanceEntity "michaelyusak/go-quant-replay-engine.git/entity/binance"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// SubscribeKlines streams the klines of the given pairs to onKline until ctx is done
+// or the connection fails. closed tells whether the kline is final or still in progress.
+func (a *Adapter) SubscribeKlines(ctx context.Context, pairs []string, interval string, onKline func(candle entity.Candle, closed bool) error) error {
+	streams := make([]string, len(pairs))
+	for i, pair := range pairs {
+		streams[i] = fmt.Sprintf("%s@kline_%s", strings.ToLower(pair), interval)
+	}
+
+	url := fmt.Sprintf("%s/stream?streams=%s", a.fstreamBaseUrl, strings.Join(streams, "/"))
+
+	conn, _, err := a.dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return fmt.Errorf("[adapter][BinanceWs][SubscribeKlines][dialer.DialContext] error: %w", err)
+	}
+	defer conn.Close()
+
+	// unblocks ReadMessage once the subscriber is gone
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("[adapter][BinanceWs][SubscribeKlines][conn.ReadMessage] error: %w", err)
+		}
+
+		var event binanceEntity.FstreamCombinedEvent
+		err = json.Unmarshal(message, &event)
+		if err != nil {
+			logrus.
+				WithError(err).
+				WithField("raw", string(message)).
+				Warn("[adapter][BinanceWs][SubscribeKlines][json.Unmarshal(message, &event)]")
+			continue
+		}
+
+		var klineEvent binanceEntity.FstreamKlineEvent
+		err = json.Unmarshal(event.Data, &klineEvent)
+		if err != nil || klineEvent.EventType != "kline" {
+			continue
+		}
+
+		candle, ok := a.normalizedCandle(klineEvent.Kline)
+		if !ok {
+			continue
+		}
+
+		err = onKline(candle, klineEvent.Kline.IsClosed)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (a *Adapter) normalizedCandle(kline binanceEntity.FstreamKline) (entity.Candle, bool) {
+	values := []string{kline.Open, kline.High, kline.Low, kline.Close, kline.Volume, kline.TakerBuyVolume}
+	decs := make([]decimal.Decimal, len(values))
+
+	for i, v := range values {
+		dec, err := decimal.NewFromString(v)
+		if err != nil {
+			logrus.
+				WithField("symbol", kline.Symbol).
+				WithField("start_time", kline.StartTime).
+				WithField("value", v).
+				Warn("[adapter][BinanceWs][NormalizedCandle] invalid decimal")
+			return entity.Candle{}, false
+		}
+
+		decs[i] = dec
+	}
+
+	return entity.Candle{
+		Epoch:    kline.StartTime / 1000,
+		Pair:     kline.Symbol,
+		Exchange: "binance",
+		Symbol:   fmt.Sprintf("binance:%s", kline.Symbol),
+		Open:     decs[0],
+		High:     decs[1],
+		Low:      decs[2],
+		Close:    decs[3],
+		Volume: entity.CandleVolume{
+			Total: decs[4],
+			Buy:   decs[5],
+			Sell:  decs[4].Sub(decs[5]),
+		},
+	}, true
+}
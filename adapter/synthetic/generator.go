@@ -0,0 +1,295 @@
+// Package synthetic generates deterministic fake markets, an exchange to test every
+// other part against without reaching out to a real one.
+package synthetic
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// every minute is walked in substeps, the high and low of a bar are those of the path
+	substeps = 10
+
+	minutesPerDay  = 24 * 60
+	minutesPerYear = 365 * minutesPerDay
+
+	defaultStartPrice    = 100
+	defaultPriceDecimals = 2
+	defaultVolume        = 10
+
+	maxPriceDecimals = 12
+)
+
+type pairState struct {
+	pair     string
+	logPrice float64
+	rng      *rand.Rand
+}
+
+// Generator produces the 1m bars of a market one minute after the other. It is not safe
+// for concurrent use.
+type Generator struct {
+	market entity.SyntheticMarket
+	epoch  int64
+	pairs  []*pairState
+	// rng draws what the pairs share, the regime switches
+	rng    *rand.Rand
+	regime int
+}
+
+// NewGenerator starts market at the minute of start, the defaults of market filled in.
+func NewGenerator(market entity.SyntheticMarket, start time.Time) (*Generator, error) {
+	market = WithDefaults(market)
+
+	err := Validate(market)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := append([]string{}, market.Pairs...)
+	sort.Strings(pairs)
+
+	g := &Generator{
+		market: market,
+		epoch:  start.Truncate(time.Minute).Unix(),
+		rng:    rand.New(rand.NewPCG(market.Seed, 0)),
+	}
+
+	// every pair draws from its own stream, adding a pair leaves the others as they were
+	for _, pair := range pairs {
+		h := fnv.New64a()
+		h.Write([]byte(pair))
+
+		g.pairs = append(g.pairs, &pairState{
+			pair:     pair,
+			logPrice: math.Log(market.StartPrice),
+			rng:      rand.New(rand.NewPCG(market.Seed, h.Sum64())),
+		})
+	}
+
+	return g, nil
+}
+
+// WithDefaults fills in what market leaves out, the seed aside.
+func WithDefaults(market entity.SyntheticMarket) entity.SyntheticMarket {
+	if market.Exchange == "" {
+		market.Exchange = entity.SyntheticExchangeDefault
+	}
+
+	if market.StartPrice == 0 {
+		market.StartPrice = defaultStartPrice
+	}
+
+	if market.PriceDecimals == 0 {
+		market.PriceDecimals = defaultPriceDecimals
+	}
+
+	if market.Model == entity.SyntheticModelOu && market.MeanPrice == 0 {
+		market.MeanPrice = market.StartPrice
+	}
+
+	if market.Volume == 0 {
+		market.Volume = defaultVolume
+	}
+
+	return market
+}
+
+// Validate checks the generator can generate market, its defaults filled in.
+func Validate(market entity.SyntheticMarket) error {
+	switch market.Model {
+	case entity.SyntheticModelGbm:
+	case entity.SyntheticModelOu:
+		if market.MeanReversion <= 0 || market.MeanPrice <= 0 {
+			return errors.New("an ou market needs a positive mean reversion and mean price")
+		}
+	case entity.SyntheticModelJumpDiffusion:
+		if market.JumpsPerDay < 0 || market.JumpVolatility < 0 {
+			return errors.New("the jumps per day and jump volatility can not be negative")
+		}
+	case entity.SyntheticModelRegimeSwitching:
+		if len(market.Regimes) == 0 {
+			return errors.New("a regime switching market needs at least one regime")
+		}
+
+		for _, regime := range market.Regimes {
+			if regime.Volatility < 0 {
+				return errors.New("the volatility of a regime can not be negative")
+			}
+		}
+
+		if market.SwitchesPerDay < 0 {
+			return errors.New("the switches per day can not be negative")
+		}
+	default:
+		return fmt.Errorf("the synthetic model '%s' is not supported", market.Model)
+	}
+
+	if strings.Contains(market.Exchange, ":") {
+		return fmt.Errorf("the exchange '%s' can not contain ':'", market.Exchange)
+	}
+
+	if len(market.Pairs) == 0 {
+		return errors.New("a synthetic market needs at least one pair")
+	}
+
+	seen := map[string]bool{}
+	for _, pair := range market.Pairs {
+		if pair == "" || strings.Contains(pair, ":") || seen[pair] {
+			return fmt.Errorf("the pair '%s' is empty, contains ':' or is repeated", pair)
+		}
+
+		seen[pair] = true
+	}
+
+	if market.StartPrice <= 0 {
+		return errors.New("the start price must be positive")
+	}
+
+	if market.PriceDecimals < 0 || market.PriceDecimals > maxPriceDecimals {
+		return fmt.Errorf("the price decimals must be between 0 and %d", maxPriceDecimals)
+	}
+
+	if market.Volatility < 0 || market.Volume < 0 {
+		return errors.New("the volatility and volume can not be negative")
+	}
+
+	if len(market.VolumeProfile) != 0 && len(market.VolumeProfile) != 24 {
+		return errors.New("the volume profile needs a factor for each of the 24 hours")
+	}
+
+	for _, factor := range market.VolumeProfile {
+		if factor < 0 {
+			return errors.New("the volume profile factors can not be negative")
+		}
+	}
+
+	return nil
+}
+
+// Symbols are the exchange:pair symbols of market, ordered.
+func Symbols(market entity.SyntheticMarket) []string {
+	market = WithDefaults(market)
+
+	symbols := make([]string, 0, len(market.Pairs))
+	for _, pair := range market.Pairs {
+		symbols = append(symbols, fmt.Sprintf("%s:%s", market.Exchange, pair))
+	}
+	sort.Strings(symbols)
+
+	return symbols
+}
+
+// Epoch is the open of the next bar.
+func (g *Generator) Epoch() int64 {
+	return g.epoch
+}
+
+// Next generates the bars of the next minute, one per pair ordered by pair.
+func (g *Generator) Next() []entity.Candle {
+	regimes := g.market.Regimes
+	if g.market.Model == entity.SyntheticModelRegimeSwitching && len(regimes) > 1 && g.rng.Float64() < g.market.SwitchesPerDay/minutesPerDay {
+		g.regime = (g.regime + 1 + g.rng.IntN(len(regimes)-1)) % len(regimes)
+	}
+
+	drift, volatility := g.market.Drift, g.market.Volatility
+	if g.market.Model == entity.SyntheticModelRegimeSwitching {
+		drift, volatility = regimes[g.regime].Drift, regimes[g.regime].Volatility
+	}
+
+	dt := 1.0 / minutesPerYear / substeps
+	hour := time.Unix(g.epoch, 0).UTC().Hour()
+
+	candles := make([]entity.Candle, 0, len(g.pairs))
+	for _, p := range g.pairs {
+		open := p.logPrice
+		high, low := open, open
+
+		for i := 0; i < substeps; i++ {
+			p.logPrice = g.step(p, dt, drift, volatility)
+
+			high = max(high, p.logPrice)
+			low = min(low, p.logPrice)
+		}
+
+		candles = append(candles, g.candle(p, hour, open, high, low, volatility))
+	}
+
+	g.epoch += 60
+
+	return candles
+}
+
+// step walks the log price of p over dt years.
+func (g *Generator) step(p *pairState, dt, drift, volatility float64) float64 {
+	y := p.logPrice
+	z := p.rng.NormFloat64()
+
+	switch g.market.Model {
+	case entity.SyntheticModelOu:
+		mean := math.Log(g.market.MeanPrice)
+		decay := math.Exp(-g.market.MeanReversion * dt)
+
+		return mean + (y-mean)*decay + volatility*math.Sqrt((1-decay*decay)/(2*g.market.MeanReversion))*z
+	case entity.SyntheticModelJumpDiffusion:
+		y += (drift-volatility*volatility/2)*dt + volatility*math.Sqrt(dt)*z
+
+		if p.rng.Float64() < g.market.JumpsPerDay*dt*365 {
+			y += g.market.JumpMean + g.market.JumpVolatility*p.rng.NormFloat64()
+		}
+
+		return y
+	default:
+		return y + (drift-volatility*volatility/2)*dt + volatility*math.Sqrt(dt)*z
+	}
+}
+
+func (g *Generator) candle(p *pairState, hour int, open, high, low, volatility float64) entity.Candle {
+	price := func(logPrice float64) decimal.Decimal {
+		return decimal.NewFromFloat(math.Exp(logPrice)).Round(g.market.PriceDecimals)
+	}
+
+	profile := 1.0
+	if len(g.market.VolumeProfile) == 24 {
+		profile = g.market.VolumeProfile[hour]
+	}
+
+	// lognormal around the mean, the side the bar moved to did more of the trading
+	total := g.market.Volume * profile * math.Exp(0.5*p.rng.NormFloat64()-0.125)
+
+	share := 0.5
+	if barVolatility := volatility * math.Sqrt(1.0/minutesPerYear); barVolatility > 0 {
+		share += 0.25 * math.Tanh((p.logPrice-open)/barVolatility)
+	}
+
+	totalVolume := decimal.NewFromFloat(total).Round(3)
+	buyVolume := decimal.NewFromFloat(total * share).Round(3)
+	if buyVolume.GreaterThan(totalVolume) {
+		buyVolume = totalVolume
+	}
+
+	return entity.Candle{
+		Epoch:    g.epoch,
+		Exchange: g.market.Exchange,
+		Pair:     p.pair,
+		Open:     price(open),
+		High:     price(high),
+		Low:      price(low),
+		Close:    price(p.logPrice),
+		Volume: entity.CandleVolume{
+			Total: totalVolume,
+			Buy:   buyVolume,
+			Sell:  totalVolume.Sub(buyVolume),
+		},
+	}
+}
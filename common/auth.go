@@ -0,0 +1,21 @@
+package common
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+)
+
+// AuthUserFromContext returns the user the auth middleware put into ctx.
+func AuthUserFromContext(ctx context.Context) (entity.AuthUser, bool) {
+	userId, ok := ctx.Value(entity.UserIdKey).(string)
+	if !ok || userId == "" {
+		return entity.AuthUser{}, false
+	}
+
+	role, _ := ctx.Value(entity.RoleKey).(entity.Role)
+
+	return entity.AuthUser{
+		UserId: userId,
+		Role:   role,
+	}, true
+}
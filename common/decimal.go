@@ -0,0 +1,42 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// DecimalPlaces returns the most decimal places any of ds carries, trailing zeros included,
+// so "0.01000000" counts 8 places.
+func DecimalPlaces(ds ...decimal.Decimal) int32 {
+	places := int32(0)
+
+	for _, d := range ds {
+		if -d.Exponent() > places {
+			places = -d.Exponent()
+		}
+	}
+
+	return places
+}
+
+// ToScaled returns d as an integer of scale decimal places. It fails rather than round
+// when d has more places than scale or the integer does not fit an int64.
+func ToScaled(d decimal.Decimal, scale int32) (int64, error) {
+	shifted := d.Shift(scale)
+	if !shifted.IsInteger() {
+		return 0, fmt.Errorf("%s has more than %d decimal places", d.String(), scale)
+	}
+
+	scaled := shifted.BigInt()
+	if !scaled.IsInt64() {
+		return 0, fmt.Errorf("%s does not fit in %d decimal places", d.String(), scale)
+	}
+
+	return scaled.Int64(), nil
+}
+
+// FromScaled is the inverse of ToScaled, the result carries exactly scale places.
+func FromScaled(v int64, scale int32) decimal.Decimal {
+	return decimal.New(v, -scale)
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestScaledRoundTrip(t *testing.T) {
+	// kline fields as binance sends them, trailing zeros included
+	rows := [][]string{
+		{"43000.10", "43012.50", "42990.00", "43005.70"},
+		{"0.0000012340", "0.0000012350", "0.0000012290", "0.0000012300"},
+		{"0.01000000", "0.01010000", "0.00990000", "0.01000000"},
+		{"98765432.1", "98765432.9", "98765431.0", "98765432.5"},
+		{"12345678901234", "0", "1.000", "123.456"},
+	}
+
+	for _, row := range rows {
+		ds := make([]decimal.Decimal, len(row))
+		for i, s := range row {
+			ds[i] = decimal.RequireFromString(s)
+		}
+
+		scale := DecimalPlaces(ds...)
+
+		for i, d := range ds {
+			v, err := ToScaled(d, scale)
+			if err != nil {
+				t.Fatalf("ToScaled(%s, %d) error: %v", row[i], scale, err)
+			}
+
+			got := FromScaled(v, scale)
+			if !got.Equal(d) {
+				t.Errorf("FromScaled(%d, %d) = %s, want %s", v, scale, got, d)
+			}
+		}
+	}
+}
+
+func TestScaledKeepsBinanceStrings(t *testing.T) {
+	// a row shares one scale, binance prints every price of a symbol with the same places
+	row := []string{"0.01000000", "0.01010000", "0.00990000", "0.01000000"}
+
+	ds := make([]decimal.Decimal, len(row))
+	for i, s := range row {
+		ds[i] = decimal.RequireFromString(s)
+	}
+
+	scale := DecimalPlaces(ds...)
+
+	for i, d := range ds {
+		v, err := ToScaled(d, scale)
+		if err != nil {
+			t.Fatalf("ToScaled(%s) error: %v", row[i], err)
+		}
+
+		got := FromScaled(v, scale)
+		if s := got.StringFixed(-got.Exponent()); s != row[i] {
+			t.Errorf("round trip of %s gave %s", row[i], s)
+		}
+	}
+}
+
+func TestToScaledRefusesToRound(t *testing.T) {
+	_, err := ToScaled(decimal.RequireFromString("1.005"), 2)
+	if err == nil {
+		t.Error("ToScaled(1.005, 2) rounded instead of failing")
+	}
+
+	_, err = ToScaled(decimal.RequireFromString("99999999999.123456789"), 9)
+	if err == nil {
+		t.Error("ToScaled overflowed int64 instead of failing")
+	}
+}
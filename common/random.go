@@ -1,14 +1,31 @@
 package common
 
-import "math/rand/v2"
+import "crypto/rand"
 
+// CreateRandomString draws targetLen characters from crypto/rand. Bytes past the
+// last full multiple of the pool size are rejected so every character is equally likely.
 func CreateRandomString(targetLen int) string {
 	pool := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	lenPool := len(pool)
+	maxByte := 256 - 256%lenPool
 	b := make([]byte, targetLen)
 
-	for i := range b {
-		b[i] = pool[rand.IntN(lenPool)]
+	buf := make([]byte, targetLen)
+	for i := 0; i < targetLen; {
+		rand.Read(buf)
+
+		for _, v := range buf {
+			if int(v) >= maxByte {
+				continue
+			}
+
+			b[i] = pool[int(v)%lenPool]
+			i++
+
+			if i == targetLen {
+				break
+			}
+		}
 	}
 
 	return string(b)
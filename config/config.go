@@ -8,21 +8,43 @@ import (
 
 	hConfig "github.com/michaelyusak/go-helper/config"
 	hEntity "github.com/michaelyusak/go-helper/entity"
+	hHelper "github.com/michaelyusak/go-helper/helper"
 )
 
 type StreamReplayConfig struct {
+	// Default seeds the default preset when the database has none yet.
 	Default entity.ReplayConfiguration `json:"default"`
 }
 
 type ReplayConfig struct {
-	Stream StreamReplayConfig `json:"stream"`
+	Stream   StreamReplayConfig          `json:"stream"`
+	Pipeline entity.ReplayPipelineConfig `json:"pipeline"`
+}
+
+type StorageConfig struct {
+	// Backend is questdb, sqlite or memory, questdb when empty. sqlite keeps everything
+	// in one local file and needs no database server, memory keeps nothing across restarts.
+	Backend string `json:"backend"`
+	// Path is the sqlite database file, created when missing.
+	Path string `json:"path"`
+}
+
+type MigrationConfig struct {
+	// Dialect is questdb or postgres, questdb when empty. The sqlite backend always
+	// migrates with the sqlite dialect.
+	Dialect string `json:"dialect"`
+	// AutoMigrate applies pending migrations when the server starts.
+	AutoMigrate bool `json:"auto_migrate"`
 }
 
 type ServiceConfig struct {
-	Port           string           `json:"port"`
-	GracefulPeriod hEntity.Duration `json:"graceful_period"`
-	Db             hEntity.DBConfig `json:"db"`
-	Replay         ReplayConfig     `json:"replay"`
+	Port           string               `json:"port"`
+	GracefulPeriod hEntity.Duration     `json:"graceful_period"`
+	Storage        StorageConfig        `json:"storage"`
+	Db             hEntity.DBConfig     `json:"db"`
+	Migration      MigrationConfig      `json:"migration"`
+	Replay         ReplayConfig         `json:"replay"`
+	Quality        entity.QualityConfig `json:"quality"`
 }
 
 type CorsConfig struct {
@@ -30,11 +52,24 @@ type CorsConfig struct {
 }
 
 type BinanceHttpConfig struct {
-	FapiBaseUrl string `json:"fapi_base_url"`
+	FapiBaseUrl        string `json:"fapi_base_url"`
+	FuturesDataBaseUrl string `json:"futures_data_base_url"`
+}
+
+type BinanceWsConfig struct {
+	FstreamBaseUrl string `json:"fstream_base_url"`
 }
 
 type AdapterConfig struct {
 	BinanceHttp BinanceHttpConfig `json:"binance_http"`
+	BinanceWs   BinanceWsConfig   `json:"binance_ws"`
+}
+
+type AuthConfig struct {
+	Jwt           hHelper.JwtConfig `json:"jwt"`
+	TokenDuration hEntity.Duration  `json:"token_duration"`
+	ApiKeys       []entity.ApiKey   `json:"api_keys"`
+	DefaultQuota  entity.Quota      `json:"default_quota"`
 }
 
 type AppConfig struct {
@@ -42,6 +77,7 @@ type AppConfig struct {
 	Log     hEntity.LogConfig `json:"log"`
 	Cors    CorsConfig        `json:"cors"`
 	Adapter AdapterConfig     `json:"adapter"`
+	Auth    AuthConfig        `json:"auth"`
 }
 
 func Init() (AppConfig, error) {
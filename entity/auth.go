@@ -0,0 +1,53 @@
+package entity
+
+import "github.com/michaelyusak/go-helper/appconstant"
+
+const (
+	UserIdKey appconstant.ContextKey = "user_id"
+	RoleKey   appconstant.ContextKey = "role"
+)
+
+type Role string
+
+const (
+	RoleReader   Role = "reader"
+	RoleReplayer Role = "replayer"
+	RoleWriter   Role = "writer"
+	RoleAdmin    Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleReader:   1,
+	RoleReplayer: 2,
+	RoleWriter:   3,
+	RoleAdmin:    4,
+}
+
+func (r Role) IsValid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Includes tells whether r grants everything the other role does, roles are ordered
+// reader < replayer < writer < admin.
+func (r Role) Includes(other Role) bool {
+	return roleRanks[r] >= roleRanks[other]
+}
+
+type AuthUser struct {
+	UserId string `json:"user_id"`
+	Role   Role   `json:"role"`
+}
+
+type IssueTokenRes struct {
+	Token              string `json:"token"`
+	ExpiredAtUnixMilli int64  `json:"expired_at_unix_milli"`
+}
+
+type ApiKey struct {
+	Key    string `json:"key"`
+	UserId string `json:"user_id"`
+	Role   Role   `json:"role"`
+	// Quota overrides the default quota for this user.
+	Quota *Quota `json:"quota,omitempty"`
+}
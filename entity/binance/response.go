@@ -1,6 +1,44 @@
 package binance
 
+import "encoding/json"
+
 type FapiGeneralErrorResponse struct {
 	Code int    `json:"code"`
 	Msg  string `json:"msg"`
 }
+
+type FapiFundingRateResponse struct {
+	Symbol      string      `json:"symbol"`
+	FundingRate string      `json:"fundingRate"`
+	FundingTime json.Number `json:"fundingTime"`
+	MarkPrice   string      `json:"markPrice"`
+}
+
+type FuturesDataOpenInterestHistResponse struct {
+	Symbol               string      `json:"symbol"`
+	SumOpenInterest      string      `json:"sumOpenInterest"`
+	SumOpenInterestValue string      `json:"sumOpenInterestValue"`
+	Timestamp            json.Number `json:"timestamp"`
+}
+
+type FapiExchangeInfoResponse struct {
+	Symbols []FapiExchangeInfoSymbol `json:"symbols"`
+}
+
+type FapiExchangeInfoSymbol struct {
+	Symbol       string                   `json:"symbol"`
+	Pair         string                   `json:"pair"`
+	ContractType string                   `json:"contractType"`
+	DeliveryDate int64                    `json:"deliveryDate"`
+	OnboardDate  int64                    `json:"onboardDate"`
+	Status       string                   `json:"status"`
+	BaseAsset    string                   `json:"baseAsset"`
+	QuoteAsset   string                   `json:"quoteAsset"`
+	Filters      []FapiExchangeInfoFilter `json:"filters"`
+}
+
+type FapiExchangeInfoFilter struct {
+	FilterType string `json:"filterType"`
+	TickSize   string `json:"tickSize"`
+	StepSize   string `json:"stepSize"`
+}
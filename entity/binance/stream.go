@@ -0,0 +1,29 @@
+package binance
+
+import "encoding/json"
+
+type FstreamCombinedEvent struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type FstreamKlineEvent struct {
+	EventType string       `json:"e"`
+	EventTime int64        `json:"E"`
+	Symbol    string       `json:"s"`
+	Kline     FstreamKline `json:"k"`
+}
+
+type FstreamKline struct {
+	StartTime      int64  `json:"t"`
+	CloseTime      int64  `json:"T"`
+	Symbol         string `json:"s"`
+	Interval       string `json:"i"`
+	Open           string `json:"o"`
+	Close          string `json:"c"`
+	High           string `json:"h"`
+	Low            string `json:"l"`
+	Volume         string `json:"v"`
+	IsClosed       bool   `json:"x"`
+	TakerBuyVolume string `json:"V"`
+}
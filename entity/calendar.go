@@ -0,0 +1,27 @@
+package entity
+
+// Calendar limits a replay to the bars opening within its allowed time. The time it
+// excludes is skipped over, the replay goes on from the next allowed bar right away.
+type Calendar struct {
+	// Timezone is the IANA zone the weekdays and sessions are read in, it defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Weekdays are the allowed days as sun, mon, tue, wed, thu, fri or sat, all days when empty.
+	Weekdays []string `json:"weekdays,omitempty"`
+	// Sessions are the allowed hours of an allowed day, the whole day when empty.
+	Sessions []CalendarSession `json:"sessions,omitempty"`
+	// Exclusions are cut out whatever the days and sessions allow.
+	Exclusions []TimeRange `json:"exclusions,omitempty"`
+}
+
+// CalendarSession runs from Start to End as HH:MM clock times, End excluded. A session
+// ending at or before its start runs past midnight and belongs to the day it starts on.
+type CalendarSession struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// TimeRange runs from its start up to its end, the end excluded.
+type TimeRange struct {
+	StartTimeUnixMilli int64 `json:"start_time_unix_milli"`
+	EndTimeUnixMilli   int64 `json:"end_time_unix_milli"`
+}
@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"time"
+
 	"github.com/shopspring/decimal"
 )
 
@@ -14,9 +16,24 @@ type Candle struct {
 	Low      decimal.Decimal `json:"low"`
 	Close    decimal.Decimal `json:"close"`
 	Volume   CandleVolume    `json:"volume"`
+	// Dirty marks a bar that was flagged or repaired on ingest.
+	Dirty bool `json:"dirty,omitempty"`
+}
+
+// CandleKey is the position of a candle in the (epoch, exchange, pair) order candles are
+// paged in, the page after a key starts right past that candle.
+type CandleKey struct {
+	Epoch    int64
+	Exchange string
+	Pair     string
+}
 
-	//internal
-	Dirty bool `json:"-"`
+func (c Candle) Key() CandleKey {
+	return CandleKey{
+		Epoch:    c.Epoch,
+		Exchange: c.Exchange,
+		Pair:     c.Pair,
+	}
 }
 
 type CandleVolume struct {
@@ -25,8 +42,57 @@ type CandleVolume struct {
 	Sell  decimal.Decimal `json:"sell"`
 }
 
+type Tick struct {
+	EpochMilli int64           `json:"epoch_milli"`
+	BarEpoch   int64           `json:"bar_epoch"`
+	Pair       string          `json:"pair"`
+	Exchange   string          `json:"exchange"`
+	Symbol     string          `json:"symbol"`
+	Price      decimal.Decimal `json:"price"`
+}
+
 type CandleInterval string
 
 const (
-	CandleInterval1m = "1m"
+	CandleInterval1m  = "1m"
+	CandleInterval5m  = "5m"
+	CandleInterval15m = "15m"
+	CandleInterval1h  = "1h"
+	CandleInterval4h  = "4h"
+	CandleInterval1d  = "1d"
 )
+
+// RollupIntervals are kept as materialised aggregates of the 1m candles.
+var RollupIntervals = []CandleInterval{
+	CandleInterval5m,
+	CandleInterval15m,
+	CandleInterval1h,
+	CandleInterval4h,
+	CandleInterval1d,
+}
+
+var candleIntervalDurations = map[CandleInterval]time.Duration{
+	CandleInterval1m:  time.Minute,
+	CandleInterval5m:  5 * time.Minute,
+	CandleInterval15m: 15 * time.Minute,
+	CandleInterval1h:  time.Hour,
+	CandleInterval4h:  4 * time.Hour,
+	CandleInterval1d:  24 * time.Hour,
+}
+
+// Duration is zero for an interval no candles are kept of.
+func (i CandleInterval) Duration() time.Duration {
+	return candleIntervalDurations[i]
+}
+
+// CandleIntervalOf returns the interval of the given candle size, false when no candles
+// of that size are kept.
+func CandleIntervalOf(size time.Duration) (CandleInterval, bool) {
+	for interval, d := range candleIntervalDurations {
+		if d == size {
+			return interval, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+type FundingRate struct {
+	Epoch       int64           `json:"epoch"`
+	Pair        string          `json:"pair"`
+	Exchange    string          `json:"exchange"`
+	Symbol      string          `json:"symbol"`
+	FundingRate decimal.Decimal `json:"funding_rate"`
+	MarkPrice   decimal.Decimal `json:"mark_price"`
+}
+
+type OpenInterest struct {
+	Epoch             int64           `json:"epoch"`
+	Pair              string          `json:"pair"`
+	Exchange          string          `json:"exchange"`
+	Symbol            string          `json:"symbol"`
+	OpenInterest      decimal.Decimal `json:"open_interest"`
+	OpenInterestValue decimal.Decimal `json:"open_interest_value"`
+}
+
+type PriceType string
+
+const (
+	PriceTypeMark  PriceType = "mark"
+	PriceTypeIndex PriceType = "index"
+)
+
+type PriceCandle struct {
+	Epoch     int64           `json:"epoch"`
+	Pair      string          `json:"pair"`
+	Exchange  string          `json:"exchange"`
+	Symbol    string          `json:"symbol"`
+	PriceType PriceType       `json:"price_type"`
+	Open      decimal.Decimal `json:"open"`
+	High      decimal.Decimal `json:"high"`
+	Low       decimal.Decimal `json:"low"`
+	Close     decimal.Decimal `json:"close"`
+}
+
+type MarketSeries string
+
+const (
+	MarketSeriesFundingRate  MarketSeries = "funding_rate"
+	MarketSeriesOpenInterest MarketSeries = "open_interest"
+	MarketSeriesMarkPrice    MarketSeries = "mark_price"
+	MarketSeriesIndexPrice   MarketSeries = "index_price"
+)
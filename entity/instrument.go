@@ -0,0 +1,41 @@
+package entity
+
+import "github.com/shopspring/decimal"
+
+// ContinuousInstrumentPrefix marks a symbol as a continuous instrument, cont:NAME.
+const ContinuousInstrumentPrefix = "cont:"
+
+type BackAdjustment string
+
+const (
+	BackAdjustmentNone BackAdjustment = "none"
+	// BackAdjustmentRatio scales the earlier legs by the price ratio at each roll.
+	BackAdjustmentRatio BackAdjustment = "ratio"
+	// BackAdjustmentDifference shifts the earlier legs by the price gap at each roll.
+	BackAdjustmentDifference BackAdjustment = "difference"
+)
+
+// ContinuousInstrument stitches stored exchange:pair series into one logical instrument.
+type ContinuousInstrument struct {
+	Name           string          `json:"name"`
+	Legs           []InstrumentLeg `json:"legs"`
+	BackAdjustment BackAdjustment  `json:"back_adjustment,omitempty"`
+}
+
+// InstrumentLeg is played from the roll of the leg before it until RollAtUnixMilli,
+// the last leg has no roll and plays until the end.
+type InstrumentLeg struct {
+	Symbol          string `json:"symbol"`
+	RollAtUnixMilli int64  `json:"roll_at_unix_milli,omitempty"`
+	// Scale multiplies the prices and divides the volumes of the leg, 1000 stitches a pair
+	// to its 1000-prefixed rename. Zero is taken as 1.
+	Scale decimal.Decimal `json:"scale"`
+}
+
+type RollData struct {
+	Epoch      int64           `json:"epoch"`
+	Instrument string          `json:"instrument"`
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Adjustment decimal.Decimal `json:"adjustment"`
+}
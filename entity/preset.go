@@ -0,0 +1,9 @@
+package entity
+
+const ReplayPresetDefault = "default"
+
+type ReplayPreset struct {
+	Name               string              `json:"name"`
+	Config             ReplayConfiguration `json:"config"`
+	UpdatedAtUnixMilli int64               `json:"updated_at_unix_milli"`
+}
@@ -0,0 +1,66 @@
+package entity
+
+import "github.com/shopspring/decimal"
+
+type AnomalyRule string
+
+const (
+	AnomalyRuleNonPositivePrice AnomalyRule = "non_positive_price"
+	// AnomalyRuleHighBelowBody is a high under max(open, close).
+	AnomalyRuleHighBelowBody AnomalyRule = "high_below_body"
+	// AnomalyRuleLowAboveBody is a low over min(open, close).
+	AnomalyRuleLowAboveBody   AnomalyRule = "low_above_body"
+	AnomalyRuleNegativeVolume AnomalyRule = "negative_volume"
+	AnomalyRuleBuyAboveTotal  AnomalyRule = "buy_above_total"
+	AnomalyRuleZeroVolume     AnomalyRule = "zero_volume"
+	// AnomalyRuleExtremeWick is a high to low range over ExtremeWickRatio of the close.
+	AnomalyRuleExtremeWick AnomalyRule = "extreme_wick"
+)
+
+type AnomalyPolicy string
+
+const (
+	// AnomalyPolicyReject drops the row.
+	AnomalyPolicyReject AnomalyPolicy = "reject"
+	// AnomalyPolicyFlag stores the row as is, marked dirty.
+	AnomalyPolicyFlag AnomalyPolicy = "flag"
+	// AnomalyPolicyRepair stores the row fixed up and marked dirty, rules that can not be repaired are flagged.
+	AnomalyPolicyRepair AnomalyPolicy = "repair"
+	AnomalyPolicyIgnore AnomalyPolicy = "ignore"
+)
+
+type AnomalySource string
+
+const (
+	AnomalySourceImport     AnomalySource = "import"
+	AnomalySourceLive       AnomalySource = "live"
+	AnomalySourceMarkPrice  AnomalySource = "mark_price"
+	AnomalySourceIndexPrice AnomalySource = "index_price"
+	AnomalySourceSynthetic  AnomalySource = "synthetic"
+)
+
+type QualityConfig struct {
+	// Rules overrides the policy of single rules, the others keep their default.
+	Rules map[AnomalyRule]AnomalyPolicy `json:"rules"`
+	// ExtremeWickRatio defaults to 0.2, a 20% range within one bar.
+	ExtremeWickRatio decimal.Decimal `json:"extreme_wick_ratio"`
+}
+
+type Anomaly struct {
+	Epoch               int64         `json:"epoch"`
+	Exchange            string        `json:"exchange"`
+	Pair                string        `json:"pair"`
+	Symbol              string        `json:"symbol"`
+	Source              AnomalySource `json:"source"`
+	Rule                AnomalyRule   `json:"rule"`
+	Policy              AnomalyPolicy `json:"policy"`
+	Detail              string        `json:"detail"`
+	DetectedAtUnixMilli int64         `json:"detected_at_unix_milli"`
+}
+
+type GetAnomaliesReq struct {
+	Symbol             string `form:"symbol"`
+	StartTimeUnixMilli int64  `form:"start_time_unix_milli"`
+	EndTimeUnixMilli   int64  `form:"end_time_unix_milli"`
+	Limit              int    `form:"limit"`
+}
@@ -0,0 +1,22 @@
+package entity
+
+import hEntity "github.com/michaelyusak/go-helper/entity"
+
+// Quota limits what a single user can consume, a zero value leaves that resource unlimited.
+type Quota struct {
+	MaxConcurrentStreams int              `json:"max_concurrent_streams"`
+	MaxReplayWindow      hEntity.Duration `json:"max_replay_window"`
+	MaxSymbolsPerStream  int              `json:"max_symbols_per_stream"`
+	MaxConcurrentImports int              `json:"max_concurrent_imports"`
+	RequestsPerSecond    float64          `json:"requests_per_second"`
+	RequestBurst         int              `json:"request_burst"`
+}
+
+type Usage struct {
+	UserId            string `json:"user_id"`
+	ConcurrentStreams int    `json:"concurrent_streams"`
+	ConcurrentImports int    `json:"concurrent_imports"`
+	// RequestTokens is what is left of the request burst, -1 when requests are unlimited.
+	RequestTokens float64 `json:"request_tokens"`
+	Quota         Quota   `json:"quota"`
+}
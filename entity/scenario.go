@@ -0,0 +1,43 @@
+package entity
+
+import hEntity "github.com/michaelyusak/go-helper/entity"
+
+type ScenarioMode string
+
+const (
+	// ScenarioModeRandomStart replays Length of the history from a random start within the range.
+	ScenarioModeRandomStart ScenarioMode = "random_start"
+	// ScenarioModeBlockBootstrap draws blocks of days from the range and chains their daily
+	// returns into a synthetic price path, the bars within a day keep their shape.
+	ScenarioModeBlockBootstrap ScenarioMode = "block_bootstrap"
+	// ScenarioModeJitter replays the history with noise put on every price.
+	ScenarioModeJitter ScenarioMode = "jitter"
+)
+
+// Scenario generates what a replay plays from the stored candles rather than replaying
+// them as they are. The same seed and parameters generate the same scenario, the
+// response of a stream creation holds both to repeat a run with.
+type Scenario struct {
+	Mode ScenarioMode `json:"mode"`
+	// Seed drives every draw, a random one is taken when it is zero.
+	Seed uint64 `json:"seed"`
+	// The range is the history the scenario draws from, it defaults to the window of the preset.
+	RangeStartTimeUnixMilli int64 `json:"range_start_time_unix_milli"`
+	RangeEndTimeUnixMilli   int64 `json:"range_end_time_unix_milli"`
+	// Length is how much of the history a random start replays.
+	Length hEntity.Duration `json:"length,omitempty"`
+	// BlockDays is the length of the blocks a bootstrap draws, it defaults to 5 days.
+	BlockDays int `json:"block_days,omitempty"`
+	// Days is the length of the bootstrapped path, it defaults to the days of the range.
+	Days int `json:"days,omitempty"`
+	// Jitter is the standard deviation of the relative noise put on every price, it applies
+	// on top of the other modes as well.
+	Jitter float64 `json:"jitter,omitempty"`
+
+	// StartTimeUnixMilli and EndTimeUnixMilli are the window the scenario plays, they are
+	// only set on a response.
+	StartTimeUnixMilli int64 `json:"start_time_unix_milli,omitempty"`
+	EndTimeUnixMilli   int64 `json:"end_time_unix_milli,omitempty"`
+	// Blocks are the first days of the drawn blocks in order, only set on a response.
+	Blocks []int64 `json:"blocks,omitempty"`
+}
@@ -7,33 +7,244 @@ import (
 )
 
 type ReplayConfiguration struct {
-	Symbols            []string `json:"symbols" form:"symbols"`
-	PlaybackSpeed      float32  `json:"playback_speed"`
-	StartTimeUnixMilli int64    `json:"start_time_unix_milli" form:"start_time_unix_milli"`
-	EndTimeUnixMilli   int64    `json:"end_time_unix_milli" form:"end_time_unix_milli"`
+	Symbols            []string       `json:"symbols" form:"symbols"`
+	PlaybackSpeed      float32        `json:"playback_speed"`
+	StartTimeUnixMilli int64          `json:"start_time_unix_milli" form:"start_time_unix_milli"`
+	EndTimeUnixMilli   int64          `json:"end_time_unix_milli" form:"end_time_unix_milli"`
+	Series             []MarketSeries `json:"series,omitempty"`
+	TickSynthesis      *TickSynthesis `json:"tick_synthesis,omitempty"`
+	// Universe replaces Symbols with a membership evaluated while the replay plays.
+	Universe *Universe `json:"universe,omitempty"`
+	// Instruments defines the continuous instruments Symbols can refer to as cont:NAME.
+	Instruments []ContinuousInstrument `json:"instruments,omitempty"`
+	// Calendar limits the replay to trading sessions, weekdays and the time it does not exclude.
+	Calendar *Calendar `json:"calendar,omitempty"`
+	// Windows replace the start and end time with windows played back to back, in order.
+	Windows []ReplayWindow `json:"windows,omitempty"`
 }
 
+// ReplayWindow is one segment of a replay, its end included like the end of a replay.
+type ReplayWindow struct {
+	Name               string `json:"name,omitempty"`
+	StartTimeUnixMilli int64  `json:"start_time_unix_milli"`
+	EndTimeUnixMilli   int64  `json:"end_time_unix_milli"`
+}
+
+type TickSynthesisMode string
+
+const (
+	// TickSynthesisModeOhlc walks O-H-L-C on bearish bars and O-L-H-C otherwise.
+	TickSynthesisModeOhlc TickSynthesisMode = "ohlc"
+	// TickSynthesisModeBrownianBridge bridges O, H, L and C with seeded brownian noise.
+	TickSynthesisModeBrownianBridge TickSynthesisMode = "brownian_bridge"
+)
+
+type TickSynthesis struct {
+	Mode         TickSynthesisMode `json:"mode"`
+	PointsPerBar int               `json:"points_per_bar"`
+	// Seed drives the brownian noise, a random one is taken when it is zero.
+	Seed uint64 `json:"seed"`
+}
+
+type StreamType string
+
+const (
+	StreamTypeReplay StreamType = "replay"
+	// StreamTypeLive passes the exchange klines through as they happen.
+	StreamTypeLive StreamType = "live"
+)
+
 type CreateStreamReq struct {
 	CandleSize hEntity.Duration `json:"candle_size"`
+	// Preset names the replay preset to stream, it defaults to the default preset.
+	Preset string `json:"preset"`
+	// Type defaults to replay.
+	Type StreamType `json:"type"`
+	// Shared streams run once and fan out to every client starting the channel.
+	Shared bool `json:"shared"`
+	// LiveUpdates also sends the in-progress bars of a live stream as candle_update.
+	LiveUpdates bool `json:"live_updates"`
+	// Persist stores the closed bars of a live stream into the replay database.
+	Persist bool `json:"persist"`
+	// TokenTtl is how long the token can start the stream, it defaults to the server setting.
+	TokenTtl hEntity.Duration `json:"token_ttl"`
+	// OneTimeToken is consumed by the first successful start. It admits a single client,
+	// so it can not be combined with Shared.
+	OneTimeToken bool `json:"one_time_token"`
+	// Scenario generates the replay from the stored candles instead of replaying them as they are.
+	Scenario *Scenario `json:"scenario,omitempty"`
+	// Synthetic plays a generated market in place of the preset symbols, the bars are
+	// generated as the stream plays and no candles are read.
+	Synthetic *SyntheticMarket `json:"synthetic,omitempty"`
 }
 
 type CreateStreamRes struct {
-	Channel string `json:"channel"`
-	Token   string `json:"token,omitempty"`
+	Channel                 string `json:"channel"`
+	Token                   string `json:"token,omitempty"`
+	TokenExpiresAtUnixMilli int64  `json:"token_expires_at_unix_milli,omitempty"`
+	// TickSynthesis is the tick synthesis of the stream with its seed filled in.
+	TickSynthesis *TickSynthesis `json:"tick_synthesis,omitempty"`
+	// Scenario is the scenario of the request with its seed and what it drew filled in.
+	Scenario *Scenario `json:"scenario,omitempty"`
+	// Synthetic is the market of the request with its seed and defaults filled in.
+	Synthetic *SyntheticMarket `json:"synthetic,omitempty"`
 }
 
 type WsMessage struct {
 	Type string          `json:"type"`
-	Data json.RawMessage `json:"data"`
+	Seq  int64           `json:"seq,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
 }
 
 type WsMessageType string
 
 const (
 	WsMessageTypeAuth WsMessageType = "auth"
+
+	WsMessageTypeStart        WsMessageType = "start"
+	WsMessageTypeCandle       WsMessageType = "candle"
+	WsMessageTypeCandleUpdate WsMessageType = "candle_update"
+	WsMessageTypeBarClose     WsMessageType = "bar_close"
+	WsMessageTypeStatus       WsMessageType = "status"
+	WsMessageTypeError        WsMessageType = "error"
+	WsMessageTypeEnd          WsMessageType = "end"
+	WsMessageTypeHeartbeat    WsMessageType = "heartbeat"
+
+	WsMessageTypeFundingRate  WsMessageType = "funding_rate"
+	WsMessageTypeOpenInterest WsMessageType = "open_interest"
+	WsMessageTypeMarkPrice    WsMessageType = "mark_price"
+	WsMessageTypeIndexPrice   WsMessageType = "index_price"
+	WsMessageTypeTick         WsMessageType = "tick"
+
+	WsMessageTypeUniverseChange WsMessageType = "universe_change"
+	WsMessageTypeRoll           WsMessageType = "roll"
+
+	WsMessageTypeSegmentStart WsMessageType = "segment_start"
+	WsMessageTypeSegmentEnd   WsMessageType = "segment_end"
 )
 
 type WsAuthData struct {
 	Channel string `json:"channel"`
 	Token   string `json:"token"`
+	// CatchUp replays a shared session from its start before going live.
+	CatchUp bool `json:"catch_up"`
+}
+
+type StreamStatus string
+
+const (
+	StreamStatusCreated      StreamStatus = "created"
+	StreamStatusStreaming    StreamStatus = "streaming"
+	StreamStatusPaused       StreamStatus = "paused"
+	StreamStatusReconnecting StreamStatus = "reconnecting"
+	StreamStatusFinished     StreamStatus = "finished"
+)
+
+type StreamStartData struct {
+	Channel            string           `json:"channel"`
+	Type               StreamType       `json:"type"`
+	Interval           CandleInterval   `json:"interval"`
+	Symbols            []string         `json:"symbols"`
+	Series             []MarketSeries   `json:"series,omitempty"`
+	PlaybackSpeed      float32          `json:"playback_speed"`
+	StartTimeUnixMilli int64            `json:"start_time_unix_milli"`
+	EndTimeUnixMilli   int64            `json:"end_time_unix_milli"`
+	TickSynthesis      *TickSynthesis   `json:"tick_synthesis,omitempty"`
+	Universe           *Universe        `json:"universe,omitempty"`
+	Calendar           *Calendar        `json:"calendar,omitempty"`
+	Windows            []ReplayWindow   `json:"windows,omitempty"`
+	Scenario           *Scenario        `json:"scenario,omitempty"`
+	Synthetic          *SyntheticMarket `json:"synthetic,omitempty"`
+}
+
+type StreamStatusData struct {
+	Status StreamStatus `json:"status"`
+}
+
+type StreamErrorData struct {
+	Message string `json:"message"`
+}
+
+type StreamEndReason string
+
+const (
+	StreamEndReasonFinished StreamEndReason = "finished"
+	StreamEndReasonError    StreamEndReason = "error"
+	StreamEndReasonDeleted  StreamEndReason = "deleted"
+	StreamEndReasonExpired  StreamEndReason = "expired"
+)
+
+type StreamEndData struct {
+	Reason       StreamEndReason `json:"reason"`
+	Messages     int64           `json:"messages"`
+	Candles      int64           `json:"candles"`
+	FirstEpoch   int64           `json:"first_epoch,omitempty"`
+	LastEpoch    int64           `json:"last_epoch,omitempty"`
+	ElapsedMilli int64           `json:"elapsed_milli"`
+}
+
+// SegmentData marks where a window of a replay starts and ends, the clients reset in between.
+type SegmentData struct {
+	Index              int    `json:"index"`
+	Name               string `json:"name,omitempty"`
+	StartTimeUnixMilli int64  `json:"start_time_unix_milli"`
+	EndTimeUnixMilli   int64  `json:"end_time_unix_milli"`
+}
+
+type BarCloseData struct {
+	Epoch   int64 `json:"epoch"`
+	Candles int   `json:"candles"`
+}
+
+type HeartbeatData struct {
+	ServerTimeUnixMilli int64 `json:"server_time_unix_milli"`
+}
+
+type StreamInfo struct {
+	Channel            string         `json:"channel"`
+	Preset             string         `json:"preset,omitempty"`
+	Type               StreamType     `json:"type"`
+	Interval           CandleInterval `json:"interval"`
+	Symbols            []string       `json:"symbols"`
+	Series             []MarketSeries `json:"series,omitempty"`
+	Universe           *Universe      `json:"universe,omitempty"`
+	PlaybackSpeed      float32        `json:"playback_speed"`
+	StartTimeUnixMilli int64          `json:"start_time_unix_milli"`
+	EndTimeUnixMilli   int64          `json:"end_time_unix_milli"`
+	Owner              string         `json:"owner"`
+	Shared             bool           `json:"shared"`
+	Status             StreamStatus   `json:"status"`
+	CursorEpoch        int64          `json:"cursor_epoch"`
+	Clients            int            `json:"clients"`
+	BytesSent          int64          `json:"bytes_sent"`
+	MessagesSent       int64          `json:"messages_sent"`
+	CreatedAtUnixMilli int64          `json:"created_at_unix_milli"`
+	ExpiresAtUnixMilli int64          `json:"expires_at_unix_milli"`
+	// Pipeline is the read-ahead of the latest replay run, there is none before the first.
+	Pipeline *ReplayPipelineStats `json:"pipeline,omitempty"`
+}
+
+type ReplayPipelineConfig struct {
+	// ReadAhead is how much simulated time is read past the last sent bar, 6h when empty.
+	// It never goes below two bars of the stream interval.
+	ReadAhead hEntity.Duration `json:"read_ahead"`
+	// MinPageSize and MaxPageSize bound the adaptive page size, 500 and 5000 when empty.
+	MinPageSize int `json:"min_page_size"`
+	MaxPageSize int `json:"max_page_size"`
+	// MaxBufferedMessages caps the messages read and not sent yet, 20000 when empty.
+	MaxBufferedMessages int `json:"max_buffered_messages"`
+}
+
+type ReplayPipelineStats struct {
+	ReadAheadMilli int64 `json:"read_ahead_milli"`
+	// BufferedMilli is the simulated time read and not sent yet.
+	BufferedMilli    int64 `json:"buffered_milli"`
+	BufferedMessages int   `json:"buffered_messages"`
+	BufferCapacity   int   `json:"buffer_capacity"`
+	// PageSize is the limit of the latest read.
+	PageSize      int   `json:"page_size"`
+	Pages         int64 `json:"pages"`
+	AvgFetchMilli int64 `json:"avg_fetch_milli"`
+	// Underruns counts the times the sender had to wait for a read.
+	Underruns int64 `json:"underruns"`
 }
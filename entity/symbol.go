@@ -0,0 +1,19 @@
+package entity
+
+import "github.com/shopspring/decimal"
+
+type SymbolInfo struct {
+	Symbol       string          `json:"symbol"`
+	Exchange     string          `json:"exchange"`
+	Pair         string          `json:"pair"`
+	BaseAsset    string          `json:"base_asset"`
+	QuoteAsset   string          `json:"quote_asset"`
+	TickSize     decimal.Decimal `json:"tick_size"`
+	LotSize      decimal.Decimal `json:"lot_size"`
+	ContractType string          `json:"contract_type"`
+	Status       string          `json:"status"`
+	// ListedAtUnixMilli and DelistedAtUnixMilli are 0 when unknown or not delisted.
+	ListedAtUnixMilli   int64 `json:"listed_at_unix_milli"`
+	DelistedAtUnixMilli int64 `json:"delisted_at_unix_milli"`
+	UpdatedAtUnixMilli  int64 `json:"updated_at_unix_milli"`
+}
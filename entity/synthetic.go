@@ -0,0 +1,57 @@
+package entity
+
+type SyntheticModel string
+
+const (
+	// SyntheticModelGbm walks the log price with a constant drift and volatility.
+	SyntheticModelGbm SyntheticModel = "gbm"
+	// SyntheticModelOu pulls the log price back to the log of MeanPrice.
+	SyntheticModelOu SyntheticModel = "ou"
+	// SyntheticModelJumpDiffusion adds normally distributed log jumps to a gbm.
+	SyntheticModelJumpDiffusion SyntheticModel = "jump_diffusion"
+	// SyntheticModelRegimeSwitching walks a gbm whose drift and volatility switch between Regimes.
+	SyntheticModelRegimeSwitching SyntheticModel = "regime_switching"
+)
+
+const (
+	SyntheticExchangeDefault = "synthetic"
+	// SyntheticContractType and SyntheticStatus list the pairs of a written synthetic market.
+	SyntheticContractType = "SYNTHETIC"
+	SyntheticStatus       = "TRADING"
+)
+
+// SyntheticMarket describes a generated market, the same market generated from the same
+// start is the same down to the last bar. Rates and volatilities are annualised over 365 days.
+type SyntheticMarket struct {
+	Model SyntheticModel `json:"model"`
+	// Seed drives every draw, a random one is taken when it is zero.
+	Seed uint64 `json:"seed"`
+	// Exchange is what the pairs are listed on, it defaults to synthetic.
+	Exchange string   `json:"exchange,omitempty"`
+	Pairs    []string `json:"pairs"`
+	// StartPrice defaults to 100.
+	StartPrice float64 `json:"start_price"`
+	// PriceDecimals rounds the prices, it defaults to 2.
+	PriceDecimals int32   `json:"price_decimals"`
+	Drift         float64 `json:"drift"`
+	Volatility    float64 `json:"volatility"`
+	// MeanReversion is how fast an ou market reverts to MeanPrice, MeanPrice defaults to the start price.
+	MeanReversion float64 `json:"mean_reversion,omitempty"`
+	MeanPrice     float64 `json:"mean_price,omitempty"`
+	// JumpsPerDay, JumpMean and JumpVolatility shape the log jumps of a jump diffusion.
+	JumpsPerDay    float64 `json:"jumps_per_day,omitempty"`
+	JumpMean       float64 `json:"jump_mean,omitempty"`
+	JumpVolatility float64 `json:"jump_volatility,omitempty"`
+	// Regimes are switched between SwitchesPerDay times a day on average, the market starts in the first.
+	Regimes        []SyntheticRegime `json:"regimes,omitempty"`
+	SwitchesPerDay float64           `json:"switches_per_day,omitempty"`
+	// Volume is the mean volume of a 1m bar, it defaults to 10.
+	Volume float64 `json:"volume"`
+	// VolumeProfile scales the volume by the UTC hour of the bar, 24 factors or none for a flat day.
+	VolumeProfile []float64 `json:"volume_profile,omitempty"`
+}
+
+type SyntheticRegime struct {
+	Drift      float64 `json:"drift"`
+	Volatility float64 `json:"volatility"`
+}
@@ -0,0 +1,33 @@
+package entity
+
+import hEntity "github.com/michaelyusak/go-helper/entity"
+
+type UniverseRank string
+
+const (
+	// UniverseRankQuoteVolume ranks by the sum of close * volume over the lookback.
+	UniverseRankQuoteVolume UniverseRank = "quote_volume"
+)
+
+// Universe picks the symbols of a replay from the symbol registry while it plays.
+// Membership is recomputed at every rebalance boundary from the candles of the
+// lookback window before it, so a symbol only counts once it actually qualified.
+type Universe struct {
+	Exchange     string       `json:"exchange"`
+	QuoteAsset   string       `json:"quote_asset,omitempty"`
+	ContractType string       `json:"contract_type,omitempty"`
+	Rank         UniverseRank `json:"rank"`
+	Top          int          `json:"top"`
+	// Lookback is the window the rank is computed over, it defaults to 30 days.
+	Lookback hEntity.Duration `json:"lookback"`
+	// Rebalance is how often membership is recomputed, a daily rebalance happens at UTC midnight.
+	// It defaults to a day.
+	Rebalance hEntity.Duration `json:"rebalance"`
+}
+
+type UniverseChangeData struct {
+	Epoch   int64    `json:"epoch"`
+	Members []string `json:"members"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
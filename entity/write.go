@@ -7,3 +7,27 @@ type ImportFromBinanceReq struct {
 	StartTimeUnixMilli int64  `json:"start_time_unix_milli" form:"start_time_unix_milli"`
 	EndTimeUnixMilli   int64  `json:"end_time_unix_milli" form:"end_time_unix_milli"`
 }
+
+type RebuildRollupsReq struct {
+	StartTimeUnixMilli int64 `json:"start_time_unix_milli"`
+	EndTimeUnixMilli   int64 `json:"end_time_unix_milli"`
+}
+
+type RebuildRollupsRes struct {
+	// Candles counts the rollup bars written over every interval.
+	Candles int64 `json:"candles"`
+}
+
+type WriteSyntheticReq struct {
+	Market             SyntheticMarket `json:"market"`
+	StartTimeUnixMilli int64           `json:"start_time_unix_milli"`
+	EndTimeUnixMilli   int64           `json:"end_time_unix_milli"`
+}
+
+type WriteSyntheticRes struct {
+	// Market is the written market with its seed and defaults filled in.
+	Market  SyntheticMarket `json:"market"`
+	Symbols []string        `json:"symbols"`
+	// Candles counts the bars stored, the ones the quality rules rejected aside.
+	Candles int64 `json:"candles"`
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/michaelyusak/go-helper/apperror"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Auth struct {
+	authService service.Auth
+}
+
+func NewAuth(
+	authService service.Auth,
+) *Auth {
+	return &Auth{
+		authService: authService,
+	}
+}
+
+func (h *Auth) IssueToken(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	c := ctx.Request.Context()
+
+	user, ok := common.AuthUserFromContext(c)
+	if !ok {
+		ctx.Error(apperror.UnauthorizedError(apperror.AppErrorOpt{
+			Message: "[handler][Auth][IssueToken] request not authenticated",
+		}))
+		return
+	}
+
+	res, err := h.authService.IssueToken(c, user)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Quality struct {
+	qualityService service.Quality
+}
+
+func NewQuality(
+	qualityService service.Quality,
+) *Quality {
+	return &Quality{
+		qualityService: qualityService,
+	}
+}
+
+func (h *Quality) ListAnomalies(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.GetAnomaliesReq
+
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	anomalies, err := h.qualityService.ListAnomalies(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, anomalies)
+}
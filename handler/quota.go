@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"michaelyusak/go-quant-replay-engine.git/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Quota struct {
+	quotaService service.Quota
+}
+
+func NewQuota(
+	quotaService service.Quota,
+) *Quota {
+	return &Quota{
+		quotaService: quotaService,
+	}
+}
+
+func (h *Quota) GetUsage(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	usage := h.quotaService.GetUsage(ctx.Request.Context())
+
+	hHelper.ResponseOK(ctx, usage)
+}
@@ -74,8 +74,12 @@ func (h *Replay) Start(ctx *gin.Context) {
 	go func() {
 		defer wg.Done()
 
-		raw := <-authDataCh
-		close(authDataCh)
+		var raw json.RawMessage
+		select {
+		case raw = <-authDataCh:
+		case <-c.Done():
+			return
+		}
 
 		var data entity.WsAuthData
 		err := json.Unmarshal(raw, &data)
@@ -88,10 +92,9 @@ func (h *Replay) Start(ctx *gin.Context) {
 			return
 		}
 
-		authenticatedCh <- true
 		close(authenticatedCh)
 
-		err = h.replayService.StreamReplay(c, dataCh, data.Channel, data.Token)
+		err = h.replayService.StreamReplay(c, dataCh, data)
 		if err != nil {
 			logrus.
 				WithError(err).
@@ -112,7 +115,11 @@ func (h *Replay) Start(ctx *gin.Context) {
 			case <-c.Done():
 				logrus.Warn("[handler][Replay][StreamReplay][Write] closing loop")
 				break loop
-			case data := <-dataCh:
+			case data, ok := <-dataCh:
+				if !ok {
+					break loop
+				}
+
 				err := conn.WriteMessage(websocket.TextMessage, data)
 				if err != nil {
 					if errors.Is(err, websocket.ErrCloseSent) {
@@ -128,10 +135,16 @@ func (h *Replay) Start(ctx *gin.Context) {
 		}
 	}()
 
-	wg.Add(1)
+	// the listener is blocked in ReadMessage until the connection closes,
+	// so it is waited on separately after the stream is over
+	var listenerWg sync.WaitGroup
+
+	listenerWg.Add(1)
 	// listener
 	go func() {
-		defer wg.Done()
+		defer listenerWg.Done()
+
+		authSent := false
 
 	loop:
 		for {
@@ -166,11 +179,24 @@ func (h *Replay) Start(ctx *gin.Context) {
 						continue
 					}
 
-					if msg.Type == string(entity.WsMessageTypeAuth) {
-						authDataCh <- msg.Data
+					if msg.Type == string(entity.WsMessageTypeAuth) && !authSent {
+						select {
+						case authDataCh <- msg.Data:
+							authSent = true
+						case <-c.Done():
+							break loop
+						}
 					}
 
-					<-authenticatedCh
+					if !authSent {
+						continue
+					}
+
+					select {
+					case <-authenticatedCh:
+					case <-c.Done():
+						break loop
+					}
 
 					// Feature
 				}
@@ -181,12 +207,18 @@ func (h *Replay) Start(ctx *gin.Context) {
 	wg.Wait()
 
 	common.CloseConn(conn)
+
+	listenerWg.Wait()
 }
 
 func (h *Replay) GetConfig(ctx *gin.Context) {
 	ctx.Header("Content-Type", "application/json")
 
-	conf := h.replayService.GetConfiguration(ctx.Request.Context())
+	conf, err := h.replayService.GetConfiguration(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
 
 	hHelper.ResponseOK(ctx, conf)
 }
@@ -201,7 +233,11 @@ func (h *Replay) UpdateConfig(ctx *gin.Context) {
 		return
 	}
 
-	h.replayService.UpdateConfiguration(ctx.Request.Context(), req)
+	err = h.replayService.UpdateConfiguration(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
 
 	hHelper.ResponseOK(ctx, nil)
 }
@@ -209,7 +245,141 @@ func (h *Replay) UpdateConfig(ctx *gin.Context) {
 func (h *Replay) GetListenedSymbols(ctx *gin.Context) {
 	ctx.Header("Content-Type", "application/json")
 
-	symbols := h.replayService.GetListenedSymbols()
+	symbols, err := h.replayService.GetListenedSymbols(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
 
 	hHelper.ResponseOK(ctx, symbols)
 }
+
+func (h *Replay) ListStreams(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	streams := h.replayService.ListStreams(ctx.Request.Context())
+
+	hHelper.ResponseOK(ctx, streams)
+}
+
+func (h *Replay) GetStream(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	stream, err := h.replayService.GetStream(ctx.Request.Context(), ctx.Param("channel"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, stream)
+}
+
+func (h *Replay) DeleteStream(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	err := h.replayService.DeleteStream(ctx.Request.Context(), ctx.Param("channel"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *Replay) PauseStream(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	err := h.replayService.PauseStream(ctx.Request.Context(), ctx.Param("channel"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *Replay) ResumeStream(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	err := h.replayService.ResumeStream(ctx.Request.Context(), ctx.Param("channel"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *Replay) ListPresets(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	presets, err := h.replayService.ListPresets(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, presets)
+}
+
+func (h *Replay) GetPreset(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	preset, err := h.replayService.GetPreset(ctx.Request.Context(), ctx.Param("name"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, preset)
+}
+
+func (h *Replay) CreatePreset(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ReplayPreset
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	preset, err := h.replayService.CreatePreset(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, preset)
+}
+
+func (h *Replay) UpdatePreset(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ReplayConfiguration
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	preset, err := h.replayService.UpdatePreset(ctx.Request.Context(), ctx.Param("name"), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, preset)
+}
+
+func (h *Replay) DeletePreset(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	err := h.replayService.DeletePreset(ctx.Request.Context(), ctx.Param("name"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"michaelyusak/go-quant-replay-engine.git/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Symbol struct {
+	symbolService service.Symbol
+}
+
+func NewSymbol(
+	symbolService service.Symbol,
+) *Symbol {
+	return &Symbol{
+		symbolService: symbolService,
+	}
+}
+
+func (h *Symbol) SyncFromBinance(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	count, err := h.symbolService.SyncFromBinance(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, map[string]int{"synced": count})
+}
+
+func (h *Symbol) ListSymbols(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	symbols, err := h.symbolService.ListSymbols(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, symbols)
+}
+
+func (h *Symbol) GetSymbol(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	symbol, err := h.symbolService.GetSymbol(ctx.Request.Context(), ctx.Param("symbol"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, symbol)
+}
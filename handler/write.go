@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"michaelyusak/go-quant-replay-engine.git/entity"
 	"michaelyusak/go-quant-replay-engine.git/service"
 
@@ -41,3 +42,79 @@ func (h *Write) ImportFromBinance(ctx *gin.Context) {
 
 	hHelper.ResponseOK(ctx, nil)
 }
+
+func (h *Write) ImportFundingRateFromBinance(ctx *gin.Context) {
+	h.importFromBinance(ctx, h.writeService.ImportFundingRateFromBinance)
+}
+
+func (h *Write) ImportOpenInterestFromBinance(ctx *gin.Context) {
+	h.importFromBinance(ctx, h.writeService.ImportOpenInterestFromBinance)
+}
+
+func (h *Write) ImportMarkPriceFromBinance(ctx *gin.Context) {
+	h.importFromBinance(ctx, h.writeService.ImportMarkPriceFromBinance)
+}
+
+func (h *Write) ImportIndexPriceFromBinance(ctx *gin.Context) {
+	h.importFromBinance(ctx, h.writeService.ImportIndexPriceFromBinance)
+}
+
+func (h *Write) RebuildRollups(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.RebuildRollupsReq
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.writeService.RebuildRollups(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Write) WriteSynthetic(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.WriteSyntheticReq
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.writeService.WriteSynthetic(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Write) importFromBinance(ctx *gin.Context, importFn func(ctx context.Context, req entity.ImportFromBinanceReq) error) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ImportFromBinanceReq
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = importFn(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
@@ -1,7 +1,18 @@
 package main
 
-import "michaelyusak/go-quant-replay-engine.git/server"
+import (
+	"os"
+	// calendars name their timezone, the zone database goes with the binary
+	_ "time/tzdata"
+
+	"michaelyusak/go-quant-replay-engine.git/server"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		server.Migrate(os.Args[2:])
+		return
+	}
+
 	server.Init()
-}
\ No newline at end of file
+}
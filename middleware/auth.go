@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/service"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/michaelyusak/go-helper/appconstant"
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/michaelyusak/go-helper/helper"
+)
+
+const (
+	apiKeyHeader = "X-Api-Key"
+
+	// browsers can not set headers on a websocket handshake, so the upgrade may carry the
+	// credentials in the query
+	apiKeyQuery      = "api_key"
+	accessTokenQuery = "access_token"
+
+	redactedQueryValue = "REDACTED"
+)
+
+// queryCredentialKey is where RedactQueryCredentials keeps a query credential for the upgrade.
+func queryCredentialKey(name string) string {
+	return "query_credential_" + name
+}
+
+// RedactQueryCredentials takes the credentials out of the query before the request is
+// logged, it has to run before the logger. Only AuthenticateUpgrade reads them back.
+func RedactQueryCredentials(ctx *gin.Context) {
+	query := ctx.Request.URL.Query()
+
+	redacted := false
+	for _, name := range []string{apiKeyQuery, accessTokenQuery} {
+		if value := query.Get(name); value != "" {
+			ctx.Set(queryCredentialKey(name), value)
+			query.Set(name, redactedQueryValue)
+			redacted = true
+		}
+	}
+
+	if redacted {
+		ctx.Request.URL.RawQuery = query.Encode()
+	}
+
+	ctx.Next()
+}
+
+type Auth struct {
+	authService service.Auth
+}
+
+func NewAuth(authService service.Auth) *Auth {
+	return &Auth{
+		authService: authService,
+	}
+}
+
+// Authenticate accepts either an api key or a bearer token issued by /v1/auth/token
+// in the headers.
+func (m *Auth) Authenticate(ctx *gin.Context) {
+	m.authenticate(ctx, false)
+}
+
+// AuthenticateUpgrade is Authenticate for the websocket upgrade, which may also carry
+// the credentials in the query.
+func (m *Auth) AuthenticateUpgrade(ctx *gin.Context) {
+	m.authenticate(ctx, true)
+}
+
+func (m *Auth) authenticate(ctx *gin.Context, queryAllowed bool) {
+	apiKey, token, err := credentials(ctx, queryAllowed)
+	if err != nil {
+		ctx.Error(err)
+		ctx.Abort()
+		return
+	}
+
+	c := ctx.Request.Context()
+
+	var user entity.AuthUser
+	if apiKey != "" {
+		user, err = m.authService.AuthenticateApiKey(c, apiKey)
+	} else {
+		user, err = m.authService.AuthenticateToken(c, token)
+	}
+	if err != nil {
+		ctx.Error(err)
+		ctx.Abort()
+		return
+	}
+
+	ctx.Request = ctx.Request.WithContext(helper.InjectValues(c, map[appconstant.ContextKey]any{
+		entity.UserIdKey: user.UserId,
+		entity.RoleKey:   user.Role,
+	}))
+
+	ctx.Next()
+}
+
+func (m *Auth) RequireRole(role entity.Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := common.AuthUserFromContext(ctx.Request.Context())
+		if !ok {
+			ctx.Error(apperror.UnauthorizedError(apperror.AppErrorOpt{
+				Message: "[middleware][Auth][RequireRole] request not authenticated",
+			}))
+			ctx.Abort()
+			return
+		}
+
+		if !user.Role.Includes(role) {
+			ctx.Error(apperror.NewAppError(apperror.AppErrorOpt{
+				Code:            http.StatusForbidden,
+				ResponseMessage: fmt.Sprintf("the '%s' role is required", role),
+				Message:         fmt.Sprintf("[middleware][Auth][RequireRole] user '%s' with role '%s' requires '%s'", user.UserId, user.Role, role),
+			}))
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func credentials(ctx *gin.Context, queryAllowed bool) (string, string, error) {
+	r := ctx.Request
+
+	if apiKey := r.Header.Get(apiKeyHeader); apiKey != "" {
+		return apiKey, "", nil
+	}
+
+	if authorization := r.Header.Get(appconstant.Authorization); authorization != "" {
+		split := strings.Split(authorization, " ")
+		if len(split) != 2 || split[0] != appconstant.Bearer || split[1] == "" {
+			return "", "", apperror.UnauthorizedError(apperror.AppErrorOpt{
+				ResponseMessage: "malformed authorization header",
+				Message:         "[middleware][Auth][credentials] malformed authorization header",
+			})
+		}
+
+		return "", split[1], nil
+	}
+
+	if queryAllowed && websocket.IsWebSocketUpgrade(r) {
+		// the short-lived token goes first, a leaked one expires on its own
+		if token := ctx.GetString(queryCredentialKey(accessTokenQuery)); token != "" {
+			return "", token, nil
+		}
+
+		if apiKey := ctx.GetString(queryCredentialKey(apiKeyQuery)); apiKey != "" {
+			return apiKey, "", nil
+		}
+	}
+
+	return "", "", apperror.UnauthorizedError(apperror.AppErrorOpt{
+		ResponseMessage: "missing credentials",
+		Message:         "[middleware][Auth][credentials] missing credentials",
+	})
+}
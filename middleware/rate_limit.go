@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"michaelyusak/go-quant-replay-engine.git/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RateLimit struct {
+	quotaService service.Quota
+}
+
+func NewRateLimit(quotaService service.Quota) *RateLimit {
+	return &RateLimit{
+		quotaService: quotaService,
+	}
+}
+
+// Limit has to run after Auth.Authenticate, requests are counted per user.
+func (m *RateLimit) Limit(ctx *gin.Context) {
+	err := m.quotaService.AllowRequest(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		ctx.Abort()
+		return
+	}
+
+	ctx.Next()
+}
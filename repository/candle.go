@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrCandleOutOfRange is returned by Candles1m.InsertMany for a candle it can not store exactly.
+var ErrCandleOutOfRange = errors.New("candle out of the storable range")
+
+// CheckStorable tells whether every price and volume of the candles fits an int64 at the
+// decimal places the candle carries, the way the scaled columns keep them. Every backend
+// checks the whole insert up front, so a candle out of range fails it before anything is
+// written rather than being clamped.
+func CheckStorable(candles []entity.Candle) error {
+	for _, candle := range candles {
+		prices := []decimal.Decimal{candle.Open, candle.High, candle.Low, candle.Close}
+		volumes := []decimal.Decimal{candle.Volume.Total, candle.Volume.Buy, candle.Volume.Sell}
+
+		for _, group := range [][]decimal.Decimal{prices, volumes} {
+			scale := common.DecimalPlaces(group...)
+
+			for _, value := range group {
+				_, err := common.ToScaled(value, scale)
+				if err != nil {
+					return fmt.Errorf("%w: %s:%s at %d: %v", ErrCandleOutOfRange, candle.Exchange, candle.Pair, candle.Epoch, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -4,10 +4,55 @@ import (
 	"context"
 	"michaelyusak/go-quant-replay-engine.git/entity"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type Candles1m interface {
+	// InsertMany replaces the bars stored under the same key. It fails with
+	// ErrCandleOutOfRange, writing nothing, when any candle does not pass CheckStorable.
 	InsertMany(ctx context.Context, candles []entity.Candle) error
 	CountCandles1m(ctx context.Context, exchange, symbol string, start, end time.Time) (int64, error)
-	GetCandles(ctx context.Context, symbols []string, cursor, end time.Time, limit int) ([]entity.Candle, error)
+	GetQuoteVolumes(ctx context.Context, exchange string, start, end time.Time) (map[string]decimal.Decimal, error)
+}
+
+// Candles reads the candles of any kept interval, the 1m ones or their rollups, which
+// Candles1m.InsertMany keeps up to date.
+type Candles interface {
+	// GetCandles pages through the candles within [start, end] in (epoch, exchange, pair)
+	// order, a page reads past the key of the last candle of the previous one.
+	GetCandles(ctx context.Context, interval entity.CandleInterval, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error)
+	RebuildRollups(ctx context.Context, start, end time.Time) (int64, error)
+}
+
+type FundingRates interface {
+	InsertMany(ctx context.Context, rates []entity.FundingRate) error
+	GetFundingRates(ctx context.Context, symbols []string, start, end time.Time) ([]entity.FundingRate, error)
+}
+
+type OpenInterests interface {
+	InsertMany(ctx context.Context, openInterests []entity.OpenInterest) error
+	GetOpenInterests(ctx context.Context, symbols []string, start, end time.Time) ([]entity.OpenInterest, error)
+}
+
+type PriceCandles1m interface {
+	InsertMany(ctx context.Context, candles []entity.PriceCandle) error
+	GetPriceCandles(ctx context.Context, priceType entity.PriceType, symbols []string, start, end time.Time) ([]entity.PriceCandle, error)
+}
+
+type ReplayPresets interface {
+	Save(ctx context.Context, preset entity.ReplayPreset) error
+	Delete(ctx context.Context, name string) error
+	GetPreset(ctx context.Context, name string) (entity.ReplayPreset, bool, error)
+	GetPresets(ctx context.Context) ([]entity.ReplayPreset, error)
+}
+
+type Symbols interface {
+	InsertMany(ctx context.Context, symbols []entity.SymbolInfo) error
+	GetSymbols(ctx context.Context) ([]entity.SymbolInfo, error)
+}
+
+type Anomalies interface {
+	InsertMany(ctx context.Context, anomalies []entity.Anomaly) error
+	GetAnomalies(ctx context.Context, symbol string, start, end time.Time, limit int) ([]entity.Anomaly, error)
 }
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"sync"
+	"time"
+)
+
+type anomalyKey struct {
+	seriesKey
+	source entity.AnomalySource
+	rule   entity.AnomalyRule
+}
+
+type anomalies struct {
+	anomalies map[anomalyKey]entity.Anomaly
+
+	mu sync.RWMutex
+}
+
+func NewAnomalies() *anomalies {
+	return &anomalies{
+		anomalies: map[anomalyKey]entity.Anomaly{},
+	}
+}
+
+func (r *anomalies) InsertMany(ctx context.Context, anomalies []entity.Anomaly) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, anomaly := range anomalies {
+		anomaly.Symbol = anomaly.Exchange + ":" + anomaly.Pair
+
+		key := anomalyKey{
+			seriesKey: seriesKey{exchange: anomaly.Exchange, pair: anomaly.Pair, epoch: anomaly.Epoch},
+			source:    anomaly.Source,
+			rule:      anomaly.Rule,
+		}
+		r.anomalies[key] = anomaly
+	}
+
+	return nil
+}
+
+// GetAnomalies returns the anomalies of the bars within [start, end) ordered by timestamp,
+// a zero end leaves the window open.
+func (r *anomalies) GetAnomalies(ctx context.Context, symbol string, start, end time.Time, limit int) ([]entity.Anomaly, error) {
+	match := symbolFilter([]string{symbol})
+
+	r.mu.RLock()
+
+	result := []entity.Anomaly{}
+	for key, anomaly := range r.anomalies {
+		if !match(key.exchange, key.pair) || key.epoch < start.Unix() {
+			continue
+		}
+
+		if end.Unix() > 0 && key.epoch >= end.Unix() {
+			continue
+		}
+
+		result = append(result, anomaly)
+	}
+
+	r.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Epoch != result[j].Epoch {
+			return result[i].Epoch < result[j].Epoch
+		}
+		if result[i].Source != result[j].Source {
+			return result[i].Source < result[j].Source
+		}
+
+		return result[i].Rule < result[j].Rule
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
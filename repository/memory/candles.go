@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/rollup"
+	"sort"
+	"time"
+)
+
+// candles reads the 1m candles and the rollups of the given candles1m store.
+type candles struct {
+	store *candles1m
+}
+
+func NewCandles(store *candles1m) *candles {
+	return &candles{
+		store: store,
+	}
+}
+
+func (r *candles) GetCandles(ctx context.Context, interval entity.CandleInterval, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	if interval == entity.CandleInterval1m {
+		return selectCandles(r.store.candles, symbols, start, end, after, limit), nil
+	}
+
+	bars, ok := r.store.rollups[interval]
+	if !ok {
+		return []entity.Candle{}, fmt.Errorf("[repository][memory][candles][GetCandles] no candles of interval '%s' are kept", interval)
+	}
+
+	return selectCandles(bars, symbols, start, end, after, limit), nil
+}
+
+// RebuildRollups recomputes every rollup bar of the whole days within [start, end] from
+// the stored 1m candles. It returns how many bars were written.
+func (r *candles) RebuildRollups(ctx context.Context, start, end time.Time) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	from, to := rollup.Span(start, end)
+	stored := r.store.storedWithin(nil, from, to)
+
+	var written int64
+
+	for _, interval := range entity.RollupIntervals {
+		bars := rollup.Aggregate(stored, interval)
+
+		r.store.storeRollups(interval, bars)
+
+		written += int64(len(bars))
+	}
+
+	return written, nil
+}
+
+// selectCandles filters candles the way the sql GetCandles do, an inclusive window applied
+// only when both ends are set and the keys past after, in (epoch, exchange, pair) order.
+func selectCandles(candles map[seriesKey]entity.Candle, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) []entity.Candle {
+	match := symbolFilter(symbols)
+	bounded := start.Unix() > 0 && end.Unix() > 0
+
+	selected := []entity.Candle{}
+	for key, candle := range candles {
+		if !match(key.exchange, key.pair) {
+			continue
+		}
+
+		if bounded && (key.epoch < start.Unix() || key.epoch > end.Unix()) {
+			continue
+		}
+
+		if after != nil && !keyLess(*after, candle.Key()) {
+			continue
+		}
+
+		selected = append(selected, candle)
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return keyLess(selected[i].Key(), selected[j].Key())
+	})
+
+	if limit > 0 && len(selected) > limit {
+		selected = selected[:limit]
+	}
+
+	return selected
+}
+
+// keyLess orders keys field by field, exchange:pair strings would not sort the same way.
+func keyLess(a, b entity.CandleKey) bool {
+	if a.Epoch != b.Epoch {
+		return a.Epoch < b.Epoch
+	}
+
+	if a.Exchange != b.Exchange {
+		return a.Exchange < b.Exchange
+	}
+
+	return a.Pair < b.Pair
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"michaelyusak/go-quant-replay-engine.git/repository/rollup"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// candles1m keeps the candles in a map keyed like the questdb dedup keys, an insert
+// of a bar already stored replaces it. The rollups are kept alongside, NewCandles reads them.
+type candles1m struct {
+	candles map[seriesKey]entity.Candle
+	rollups map[entity.CandleInterval]map[seriesKey]entity.Candle
+
+	mu sync.RWMutex
+}
+
+func NewCandles1m() *candles1m {
+	rollups := map[entity.CandleInterval]map[seriesKey]entity.Candle{}
+	for _, interval := range entity.RollupIntervals {
+		rollups[interval] = map[seriesKey]entity.Candle{}
+	}
+
+	return &candles1m{
+		candles: map[seriesKey]entity.Candle{},
+		rollups: rollups,
+	}
+}
+
+// InsertMany also refreshes the rollup bars the candles fall in.
+func (r *candles1m) InsertMany(ctx context.Context, candles []entity.Candle) error {
+	err := repository.CheckStorable(candles)
+	if err != nil {
+		return fmt.Errorf("[repository][memory][candles1m][InsertMany][repository.CheckStorable] error: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, candle := range candles {
+		candle.Symbol = candle.Exchange + ":" + candle.Pair
+		r.candles[seriesKey{exchange: candle.Exchange, pair: candle.Pair, epoch: candle.Epoch}] = candle
+	}
+
+	if len(candles) == 0 {
+		return nil
+	}
+
+	start, end, symbols := rollup.Window(candles)
+
+	for interval, bars := range rollup.Refresh(candles, r.storedWithin(symbols, start, end)) {
+		r.storeRollups(interval, bars)
+	}
+
+	return nil
+}
+
+// storedWithin returns the 1m candles of symbols within [start, end), the caller holds mu.
+func (r *candles1m) storedWithin(symbols []string, start, end time.Time) []entity.Candle {
+	match := symbolFilter(symbols)
+
+	stored := []entity.Candle{}
+	for key, candle := range r.candles {
+		if match(key.exchange, key.pair) && inWindow(key.epoch, start, end) {
+			stored = append(stored, candle)
+		}
+	}
+
+	return stored
+}
+
+// storeRollups replaces the bars of interval, the caller holds mu.
+func (r *candles1m) storeRollups(interval entity.CandleInterval, bars []entity.Candle) {
+	for _, bar := range bars {
+		r.rollups[interval][seriesKey{exchange: bar.Exchange, pair: bar.Pair, epoch: bar.Epoch}] = bar
+	}
+}
+
+func (r *candles1m) CountCandles1m(ctx context.Context, exchange, symbol string, start, end time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+
+	for key := range r.candles {
+		if key.exchange == exchange && key.pair == symbol && key.epoch >= start.Unix() && key.epoch <= end.Unix() {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetQuoteVolumes sums close * volume of every symbol of the exchange within [start, end),
+// keyed by exchange:pair.
+func (r *candles1m) GetQuoteVolumes(ctx context.Context, exchange string, start, end time.Time) (map[string]decimal.Decimal, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	volumes := map[string]decimal.Decimal{}
+
+	for key, candle := range r.candles {
+		if key.exchange != exchange || !inWindow(key.epoch, start, end) {
+			continue
+		}
+
+		symbol := key.exchange + ":" + key.pair
+		volumes[symbol] = volumes[symbol].Add(candle.Close.Mul(candle.Volume.Total))
+	}
+
+	return volumes, nil
+}
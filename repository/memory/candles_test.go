@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"michaelyusak/go-quant-replay-engine.git/repository/repositorytest"
+	"testing"
+)
+
+func TestCandlesPaging(t *testing.T) {
+	repositorytest.CandlesPaging(t, func(t *testing.T) (repository.Candles1m, repository.Candles) {
+		candles1m := NewCandles1m()
+
+		return candles1m, NewCandles(candles1m)
+	})
+}
+
+func TestCandlesBulkWrite(t *testing.T) {
+	repositorytest.CandlesBulkWrite(t, func(t *testing.T) (repository.Candles1m, repository.Candles) {
+		candles1m := NewCandles1m()
+
+		return candles1m, NewCandles(candles1m)
+	})
+}
+
+func TestCandlesRoundTrip(t *testing.T) {
+	repositorytest.CandlesRoundTrip(t, func(t *testing.T) (repository.Candles1m, repository.Candles) {
+		candles1m := NewCandles1m()
+
+		return candles1m, NewCandles(candles1m)
+	})
+}
+
+func TestCandlesOutOfRange(t *testing.T) {
+	repositorytest.CandlesOutOfRange(t, func(t *testing.T) (repository.Candles1m, repository.Candles) {
+		candles1m := NewCandles1m()
+
+		return candles1m, NewCandles(candles1m)
+	})
+}
+
+func TestCandlesQuoteVolumes(t *testing.T) {
+	repositorytest.CandlesQuoteVolumes(t, func(t *testing.T) (repository.Candles1m, repository.Candles) {
+		candles1m := NewCandles1m()
+
+		return candles1m, NewCandles(candles1m)
+	})
+}
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"sync"
+	"time"
+)
+
+type fundingRates struct {
+	rates map[seriesKey]entity.FundingRate
+
+	mu sync.RWMutex
+}
+
+func NewFundingRates() *fundingRates {
+	return &fundingRates{
+		rates: map[seriesKey]entity.FundingRate{},
+	}
+}
+
+func (r *fundingRates) InsertMany(ctx context.Context, rates []entity.FundingRate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rate := range rates {
+		rate.Symbol = rate.Exchange + ":" + rate.Pair
+		r.rates[seriesKey{exchange: rate.Exchange, pair: rate.Pair, epoch: rate.Epoch}] = rate
+	}
+
+	return nil
+}
+
+// GetFundingRates returns the funding rates within [start, end) ordered by timestamp.
+func (r *fundingRates) GetFundingRates(ctx context.Context, symbols []string, start, end time.Time) ([]entity.FundingRate, error) {
+	match := symbolFilter(symbols)
+
+	r.mu.RLock()
+
+	rates := []entity.FundingRate{}
+	for key, rate := range r.rates {
+		if match(key.exchange, key.pair) && inWindow(key.epoch, start, end) {
+			rates = append(rates, rate)
+		}
+	}
+
+	r.mu.RUnlock()
+
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Epoch != rates[j].Epoch {
+			return rates[i].Epoch < rates[j].Epoch
+		}
+
+		return rates[i].Symbol < rates[j].Symbol
+	})
+
+	return rates, nil
+}
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"sync"
+	"time"
+)
+
+type openInterests struct {
+	openInterests map[seriesKey]entity.OpenInterest
+
+	mu sync.RWMutex
+}
+
+func NewOpenInterests() *openInterests {
+	return &openInterests{
+		openInterests: map[seriesKey]entity.OpenInterest{},
+	}
+}
+
+func (r *openInterests) InsertMany(ctx context.Context, openInterests []entity.OpenInterest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, oi := range openInterests {
+		oi.Symbol = oi.Exchange + ":" + oi.Pair
+		r.openInterests[seriesKey{exchange: oi.Exchange, pair: oi.Pair, epoch: oi.Epoch}] = oi
+	}
+
+	return nil
+}
+
+// GetOpenInterests returns the open interest snapshots within [start, end) ordered by timestamp.
+func (r *openInterests) GetOpenInterests(ctx context.Context, symbols []string, start, end time.Time) ([]entity.OpenInterest, error) {
+	match := symbolFilter(symbols)
+
+	r.mu.RLock()
+
+	openInterests := []entity.OpenInterest{}
+	for key, oi := range r.openInterests {
+		if match(key.exchange, key.pair) && inWindow(key.epoch, start, end) {
+			openInterests = append(openInterests, oi)
+		}
+	}
+
+	r.mu.RUnlock()
+
+	sort.Slice(openInterests, func(i, j int) bool {
+		if openInterests[i].Epoch != openInterests[j].Epoch {
+			return openInterests[i].Epoch < openInterests[j].Epoch
+		}
+
+		return openInterests[i].Symbol < openInterests[j].Symbol
+	})
+
+	return openInterests, nil
+}
@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"sync"
+	"time"
+)
+
+type priceCandleKey struct {
+	seriesKey
+	priceType entity.PriceType
+}
+
+type priceCandles1m struct {
+	candles map[priceCandleKey]entity.PriceCandle
+
+	mu sync.RWMutex
+}
+
+func NewPriceCandles1m() *priceCandles1m {
+	return &priceCandles1m{
+		candles: map[priceCandleKey]entity.PriceCandle{},
+	}
+}
+
+func (r *priceCandles1m) InsertMany(ctx context.Context, candles []entity.PriceCandle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, candle := range candles {
+		candle.Symbol = candle.Exchange + ":" + candle.Pair
+
+		key := priceCandleKey{
+			seriesKey: seriesKey{exchange: candle.Exchange, pair: candle.Pair, epoch: candle.Epoch},
+			priceType: candle.PriceType,
+		}
+		r.candles[key] = candle
+	}
+
+	return nil
+}
+
+// GetPriceCandles returns the mark or index price candles within [start, end) ordered by timestamp.
+func (r *priceCandles1m) GetPriceCandles(ctx context.Context, priceType entity.PriceType, symbols []string, start, end time.Time) ([]entity.PriceCandle, error) {
+	match := symbolFilter(symbols)
+
+	r.mu.RLock()
+
+	candles := []entity.PriceCandle{}
+	for key, candle := range r.candles {
+		if key.priceType == priceType && match(key.exchange, key.pair) && inWindow(key.epoch, start, end) {
+			candles = append(candles, candle)
+		}
+	}
+
+	r.mu.RUnlock()
+
+	sort.Slice(candles, func(i, j int) bool {
+		if candles[i].Epoch != candles[j].Epoch {
+			return candles[i].Epoch < candles[j].Epoch
+		}
+
+		return candles[i].Symbol < candles[j].Symbol
+	})
+
+	return candles, nil
+}
@@ -0,0 +1,35 @@
+package memory
+
+import (
+	"strings"
+	"time"
+)
+
+// symbolFilter matches the given exchange:pair symbols the way the sql filters do,
+// symbols not in exchange:pair form are skipped and no valid symbol matches everything.
+func symbolFilter(symbols []string) func(exchange, pair string) bool {
+	wanted := map[string]bool{}
+
+	for _, symbol := range symbols {
+		if len(strings.Split(symbol, ":")) != 2 {
+			continue
+		}
+
+		wanted[symbol] = true
+	}
+
+	return func(exchange, pair string) bool {
+		return len(wanted) == 0 || wanted[exchange+":"+pair]
+	}
+}
+
+// inWindow tells whether epoch falls within [start, end).
+func inWindow(epoch int64, start, end time.Time) bool {
+	return epoch >= start.Unix() && epoch < end.Unix()
+}
+
+type seriesKey struct {
+	exchange string
+	pair     string
+	epoch    int64
+}
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"sync"
+)
+
+type replayPresets struct {
+	presets map[string]entity.ReplayPreset
+
+	mu sync.RWMutex
+}
+
+func NewReplayPresets() *replayPresets {
+	return &replayPresets{
+		presets: map[string]entity.ReplayPreset{},
+	}
+}
+
+func (r *replayPresets) Save(ctx context.Context, preset entity.ReplayPreset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.presets[preset.Name] = preset
+
+	return nil
+}
+
+func (r *replayPresets) Delete(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.presets, name)
+
+	return nil
+}
+
+func (r *replayPresets) GetPreset(ctx context.Context, name string) (entity.ReplayPreset, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	preset, ok := r.presets[name]
+
+	return preset, ok, nil
+}
+
+func (r *replayPresets) GetPresets(ctx context.Context) ([]entity.ReplayPreset, error) {
+	r.mu.RLock()
+
+	presets := make([]entity.ReplayPreset, 0, len(r.presets))
+	for _, preset := range r.presets {
+		presets = append(presets, preset)
+	}
+
+	r.mu.RUnlock()
+
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+
+	return presets, nil
+}
@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"sync"
+)
+
+// symbols keeps the latest sync of every exchange and pair.
+type symbols struct {
+	symbolInfos map[string]entity.SymbolInfo
+
+	mu sync.RWMutex
+}
+
+func NewSymbols() *symbols {
+	return &symbols{
+		symbolInfos: map[string]entity.SymbolInfo{},
+	}
+}
+
+func (r *symbols) InsertMany(ctx context.Context, symbolInfos []entity.SymbolInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, info := range symbolInfos {
+		info.Symbol = info.Exchange + ":" + info.Pair
+
+		stored, ok := r.symbolInfos[info.Symbol]
+		if ok && stored.UpdatedAtUnixMilli > info.UpdatedAtUnixMilli {
+			continue
+		}
+
+		r.symbolInfos[info.Symbol] = info
+	}
+
+	return nil
+}
+
+func (r *symbols) GetSymbols(ctx context.Context) ([]entity.SymbolInfo, error) {
+	r.mu.RLock()
+
+	symbolInfos := make([]entity.SymbolInfo, 0, len(r.symbolInfos))
+	for _, info := range r.symbolInfos {
+		symbolInfos = append(symbolInfos, info)
+	}
+
+	r.mu.RUnlock()
+
+	sort.Slice(symbolInfos, func(i, j int) bool {
+		return symbolInfos[i].Symbol < symbolInfos[j].Symbol
+	})
+
+	return symbolInfos, nil
+}
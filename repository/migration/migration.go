@@ -0,0 +1,278 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect picks the migration variant. questdb and postgres back the pg wire repositories,
+// which pick their upserts and latest-row reads by it, sqlite backs its own.
+type Dialect string
+
+const (
+	DialectQuestDB  Dialect = "questdb"
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+//go:embed questdb/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// Migration is one versioned file, named <version>_<name>.sql.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+
+	statements []string
+}
+
+type migrator struct {
+	db      *sql.DB
+	dialect Dialect
+	source  fs.FS
+}
+
+func NewMigrator(db *sql.DB, dialect Dialect) (*migrator, error) {
+	if dialect == "" {
+		dialect = DialectQuestDB
+	}
+
+	if dialect != DialectQuestDB && dialect != DialectPostgres && dialect != DialectSQLite {
+		return nil, fmt.Errorf("[repository][migration][NewMigrator] unknown dialect '%s'", dialect)
+	}
+
+	return &migrator{
+		db:      db,
+		dialect: dialect,
+		source:  files,
+	}, nil
+}
+
+// Up applies every migration that is not in schema_migrations yet, oldest first,
+// and returns the ones it applied.
+func (m *migrator) Up(ctx context.Context) ([]Migration, error) {
+	migrations, err := m.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][migration][migrator][Up][m.Status] error: %w", err)
+	}
+
+	applied := []Migration{}
+
+	for _, migration := range migrations {
+		if migration.Applied {
+			continue
+		}
+
+		err := m.apply(ctx, migration)
+		if err != nil {
+			return applied, fmt.Errorf("[repository][migration][migrator][Up][m.apply] version %d error: %w", migration.Version, err)
+		}
+
+		migration.Applied = true
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// Status lists every embedded migration of the dialect and whether it is applied.
+func (m *migrator) Status(ctx context.Context) ([]Migration, error) {
+	migrations, err := m.load()
+	if err != nil {
+		return nil, fmt.Errorf("[repository][migration][migrator][Status][m.load] error: %w", err)
+	}
+
+	err = m.ensureTable(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][migration][migrator][Status][m.ensureTable] error: %w", err)
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("[repository][migration][migrator][Status][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+
+	for rows.Next() {
+		var version int
+
+		err := rows.Scan(&version)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][migration][migrator][Status][rows.Scan] error: %w", err)
+		}
+
+		applied[version] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("[repository][migration][migrator][Status][rows.Err] error: %w", err)
+	}
+
+	for i := range migrations {
+		migrations[i].Applied = applied[migrations[i].Version]
+	}
+
+	return migrations, nil
+}
+
+func (m *migrator) ensureTable(ctx context.Context) error {
+	query := "CREATE TABLE IF NOT EXISTS schema_migrations (applied_at TIMESTAMPTZ NOT NULL, version INT PRIMARY KEY, name TEXT NOT NULL)"
+	if m.dialect == DialectQuestDB {
+		query = "CREATE TABLE IF NOT EXISTS schema_migrations (applied_at TIMESTAMP, version INT, name STRING) TIMESTAMP(applied_at)"
+	}
+
+	_, err := m.db.ExecContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("[repository][migration][migrator][ensureTable][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// apply runs a migration inside a transaction on postgres and sqlite. questdb has no
+// transactional DDL, a migration that fails there halfway is not recorded and has to
+// be finished or undone by hand before it is retried.
+func (m *migrator) apply(ctx context.Context, migration Migration) error {
+	record := "INSERT INTO schema_migrations (applied_at, version, name) VALUES ($1,$2,$3)"
+
+	if m.dialect == DialectQuestDB {
+		for _, statement := range migration.statements {
+			_, err := m.db.ExecContext(ctx, statement)
+			if err != nil {
+				return fmt.Errorf("[repository][migration][migrator][apply][db.ExecContext] error: %w", err)
+			}
+		}
+
+		_, err := m.db.ExecContext(ctx, record, time.Now(), migration.Version, migration.Name)
+		if err != nil {
+			return fmt.Errorf("[repository][migration][migrator][apply][db.ExecContext(record)] error: %w", err)
+		}
+
+		return nil
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("[repository][migration][migrator][apply][db.BeginTx] error: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, statement := range migration.statements {
+		_, err := tx.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("[repository][migration][migrator][apply][tx.ExecContext] error: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, record, time.Now(), migration.Version, migration.Name)
+	if err != nil {
+		return fmt.Errorf("[repository][migration][migrator][apply][tx.ExecContext(record)] error: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("[repository][migration][migrator][apply][tx.Commit] error: %w", err)
+	}
+
+	return nil
+}
+
+func (m *migrator) load() ([]Migration, error) {
+	entries, err := fs.ReadDir(m.source, string(m.dialect))
+	if err != nil {
+		return nil, fmt.Errorf("[repository][migration][migrator][load][fs.ReadDir] error: %w", err)
+	}
+
+	migrations := []Migration{}
+	seen := map[int]string{}
+
+	for _, entry := range entries {
+		version, name, ok := parseFileName(entry.Name())
+		if !ok {
+			return nil, fmt.Errorf("[repository][migration][migrator][load] malformed migration file name '%s'", entry.Name())
+		}
+
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("[repository][migration][migrator][load] version %d is used by both '%s' and '%s'", version, other, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		content, err := fs.ReadFile(m.source, path.Join(string(m.dialect), entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("[repository][migration][migrator][load][fs.ReadFile] error: %w", err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version:    version,
+			Name:       name,
+			statements: splitStatements(string(content)),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func parseFileName(fileName string) (int, string, bool) {
+	base, ok := strings.CutSuffix(fileName, ".sql")
+	if !ok {
+		return 0, "", false
+	}
+
+	versionPart, name, ok := strings.Cut(base, "_")
+	if !ok || name == "" {
+		return 0, "", false
+	}
+
+	version, err := strconv.Atoi(versionPart)
+	if err != nil || version <= 0 {
+		return 0, "", false
+	}
+
+	return version, name, true
+}
+
+// splitStatements cuts a file on the semicolons that end a line, which is all the
+// migrations need, and drops the -- comment lines.
+func splitStatements(content string) []string {
+	statements := []string{}
+	current := []string{}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "--") || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if statement, ok := strings.CutSuffix(line, ";"); ok {
+			current = append(current, statement)
+			statements = append(statements, strings.Join(current, "\n"))
+			current = []string{}
+			continue
+		}
+
+		current = append(current, line)
+	}
+
+	if len(current) > 0 {
+		statements = append(statements, strings.Join(current, "\n"))
+	}
+
+	return statements
+}
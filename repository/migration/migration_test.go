@@ -0,0 +1,286 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"michaelyusak/go-quant-replay-engine.git/repository/sqlite"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "replay.db"))
+	if err != nil {
+		t.Fatalf("sqlite.Open error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("sqlite_master error: %v", err)
+	}
+
+	return count > 0
+}
+
+func versionsOf(migrations []Migration) string {
+	versions := []int{}
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+
+	return fmt.Sprint(versions)
+}
+
+func TestNewMigrator(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		want    Dialect
+		wantErr bool
+	}{
+		{"questdb when empty", "", DialectQuestDB, false},
+		{"postgres", DialectPostgres, DialectPostgres, false},
+		{"sqlite", DialectSQLite, DialectSQLite, false},
+		{"an unknown dialect", "mysql", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := NewMigrator(nil, test.dialect)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewMigrator error = %v, want error %v", err, test.wantErr)
+			}
+
+			if err == nil && m.dialect != test.want {
+				t.Errorf("dialect = %s, want %s", m.dialect, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadEveryDialect(t *testing.T) {
+	versions := map[Dialect]string{}
+
+	for _, dialect := range []Dialect{DialectQuestDB, DialectPostgres, DialectSQLite} {
+		m, err := NewMigrator(nil, dialect)
+		if err != nil {
+			t.Fatalf("NewMigrator error: %v", err)
+		}
+
+		migrations, err := m.load()
+		if err != nil {
+			t.Fatalf("%s: load error: %v", dialect, err)
+		}
+
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Errorf("%s: migration %d is version %d, want the versions to run from 1 without gaps", dialect, i, migration.Version)
+			}
+
+			if len(migration.statements) == 0 {
+				t.Errorf("%s: version %d has no statements", dialect, migration.Version)
+			}
+		}
+
+		versions[dialect] = versionsOf(migrations)
+	}
+
+	// the pg wire dialects move in step, the repositories pick their queries by dialect only
+	if versions[DialectQuestDB] != versions[DialectPostgres] {
+		t.Errorf("questdb has versions %s and postgres %s, want the same", versions[DialectQuestDB], versions[DialectPostgres])
+	}
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"a file without a version", fstest.MapFS{"sqlite/schema.sql": {Data: []byte("SELECT 1;")}}},
+		{"a file without a name", fstest.MapFS{"sqlite/0001.sql": {Data: []byte("SELECT 1;")}}},
+		{"a file that is not sql", fstest.MapFS{"sqlite/0001_schema.txt": {Data: []byte("SELECT 1;")}}},
+		{"a version used twice", fstest.MapFS{
+			"sqlite/0001_schema.sql": {Data: []byte("SELECT 1;")},
+			"sqlite/1_again.sql":     {Data: []byte("SELECT 1;")},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &migrator{dialect: DialectSQLite, source: test.files}
+
+			_, err := m.load()
+			if err == nil {
+				t.Errorf("load error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestUpAppliesEverySQLiteMigrationOnce(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	m, err := NewMigrator(db, DialectSQLite)
+	if err != nil {
+		t.Fatalf("NewMigrator error: %v", err)
+	}
+
+	all, err := m.load()
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up error: %v", err)
+	}
+
+	if versionsOf(applied) != versionsOf(all) {
+		t.Errorf("Up applied %s, want every version %s", versionsOf(applied), versionsOf(all))
+	}
+
+	for _, table := range []string{"candles_1m", "funding_rates", "open_interest", "price_candles_1m", "replay_presets", "symbols", "anomalies", "candles_1d"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("table %s is missing after Up", table)
+		}
+	}
+
+	again, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("second Up error: %v", err)
+	}
+
+	if len(again) != 0 {
+		t.Errorf("second Up applied %s, want nothing", versionsOf(again))
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status error: %v", err)
+	}
+
+	for _, migration := range status {
+		if !migration.Applied {
+			t.Errorf("version %d is not applied", migration.Version)
+		}
+	}
+
+	var recorded int
+	err = db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&recorded)
+	if err != nil {
+		t.Fatalf("schema_migrations error: %v", err)
+	}
+
+	if recorded != len(all) {
+		t.Errorf("schema_migrations has %d rows, want %d", recorded, len(all))
+	}
+}
+
+func TestUpLeavesAFailedMigrationUnrecorded(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	m := &migrator{db: db, dialect: DialectSQLite, source: fstest.MapFS{
+		"sqlite/0001_first.sql":  {Data: []byte("CREATE TABLE first (id INTEGER);\n")},
+		"sqlite/0002_second.sql": {Data: []byte("CREATE TABLE second (id INTEGER);\nINSERT INTO missing VALUES (1);\n")},
+	}}
+
+	applied, err := m.Up(ctx)
+	if err == nil {
+		t.Fatalf("Up error = nil, want the failure of version 2")
+	}
+
+	if versionsOf(applied) != "[1]" {
+		t.Errorf("Up applied %s, want [1]", versionsOf(applied))
+	}
+
+	if tableExists(t, db, "second") {
+		t.Errorf("the failed migration left its table behind")
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status error: %v", err)
+	}
+
+	if len(status) != 2 || !status[0].Applied || status[1].Applied {
+		t.Fatalf("Status = %+v, want version 1 applied and version 2 pending", status)
+	}
+
+	m.source = fstest.MapFS{
+		"sqlite/0001_first.sql":  {Data: []byte("CREATE TABLE first (id INTEGER);\n")},
+		"sqlite/0002_second.sql": {Data: []byte("CREATE TABLE second (id INTEGER);\n")},
+	}
+
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up after the fix error: %v", err)
+	}
+
+	if versionsOf(applied) != "[2]" || !tableExists(t, db, "second") {
+		t.Errorf("Up after the fix applied %s, want the retried version 2", versionsOf(applied))
+	}
+}
+
+func TestParseFileName(t *testing.T) {
+	tests := []struct {
+		fileName string
+		version  int
+		name     string
+		ok       bool
+	}{
+		{"0001_candles_1m.sql", 1, "candles_1m", true},
+		{"12_rollups.sql", 12, "rollups", true},
+		{"0001_candles_1m.txt", 0, "", false},
+		{"0001.sql", 0, "", false},
+		{"0001_.sql", 0, "", false},
+		{"0000_zero.sql", 0, "", false},
+		{"v1_schema.sql", 0, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fileName, func(t *testing.T) {
+			version, name, ok := parseFileName(test.fileName)
+			if version != test.version || name != test.name || ok != test.ok {
+				t.Errorf("parseFileName = %d %q %v, want %d %q %v", version, name, ok, test.version, test.name, test.ok)
+			}
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"one statement a line", "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n", []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"}},
+		{"a statement over lines", "CREATE TABLE a (\n    id INT\n);\n", []string{"CREATE TABLE a (\n    id INT\n)"}},
+		{"comments and blank lines are dropped", "-- the first table\n\nCREATE TABLE a (id INT);\n  -- indented\n", []string{"CREATE TABLE a (id INT)"}},
+		{"a missing last semicolon", "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT)", []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"}},
+		{"trailing spaces and carriage returns", "CREATE TABLE a (id INT); \r\n", []string{"CREATE TABLE a (id INT)"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitStatements(test.content)
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+				t.Errorf("splitStatements = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+-- The candles the replay is built on, as they were first stored with double prices.
+CREATE TABLE IF NOT EXISTS candles_1m (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open DOUBLE PRECISION NOT NULL,
+    high DOUBLE PRECISION NOT NULL,
+    low DOUBLE PRECISION NOT NULL,
+    close DOUBLE PRECISION NOT NULL,
+    volume DOUBLE PRECISION NOT NULL,
+    buy_volume DOUBLE PRECISION NOT NULL,
+    sell_volume DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (exchange, symbol, timestamp)
+);
+
+CREATE INDEX IF NOT EXISTS candles_1m_timestamp_idx ON candles_1m (timestamp);
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS funding_rates (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    funding_rate DOUBLE PRECISION NOT NULL,
+    mark_price DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (exchange, symbol, timestamp)
+);
+
+CREATE TABLE IF NOT EXISTS open_interest (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    sum_open_interest DOUBLE PRECISION NOT NULL,
+    sum_open_interest_value DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (exchange, symbol, timestamp)
+);
+
+CREATE TABLE IF NOT EXISTS price_candles_1m (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    price_type TEXT NOT NULL,
+    open DOUBLE PRECISION NOT NULL,
+    high DOUBLE PRECISION NOT NULL,
+    low DOUBLE PRECISION NOT NULL,
+    close DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (exchange, symbol, price_type, timestamp)
+);
@@ -0,0 +1,9 @@
+-- Every preset version is a row, reads take the latest row per name.
+CREATE TABLE IF NOT EXISTS replay_presets (
+    timestamp TIMESTAMPTZ NOT NULL,
+    name TEXT NOT NULL,
+    config TEXT NOT NULL,
+    deleted BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS replay_presets_name_timestamp_idx ON replay_presets (name, timestamp DESC);
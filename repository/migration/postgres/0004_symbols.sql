@@ -0,0 +1,16 @@
+-- Every sync appends a row per symbol, reads take the latest row per exchange and symbol.
+CREATE TABLE IF NOT EXISTS symbols (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    base_asset TEXT NOT NULL,
+    quote_asset TEXT NOT NULL,
+    tick_size TEXT NOT NULL,
+    lot_size TEXT NOT NULL,
+    contract_type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    listed_at BIGINT NOT NULL,
+    delisted_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS symbols_exchange_symbol_timestamp_idx ON symbols (exchange, symbol, timestamp DESC);
@@ -0,0 +1,14 @@
+ALTER TABLE candles_1m ADD COLUMN IF NOT EXISTS dirty BOOLEAN NOT NULL DEFAULT false;
+
+-- timestamp is the bar the anomaly was found on, a re-import replaces the earlier finding.
+CREATE TABLE IF NOT EXISTS anomalies (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    source TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    policy TEXT NOT NULL,
+    detail TEXT NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (exchange, symbol, timestamp, source, rule)
+);
@@ -0,0 +1,17 @@
+-- candles_1m used to keep prices and volumes as doubles. This moves the table to integers
+-- scaled by price_scale and volume_scale decimal places, which is how InsertMany writes now.
+--
+-- The doubles already lost whatever precision they lost, they are rounded at 8 price and
+-- 3 volume places, enough for every binance futures tick and lot size. Bars imported after
+-- the migration keep the exact places binance sent.
+
+ALTER TABLE candles_1m
+    ALTER COLUMN open TYPE BIGINT USING round(open * 100000000)::BIGINT,
+    ALTER COLUMN high TYPE BIGINT USING round(high * 100000000)::BIGINT,
+    ALTER COLUMN low TYPE BIGINT USING round(low * 100000000)::BIGINT,
+    ALTER COLUMN close TYPE BIGINT USING round(close * 100000000)::BIGINT,
+    ALTER COLUMN volume TYPE BIGINT USING round(volume * 1000)::BIGINT,
+    ALTER COLUMN buy_volume TYPE BIGINT USING round(buy_volume * 1000)::BIGINT,
+    ALTER COLUMN sell_volume TYPE BIGINT USING round(sell_volume * 1000)::BIGINT,
+    ADD COLUMN price_scale INT NOT NULL DEFAULT 8,
+    ADD COLUMN volume_scale INT NOT NULL DEFAULT 3;
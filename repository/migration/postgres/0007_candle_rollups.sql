@@ -0,0 +1,97 @@
+-- Rollups of candles_1m kept materialised, candles_1m.InsertMany refreshes the bars it
+-- writes into and the rollup rebuild job backfills the history stored before this migration.
+
+CREATE TABLE IF NOT EXISTS candles_5m (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open BIGINT NOT NULL,
+    high BIGINT NOT NULL,
+    low BIGINT NOT NULL,
+    close BIGINT NOT NULL,
+    volume BIGINT NOT NULL,
+    buy_volume BIGINT NOT NULL,
+    sell_volume BIGINT NOT NULL,
+    price_scale INT NOT NULL,
+    volume_scale INT NOT NULL,
+    dirty BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (exchange, symbol, timestamp)
+);
+
+CREATE INDEX IF NOT EXISTS candles_5m_timestamp_idx ON candles_5m (timestamp);
+
+CREATE TABLE IF NOT EXISTS candles_15m (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open BIGINT NOT NULL,
+    high BIGINT NOT NULL,
+    low BIGINT NOT NULL,
+    close BIGINT NOT NULL,
+    volume BIGINT NOT NULL,
+    buy_volume BIGINT NOT NULL,
+    sell_volume BIGINT NOT NULL,
+    price_scale INT NOT NULL,
+    volume_scale INT NOT NULL,
+    dirty BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (exchange, symbol, timestamp)
+);
+
+CREATE INDEX IF NOT EXISTS candles_15m_timestamp_idx ON candles_15m (timestamp);
+
+CREATE TABLE IF NOT EXISTS candles_1h (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open BIGINT NOT NULL,
+    high BIGINT NOT NULL,
+    low BIGINT NOT NULL,
+    close BIGINT NOT NULL,
+    volume BIGINT NOT NULL,
+    buy_volume BIGINT NOT NULL,
+    sell_volume BIGINT NOT NULL,
+    price_scale INT NOT NULL,
+    volume_scale INT NOT NULL,
+    dirty BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (exchange, symbol, timestamp)
+);
+
+CREATE INDEX IF NOT EXISTS candles_1h_timestamp_idx ON candles_1h (timestamp);
+
+CREATE TABLE IF NOT EXISTS candles_4h (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open BIGINT NOT NULL,
+    high BIGINT NOT NULL,
+    low BIGINT NOT NULL,
+    close BIGINT NOT NULL,
+    volume BIGINT NOT NULL,
+    buy_volume BIGINT NOT NULL,
+    sell_volume BIGINT NOT NULL,
+    price_scale INT NOT NULL,
+    volume_scale INT NOT NULL,
+    dirty BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (exchange, symbol, timestamp)
+);
+
+CREATE INDEX IF NOT EXISTS candles_4h_timestamp_idx ON candles_4h (timestamp);
+
+CREATE TABLE IF NOT EXISTS candles_1d (
+    timestamp TIMESTAMPTZ NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open BIGINT NOT NULL,
+    high BIGINT NOT NULL,
+    low BIGINT NOT NULL,
+    close BIGINT NOT NULL,
+    volume BIGINT NOT NULL,
+    buy_volume BIGINT NOT NULL,
+    sell_volume BIGINT NOT NULL,
+    price_scale INT NOT NULL,
+    volume_scale INT NOT NULL,
+    dirty BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (exchange, symbol, timestamp)
+);
+
+CREATE INDEX IF NOT EXISTS candles_1d_timestamp_idx ON candles_1d (timestamp);
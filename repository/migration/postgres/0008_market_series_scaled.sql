@@ -0,0 +1,25 @@
+-- funding_rates, open_interest and price_candles_1m used to keep their values as doubles.
+-- This moves them to integers scaled by the decimal places each value carries, the same
+-- encoding candles_1m moved to in 0006.
+--
+-- The doubles are rounded at 8 places, as many as binance sends for any of them. Rows
+-- imported after the migration keep the exact places binance sent.
+
+ALTER TABLE funding_rates
+    ALTER COLUMN funding_rate TYPE BIGINT USING round(funding_rate * 100000000)::BIGINT,
+    ALTER COLUMN mark_price TYPE BIGINT USING round(mark_price * 100000000)::BIGINT,
+    ADD COLUMN rate_scale INT NOT NULL DEFAULT 8,
+    ADD COLUMN price_scale INT NOT NULL DEFAULT 8;
+
+ALTER TABLE open_interest
+    ALTER COLUMN sum_open_interest TYPE BIGINT USING round(sum_open_interest * 100000000)::BIGINT,
+    ALTER COLUMN sum_open_interest_value TYPE BIGINT USING round(sum_open_interest_value * 100000000)::BIGINT,
+    ADD COLUMN interest_scale INT NOT NULL DEFAULT 8,
+    ADD COLUMN value_scale INT NOT NULL DEFAULT 8;
+
+ALTER TABLE price_candles_1m
+    ALTER COLUMN open TYPE BIGINT USING round(open * 100000000)::BIGINT,
+    ALTER COLUMN high TYPE BIGINT USING round(high * 100000000)::BIGINT,
+    ALTER COLUMN low TYPE BIGINT USING round(low * 100000000)::BIGINT,
+    ALTER COLUMN close TYPE BIGINT USING round(close * 100000000)::BIGINT,
+    ADD COLUMN price_scale INT NOT NULL DEFAULT 8;
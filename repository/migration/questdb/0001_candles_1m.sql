@@ -0,0 +1,14 @@
+-- The candles the replay is built on, as they were first stored with double prices.
+CREATE TABLE IF NOT EXISTS candles_1m (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    open DOUBLE,
+    high DOUBLE,
+    low DOUBLE,
+    close DOUBLE,
+    volume DOUBLE,
+    buy_volume DOUBLE,
+    sell_volume DOUBLE
+) TIMESTAMP(timestamp) PARTITION BY DAY WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
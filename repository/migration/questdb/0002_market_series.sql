@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS funding_rates (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    funding_rate DOUBLE,
+    mark_price DOUBLE
+) TIMESTAMP(timestamp) PARTITION BY MONTH WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
+
+CREATE TABLE IF NOT EXISTS open_interest (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    sum_open_interest DOUBLE,
+    sum_open_interest_value DOUBLE
+) TIMESTAMP(timestamp) PARTITION BY DAY WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
+
+CREATE TABLE IF NOT EXISTS price_candles_1m (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    price_type SYMBOL,
+    open DOUBLE,
+    high DOUBLE,
+    low DOUBLE,
+    close DOUBLE
+) TIMESTAMP(timestamp) PARTITION BY DAY WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol, price_type);
@@ -0,0 +1,7 @@
+-- Every preset version is a row, reads take the latest row per name.
+CREATE TABLE IF NOT EXISTS replay_presets (
+    timestamp TIMESTAMP,
+    name SYMBOL,
+    config STRING,
+    deleted BOOLEAN
+) TIMESTAMP(timestamp) PARTITION BY YEAR WAL;
@@ -0,0 +1,14 @@
+-- Every sync appends a row per symbol, reads take the latest row per exchange and symbol.
+CREATE TABLE IF NOT EXISTS symbols (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    base_asset SYMBOL,
+    quote_asset SYMBOL,
+    tick_size STRING,
+    lot_size STRING,
+    contract_type SYMBOL,
+    status SYMBOL,
+    listed_at LONG,
+    delisted_at LONG
+) TIMESTAMP(timestamp) PARTITION BY MONTH WAL;
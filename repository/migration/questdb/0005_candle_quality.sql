@@ -0,0 +1,14 @@
+ALTER TABLE candles_1m ADD COLUMN IF NOT EXISTS dirty BOOLEAN;
+
+-- timestamp is the bar the anomaly was found on, a re-import replaces the earlier finding.
+CREATE TABLE IF NOT EXISTS anomalies (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    source SYMBOL,
+    rule SYMBOL,
+    policy SYMBOL,
+    detail STRING,
+    detected_at TIMESTAMP
+) TIMESTAMP(timestamp) PARTITION BY MONTH WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol, source, rule);
@@ -0,0 +1,44 @@
+-- candles_1m used to keep prices and volumes as doubles. This moves the table to integers
+-- scaled by price_scale and volume_scale decimal places, which is how InsertMany writes now.
+--
+-- The doubles already lost whatever precision they lost, they are rounded at 8 price and
+-- 3 volume places, enough for every binance futures tick and lot size. Bars imported after
+-- the migration keep the exact places binance sent.
+
+CREATE TABLE candles_1m_scaled (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    open LONG,
+    high LONG,
+    low LONG,
+    close LONG,
+    volume LONG,
+    buy_volume LONG,
+    sell_volume LONG,
+    price_scale INT,
+    volume_scale INT,
+    dirty BOOLEAN
+) TIMESTAMP(timestamp) PARTITION BY DAY WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
+
+INSERT INTO candles_1m_scaled
+SELECT
+    timestamp,
+    exchange,
+    symbol,
+    cast(round(open * 100000000, 0) AS LONG),
+    cast(round(high * 100000000, 0) AS LONG),
+    cast(round(low * 100000000, 0) AS LONG),
+    cast(round(close * 100000000, 0) AS LONG),
+    cast(round(volume * 1000, 0) AS LONG),
+    cast(round(buy_volume * 1000, 0) AS LONG),
+    cast(round(sell_volume * 1000, 0) AS LONG),
+    8,
+    3,
+    dirty
+FROM candles_1m;
+
+DROP TABLE candles_1m;
+
+RENAME TABLE candles_1m_scaled TO candles_1m;
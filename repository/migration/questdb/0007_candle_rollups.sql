@@ -0,0 +1,87 @@
+-- Rollups of candles_1m kept materialised, candles_1m.InsertMany refreshes the bars it
+-- writes into and the rollup rebuild job backfills the history stored before this migration.
+
+CREATE TABLE IF NOT EXISTS candles_5m (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    open LONG,
+    high LONG,
+    low LONG,
+    close LONG,
+    volume LONG,
+    buy_volume LONG,
+    sell_volume LONG,
+    price_scale INT,
+    volume_scale INT,
+    dirty BOOLEAN
+) TIMESTAMP(timestamp) PARTITION BY MONTH WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
+
+CREATE TABLE IF NOT EXISTS candles_15m (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    open LONG,
+    high LONG,
+    low LONG,
+    close LONG,
+    volume LONG,
+    buy_volume LONG,
+    sell_volume LONG,
+    price_scale INT,
+    volume_scale INT,
+    dirty BOOLEAN
+) TIMESTAMP(timestamp) PARTITION BY MONTH WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
+
+CREATE TABLE IF NOT EXISTS candles_1h (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    open LONG,
+    high LONG,
+    low LONG,
+    close LONG,
+    volume LONG,
+    buy_volume LONG,
+    sell_volume LONG,
+    price_scale INT,
+    volume_scale INT,
+    dirty BOOLEAN
+) TIMESTAMP(timestamp) PARTITION BY YEAR WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
+
+CREATE TABLE IF NOT EXISTS candles_4h (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    open LONG,
+    high LONG,
+    low LONG,
+    close LONG,
+    volume LONG,
+    buy_volume LONG,
+    sell_volume LONG,
+    price_scale INT,
+    volume_scale INT,
+    dirty BOOLEAN
+) TIMESTAMP(timestamp) PARTITION BY YEAR WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
+
+CREATE TABLE IF NOT EXISTS candles_1d (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    open LONG,
+    high LONG,
+    low LONG,
+    close LONG,
+    volume LONG,
+    buy_volume LONG,
+    sell_volume LONG,
+    price_scale INT,
+    volume_scale INT,
+    dirty BOOLEAN
+) TIMESTAMP(timestamp) PARTITION BY YEAR WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
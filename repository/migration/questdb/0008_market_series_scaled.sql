@@ -0,0 +1,88 @@
+-- funding_rates, open_interest and price_candles_1m used to keep their values as doubles.
+-- This moves them to integers scaled by the decimal places each value carries, the same
+-- encoding candles_1m moved to in 0006.
+--
+-- The doubles are rounded at 8 places, as many as binance sends for any of them. Rows
+-- imported after the migration keep the exact places binance sent.
+
+CREATE TABLE funding_rates_scaled (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    funding_rate LONG,
+    mark_price LONG,
+    rate_scale INT,
+    price_scale INT
+) TIMESTAMP(timestamp) PARTITION BY MONTH WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
+
+INSERT INTO funding_rates_scaled
+SELECT
+    timestamp,
+    exchange,
+    symbol,
+    cast(round(funding_rate * 100000000, 0) AS LONG),
+    cast(round(mark_price * 100000000, 0) AS LONG),
+    8,
+    8
+FROM funding_rates;
+
+DROP TABLE funding_rates;
+
+RENAME TABLE funding_rates_scaled TO funding_rates;
+
+CREATE TABLE open_interest_scaled (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    sum_open_interest LONG,
+    sum_open_interest_value LONG,
+    interest_scale INT,
+    value_scale INT
+) TIMESTAMP(timestamp) PARTITION BY DAY WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol);
+
+INSERT INTO open_interest_scaled
+SELECT
+    timestamp,
+    exchange,
+    symbol,
+    cast(round(sum_open_interest * 100000000, 0) AS LONG),
+    cast(round(sum_open_interest_value * 100000000, 0) AS LONG),
+    8,
+    8
+FROM open_interest;
+
+DROP TABLE open_interest;
+
+RENAME TABLE open_interest_scaled TO open_interest;
+
+CREATE TABLE price_candles_1m_scaled (
+    timestamp TIMESTAMP,
+    exchange SYMBOL,
+    symbol SYMBOL,
+    price_type SYMBOL,
+    open LONG,
+    high LONG,
+    low LONG,
+    close LONG,
+    price_scale INT
+) TIMESTAMP(timestamp) PARTITION BY DAY WAL
+DEDUP UPSERT KEYS(timestamp, exchange, symbol, price_type);
+
+INSERT INTO price_candles_1m_scaled
+SELECT
+    timestamp,
+    exchange,
+    symbol,
+    price_type,
+    cast(round(open * 100000000, 0) AS LONG),
+    cast(round(high * 100000000, 0) AS LONG),
+    cast(round(low * 100000000, 0) AS LONG),
+    cast(round(close * 100000000, 0) AS LONG),
+    8
+FROM price_candles_1m;
+
+DROP TABLE price_candles_1m;
+
+RENAME TABLE price_candles_1m_scaled TO price_candles_1m;
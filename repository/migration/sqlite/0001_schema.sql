@@ -0,0 +1,88 @@
+-- The sqlite backend starts at the current schema, timestamps are unix seconds except the
+-- ones the entities carry in milliseconds, decimals are text so every place survives.
+
+CREATE TABLE IF NOT EXISTS candles_1m (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open TEXT NOT NULL,
+    high TEXT NOT NULL,
+    low TEXT NOT NULL,
+    close TEXT NOT NULL,
+    volume TEXT NOT NULL,
+    buy_volume TEXT NOT NULL,
+    sell_volume TEXT NOT NULL,
+    dirty INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (exchange, symbol, timestamp)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS candles_1m_timestamp_idx ON candles_1m (timestamp);
+
+CREATE TABLE IF NOT EXISTS funding_rates (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    funding_rate TEXT NOT NULL,
+    mark_price TEXT NOT NULL,
+    PRIMARY KEY (exchange, symbol, timestamp)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS open_interest (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    sum_open_interest TEXT NOT NULL,
+    sum_open_interest_value TEXT NOT NULL,
+    PRIMARY KEY (exchange, symbol, timestamp)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS price_candles_1m (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    price_type TEXT NOT NULL,
+    open TEXT NOT NULL,
+    high TEXT NOT NULL,
+    low TEXT NOT NULL,
+    close TEXT NOT NULL,
+    PRIMARY KEY (exchange, symbol, price_type, timestamp)
+) WITHOUT ROWID;
+
+-- Every preset version is a row, reads take the latest row per name.
+CREATE TABLE IF NOT EXISTS replay_presets (
+    timestamp INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    config TEXT NOT NULL,
+    deleted INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS replay_presets_name_timestamp_idx ON replay_presets (name, timestamp);
+
+-- Every sync appends a row per symbol, reads take the latest row per exchange and symbol.
+CREATE TABLE IF NOT EXISTS symbols (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    base_asset TEXT NOT NULL,
+    quote_asset TEXT NOT NULL,
+    tick_size TEXT NOT NULL,
+    lot_size TEXT NOT NULL,
+    contract_type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    listed_at INTEGER NOT NULL,
+    delisted_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS symbols_exchange_symbol_timestamp_idx ON symbols (exchange, symbol, timestamp);
+
+CREATE TABLE IF NOT EXISTS anomalies (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    source TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    policy TEXT NOT NULL,
+    detail TEXT NOT NULL,
+    detected_at INTEGER NOT NULL,
+    PRIMARY KEY (exchange, symbol, timestamp, source, rule)
+) WITHOUT ROWID;
@@ -0,0 +1,87 @@
+-- Rollups of candles_1m kept materialised, candles_1m.InsertMany refreshes the bars it
+-- writes into and the rollup rebuild job backfills the history stored before this migration.
+
+CREATE TABLE IF NOT EXISTS candles_5m (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open TEXT NOT NULL,
+    high TEXT NOT NULL,
+    low TEXT NOT NULL,
+    close TEXT NOT NULL,
+    volume TEXT NOT NULL,
+    buy_volume TEXT NOT NULL,
+    sell_volume TEXT NOT NULL,
+    dirty INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (exchange, symbol, timestamp)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS candles_5m_timestamp_idx ON candles_5m (timestamp);
+
+CREATE TABLE IF NOT EXISTS candles_15m (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open TEXT NOT NULL,
+    high TEXT NOT NULL,
+    low TEXT NOT NULL,
+    close TEXT NOT NULL,
+    volume TEXT NOT NULL,
+    buy_volume TEXT NOT NULL,
+    sell_volume TEXT NOT NULL,
+    dirty INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (exchange, symbol, timestamp)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS candles_15m_timestamp_idx ON candles_15m (timestamp);
+
+CREATE TABLE IF NOT EXISTS candles_1h (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open TEXT NOT NULL,
+    high TEXT NOT NULL,
+    low TEXT NOT NULL,
+    close TEXT NOT NULL,
+    volume TEXT NOT NULL,
+    buy_volume TEXT NOT NULL,
+    sell_volume TEXT NOT NULL,
+    dirty INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (exchange, symbol, timestamp)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS candles_1h_timestamp_idx ON candles_1h (timestamp);
+
+CREATE TABLE IF NOT EXISTS candles_4h (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open TEXT NOT NULL,
+    high TEXT NOT NULL,
+    low TEXT NOT NULL,
+    close TEXT NOT NULL,
+    volume TEXT NOT NULL,
+    buy_volume TEXT NOT NULL,
+    sell_volume TEXT NOT NULL,
+    dirty INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (exchange, symbol, timestamp)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS candles_4h_timestamp_idx ON candles_4h (timestamp);
+
+CREATE TABLE IF NOT EXISTS candles_1d (
+    timestamp INTEGER NOT NULL,
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open TEXT NOT NULL,
+    high TEXT NOT NULL,
+    low TEXT NOT NULL,
+    close TEXT NOT NULL,
+    volume TEXT NOT NULL,
+    buy_volume TEXT NOT NULL,
+    sell_volume TEXT NOT NULL,
+    dirty INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (exchange, symbol, timestamp)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS candles_1d_timestamp_idx ON candles_1d (timestamp);
@@ -0,0 +1,265 @@
+package quest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"michaelyusak/go-quant-replay-engine.git/repository/rollup"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type candles struct {
+	db      *sql.DB
+	dialect migration.Dialect
+}
+
+func NewCandles(db *sql.DB, dialect migration.Dialect) *candles {
+	return &candles{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+func (r *candles) GetCandles(ctx context.Context, interval entity.CandleInterval, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error) {
+	table, err := candlesTable(interval)
+	if err != nil {
+		return []entity.Candle{}, fmt.Errorf("[repository][quest][candles][GetCandles][candlesTable] error: %w", err)
+	}
+
+	candles, err := selectCandles(ctx, r.db, table, symbols, start, end, after, limit)
+	if err != nil {
+		return []entity.Candle{}, fmt.Errorf("[repository][quest][candles][GetCandles][selectCandles] error: %w", err)
+	}
+
+	return candles, nil
+}
+
+// RebuildRollups recomputes every rollup bar of the whole days within [start, end] from
+// the stored 1m candles, a day at a time. It returns how many bars were written.
+func (r *candles) RebuildRollups(ctx context.Context, start, end time.Time) (int64, error) {
+	from, to := rollup.Span(start, end)
+
+	var written int64
+
+	for day := from; day.Before(to); day = day.Add(24 * time.Hour) {
+		stored, err := selectCandles(ctx, r.db, "candles_1m", nil, day, day.Add(24*time.Hour-time.Second), nil, 0)
+		if err != nil {
+			return written, fmt.Errorf("[repository][quest][candles][RebuildRollups][selectCandles] error: %w", err)
+		}
+
+		for _, interval := range entity.RollupIntervals {
+			bars := rollup.Aggregate(stored, interval)
+
+			err = insertCandles(ctx, r.db, r.dialect, rollupTable(interval), bars)
+			if err != nil {
+				return written, fmt.Errorf("[repository][quest][candles][RebuildRollups][insertCandles] %s error: %w", interval, err)
+			}
+
+			written += int64(len(bars))
+		}
+	}
+
+	return written, nil
+}
+
+// refreshRollups rewrites the rollup bars the written 1m candles fall in, reading back
+// the 1m candles of the whole days they touch.
+func refreshRollups(ctx context.Context, db *sql.DB, dialect migration.Dialect, written []entity.Candle) error {
+	if len(written) == 0 {
+		return nil
+	}
+
+	start, end, symbols := rollup.Window(written)
+
+	stored, err := selectCandles(ctx, db, "candles_1m", symbols, start, end.Add(-time.Second), nil, 0)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][refreshRollups][selectCandles] error: %w", err)
+	}
+
+	for interval, bars := range rollup.Refresh(written, stored) {
+		err = insertCandles(ctx, db, dialect, rollupTable(interval), bars)
+		if err != nil {
+			return fmt.Errorf("[repository][quest][refreshRollups][insertCandles] %s error: %w", interval, err)
+		}
+	}
+
+	return nil
+}
+
+func candlesTable(interval entity.CandleInterval) (string, error) {
+	if interval.Duration() == 0 {
+		return "", fmt.Errorf("no candles of interval '%s' are kept", interval)
+	}
+
+	return rollupTable(interval), nil
+}
+
+func rollupTable(interval entity.CandleInterval) string {
+	return "candles_" + string(interval)
+}
+
+var (
+	candleKeys    = []string{"exchange", "symbol", "timestamp"}
+	candleColumns = []string{"open", "high", "low", "close", "volume", "buy_volume", "sell_volume", "price_scale", "volume_scale", "dirty"}
+)
+
+// insertBatchRows is how many rows an insert statement holds, at 13 binds a row it
+// stays well within the 65535 binds of the pg wire protocol.
+const insertBatchRows = 1000
+
+// insertCandles stores prices and volumes as integers scaled by the decimal places the
+// candle carries, price_scale for the prices and volume_scale for the volumes.
+func insertCandles(ctx context.Context, db *sql.DB, dialect migration.Dialect, table string, candles []entity.Candle) error {
+	for len(candles) > 0 {
+		batch := candles[:min(len(candles), insertBatchRows)]
+		candles = candles[len(batch):]
+
+		err := insertCandlesBatch(ctx, db, dialect, table, batch)
+		if err != nil {
+			return fmt.Errorf("[repository][quest][insertCandles][insertCandlesBatch] error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func insertCandlesBatch(ctx context.Context, db *sql.DB, dialect migration.Dialect, table string, candles []entity.Candle) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "INSERT INTO %s (timestamp, exchange, symbol, open, high, low, close, volume, buy_volume, sell_volume, price_scale, volume_scale, dirty) VALUES ", table)
+
+	vals := make([]any, 0, len(candles)*13)
+	for i, candle := range candles {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*13+1, i*13+2, i*13+3, i*13+4, i*13+5, i*13+6, i*13+7, i*13+8, i*13+9, i*13+10, i*13+11, i*13+12, i*13+13)
+
+		priceScale := common.DecimalPlaces(candle.Open, candle.High, candle.Low, candle.Close)
+		volumeScale := common.DecimalPlaces(candle.Volume.Total, candle.Volume.Buy, candle.Volume.Sell)
+
+		scaled := make([]any, 0, 7)
+		for _, field := range []struct {
+			value decimal.Decimal
+			scale int32
+		}{
+			{candle.Open, priceScale},
+			{candle.High, priceScale},
+			{candle.Low, priceScale},
+			{candle.Close, priceScale},
+			{candle.Volume.Total, volumeScale},
+			{candle.Volume.Buy, volumeScale},
+			{candle.Volume.Sell, volumeScale},
+		} {
+			v, err := common.ToScaled(field.value, field.scale)
+			if err != nil {
+				return fmt.Errorf("[repository][quest][insertCandlesBatch][common.ToScaled] %s:%s at %d error: %w", candle.Exchange, candle.Pair, candle.Epoch, err)
+			}
+
+			scaled = append(scaled, v)
+		}
+
+		vals = append(vals, time.Unix(candle.Epoch, 0), candle.Exchange, candle.Pair)
+		vals = append(vals, scaled...)
+		vals = append(vals, priceScale, volumeScale, candle.Dirty)
+	}
+
+	sb.WriteString(upsertClause(dialect, candleKeys, candleColumns))
+
+	_, err := db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][insertCandlesBatch][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// selectCandles reads candles in (timestamp, exchange, symbol) order, the window applies
+// only when both ends are set and after, when set, keeps the keys past it.
+func selectCandles(ctx context.Context, db *sql.DB, table string, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SELECT timestamp, open, high, low, close, volume, buy_volume, sell_volume, price_scale, volume_scale, exchange, symbol, dirty FROM %s WHERE ", table)
+
+	args := []any{}
+
+	args = writeSymbolsFilter(&sb, args, symbols)
+
+	if start.Unix() > 0 && end.Unix() > 0 {
+		args = append(args, start, end)
+		fmt.Fprintf(&sb, "timestamp BETWEEN $%d AND $%d AND ", len(args)-1, len(args))
+	}
+
+	if after != nil {
+		args = append(args, time.Unix(after.Epoch, 0), after.Exchange, after.Pair)
+		ts, exchange, pair := len(args)-2, len(args)-1, len(args)
+		fmt.Fprintf(&sb, "(timestamp > $%d OR (timestamp = $%d AND (exchange > $%d OR (exchange = $%d AND symbol > $%d)))) AND ", ts, ts, exchange, exchange, pair)
+	}
+
+	sb.WriteString("1 = 1 ORDER BY timestamp ASC, exchange ASC, symbol ASC ")
+
+	if limit > 0 {
+		args = append(args, limit)
+		fmt.Fprintf(&sb, "LIMIT $%d", len(args))
+	}
+
+	rows, err := db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []entity.Candle{}, nil
+		}
+
+		return []entity.Candle{}, fmt.Errorf("[repository][quest][selectCandles][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	candles := []entity.Candle{}
+
+	for rows.Next() {
+		var candle entity.Candle
+		var candleTs time.Time
+		var openScaled, highScaled, lowScaled, closeScaled, volTotalScaled, volBuyScaled, volSellScaled int64
+		var priceScale, volumeScale int32
+
+		err := rows.Scan(
+			&candleTs,
+			&openScaled,
+			&highScaled,
+			&lowScaled,
+			&closeScaled,
+			&volTotalScaled,
+			&volBuyScaled,
+			&volSellScaled,
+			&priceScale,
+			&volumeScale,
+			&candle.Exchange,
+			&candle.Pair,
+			&candle.Dirty,
+		)
+		if err != nil {
+			return []entity.Candle{}, fmt.Errorf("[repository][quest][selectCandles][rows.Scan] error: %w", err)
+		}
+
+		candle.Epoch = candleTs.Unix()
+		candle.Open = common.FromScaled(openScaled, priceScale)
+		candle.High = common.FromScaled(highScaled, priceScale)
+		candle.Low = common.FromScaled(lowScaled, priceScale)
+		candle.Close = common.FromScaled(closeScaled, priceScale)
+		candle.Volume = entity.CandleVolume{
+			Total: common.FromScaled(volTotalScaled, volumeScale),
+			Buy:   common.FromScaled(volBuyScaled, volumeScale),
+			Sell:  common.FromScaled(volSellScaled, volumeScale),
+		}
+		candle.Symbol = fmt.Sprintf("%s:%s", candle.Exchange, candle.Pair)
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
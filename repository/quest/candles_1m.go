@@ -3,49 +3,43 @@ package quest
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/common"
 	"michaelyusak/go-quant-replay-engine.git/entity"
-	"strings"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type candles1m struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect migration.Dialect
 }
 
-func NewCandles1m(db *sql.DB) *candles1m {
+func NewCandles1m(db *sql.DB, dialect migration.Dialect) *candles1m {
 	return &candles1m{
-		db: db,
+		db:      db,
+		dialect: dialect,
 	}
 }
 
+// InsertMany also refreshes the rollup bars the candles fall in.
 func (r *candles1m) InsertMany(ctx context.Context, candles []entity.Candle) error {
-	var sb strings.Builder
-	sb.WriteString("INSERT INTO candles_1m (timestamp, exchange, symbol, open, high, low, close, volume, buy_volume, sell_volume) VALUES ")
-
-	vals := make([]any, 0, len(candles)*8)
-	for i, candle := range candles {
-		if i > 0 {
-			sb.WriteString(",")
-		}
-
-		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*10+1, i*10+2, i*10+3, i*10+4, i*10+5, i*10+6, i*10+7, i*10+8, i*10+9, i*10+10)
-
-		openFl, _ := candle.Open.Float64()
-		highFl, _ := candle.High.Float64()
-		lowFl, _ := candle.Low.Float64()
-		closeFl, _ := candle.Close.Float64()
-		volTotalFl, _ := candle.Volume.Total.Float64()
-		volBuyFl, _ := candle.Volume.Buy.Float64()
-		volSellFl, _ := candle.Volume.Sell.Float64()
+	err := repository.CheckStorable(candles)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][candles1m][InsertMany][repository.CheckStorable] error: %w", err)
+	}
 
-		vals = append(vals, time.Unix(candle.Epoch, 0), candle.Exchange, candle.Pair, openFl, highFl, lowFl, closeFl, volTotalFl, volBuyFl, volSellFl)
+	err = insertCandles(ctx, r.db, r.dialect, "candles_1m", candles)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][candles1m][InsertMany][insertCandles] error: %w", err)
 	}
 
-	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	err = refreshRollups(ctx, r.db, r.dialect, candles)
 	if err != nil {
-		return fmt.Errorf("[repository][quest][candles1m][InsertMany][db.ExecContext] error: %w", err)
+		return fmt.Errorf("[repository][quest][candles1m][InsertMany][refreshRollups] error: %w", err)
 	}
 
 	return nil
@@ -70,84 +64,43 @@ func (r *candles1m) CountCandles1m(ctx context.Context, exchange, symbol string,
 	return count, nil
 }
 
-func (r *candles1m) GetCandles(ctx context.Context, symbols []string, cursor, end time.Time, limit int) ([]entity.Candle, error) {
-	var sb strings.Builder
-	sb.WriteString("SELECT timestamp, open, high, low, close, volume, buy_volume, sell_volume, exchange, symbol FROM candles_1m WHERE ")
-
-	args := []any{}
-
-	if len(symbols) > 0 {
-		sb.WriteString("(")
-
-		for i, symbol := range symbols {
-			arr := strings.Split(symbol, ":")
-			if len(arr) != 2 {
-				continue
-			}
-
-			exchange := arr[0]
-			pair := arr[1]
-
-			args = append(args, exchange, pair)
-			fmt.Fprintf(&sb, "(exchange = $%d AND symbol = $%d) ", len(args)-1, len(args))
-
-			if i < len(symbols)-1 {
-				sb.WriteString("OR ")
-			} else {
-				sb.WriteString(") AND ")
-			}
-		}
-	}
-
-	if cursor.Unix() > 0 && end.Unix() > 0 {
-		args = append(args, cursor, end)
-		fmt.Fprintf(&sb, "timestamp BETWEEN $%d AND $%d ", len(args)-1, len(args))
-	}
-
-	sb.WriteString("ORDER BY timestamp ASC ")
-
-	if limit > 0 {
-		args = append(args, limit)
-		fmt.Fprintf(&sb, "LIMIT $%d", len(args))
-	}
+// GetQuoteVolumes sums close * volume of every symbol of the exchange within [start, end),
+// keyed by exchange:pair. The products are summed as decimals here, a float sum in the
+// database would lose the exact values the scaled columns keep.
+func (r *candles1m) GetQuoteVolumes(ctx context.Context, exchange string, start, end time.Time) (map[string]decimal.Decimal, error) {
+	q := `
+		SELECT symbol, close, volume, price_scale, volume_scale
+		FROM candles_1m
+		WHERE exchange = $1
+			AND timestamp >= $2
+			AND timestamp < $3
+	`
 
-	rows, err := r.db.QueryContext(ctx, sb.String(), args...)
+	rows, err := r.db.QueryContext(ctx, q, exchange, start, end)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return []entity.Candle{}, nil
-		}
-
-		return []entity.Candle{}, fmt.Errorf("[repository][quest][candles1m][GetCandles][db.QueryContext] error: %w", err)
+		return nil, fmt.Errorf("[repository][quest][candles1m][GetQuoteVolumes][db.QueryContext] error: %w", err)
 	}
 	defer rows.Close()
 
-	candles := []entity.Candle{}
+	volumes := map[string]decimal.Decimal{}
 
 	for rows.Next() {
-		var candle entity.Candle
-		var candleTs time.Time
-
-		err := rows.Scan(
-			&candleTs,
-			&candle.Open,
-			&candle.High,
-			&candle.Low,
-			&candle.Close,
-			&candle.Volume.Total,
-			&candle.Volume.Buy,
-			&candle.Volume.Sell,
-			&candle.Exchange,
-			&candle.Pair,
-		)
+		var pair string
+		var close, volume int64
+		var priceScale, volumeScale int32
+
+		err := rows.Scan(&pair, &close, &volume, &priceScale, &volumeScale)
 		if err != nil {
-			return []entity.Candle{}, fmt.Errorf("[repository][quest][candles1m][GetCandles][rows.Scan] error: %w", err)
+			return nil, fmt.Errorf("[repository][quest][candles1m][GetQuoteVolumes][rows.Scan] error: %w", err)
 		}
 
-		candle.Epoch = candleTs.Unix()
-		candle.Symbol = fmt.Sprintf("%s:%s", candle.Exchange, candle.Pair)
+		symbol := fmt.Sprintf("%s:%s", exchange, pair)
+		volumes[symbol] = volumes[symbol].Add(common.FromScaled(close, priceScale).Mul(common.FromScaled(volume, volumeScale)))
+	}
 
-		candles = append(candles, candle)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("[repository][quest][candles1m][GetQuoteVolumes][rows.Err] error: %w", err)
 	}
 
-	return candles, nil
+	return volumes, nil
 }
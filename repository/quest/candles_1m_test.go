@@ -0,0 +1,82 @@
+package quest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/shopspring/decimal"
+)
+
+// TestCandles1mRoundTrip needs a questdb with the candles_1m table migrated, it is
+// skipped unless QUESTDB_TEST_DSN points at one.
+func TestCandles1mRoundTrip(t *testing.T) {
+	dsn := os.Getenv("QUESTDB_TEST_DSN")
+	if dsn == "" {
+		t.Skip("QUESTDB_TEST_DSN is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	repo := NewCandles1m(db, migration.DialectQuestDB)
+	candles := NewCandles(db, migration.DialectQuestDB)
+
+	pair := fmt.Sprintf("ROUNDTRIP%dUSDT", time.Now().UnixNano())
+	epoch := time.Now().Truncate(time.Minute).Unix()
+
+	// open, high, low, close, volume, buy volume as binance sends them
+	raw := []string{"0.0000012340", "0.0000012350", "0.0000012290", "0.0000012300", "98765432101234", "12345678901234"}
+
+	in := entity.Candle{
+		Epoch:    epoch,
+		Exchange: "binance",
+		Pair:     pair,
+		Open:     decimal.RequireFromString(raw[0]),
+		High:     decimal.RequireFromString(raw[1]),
+		Low:      decimal.RequireFromString(raw[2]),
+		Close:    decimal.RequireFromString(raw[3]),
+		Volume: entity.CandleVolume{
+			Total: decimal.RequireFromString(raw[4]),
+			Buy:   decimal.RequireFromString(raw[5]),
+		},
+	}
+	in.Volume.Sell = in.Volume.Total.Sub(in.Volume.Buy)
+
+	err = repo.InsertMany(ctx, []entity.Candle{in})
+	if err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+
+	var out []entity.Candle
+	// questdb applies WAL writes asynchronously
+	for i := 0; i < 50 && len(out) == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+
+		out, err = candles.GetCandles(ctx, entity.CandleInterval1m, []string{"binance:" + pair}, time.Unix(epoch, 0), time.Unix(epoch, 0), nil, 1)
+		if err != nil {
+			t.Fatalf("GetCandles error: %v", err)
+		}
+	}
+
+	if len(out) != 1 {
+		t.Fatalf("GetCandles returned %d candles, want 1", len(out))
+	}
+
+	got := []decimal.Decimal{out[0].Open, out[0].High, out[0].Low, out[0].Close, out[0].Volume.Total, out[0].Volume.Buy}
+	for i, d := range got {
+		if s := d.StringFixed(-d.Exponent()); s != raw[i] {
+			t.Errorf("field %d came back as %s, want %s", i, s, raw[i])
+		}
+	}
+}
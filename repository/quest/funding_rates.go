@@ -0,0 +1,110 @@
+package quest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"strings"
+	"time"
+)
+
+type fundingRates struct {
+	db      *sql.DB
+	dialect migration.Dialect
+}
+
+func NewFundingRates(db *sql.DB, dialect migration.Dialect) *fundingRates {
+	return &fundingRates{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+func (r *fundingRates) InsertMany(ctx context.Context, rates []entity.FundingRate) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO funding_rates (timestamp, exchange, symbol, funding_rate, mark_price, rate_scale, price_scale) VALUES ")
+
+	vals := make([]any, 0, len(rates)*7)
+	for i, rate := range rates {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*7+1, i*7+2, i*7+3, i*7+4, i*7+5, i*7+6, i*7+7)
+
+		rateScale := common.DecimalPlaces(rate.FundingRate)
+		priceScale := common.DecimalPlaces(rate.MarkPrice)
+
+		rateScaled, err := common.ToScaled(rate.FundingRate, rateScale)
+		if err != nil {
+			return fmt.Errorf("[repository][quest][fundingRates][InsertMany][common.ToScaled] %s:%s at %d error: %w", rate.Exchange, rate.Pair, rate.Epoch, err)
+		}
+
+		markPriceScaled, err := common.ToScaled(rate.MarkPrice, priceScale)
+		if err != nil {
+			return fmt.Errorf("[repository][quest][fundingRates][InsertMany][common.ToScaled] %s:%s at %d error: %w", rate.Exchange, rate.Pair, rate.Epoch, err)
+		}
+
+		vals = append(vals, time.Unix(rate.Epoch, 0), rate.Exchange, rate.Pair, rateScaled, markPriceScaled, rateScale, priceScale)
+	}
+
+	sb.WriteString(upsertClause(r.dialect, []string{"exchange", "symbol", "timestamp"}, []string{"funding_rate", "mark_price", "rate_scale", "price_scale"}))
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][fundingRates][InsertMany][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// GetFundingRates returns the funding rates within [start, end) ordered by timestamp.
+func (r *fundingRates) GetFundingRates(ctx context.Context, symbols []string, start, end time.Time) ([]entity.FundingRate, error) {
+	var sb strings.Builder
+	sb.WriteString("SELECT timestamp, funding_rate, mark_price, rate_scale, price_scale, exchange, symbol FROM funding_rates WHERE ")
+
+	args := writeSymbolsFilter(&sb, []any{}, symbols)
+
+	args = append(args, start, end)
+	fmt.Fprintf(&sb, "timestamp >= $%d AND timestamp < $%d ORDER BY timestamp ASC", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return []entity.FundingRate{}, fmt.Errorf("[repository][quest][fundingRates][GetFundingRates][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []entity.FundingRate{}
+
+	for rows.Next() {
+		var rate entity.FundingRate
+		var rateTs time.Time
+		var rateScaled, markPriceScaled int64
+		var rateScale, priceScale int32
+
+		err := rows.Scan(
+			&rateTs,
+			&rateScaled,
+			&markPriceScaled,
+			&rateScale,
+			&priceScale,
+			&rate.Exchange,
+			&rate.Pair,
+		)
+		if err != nil {
+			return []entity.FundingRate{}, fmt.Errorf("[repository][quest][fundingRates][GetFundingRates][rows.Scan] error: %w", err)
+		}
+
+		rate.Epoch = rateTs.Unix()
+		rate.FundingRate = common.FromScaled(rateScaled, rateScale)
+		rate.MarkPrice = common.FromScaled(markPriceScaled, priceScale)
+		rate.Symbol = fmt.Sprintf("%s:%s", rate.Exchange, rate.Pair)
+
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
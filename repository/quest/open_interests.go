@@ -0,0 +1,110 @@
+package quest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"strings"
+	"time"
+)
+
+type openInterests struct {
+	db      *sql.DB
+	dialect migration.Dialect
+}
+
+func NewOpenInterests(db *sql.DB, dialect migration.Dialect) *openInterests {
+	return &openInterests{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+func (r *openInterests) InsertMany(ctx context.Context, openInterests []entity.OpenInterest) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO open_interest (timestamp, exchange, symbol, sum_open_interest, sum_open_interest_value, interest_scale, value_scale) VALUES ")
+
+	vals := make([]any, 0, len(openInterests)*7)
+	for i, oi := range openInterests {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*7+1, i*7+2, i*7+3, i*7+4, i*7+5, i*7+6, i*7+7)
+
+		interestScale := common.DecimalPlaces(oi.OpenInterest)
+		valueScale := common.DecimalPlaces(oi.OpenInterestValue)
+
+		oiScaled, err := common.ToScaled(oi.OpenInterest, interestScale)
+		if err != nil {
+			return fmt.Errorf("[repository][quest][openInterests][InsertMany][common.ToScaled] %s:%s at %d error: %w", oi.Exchange, oi.Pair, oi.Epoch, err)
+		}
+
+		oiValueScaled, err := common.ToScaled(oi.OpenInterestValue, valueScale)
+		if err != nil {
+			return fmt.Errorf("[repository][quest][openInterests][InsertMany][common.ToScaled] %s:%s at %d error: %w", oi.Exchange, oi.Pair, oi.Epoch, err)
+		}
+
+		vals = append(vals, time.Unix(oi.Epoch, 0), oi.Exchange, oi.Pair, oiScaled, oiValueScaled, interestScale, valueScale)
+	}
+
+	sb.WriteString(upsertClause(r.dialect, []string{"exchange", "symbol", "timestamp"}, []string{"sum_open_interest", "sum_open_interest_value", "interest_scale", "value_scale"}))
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][openInterests][InsertMany][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// GetOpenInterests returns the open interest snapshots within [start, end) ordered by timestamp.
+func (r *openInterests) GetOpenInterests(ctx context.Context, symbols []string, start, end time.Time) ([]entity.OpenInterest, error) {
+	var sb strings.Builder
+	sb.WriteString("SELECT timestamp, sum_open_interest, sum_open_interest_value, interest_scale, value_scale, exchange, symbol FROM open_interest WHERE ")
+
+	args := writeSymbolsFilter(&sb, []any{}, symbols)
+
+	args = append(args, start, end)
+	fmt.Fprintf(&sb, "timestamp >= $%d AND timestamp < $%d ORDER BY timestamp ASC", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return []entity.OpenInterest{}, fmt.Errorf("[repository][quest][openInterests][GetOpenInterests][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	openInterests := []entity.OpenInterest{}
+
+	for rows.Next() {
+		var oi entity.OpenInterest
+		var oiTs time.Time
+		var oiScaled, oiValueScaled int64
+		var interestScale, valueScale int32
+
+		err := rows.Scan(
+			&oiTs,
+			&oiScaled,
+			&oiValueScaled,
+			&interestScale,
+			&valueScale,
+			&oi.Exchange,
+			&oi.Pair,
+		)
+		if err != nil {
+			return []entity.OpenInterest{}, fmt.Errorf("[repository][quest][openInterests][GetOpenInterests][rows.Scan] error: %w", err)
+		}
+
+		oi.Epoch = oiTs.Unix()
+		oi.OpenInterest = common.FromScaled(oiScaled, interestScale)
+		oi.OpenInterestValue = common.FromScaled(oiValueScaled, valueScale)
+		oi.Symbol = fmt.Sprintf("%s:%s", oi.Exchange, oi.Pair)
+
+		openInterests = append(openInterests, oi)
+	}
+
+	return openInterests, nil
+}
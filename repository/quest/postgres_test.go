@@ -0,0 +1,278 @@
+package quest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"michaelyusak/go-quant-replay-engine.git/repository/repositorytest"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/shopspring/decimal"
+)
+
+// openPostgres migrates a schema of its own on the postgres POSTGRES_TEST_DSN points at,
+// the test is skipped without one.
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("replay_test_%d", time.Now().UnixNano())
+
+	// the search path is set per connection, a single one keeps it
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, "CREATE SCHEMA "+schema)
+	if err != nil {
+		t.Fatalf("create schema error: %v", err)
+	}
+	t.Cleanup(func() { db.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+
+	_, err = db.ExecContext(ctx, "SET search_path TO "+schema)
+	if err != nil {
+		t.Fatalf("set search_path error: %v", err)
+	}
+
+	migrator, err := migration.NewMigrator(db, migration.DialectPostgres)
+	if err != nil {
+		t.Fatalf("NewMigrator error: %v", err)
+	}
+
+	_, err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("migrator.Up error: %v", err)
+	}
+
+	return db
+}
+
+func TestPostgresReimportReplacesRows(t *testing.T) {
+	db := openPostgres(t)
+	ctx := context.Background()
+	dialect := migration.DialectPostgres
+
+	candles1m := NewCandles1m(db, dialect)
+	candles := NewCandles(db, dialect)
+
+	epoch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	bar := func(close string) entity.Candle {
+		return entity.Candle{
+			Epoch:    epoch,
+			Exchange: "binance",
+			Pair:     "BTCUSDT",
+			Open:     decimal.RequireFromString("43000.10"),
+			High:     decimal.RequireFromString("43100.00"),
+			Low:      decimal.RequireFromString("42900.00"),
+			Close:    decimal.RequireFromString(close),
+			Volume: entity.CandleVolume{
+				Total: decimal.RequireFromString("12.500"),
+				Buy:   decimal.RequireFromString("7.250"),
+				Sell:  decimal.RequireFromString("5.250"),
+			},
+		}
+	}
+
+	// the second import of the bar replaces the first one and its rollups
+	for _, close := range []string{"43005.70", "43050.20"} {
+		err := candles1m.InsertMany(ctx, []entity.Candle{bar(close)})
+		if err != nil {
+			t.Fatalf("candles1m.InsertMany error: %v", err)
+		}
+	}
+
+	for _, interval := range []entity.CandleInterval{entity.CandleInterval1m, entity.CandleInterval1d} {
+		got, err := candles.GetCandles(ctx, interval, []string{"binance:BTCUSDT"}, time.Unix(epoch, 0), time.Unix(epoch, 0), nil, 0)
+		if err != nil {
+			t.Fatalf("GetCandles %s error: %v", interval, err)
+		}
+
+		if len(got) != 1 || got[0].Close.String() != "43050.2" {
+			t.Fatalf("GetCandles %s = %+v, want the re-imported bar", interval, got)
+		}
+	}
+
+	_, err := candles.RebuildRollups(ctx, time.Unix(epoch, 0), time.Unix(epoch, 0).Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("RebuildRollups error: %v", err)
+	}
+
+	fundingRates := NewFundingRates(db, dialect)
+	for _, rate := range []string{"0.00010000", "0.00012500"} {
+		err := fundingRates.InsertMany(ctx, []entity.FundingRate{{
+			Epoch:       epoch,
+			Exchange:    "binance",
+			Pair:        "BTCUSDT",
+			FundingRate: decimal.RequireFromString(rate),
+			MarkPrice:   decimal.RequireFromString("43000.12345678"),
+		}})
+		if err != nil {
+			t.Fatalf("fundingRates.InsertMany error: %v", err)
+		}
+	}
+
+	rates, err := fundingRates.GetFundingRates(ctx, []string{"binance:BTCUSDT"}, time.Unix(epoch, 0), time.Unix(epoch+1, 0))
+	if err != nil {
+		t.Fatalf("GetFundingRates error: %v", err)
+	}
+	if len(rates) != 1 || rates[0].FundingRate.String() != "0.000125" || rates[0].MarkPrice.String() != "43000.12345678" {
+		t.Fatalf("GetFundingRates = %+v, want the re-imported rate", rates)
+	}
+
+	openInterests := NewOpenInterests(db, dialect)
+	priceCandles := NewPriceCandles1m(db, dialect)
+	anomalies := NewAnomalies(db, dialect)
+	for i := 0; i < 2; i++ {
+		err = openInterests.InsertMany(ctx, []entity.OpenInterest{{
+			Epoch:             epoch,
+			Exchange:          "binance",
+			Pair:              "BTCUSDT",
+			OpenInterest:      decimal.RequireFromString("20403.637"),
+			OpenInterestValue: decimal.RequireFromString("150570784.07809979"),
+		}})
+		if err != nil {
+			t.Fatalf("openInterests.InsertMany error: %v", err)
+		}
+
+		err = priceCandles.InsertMany(ctx, []entity.PriceCandle{{
+			Epoch:     epoch,
+			Exchange:  "binance",
+			Pair:      "BTCUSDT",
+			PriceType: entity.PriceTypeMark,
+			Open:      decimal.RequireFromString("43000.1"),
+			High:      decimal.RequireFromString("43100"),
+			Low:       decimal.RequireFromString("42900"),
+			Close:     decimal.RequireFromString("43005.7"),
+		}})
+		if err != nil {
+			t.Fatalf("priceCandles.InsertMany error: %v", err)
+		}
+
+		err = anomalies.InsertMany(ctx, []entity.Anomaly{{
+			Epoch:               epoch,
+			Exchange:            "binance",
+			Pair:                "BTCUSDT",
+			Source:              entity.AnomalySourceImport,
+			Rule:                entity.AnomalyRuleExtremeWick,
+			Policy:              entity.AnomalyPolicyFlag,
+			Detail:              fmt.Sprintf("finding %d", i),
+			DetectedAtUnixMilli: time.Now().UnixMilli(),
+		}})
+		if err != nil {
+			t.Fatalf("anomalies.InsertMany error: %v", err)
+		}
+	}
+
+	interests, err := openInterests.GetOpenInterests(ctx, []string{"binance:BTCUSDT"}, time.Unix(epoch, 0), time.Unix(epoch+1, 0))
+	if err != nil {
+		t.Fatalf("GetOpenInterests error: %v", err)
+	}
+	if len(interests) != 1 || interests[0].OpenInterestValue.String() != "150570784.07809979" {
+		t.Fatalf("GetOpenInterests = %+v, want the exact value stored once", interests)
+	}
+
+	prices, err := priceCandles.GetPriceCandles(ctx, entity.PriceTypeMark, []string{"binance:BTCUSDT"}, time.Unix(epoch, 0), time.Unix(epoch+1, 0))
+	if err != nil {
+		t.Fatalf("GetPriceCandles error: %v", err)
+	}
+	if len(prices) != 1 || prices[0].Close.String() != "43005.7" {
+		t.Fatalf("GetPriceCandles = %+v, want the exact close stored once", prices)
+	}
+
+	found, err := anomalies.GetAnomalies(ctx, "binance:BTCUSDT", time.Unix(epoch, 0), time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("GetAnomalies error: %v", err)
+	}
+	if len(found) != 1 || found[0].Detail != "finding 1" {
+		t.Fatalf("GetAnomalies = %+v, want the later finding", found)
+	}
+}
+
+func TestPostgresReadsTheLatestRows(t *testing.T) {
+	db := openPostgres(t)
+	ctx := context.Background()
+	dialect := migration.DialectPostgres
+
+	presets := NewReplayPresets(db, dialect)
+	for i, speed := range []float32{1, 2} {
+		err := presets.Save(ctx, entity.ReplayPreset{
+			Name:               "fast",
+			Config:             entity.ReplayConfiguration{Symbols: []string{"binance:BTCUSDT"}, PlaybackSpeed: speed},
+			UpdatedAtUnixMilli: time.Now().Add(time.Duration(i) * time.Second).UnixMilli(),
+		})
+		if err != nil {
+			t.Fatalf("presets.Save error: %v", err)
+		}
+	}
+
+	preset, ok, err := presets.GetPreset(ctx, "fast")
+	if err != nil || !ok || preset.Config.PlaybackSpeed != 2 {
+		t.Fatalf("GetPreset = %+v, %v, %v, want the second version", preset, ok, err)
+	}
+
+	err = presets.Delete(ctx, "fast")
+	if err != nil {
+		t.Fatalf("presets.Delete error: %v", err)
+	}
+
+	all, err := presets.GetPresets(ctx)
+	if err != nil || len(all) != 0 {
+		t.Fatalf("GetPresets = %+v, %v, want none after the delete", all, err)
+	}
+
+	symbols := NewSymbols(db, dialect)
+	for i, status := range []string{"TRADING", "SETTLING"} {
+		err := symbols.InsertMany(ctx, []entity.SymbolInfo{{
+			Exchange:           "binance",
+			Pair:               "BTCUSDT",
+			BaseAsset:          "BTC",
+			QuoteAsset:         "USDT",
+			TickSize:           decimal.RequireFromString("0.10"),
+			LotSize:            decimal.RequireFromString("0.001"),
+			ContractType:       "PERPETUAL",
+			Status:             status,
+			UpdatedAtUnixMilli: time.Now().Add(time.Duration(i) * time.Second).UnixMilli(),
+		}})
+		if err != nil {
+			t.Fatalf("symbols.InsertMany error: %v", err)
+		}
+	}
+
+	infos, err := symbols.GetSymbols(ctx)
+	if err != nil || len(infos) != 1 || infos[0].Status != "SETTLING" {
+		t.Fatalf("GetSymbols = %+v, %v, want the latest sync", infos, err)
+	}
+}
+
+func TestPostgresCandlesRoundTrip(t *testing.T) {
+	repositorytest.CandlesRoundTrip(t, newPostgresCandlesRepos)
+}
+
+func TestPostgresCandlesOutOfRange(t *testing.T) {
+	repositorytest.CandlesOutOfRange(t, newPostgresCandlesRepos)
+}
+
+func TestPostgresCandlesQuoteVolumes(t *testing.T) {
+	repositorytest.CandlesQuoteVolumes(t, newPostgresCandlesRepos)
+}
+
+func newPostgresCandlesRepos(t *testing.T) (repository.Candles1m, repository.Candles) {
+	db := openPostgres(t)
+
+	return NewCandles1m(db, migration.DialectPostgres), NewCandles(db, migration.DialectPostgres)
+}
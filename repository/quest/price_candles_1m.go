@@ -0,0 +1,114 @@
+package quest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type priceCandles1m struct {
+	db      *sql.DB
+	dialect migration.Dialect
+}
+
+func NewPriceCandles1m(db *sql.DB, dialect migration.Dialect) *priceCandles1m {
+	return &priceCandles1m{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+func (r *priceCandles1m) InsertMany(ctx context.Context, candles []entity.PriceCandle) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO price_candles_1m (timestamp, exchange, symbol, price_type, open, high, low, close, price_scale) VALUES ")
+
+	vals := make([]any, 0, len(candles)*9)
+	for i, candle := range candles {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*9+1, i*9+2, i*9+3, i*9+4, i*9+5, i*9+6, i*9+7, i*9+8, i*9+9)
+
+		priceScale := common.DecimalPlaces(candle.Open, candle.High, candle.Low, candle.Close)
+
+		vals = append(vals, time.Unix(candle.Epoch, 0), candle.Exchange, candle.Pair, string(candle.PriceType))
+		for _, price := range []decimal.Decimal{candle.Open, candle.High, candle.Low, candle.Close} {
+			v, err := common.ToScaled(price, priceScale)
+			if err != nil {
+				return fmt.Errorf("[repository][quest][priceCandles1m][InsertMany][common.ToScaled] %s:%s at %d error: %w", candle.Exchange, candle.Pair, candle.Epoch, err)
+			}
+
+			vals = append(vals, v)
+		}
+		vals = append(vals, priceScale)
+	}
+
+	sb.WriteString(upsertClause(r.dialect, []string{"exchange", "symbol", "price_type", "timestamp"}, []string{"open", "high", "low", "close", "price_scale"}))
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][priceCandles1m][InsertMany][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// GetPriceCandles returns the mark or index price candles within [start, end) ordered by timestamp.
+func (r *priceCandles1m) GetPriceCandles(ctx context.Context, priceType entity.PriceType, symbols []string, start, end time.Time) ([]entity.PriceCandle, error) {
+	var sb strings.Builder
+	sb.WriteString("SELECT timestamp, open, high, low, close, price_scale, exchange, symbol FROM price_candles_1m WHERE price_type = $1 AND ")
+
+	args := writeSymbolsFilter(&sb, []any{string(priceType)}, symbols)
+
+	args = append(args, start, end)
+	fmt.Fprintf(&sb, "timestamp >= $%d AND timestamp < $%d ORDER BY timestamp ASC", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return []entity.PriceCandle{}, fmt.Errorf("[repository][quest][priceCandles1m][GetPriceCandles][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	candles := []entity.PriceCandle{}
+
+	for rows.Next() {
+		var candle entity.PriceCandle
+		var candleTs time.Time
+		var openScaled, highScaled, lowScaled, closeScaled int64
+		var priceScale int32
+
+		err := rows.Scan(
+			&candleTs,
+			&openScaled,
+			&highScaled,
+			&lowScaled,
+			&closeScaled,
+			&priceScale,
+			&candle.Exchange,
+			&candle.Pair,
+		)
+		if err != nil {
+			return []entity.PriceCandle{}, fmt.Errorf("[repository][quest][priceCandles1m][GetPriceCandles][rows.Scan] error: %w", err)
+		}
+
+		candle.Epoch = candleTs.Unix()
+		candle.Open = common.FromScaled(openScaled, priceScale)
+		candle.High = common.FromScaled(highScaled, priceScale)
+		candle.Low = common.FromScaled(lowScaled, priceScale)
+		candle.Close = common.FromScaled(closeScaled, priceScale)
+		candle.Symbol = fmt.Sprintf("%s:%s", candle.Exchange, candle.Pair)
+		candle.PriceType = priceType
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
@@ -0,0 +1,57 @@
+package quest
+
+import (
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"strings"
+)
+
+// upsertClause makes an insert replace the stored rows of the same keys. questdb does it
+// through the dedup keys of the table, postgres has to be told on every insert.
+func upsertClause(dialect migration.Dialect, keys, columns []string) string {
+	if dialect != migration.DialectPostgres {
+		return ""
+	}
+
+	sets := make([]string, 0, len(columns))
+	for _, column := range columns {
+		sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+	}
+
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(keys, ", "), strings.Join(sets, ", "))
+}
+
+// latestRows selects columns of the latest row by timestamp of every partition of table,
+// filter is a WHERE clause or empty.
+func latestRows(dialect migration.Dialect, table, columns, filter string, partition []string) string {
+	if dialect != migration.DialectPostgres {
+		return fmt.Sprintf("SELECT %s FROM %s %s LATEST ON timestamp PARTITION BY %s", columns, table, filter, strings.Join(partition, ", "))
+	}
+
+	return fmt.Sprintf("SELECT DISTINCT ON (%s) %s FROM %s %s ORDER BY %s, timestamp DESC", strings.Join(partition, ", "), columns, table, filter, strings.Join(partition, ", "))
+}
+
+// writeSymbolsFilter appends "(... OR ...) AND " matching the given exchange:pair symbols.
+// Symbols not in exchange:pair form are skipped, nothing is written when none is valid.
+func writeSymbolsFilter(sb *strings.Builder, args []any, symbols []string) []any {
+	conds := []string{}
+
+	for _, symbol := range symbols {
+		arr := strings.Split(symbol, ":")
+		if len(arr) != 2 {
+			continue
+		}
+
+		exchange := arr[0]
+		pair := arr[1]
+
+		args = append(args, exchange, pair)
+		conds = append(conds, fmt.Sprintf("(exchange = $%d AND symbol = $%d)", len(args)-1, len(args)))
+	}
+
+	if len(conds) > 0 {
+		fmt.Fprintf(sb, "(%s) AND ", strings.Join(conds, " OR "))
+	}
+
+	return args
+}
@@ -0,0 +1,113 @@
+package quest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"time"
+)
+
+// replayPresets keeps every version of a preset as its own row, questdb has no row
+// deletes so a delete is a row flagged as deleted. Reads take the latest row per name.
+type replayPresets struct {
+	db      *sql.DB
+	dialect migration.Dialect
+}
+
+func NewReplayPresets(db *sql.DB, dialect migration.Dialect) *replayPresets {
+	return &replayPresets{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+func (r *replayPresets) Save(ctx context.Context, preset entity.ReplayPreset) error {
+	configBytes, err := json.Marshal(preset.Config)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][replayPresets][Save][json.Marshal] error: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO replay_presets (timestamp, name, config, deleted) VALUES ($1,$2,$3,$4)",
+		time.UnixMilli(preset.UpdatedAtUnixMilli), preset.Name, string(configBytes), false,
+	)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][replayPresets][Save][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *replayPresets) Delete(ctx context.Context, name string) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO replay_presets (timestamp, name, config, deleted) VALUES ($1,$2,$3,$4)",
+		time.Now(), name, "", true,
+	)
+	if err != nil {
+		return fmt.Errorf("[repository][quest][replayPresets][Delete][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *replayPresets) GetPreset(ctx context.Context, name string) (entity.ReplayPreset, bool, error) {
+	presets, err := r.getLatest(ctx, "GetPreset", "WHERE name = $1", name)
+	if err != nil {
+		return entity.ReplayPreset{}, false, err
+	}
+
+	if len(presets) == 0 {
+		return entity.ReplayPreset{}, false, nil
+	}
+
+	return presets[0], true, nil
+}
+
+func (r *replayPresets) GetPresets(ctx context.Context) ([]entity.ReplayPreset, error) {
+	return r.getLatest(ctx, "GetPresets", "")
+}
+
+func (r *replayPresets) getLatest(ctx context.Context, method, filter string, args ...any) ([]entity.ReplayPreset, error) {
+	// the deleted flag is checked on the latest rows only, filtering it inside would resurrect older versions
+	query := fmt.Sprintf(
+		"SELECT timestamp, name, config FROM (%s) latest WHERE deleted = false ORDER BY name ASC",
+		latestRows(r.dialect, "replay_presets", "timestamp, name, config, deleted", filter, []string{"name"}),
+	)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return []entity.ReplayPreset{}, fmt.Errorf("[repository][quest][replayPresets][%s][db.QueryContext] error: %w", method, err)
+	}
+	defer rows.Close()
+
+	presets := []entity.ReplayPreset{}
+
+	for rows.Next() {
+		var preset entity.ReplayPreset
+		var updatedAt time.Time
+		var config string
+
+		err := rows.Scan(
+			&updatedAt,
+			&preset.Name,
+			&config,
+		)
+		if err != nil {
+			return []entity.ReplayPreset{}, fmt.Errorf("[repository][quest][replayPresets][%s][rows.Scan] error: %w", method, err)
+		}
+
+		err = json.Unmarshal([]byte(config), &preset.Config)
+		if err != nil {
+			return []entity.ReplayPreset{}, fmt.Errorf("[repository][quest][replayPresets][%s][json.Unmarshal] error: %w", method, err)
+		}
+
+		preset.UpdatedAtUnixMilli = updatedAt.UnixMilli()
+
+		presets = append(presets, preset)
+	}
+
+	return presets, nil
+}
@@ -0,0 +1,378 @@
+// Package repositorytest holds the behaviour every storage backend has to share, run
+// by the tests of each backend against its own repositories.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CandlesPagingCases is how many random markets CandlesPaging pages through.
+const CandlesPagingCases = 60
+
+// CandlesPaging checks, over random markets of many symbols, that paging through
+// Candles.GetCandles with the key of the last candle read returns every candle of the
+// window exactly once, in key order, whatever the page size. newRepos has to return
+// empty repositories on every call.
+func CandlesPaging(t *testing.T, newRepos func(t *testing.T) (repository.Candles1m, repository.Candles)) {
+	t.Helper()
+
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	for seed := uint64(1); seed <= CandlesPagingCases; seed++ {
+		rng := rand.New(rand.NewPCG(seed, seed))
+
+		candles1m, candles := newRepos(t)
+
+		// "ex" and "ex2" sort one way as exchanges and the other way as "ex:" and "ex2:"
+		exchanges := []string{"ex", "ex2", "fx"}[:1+rng.IntN(3)]
+
+		symbols := []string{}
+		stored := []entity.Candle{}
+		for s := 0; s < 1+rng.IntN(40); s++ {
+			exchange := exchanges[rng.IntN(len(exchanges))]
+			pair := fmt.Sprintf("P%02dUSDT", s)
+			symbols = append(symbols, exchange+":"+pair)
+
+			for m := int64(0); m < 30; m++ {
+				if rng.IntN(4) == 0 {
+					continue
+				}
+
+				stored = append(stored, pagingCandle(exchange, pair, base+m*60, rng))
+			}
+		}
+
+		err := candles1m.InsertMany(ctx, stored)
+		if err != nil {
+			t.Fatalf("seed %d: InsertMany error: %v", seed, err)
+		}
+
+		filter := []string{}
+		for _, symbol := range symbols {
+			if rng.IntN(3) > 0 {
+				filter = append(filter, symbol)
+			}
+		}
+		if len(filter) == 0 {
+			filter = symbols
+		}
+
+		start := time.Unix(base+int64(rng.IntN(10))*60, 0)
+		end := start.Add(time.Duration(rng.IntN(25)) * time.Minute)
+
+		want := []entity.CandleKey{}
+		for _, candle := range stored {
+			if slices.Contains(filter, candle.Exchange+":"+candle.Pair) && candle.Epoch >= start.Unix() && candle.Epoch <= end.Unix() {
+				want = append(want, candle.Key())
+			}
+		}
+		slices.SortFunc(want, compareKeys)
+
+		limit := 1 + rng.IntN(2*len(filter)+5)
+
+		got := []entity.CandleKey{}
+		var after *entity.CandleKey
+		for {
+			page, err := candles.GetCandles(ctx, entity.CandleInterval1m, filter, start, end, after, limit)
+			if err != nil {
+				t.Fatalf("seed %d: GetCandles error: %v", seed, err)
+			}
+
+			for _, candle := range page {
+				got = append(got, candle.Key())
+			}
+
+			if len(page) < limit {
+				break
+			}
+
+			if len(got) > len(want) {
+				t.Fatalf("seed %d: paging by %d read %d candles of %d", seed, limit, len(got), len(want))
+			}
+
+			key := page[len(page)-1].Key()
+			after = &key
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("seed %d: paging %d symbols by %d read\n%v\nwant\n%v", seed, len(filter), limit, got, want)
+		}
+	}
+}
+
+// CandlesBulkSymbols is how many symbols CandlesBulkWrite writes a whole day of 1m bars of.
+const CandlesBulkSymbols = 6
+
+// CandlesBulkWrite checks that a day of 1m bars of many symbols, more than a single
+// statement can bind, is written, rolled up and rebuilt in full. newRepos has to return
+// empty repositories.
+func CandlesBulkWrite(t *testing.T, newRepos func(t *testing.T) (repository.Candles1m, repository.Candles)) {
+	t.Helper()
+
+	ctx := context.Background()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rng := rand.New(rand.NewPCG(1, 1))
+
+	candles1m, candles := newRepos(t)
+
+	stored := []entity.Candle{}
+	for s := 0; s < CandlesBulkSymbols; s++ {
+		for m := int64(0); m < 24*60; m++ {
+			stored = append(stored, pagingCandle("ex", fmt.Sprintf("P%02dUSDT", s), day.Unix()+m*60, rng))
+		}
+	}
+
+	err := candles1m.InsertMany(ctx, stored)
+	if err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+
+	written, err := candles.RebuildRollups(ctx, day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("RebuildRollups error: %v", err)
+	}
+
+	var want int64
+	for _, interval := range entity.RollupIntervals {
+		want += int64(CandlesBulkSymbols) * int64(24*time.Hour/interval.Duration())
+	}
+	if written != want {
+		t.Errorf("RebuildRollups wrote %d bars, want %d", written, want)
+	}
+
+	for _, interval := range append([]entity.CandleInterval{entity.CandleInterval1m}, entity.RollupIntervals...) {
+		got, err := candles.GetCandles(ctx, interval, nil, day, day.Add(24*time.Hour-time.Second), nil, 0)
+		if err != nil {
+			t.Fatalf("GetCandles %s error: %v", interval, err)
+		}
+
+		if want := CandlesBulkSymbols * int(24*time.Hour/interval.Duration()); len(got) != want {
+			t.Errorf("GetCandles %s read %d bars, want %d", interval, len(got), want)
+		}
+	}
+}
+
+// CandlesRoundTrip checks that GetCandles reads back every price and volume written
+// with the digits it was written with, trailing zeros included, up to the int64 limit of
+// the scaled columns. newRepos has to return empty repositories.
+func CandlesRoundTrip(t *testing.T, newRepos func(t *testing.T) (repository.Candles1m, repository.Candles)) {
+	t.Helper()
+
+	ctx := context.Background()
+	epoch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	candles1m, candles := newRepos(t)
+
+	// open, high, low, close, volume, buy volume, sell volume
+	rows := map[string][]string{
+		"TICKUSDT":  {"43000.10", "43012.50", "42990.00", "43005.70", "12.500", "7.250", "5.250"},
+		"TINYUSDT":  {"0.0000012340", "0.0000012350", "0.0000012290", "0.0000012300", "98765432101234", "12345678901234", "86419753200000"},
+		"ZEROSUSDT": {"0.01000000", "0.01010000", "0.00990000", "0.01000000", "0", "0.000", "0"},
+		// the largest int64 at 8 price places and 3 volume places
+		"LIMITUSDT": {"92233720368.54775807", "92233720368.54775807", "0.00000001", "92233720368.54775807", "9223372036854775.807", "9223372036854775.807", "0.000"},
+	}
+
+	stored := []entity.Candle{}
+	for pair, row := range rows {
+		stored = append(stored, roundTripCandle(pair, epoch, row))
+	}
+
+	err := candles1m.InsertMany(ctx, stored)
+	if err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+
+	got, err := candles.GetCandles(ctx, entity.CandleInterval1m, nil, time.Unix(epoch, 0), time.Unix(epoch, 0), nil, 0)
+	if err != nil {
+		t.Fatalf("GetCandles error: %v", err)
+	}
+
+	if len(got) != len(rows) {
+		t.Fatalf("GetCandles read %d candles, want %d", len(got), len(rows))
+	}
+
+	for _, candle := range got {
+		fields := []decimal.Decimal{candle.Open, candle.High, candle.Low, candle.Close, candle.Volume.Total, candle.Volume.Buy, candle.Volume.Sell}
+
+		for i, d := range fields {
+			if s := d.StringFixed(max(-d.Exponent(), 0)); s != rows[candle.Pair][i] {
+				t.Errorf("%s field %d came back as %s, want %s", candle.Pair, i, s, rows[candle.Pair][i])
+			}
+		}
+	}
+}
+
+// CandlesOutOfRange checks that a candle past the int64 limit of the scaled columns fails
+// the whole insert, the candles before it in more than one insert batch included, and
+// that nothing of it is stored. newRepos has to return empty repositories.
+func CandlesOutOfRange(t *testing.T, newRepos func(t *testing.T) (repository.Candles1m, repository.Candles)) {
+	t.Helper()
+
+	ctx := context.Background()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rng := rand.New(rand.NewPCG(1, 1))
+
+	tests := []struct {
+		name string
+		row  []string
+	}{
+		{"a price a unit past the limit at 8 places", []string{"92233720368.54775808", "92233720368.54775808", "1.00000000", "2.00000000", "1.000", "1.000", "0.000"}},
+		{"a volume a unit past the limit at 3 places", []string{"1.00", "1.00", "1.00", "1.00", "9223372036854775.808", "0.000", "0.000"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candles1m, candles := newRepos(t)
+
+			stored := []entity.Candle{}
+			for m := int64(0); m < 1500; m++ {
+				stored = append(stored, pagingCandle("ex", "P00USDT", day.Unix()+m*60, rng))
+			}
+			stored = append(stored, roundTripCandle("P01USDT", day.Unix()+1499*60, test.row))
+
+			err := candles1m.InsertMany(ctx, stored)
+			if !errors.Is(err, repository.ErrCandleOutOfRange) {
+				t.Fatalf("InsertMany error = %v, want %v", err, repository.ErrCandleOutOfRange)
+			}
+
+			got, err := candles.GetCandles(ctx, entity.CandleInterval1m, nil, day, day.Add(24*time.Hour), nil, 0)
+			if err != nil {
+				t.Fatalf("GetCandles error: %v", err)
+			}
+
+			if len(got) != 0 {
+				t.Errorf("GetCandles read %d candles of the rejected insert, want none", len(got))
+			}
+		})
+	}
+}
+
+// CandlesQuoteVolumes checks that GetQuoteVolumes sums close * volume exactly, so quote
+// volumes a float could not tell apart still rank apart. newRepos has to return empty
+// repositories.
+func CandlesQuoteVolumes(t *testing.T, newRepos func(t *testing.T) (repository.Candles1m, repository.Candles)) {
+	t.Helper()
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	candles1m, _ := newRepos(t)
+
+	bar := func(exchange, pair string, minute int64, close, volume string) entity.Candle {
+		candle := roundTripCandle(pair, start.Unix()+minute*60, []string{close, close, close, close, volume, volume, "0"})
+		candle.Exchange = exchange
+
+		return candle
+	}
+
+	err := candles1m.InsertMany(ctx, []entity.Candle{
+		bar("ex", "AUSDT", 0, "43000.12345678", "1234567.891"),
+		bar("ex", "AUSDT", 1, "43000.12345678", "0.001"),
+		bar("ex", "BUSDT", 0, "43000.12345677", "1234567.892"),
+		// a float sees the same quote volume for both
+		bar("ex", "CUSDT", 0, "92233720368.54775807", "1.000"),
+		bar("ex", "DUSDT", 0, "92233720368.54775806", "1.000"),
+		// another exchange and a bar past the end are left out
+		bar("fx", "AUSDT", 0, "1.0", "1.0"),
+		bar("ex", "AUSDT", 60, "1.0", "1.0"),
+	})
+	if err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+
+	got, err := candles1m.GetQuoteVolumes(ctx, "ex", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetQuoteVolumes error: %v", err)
+	}
+
+	want := map[string]string{
+		"ex:AUSDT": "53086571771.77663770776",
+		"ex:BUSDT": "53086571771.76429202884",
+		"ex:CUSDT": "92233720368.54775807",
+		"ex:DUSDT": "92233720368.54775806",
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("GetQuoteVolumes = %v, want %v", got, want)
+	}
+
+	for symbol, volume := range want {
+		if !got[symbol].Equal(decimal.RequireFromString(volume)) {
+			t.Errorf("quote volume of %s = %s, want %s", symbol, got[symbol], volume)
+		}
+	}
+
+	if !got["ex:CUSDT"].GreaterThan(got["ex:DUSDT"]) {
+		t.Errorf("quote volume of ex:CUSDT %s does not rank above ex:DUSDT %s", got["ex:CUSDT"], got["ex:DUSDT"])
+	}
+}
+
+func roundTripCandle(pair string, epoch int64, row []string) entity.Candle {
+	return entity.Candle{
+		Epoch:    epoch,
+		Exchange: "ex",
+		Pair:     pair,
+		Open:     decimal.RequireFromString(row[0]),
+		High:     decimal.RequireFromString(row[1]),
+		Low:      decimal.RequireFromString(row[2]),
+		Close:    decimal.RequireFromString(row[3]),
+		Volume: entity.CandleVolume{
+			Total: decimal.RequireFromString(row[4]),
+			Buy:   decimal.RequireFromString(row[5]),
+			Sell:  decimal.RequireFromString(row[6]),
+		},
+	}
+}
+
+func pagingCandle(exchange, pair string, epoch int64, rng *rand.Rand) entity.Candle {
+	open := decimal.New(1000+rng.Int64N(1000), -2)
+
+	return entity.Candle{
+		Epoch:    epoch,
+		Exchange: exchange,
+		Pair:     pair,
+		Open:     open,
+		High:     open.Add(decimal.New(5, -1)),
+		Low:      open.Sub(decimal.New(5, -1)),
+		Close:    open,
+		Volume: entity.CandleVolume{
+			Total: decimal.New(2000, -3),
+			Buy:   decimal.New(1000, -3),
+			Sell:  decimal.New(1000, -3),
+		},
+	}
+}
+
+func compareKeys(a, b entity.CandleKey) int {
+	if a.Epoch != b.Epoch {
+		return int(a.Epoch - b.Epoch)
+	}
+
+	if a.Exchange != b.Exchange {
+		if a.Exchange < b.Exchange {
+			return -1
+		}
+
+		return 1
+	}
+
+	if a.Pair < b.Pair {
+		return -1
+	}
+	if a.Pair > b.Pair {
+		return 1
+	}
+
+	return 0
+}
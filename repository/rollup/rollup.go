@@ -0,0 +1,153 @@
+// Package rollup aggregates the 1m candles into the higher intervals every storage
+// backend keeps materialised.
+package rollup
+
+import (
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"time"
+)
+
+type bucketKey struct {
+	exchange string
+	pair     string
+	epoch    int64
+}
+
+// Aggregate folds 1m candles into bars of interval. Bars are aligned to the unix epoch,
+// so every bar of a day starts a whole number of intervals after midnight UTC. candles
+// may come in any order and mix symbols, the bars are sorted by epoch then symbol.
+func Aggregate(candles []entity.Candle, interval entity.CandleInterval) []entity.Candle {
+	size := int64(interval.Duration().Seconds())
+	if size <= 0 {
+		return []entity.Candle{}
+	}
+
+	sorted := make([]entity.Candle, len(candles))
+	copy(sorted, candles)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Epoch < sorted[j].Epoch
+	})
+
+	bars := map[bucketKey]*entity.Candle{}
+
+	for _, candle := range sorted {
+		key := bucketKey{exchange: candle.Exchange, pair: candle.Pair, epoch: bucketOf(candle.Epoch, size)}
+
+		bar, ok := bars[key]
+		if !ok {
+			bars[key] = &entity.Candle{
+				Epoch:    key.epoch,
+				Pair:     candle.Pair,
+				Exchange: candle.Exchange,
+				Symbol:   candle.Exchange + ":" + candle.Pair,
+				Open:     candle.Open,
+				High:     candle.High,
+				Low:      candle.Low,
+				Close:    candle.Close,
+				Volume:   candle.Volume,
+				Dirty:    candle.Dirty,
+			}
+
+			continue
+		}
+
+		if candle.High.GreaterThan(bar.High) {
+			bar.High = candle.High
+		}
+		if candle.Low.LessThan(bar.Low) {
+			bar.Low = candle.Low
+		}
+		bar.Close = candle.Close
+		bar.Volume = entity.CandleVolume{
+			Total: bar.Volume.Total.Add(candle.Volume.Total),
+			Buy:   bar.Volume.Buy.Add(candle.Volume.Buy),
+			Sell:  bar.Volume.Sell.Add(candle.Volume.Sell),
+		}
+		bar.Dirty = bar.Dirty || candle.Dirty
+	}
+
+	aggregated := make([]entity.Candle, 0, len(bars))
+	for _, bar := range bars {
+		aggregated = append(aggregated, *bar)
+	}
+
+	sort.Slice(aggregated, func(i, j int) bool {
+		if aggregated[i].Epoch != aggregated[j].Epoch {
+			return aggregated[i].Epoch < aggregated[j].Epoch
+		}
+
+		return aggregated[i].Symbol < aggregated[j].Symbol
+	})
+
+	return aggregated
+}
+
+// Window returns the span [start, end) of the 1m candles the rollup bars touched by
+// written are built from, and the exchange:pair symbols written.
+func Window(written []entity.Candle) (time.Time, time.Time, []string) {
+	if len(written) == 0 {
+		return time.Time{}, time.Time{}, []string{}
+	}
+
+	first, last := written[0].Epoch, written[0].Epoch
+	seen := map[string]bool{}
+	symbols := []string{}
+
+	for _, candle := range written {
+		first = min(first, candle.Epoch)
+		last = max(last, candle.Epoch)
+
+		symbol := candle.Exchange + ":" + candle.Pair
+		if !seen[symbol] {
+			seen[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	start, end := Span(time.Unix(first, 0), time.Unix(last, 0))
+
+	return start, end, symbols
+}
+
+// Span widens [start, end] to whole days, which hold whole bars of every rollup interval.
+func Span(start, end time.Time) (time.Time, time.Time) {
+	day := int64(entity.CandleInterval(entity.CandleInterval1d).Duration().Seconds())
+
+	return time.Unix(bucketOf(start.Unix(), day), 0), time.Unix(bucketOf(end.Unix(), day)+day, 0)
+}
+
+// Refresh rebuilds, for every rollup interval, the bars holding one of the written 1m
+// candles out of the stored ones, which must cover the Window of written.
+func Refresh(written, stored []entity.Candle) map[entity.CandleInterval][]entity.Candle {
+	refreshed := map[entity.CandleInterval][]entity.Candle{}
+
+	for _, interval := range entity.RollupIntervals {
+		size := int64(interval.Duration().Seconds())
+
+		touched := map[bucketKey]bool{}
+		for _, candle := range written {
+			touched[bucketKey{exchange: candle.Exchange, pair: candle.Pair, epoch: bucketOf(candle.Epoch, size)}] = true
+		}
+
+		bars := []entity.Candle{}
+		for _, bar := range Aggregate(stored, interval) {
+			if touched[bucketKey{exchange: bar.Exchange, pair: bar.Pair, epoch: bar.Epoch}] {
+				bars = append(bars, bar)
+			}
+		}
+
+		refreshed[interval] = bars
+	}
+
+	return refreshed
+}
+
+func bucketOf(epoch, size int64) int64 {
+	bucket := epoch - epoch%size
+	if epoch < 0 && epoch%size != 0 {
+		bucket -= size
+	}
+
+	return bucket
+}
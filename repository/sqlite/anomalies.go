@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"strings"
+	"time"
+)
+
+type anomalies struct {
+	db *sql.DB
+}
+
+func NewAnomalies(db *sql.DB) *anomalies {
+	return &anomalies{
+		db: db,
+	}
+}
+
+func (r *anomalies) InsertMany(ctx context.Context, anomalies []entity.Anomaly) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT OR REPLACE INTO anomalies (timestamp, exchange, symbol, source, rule, policy, detail, detected_at) VALUES ")
+
+	vals := make([]any, 0, len(anomalies)*8)
+	for i, anomaly := range anomalies {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*8+1, i*8+2, i*8+3, i*8+4, i*8+5, i*8+6, i*8+7, i*8+8)
+
+		vals = append(vals,
+			anomaly.Epoch, anomaly.Exchange, anomaly.Pair, string(anomaly.Source),
+			string(anomaly.Rule), string(anomaly.Policy), anomaly.Detail, anomaly.DetectedAtUnixMilli,
+		)
+	}
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][anomalies][InsertMany][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// GetAnomalies returns the anomalies of the bars within [start, end) ordered by timestamp,
+// a zero end leaves the window open.
+func (r *anomalies) GetAnomalies(ctx context.Context, symbol string, start, end time.Time, limit int) ([]entity.Anomaly, error) {
+	var sb strings.Builder
+	sb.WriteString("SELECT timestamp, exchange, symbol, source, rule, policy, detail, detected_at FROM anomalies WHERE ")
+
+	args := writeSymbolsFilter(&sb, []any{}, []string{symbol})
+
+	args = append(args, start.Unix())
+	fmt.Fprintf(&sb, "timestamp >= $%d ", len(args))
+
+	if end.Unix() > 0 {
+		args = append(args, end.Unix())
+		fmt.Fprintf(&sb, "AND timestamp < $%d ", len(args))
+	}
+
+	sb.WriteString("ORDER BY timestamp ASC, source ASC, rule ASC ")
+
+	if limit > 0 {
+		args = append(args, limit)
+		fmt.Fprintf(&sb, "LIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return []entity.Anomaly{}, fmt.Errorf("[repository][sqlite][anomalies][GetAnomalies][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	result := []entity.Anomaly{}
+
+	for rows.Next() {
+		var anomaly entity.Anomaly
+		var source, rule, policy string
+
+		err := rows.Scan(
+			&anomaly.Epoch,
+			&anomaly.Exchange,
+			&anomaly.Pair,
+			&source,
+			&rule,
+			&policy,
+			&anomaly.Detail,
+			&anomaly.DetectedAtUnixMilli,
+		)
+		if err != nil {
+			return []entity.Anomaly{}, fmt.Errorf("[repository][sqlite][anomalies][GetAnomalies][rows.Scan] error: %w", err)
+		}
+
+		anomaly.Symbol = fmt.Sprintf("%s:%s", anomaly.Exchange, anomaly.Pair)
+		anomaly.Source = entity.AnomalySource(source)
+		anomaly.Rule = entity.AnomalyRule(rule)
+		anomaly.Policy = entity.AnomalyPolicy(policy)
+
+		result = append(result, anomaly)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,215 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/rollup"
+	"strings"
+	"time"
+)
+
+type candles struct {
+	db *sql.DB
+}
+
+func NewCandles(db *sql.DB) *candles {
+	return &candles{
+		db: db,
+	}
+}
+
+func (r *candles) GetCandles(ctx context.Context, interval entity.CandleInterval, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error) {
+	table, err := candlesTable(interval)
+	if err != nil {
+		return []entity.Candle{}, fmt.Errorf("[repository][sqlite][candles][GetCandles][candlesTable] error: %w", err)
+	}
+
+	candles, err := selectCandles(ctx, r.db, table, symbols, start, end, after, limit)
+	if err != nil {
+		return []entity.Candle{}, fmt.Errorf("[repository][sqlite][candles][GetCandles][selectCandles] error: %w", err)
+	}
+
+	return candles, nil
+}
+
+// RebuildRollups recomputes every rollup bar of the whole days within [start, end] from
+// the stored 1m candles, a day at a time. It returns how many bars were written.
+func (r *candles) RebuildRollups(ctx context.Context, start, end time.Time) (int64, error) {
+	from, to := rollup.Span(start, end)
+
+	var written int64
+
+	for day := from; day.Before(to); day = day.Add(24 * time.Hour) {
+		stored, err := selectCandles(ctx, r.db, "candles_1m", nil, day, day.Add(24*time.Hour-time.Second), nil, 0)
+		if err != nil {
+			return written, fmt.Errorf("[repository][sqlite][candles][RebuildRollups][selectCandles] error: %w", err)
+		}
+
+		for _, interval := range entity.RollupIntervals {
+			bars := rollup.Aggregate(stored, interval)
+
+			err = insertCandles(ctx, r.db, rollupTable(interval), bars)
+			if err != nil {
+				return written, fmt.Errorf("[repository][sqlite][candles][RebuildRollups][insertCandles] %s error: %w", interval, err)
+			}
+
+			written += int64(len(bars))
+		}
+	}
+
+	return written, nil
+}
+
+// refreshRollups rewrites the rollup bars the written 1m candles fall in, reading back
+// the 1m candles of the whole days they touch.
+func refreshRollups(ctx context.Context, db *sql.DB, written []entity.Candle) error {
+	if len(written) == 0 {
+		return nil
+	}
+
+	start, end, symbols := rollup.Window(written)
+
+	stored, err := selectCandles(ctx, db, "candles_1m", symbols, start, end.Add(-time.Second), nil, 0)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][refreshRollups][selectCandles] error: %w", err)
+	}
+
+	for interval, bars := range rollup.Refresh(written, stored) {
+		err = insertCandles(ctx, db, rollupTable(interval), bars)
+		if err != nil {
+			return fmt.Errorf("[repository][sqlite][refreshRollups][insertCandles] %s error: %w", interval, err)
+		}
+	}
+
+	return nil
+}
+
+func candlesTable(interval entity.CandleInterval) (string, error) {
+	if interval.Duration() == 0 {
+		return "", fmt.Errorf("no candles of interval '%s' are kept", interval)
+	}
+
+	return rollupTable(interval), nil
+}
+
+func rollupTable(interval entity.CandleInterval) string {
+	return "candles_" + string(interval)
+}
+
+// insertBatchRows is how many rows an insert statement holds. At 11 binds a row it stays
+// well within the 32766 binds sqlite takes, binding slows down fast past a few hundred.
+const insertBatchRows = 100
+
+// insertCandles replaces the bars already stored at the same timestamp, the way the
+// questdb dedup keys do.
+func insertCandles(ctx context.Context, db *sql.DB, table string, candles []entity.Candle) error {
+	for len(candles) > 0 {
+		batch := candles[:min(len(candles), insertBatchRows)]
+		candles = candles[len(batch):]
+
+		err := insertCandlesBatch(ctx, db, table, batch)
+		if err != nil {
+			return fmt.Errorf("[repository][sqlite][insertCandles][insertCandlesBatch] error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func insertCandlesBatch(ctx context.Context, db *sql.DB, table string, candles []entity.Candle) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "INSERT OR REPLACE INTO %s (timestamp, exchange, symbol, open, high, low, close, volume, buy_volume, sell_volume, dirty) VALUES ", table)
+
+	vals := make([]any, 0, len(candles)*11)
+	for i, candle := range candles {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*11+1, i*11+2, i*11+3, i*11+4, i*11+5, i*11+6, i*11+7, i*11+8, i*11+9, i*11+10, i*11+11)
+
+		vals = append(vals,
+			candle.Epoch, candle.Exchange, candle.Pair,
+			decimalText(candle.Open), decimalText(candle.High), decimalText(candle.Low), decimalText(candle.Close),
+			decimalText(candle.Volume.Total), decimalText(candle.Volume.Buy), decimalText(candle.Volume.Sell),
+			candle.Dirty,
+		)
+	}
+
+	_, err := db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][insertCandlesBatch][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// selectCandles reads candles in (timestamp, exchange, symbol) order, the window applies
+// only when both ends are set and after, when set, keeps the keys past it.
+func selectCandles(ctx context.Context, db *sql.DB, table string, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SELECT timestamp, open, high, low, close, volume, buy_volume, sell_volume, exchange, symbol, dirty FROM %s WHERE ", table)
+
+	args := []any{}
+
+	args = writeSymbolsFilter(&sb, args, symbols)
+
+	if start.Unix() > 0 && end.Unix() > 0 {
+		args = append(args, start.Unix(), end.Unix())
+		fmt.Fprintf(&sb, "timestamp BETWEEN $%d AND $%d AND ", len(args)-1, len(args))
+	}
+
+	if after != nil {
+		args = append(args, time.Unix(after.Epoch, 0).Unix(), after.Exchange, after.Pair)
+		ts, exchange, pair := len(args)-2, len(args)-1, len(args)
+		fmt.Fprintf(&sb, "(timestamp > $%d OR (timestamp = $%d AND (exchange > $%d OR (exchange = $%d AND symbol > $%d)))) AND ", ts, ts, exchange, exchange, pair)
+	}
+
+	sb.WriteString("1 = 1 ORDER BY timestamp ASC, exchange ASC, symbol ASC ")
+
+	if limit > 0 {
+		args = append(args, limit)
+		fmt.Fprintf(&sb, "LIMIT $%d", len(args))
+	}
+
+	rows, err := db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return []entity.Candle{}, fmt.Errorf("[repository][sqlite][selectCandles][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	candles := []entity.Candle{}
+
+	for rows.Next() {
+		var candle entity.Candle
+
+		err := rows.Scan(
+			&candle.Epoch,
+			&candle.Open,
+			&candle.High,
+			&candle.Low,
+			&candle.Close,
+			&candle.Volume.Total,
+			&candle.Volume.Buy,
+			&candle.Volume.Sell,
+			&candle.Exchange,
+			&candle.Pair,
+			&candle.Dirty,
+		)
+		if err != nil {
+			return []entity.Candle{}, fmt.Errorf("[repository][sqlite][selectCandles][rows.Scan] error: %w", err)
+		}
+
+		candle.Symbol = fmt.Sprintf("%s:%s", candle.Exchange, candle.Pair)
+
+		candles = append(candles, candle)
+	}
+
+	if err := rows.Err(); err != nil {
+		return []entity.Candle{}, fmt.Errorf("[repository][sqlite][selectCandles][rows.Err] error: %w", err)
+	}
+
+	return candles, nil
+}
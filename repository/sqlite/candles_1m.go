@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type candles1m struct {
+	db *sql.DB
+}
+
+func NewCandles1m(db *sql.DB) *candles1m {
+	return &candles1m{
+		db: db,
+	}
+}
+
+// InsertMany replaces the bars already stored at the same timestamp, the way the
+// questdb dedup keys do, and refreshes the rollup bars the candles fall in.
+func (r *candles1m) InsertMany(ctx context.Context, candles []entity.Candle) error {
+	err := repository.CheckStorable(candles)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][candles1m][InsertMany][repository.CheckStorable] error: %w", err)
+	}
+
+	err = insertCandles(ctx, r.db, "candles_1m", candles)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][candles1m][InsertMany][insertCandles] error: %w", err)
+	}
+
+	err = refreshRollups(ctx, r.db, candles)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][candles1m][InsertMany][refreshRollups] error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *candles1m) CountCandles1m(ctx context.Context, exchange, symbol string, start, end time.Time) (int64, error) {
+	q := `
+		SELECT COUNT(*)
+		FROM candles_1m
+		WHERE exchange = $1
+			AND symbol = $2
+			AND timestamp
+				BETWEEN $3 AND $4
+	`
+
+	var count int64
+	err := r.db.QueryRowContext(ctx, q, exchange, symbol, start.Unix(), end.Unix()).Scan(&count)
+	if err != nil {
+		return count, fmt.Errorf("[repository][sqlite][candles1m][CountCandles1m][db.QueryRowContext] error: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetQuoteVolumes sums close * volume of every symbol of the exchange within [start, end),
+// keyed by exchange:pair. The products are summed as decimals here, a REAL sum in sqlite
+// would lose the exact values the text columns keep.
+func (r *candles1m) GetQuoteVolumes(ctx context.Context, exchange string, start, end time.Time) (map[string]decimal.Decimal, error) {
+	q := `
+		SELECT symbol, close, volume
+		FROM candles_1m
+		WHERE exchange = $1
+			AND timestamp >= $2
+			AND timestamp < $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, q, exchange, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("[repository][sqlite][candles1m][GetQuoteVolumes][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	volumes := map[string]decimal.Decimal{}
+
+	for rows.Next() {
+		var pair string
+		var close, volume decimal.Decimal
+
+		err := rows.Scan(&pair, &close, &volume)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][sqlite][candles1m][GetQuoteVolumes][rows.Scan] error: %w", err)
+		}
+
+		symbol := fmt.Sprintf("%s:%s", exchange, pair)
+		volumes[symbol] = volumes[symbol].Add(close.Mul(volume))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("[repository][sqlite][candles1m][GetQuoteVolumes][rows.Err] error: %w", err)
+	}
+
+	return volumes, nil
+}
@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"michaelyusak/go-quant-replay-engine.git/repository/repositorytest"
+	"path/filepath"
+	"testing"
+)
+
+func TestCandlesPaging(t *testing.T) {
+	repositorytest.CandlesPaging(t, newCandlesRepos)
+}
+
+func TestCandlesBulkWrite(t *testing.T) {
+	repositorytest.CandlesBulkWrite(t, newCandlesRepos)
+}
+
+func TestCandlesRoundTrip(t *testing.T) {
+	repositorytest.CandlesRoundTrip(t, newCandlesRepos)
+}
+
+func TestCandlesOutOfRange(t *testing.T) {
+	repositorytest.CandlesOutOfRange(t, newCandlesRepos)
+}
+
+func TestCandlesQuoteVolumes(t *testing.T) {
+	repositorytest.CandlesQuoteVolumes(t, newCandlesRepos)
+}
+
+func newCandlesRepos(t *testing.T) (repository.Candles1m, repository.Candles) {
+	db, err := Open(filepath.Join(t.TempDir(), "replay.db"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migration.NewMigrator(db, migration.DialectSQLite)
+	if err != nil {
+		t.Fatalf("NewMigrator error: %v", err)
+	}
+
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("migrator.Up error: %v", err)
+	}
+
+	return NewCandles1m(db), NewCandles(db)
+}
@@ -0,0 +1,31 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+)
+
+// Open opens the database file at path, creating it when missing. sqlite takes one
+// writer at a time, a single connection keeps imports and replays from tripping over
+// SQLITE_BUSY.
+func Open(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)", url.PathEscape(path))
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][sqlite][Open][sql.Open] error: %w", err)
+	}
+
+	db.SetMaxOpenConns(1)
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("[repository][sqlite][Open][db.Ping] error: %w", err)
+	}
+
+	return db, nil
+}
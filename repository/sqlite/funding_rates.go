@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"strings"
+	"time"
+)
+
+type fundingRates struct {
+	db *sql.DB
+}
+
+func NewFundingRates(db *sql.DB) *fundingRates {
+	return &fundingRates{
+		db: db,
+	}
+}
+
+func (r *fundingRates) InsertMany(ctx context.Context, rates []entity.FundingRate) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT OR REPLACE INTO funding_rates (timestamp, exchange, symbol, funding_rate, mark_price) VALUES ")
+
+	vals := make([]any, 0, len(rates)*5)
+	for i, rate := range rates {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d)", i*5+1, i*5+2, i*5+3, i*5+4, i*5+5)
+
+		vals = append(vals, rate.Epoch, rate.Exchange, rate.Pair, decimalText(rate.FundingRate), decimalText(rate.MarkPrice))
+	}
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][fundingRates][InsertMany][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// GetFundingRates returns the funding rates within [start, end) ordered by timestamp.
+func (r *fundingRates) GetFundingRates(ctx context.Context, symbols []string, start, end time.Time) ([]entity.FundingRate, error) {
+	var sb strings.Builder
+	sb.WriteString("SELECT timestamp, funding_rate, mark_price, exchange, symbol FROM funding_rates WHERE ")
+
+	args := writeSymbolsFilter(&sb, []any{}, symbols)
+
+	args = append(args, start.Unix(), end.Unix())
+	fmt.Fprintf(&sb, "timestamp >= $%d AND timestamp < $%d ORDER BY timestamp ASC, exchange ASC, symbol ASC", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return []entity.FundingRate{}, fmt.Errorf("[repository][sqlite][fundingRates][GetFundingRates][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []entity.FundingRate{}
+
+	for rows.Next() {
+		var rate entity.FundingRate
+
+		err := rows.Scan(
+			&rate.Epoch,
+			&rate.FundingRate,
+			&rate.MarkPrice,
+			&rate.Exchange,
+			&rate.Pair,
+		)
+		if err != nil {
+			return []entity.FundingRate{}, fmt.Errorf("[repository][sqlite][fundingRates][GetFundingRates][rows.Scan] error: %w", err)
+		}
+
+		rate.Symbol = fmt.Sprintf("%s:%s", rate.Exchange, rate.Pair)
+
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"strings"
+	"time"
+)
+
+type openInterests struct {
+	db *sql.DB
+}
+
+func NewOpenInterests(db *sql.DB) *openInterests {
+	return &openInterests{
+		db: db,
+	}
+}
+
+func (r *openInterests) InsertMany(ctx context.Context, openInterests []entity.OpenInterest) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT OR REPLACE INTO open_interest (timestamp, exchange, symbol, sum_open_interest, sum_open_interest_value) VALUES ")
+
+	vals := make([]any, 0, len(openInterests)*5)
+	for i, oi := range openInterests {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d)", i*5+1, i*5+2, i*5+3, i*5+4, i*5+5)
+
+		vals = append(vals, oi.Epoch, oi.Exchange, oi.Pair, decimalText(oi.OpenInterest), decimalText(oi.OpenInterestValue))
+	}
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][openInterests][InsertMany][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// GetOpenInterests returns the open interest snapshots within [start, end) ordered by timestamp.
+func (r *openInterests) GetOpenInterests(ctx context.Context, symbols []string, start, end time.Time) ([]entity.OpenInterest, error) {
+	var sb strings.Builder
+	sb.WriteString("SELECT timestamp, sum_open_interest, sum_open_interest_value, exchange, symbol FROM open_interest WHERE ")
+
+	args := writeSymbolsFilter(&sb, []any{}, symbols)
+
+	args = append(args, start.Unix(), end.Unix())
+	fmt.Fprintf(&sb, "timestamp >= $%d AND timestamp < $%d ORDER BY timestamp ASC, exchange ASC, symbol ASC", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return []entity.OpenInterest{}, fmt.Errorf("[repository][sqlite][openInterests][GetOpenInterests][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	openInterests := []entity.OpenInterest{}
+
+	for rows.Next() {
+		var oi entity.OpenInterest
+
+		err := rows.Scan(
+			&oi.Epoch,
+			&oi.OpenInterest,
+			&oi.OpenInterestValue,
+			&oi.Exchange,
+			&oi.Pair,
+		)
+		if err != nil {
+			return []entity.OpenInterest{}, fmt.Errorf("[repository][sqlite][openInterests][GetOpenInterests][rows.Scan] error: %w", err)
+		}
+
+		oi.Symbol = fmt.Sprintf("%s:%s", oi.Exchange, oi.Pair)
+
+		openInterests = append(openInterests, oi)
+	}
+
+	return openInterests, nil
+}
@@ -0,0 +1,89 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"strings"
+	"time"
+)
+
+type priceCandles1m struct {
+	db *sql.DB
+}
+
+func NewPriceCandles1m(db *sql.DB) *priceCandles1m {
+	return &priceCandles1m{
+		db: db,
+	}
+}
+
+func (r *priceCandles1m) InsertMany(ctx context.Context, candles []entity.PriceCandle) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT OR REPLACE INTO price_candles_1m (timestamp, exchange, symbol, price_type, open, high, low, close) VALUES ")
+
+	vals := make([]any, 0, len(candles)*8)
+	for i, candle := range candles {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*8+1, i*8+2, i*8+3, i*8+4, i*8+5, i*8+6, i*8+7, i*8+8)
+
+		vals = append(vals,
+			candle.Epoch, candle.Exchange, candle.Pair, string(candle.PriceType),
+			decimalText(candle.Open), decimalText(candle.High), decimalText(candle.Low), decimalText(candle.Close),
+		)
+	}
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][priceCandles1m][InsertMany][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+// GetPriceCandles returns the mark or index price candles within [start, end) ordered by timestamp.
+func (r *priceCandles1m) GetPriceCandles(ctx context.Context, priceType entity.PriceType, symbols []string, start, end time.Time) ([]entity.PriceCandle, error) {
+	var sb strings.Builder
+	sb.WriteString("SELECT timestamp, open, high, low, close, exchange, symbol FROM price_candles_1m WHERE price_type = $1 AND ")
+
+	args := writeSymbolsFilter(&sb, []any{string(priceType)}, symbols)
+
+	args = append(args, start.Unix(), end.Unix())
+	fmt.Fprintf(&sb, "timestamp >= $%d AND timestamp < $%d ORDER BY timestamp ASC, exchange ASC, symbol ASC", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return []entity.PriceCandle{}, fmt.Errorf("[repository][sqlite][priceCandles1m][GetPriceCandles][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	candles := []entity.PriceCandle{}
+
+	for rows.Next() {
+		var candle entity.PriceCandle
+
+		err := rows.Scan(
+			&candle.Epoch,
+			&candle.Open,
+			&candle.High,
+			&candle.Low,
+			&candle.Close,
+			&candle.Exchange,
+			&candle.Pair,
+		)
+		if err != nil {
+			return []entity.PriceCandle{}, fmt.Errorf("[repository][sqlite][priceCandles1m][GetPriceCandles][rows.Scan] error: %w", err)
+		}
+
+		candle.Symbol = fmt.Sprintf("%s:%s", candle.Exchange, candle.Pair)
+		candle.PriceType = priceType
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// writeSymbolsFilter appends "(... OR ...) AND " matching the given exchange:pair symbols.
+// Symbols not in exchange:pair form are skipped, nothing is written when none is valid.
+func writeSymbolsFilter(sb *strings.Builder, args []any, symbols []string) []any {
+	conds := []string{}
+
+	for _, symbol := range symbols {
+		arr := strings.Split(symbol, ":")
+		if len(arr) != 2 {
+			continue
+		}
+
+		exchange := arr[0]
+		pair := arr[1]
+
+		args = append(args, exchange, pair)
+		conds = append(conds, fmt.Sprintf("(exchange = $%d AND symbol = $%d)", len(args)-1, len(args)))
+	}
+
+	if len(conds) > 0 {
+		fmt.Fprintf(sb, "(%s) AND ", strings.Join(conds, " OR "))
+	}
+
+	return args
+}
+
+// decimalText keeps the trailing zeros d carries, "0.01000000" stays as binance sent it.
+func decimalText(d decimal.Decimal) string {
+	if d.Exponent() >= 0 {
+		return d.String()
+	}
+
+	return d.StringFixed(-d.Exponent())
+}
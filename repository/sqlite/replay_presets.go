@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"time"
+)
+
+// replayPresets keeps every version of a preset as its own row like the questdb table
+// does, a delete is a row flagged as deleted. Reads take the latest row per name.
+type replayPresets struct {
+	db *sql.DB
+}
+
+func NewReplayPresets(db *sql.DB) *replayPresets {
+	return &replayPresets{
+		db: db,
+	}
+}
+
+func (r *replayPresets) Save(ctx context.Context, preset entity.ReplayPreset) error {
+	configBytes, err := json.Marshal(preset.Config)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][replayPresets][Save][json.Marshal] error: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO replay_presets (timestamp, name, config, deleted) VALUES ($1,$2,$3,$4)",
+		preset.UpdatedAtUnixMilli, preset.Name, string(configBytes), false,
+	)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][replayPresets][Save][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *replayPresets) Delete(ctx context.Context, name string) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO replay_presets (timestamp, name, config, deleted) VALUES ($1,$2,$3,$4)",
+		time.Now().UnixMilli(), name, "", true,
+	)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][replayPresets][Delete][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *replayPresets) GetPreset(ctx context.Context, name string) (entity.ReplayPreset, bool, error) {
+	presets, err := r.getLatest(ctx, "GetPreset", "WHERE name = $1", name)
+	if err != nil {
+		return entity.ReplayPreset{}, false, err
+	}
+
+	if len(presets) == 0 {
+		return entity.ReplayPreset{}, false, nil
+	}
+
+	return presets[0], true, nil
+}
+
+func (r *replayPresets) GetPresets(ctx context.Context) ([]entity.ReplayPreset, error) {
+	return r.getLatest(ctx, "GetPresets", "")
+}
+
+func (r *replayPresets) getLatest(ctx context.Context, method, filter string, args ...any) ([]entity.ReplayPreset, error) {
+	// the deleted flag is checked on the latest rows only, filtering it inside would resurrect older versions
+	query := fmt.Sprintf(
+		"SELECT timestamp, name, config FROM (SELECT timestamp, name, config, deleted, row_number() OVER (PARTITION BY name ORDER BY timestamp DESC, rowid DESC) AS latest FROM replay_presets %s) WHERE latest = 1 AND deleted = 0 ORDER BY name ASC",
+		filter,
+	)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return []entity.ReplayPreset{}, fmt.Errorf("[repository][sqlite][replayPresets][%s][db.QueryContext] error: %w", method, err)
+	}
+	defer rows.Close()
+
+	presets := []entity.ReplayPreset{}
+
+	for rows.Next() {
+		var preset entity.ReplayPreset
+		var config string
+
+		err := rows.Scan(
+			&preset.UpdatedAtUnixMilli,
+			&preset.Name,
+			&config,
+		)
+		if err != nil {
+			return []entity.ReplayPreset{}, fmt.Errorf("[repository][sqlite][replayPresets][%s][rows.Scan] error: %w", method, err)
+		}
+
+		err = json.Unmarshal([]byte(config), &preset.Config)
+		if err != nil {
+			return []entity.ReplayPreset{}, fmt.Errorf("[repository][sqlite][replayPresets][%s][json.Unmarshal] error: %w", method, err)
+		}
+
+		presets = append(presets, preset)
+	}
+
+	return presets, nil
+}
@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"strings"
+)
+
+// symbols appends a row per sync, reads take the latest row of every exchange and pair.
+type symbols struct {
+	db *sql.DB
+}
+
+func NewSymbols(db *sql.DB) *symbols {
+	return &symbols{
+		db: db,
+	}
+}
+
+func (r *symbols) InsertMany(ctx context.Context, symbolInfos []entity.SymbolInfo) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO symbols (timestamp, exchange, symbol, base_asset, quote_asset, tick_size, lot_size, contract_type, status, listed_at, delisted_at) VALUES ")
+
+	vals := make([]any, 0, len(symbolInfos)*11)
+	for i, info := range symbolInfos {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", i*11+1, i*11+2, i*11+3, i*11+4, i*11+5, i*11+6, i*11+7, i*11+8, i*11+9, i*11+10, i*11+11)
+
+		vals = append(vals,
+			info.UpdatedAtUnixMilli, info.Exchange, info.Pair, info.BaseAsset, info.QuoteAsset,
+			info.TickSize.String(), info.LotSize.String(), info.ContractType, info.Status,
+			info.ListedAtUnixMilli, info.DelistedAtUnixMilli,
+		)
+	}
+
+	_, err := r.db.ExecContext(ctx, sb.String(), vals...)
+	if err != nil {
+		return fmt.Errorf("[repository][sqlite][symbols][InsertMany][db.ExecContext] error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *symbols) GetSymbols(ctx context.Context) ([]entity.SymbolInfo, error) {
+	q := `
+		SELECT timestamp, exchange, symbol, base_asset, quote_asset, tick_size, lot_size, contract_type, status, listed_at, delisted_at
+		FROM (
+			SELECT *, row_number() OVER (PARTITION BY exchange, symbol ORDER BY timestamp DESC, rowid DESC) AS latest
+			FROM symbols
+		)
+		WHERE latest = 1
+		ORDER BY exchange ASC, symbol ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, q)
+	if err != nil {
+		return []entity.SymbolInfo{}, fmt.Errorf("[repository][sqlite][symbols][GetSymbols][db.QueryContext] error: %w", err)
+	}
+	defer rows.Close()
+
+	symbolInfos := []entity.SymbolInfo{}
+
+	for rows.Next() {
+		var info entity.SymbolInfo
+
+		err := rows.Scan(
+			&info.UpdatedAtUnixMilli,
+			&info.Exchange,
+			&info.Pair,
+			&info.BaseAsset,
+			&info.QuoteAsset,
+			&info.TickSize,
+			&info.LotSize,
+			&info.ContractType,
+			&info.Status,
+			&info.ListedAtUnixMilli,
+			&info.DelistedAtUnixMilli,
+		)
+		if err != nil {
+			return []entity.SymbolInfo{}, fmt.Errorf("[repository][sqlite][symbols][GetSymbols][rows.Scan] error: %w", err)
+		}
+
+		info.Symbol = fmt.Sprintf("%s:%s", info.Exchange, info.Pair)
+
+		symbolInfos = append(symbolInfos, info)
+	}
+
+	return symbolInfos, nil
+}
@@ -0,0 +1,1375 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"michaelyusak/go-quant-replay-engine.git/adapter/binance_http/binancehttptest"
+	"michaelyusak/go-quant-replay-engine.git/adapter/binance_ws/binancewstest"
+	"michaelyusak/go-quant-replay-engine.git/adapter/synthetic"
+	"michaelyusak/go-quant-replay-engine.git/config"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+
+	binanceEntity "michaelyusak/go-quant-replay-engine.git/entity/binance"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	hEntity "github.com/michaelyusak/go-helper/entity"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	e2eApiKey = "e2e-admin-key"
+	e2eBars   = 5
+)
+
+// e2eStart is the open of the first bar the fake binance serves
+var e2eStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	logrus.SetOutput(io.Discard)
+
+	os.Exit(m.Run())
+}
+
+type e2eEnv struct {
+	binance *binancehttptest.Server
+	server  *httptest.Server
+}
+
+// newE2eEnv runs the whole router on the memory backend against a fake binance serving
+// e2eBars bars of BTCUSDT and ETHUSDT. The default preset replays the first four bars
+// of both at playbackSpeed. opts adjust the config before the router is built.
+func newE2eEnv(t *testing.T, playbackSpeed float32, opts ...func(conf *config.AppConfig)) *e2eEnv {
+	t.Helper()
+
+	binance := binancehttptest.NewServer()
+	t.Cleanup(binance.Close)
+
+	for _, pair := range []string{"BTCUSDT", "ETHUSDT"} {
+		binance.AddSymbols(binanceEntity.FapiExchangeInfoSymbol{
+			Symbol:       pair,
+			Pair:         pair,
+			ContractType: "PERPETUAL",
+			DeliveryDate: 4133404800000,
+			OnboardDate:  e2eStart.Add(-24 * time.Hour).UnixMilli(),
+			Status:       "TRADING",
+			BaseAsset:    strings.TrimSuffix(pair, "USDT"),
+			QuoteAsset:   "USDT",
+			Filters: []binanceEntity.FapiExchangeInfoFilter{
+				{FilterType: "PRICE_FILTER", TickSize: "0.10"},
+				{FilterType: "LOT_SIZE", StepSize: "0.001"},
+			},
+		})
+
+		for i := 0; i < e2eBars; i++ {
+			binance.AddKlines(e2eCandle(pair, i))
+		}
+	}
+
+	conf := config.AppConfig{
+		Service: config.ServiceConfig{
+			Storage: config.StorageConfig{Backend: storageBackendMemory},
+			Replay: config.ReplayConfig{
+				Stream: config.StreamReplayConfig{
+					Default: entity.ReplayConfiguration{
+						Symbols:            []string{"binance:BTCUSDT", "binance:ETHUSDT"},
+						PlaybackSpeed:      playbackSpeed,
+						StartTimeUnixMilli: e2eStart.UnixMilli(),
+						EndTimeUnixMilli:   e2eStart.Add(3 * time.Minute).UnixMilli(),
+					},
+				},
+			},
+		},
+		Cors: config.CorsConfig{AllowedOrigins: []string{"http://localhost"}},
+		Adapter: config.AdapterConfig{
+			BinanceHttp: config.BinanceHttpConfig{
+				FapiBaseUrl:        binance.FapiBaseUrl(),
+				FuturesDataBaseUrl: binance.FuturesDataBaseUrl(),
+			},
+		},
+		Auth: config.AuthConfig{
+			Jwt:           hHelper.JwtConfig{},
+			TokenDuration: hEntity.Duration(time.Hour),
+			ApiKeys:       []entity.ApiKey{{Key: e2eApiKey, UserId: "e2e", Role: entity.RoleAdmin}},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	server := httptest.NewServer(newRouter(&conf))
+	t.Cleanup(server.Close)
+
+	env := &e2eEnv{
+		binance: binance,
+		server:  server,
+	}
+
+	env.do(t, http.MethodPost, "/v1/write/binance/symbols", nil, http.StatusOK, nil)
+	for _, pair := range []string{"BTCUSDT", "ETHUSDT"} {
+		env.do(t, http.MethodPost, "/v1/write/binance", entity.ImportFromBinanceReq{
+			Symbol:             pair,
+			Interval:           "1m",
+			Limit:              2,
+			StartTimeUnixMilli: e2eStart.UnixMilli(),
+			EndTimeUnixMilli:   e2eStart.Add((e2eBars - 1) * time.Minute).UnixMilli(),
+		}, http.StatusOK, nil)
+	}
+
+	return env
+}
+
+// e2eCandle is bar i of pair as the fake binance serves it.
+func e2eCandle(pair string, i int) entity.Candle {
+	base := int64(100)
+	if pair == "ETHUSDT" {
+		base = 10
+	}
+
+	open := decimal.New(base*100+int64(i)*10, -2)
+	close := open.Add(decimal.RequireFromString("0.50"))
+
+	return entity.Candle{
+		Epoch:    e2eStart.Add(time.Duration(i) * time.Minute).Unix(),
+		Exchange: "binance",
+		Pair:     pair,
+		Open:     open,
+		High:     close.Add(decimal.RequireFromString("1.00")),
+		Low:      open.Sub(decimal.RequireFromString("1.00")),
+		Close:    close,
+		Volume: entity.CandleVolume{
+			Total: decimal.RequireFromString("12.500"),
+			Buy:   decimal.RequireFromString("7.250"),
+			Sell:  decimal.RequireFromString("5.250"),
+		},
+	}
+}
+
+func (e *e2eEnv) do(t *testing.T, method, path string, body any, wantStatus int, out any) {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("json.Marshal error: %v", err)
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, e.server.URL+path, reqBody)
+	if err != nil {
+		t.Fatalf("http.NewRequest error: %v", err)
+	}
+	req.Header.Set("X-Api-Key", e2eApiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	raw, _ := io.ReadAll(res.Body)
+	if res.StatusCode != wantStatus {
+		t.Fatalf("%s %s status %d, want %d: %s", method, path, res.StatusCode, wantStatus, raw)
+	}
+
+	if out == nil {
+		return
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	err = json.Unmarshal(raw, &envelope)
+	if err == nil {
+		err = json.Unmarshal(envelope.Data, out)
+	}
+	if err != nil {
+		t.Fatalf("%s %s decode error: %v: %s", method, path, err, raw)
+	}
+}
+
+func (e *e2eEnv) createStream(t *testing.T) entity.CreateStreamRes {
+	t.Helper()
+
+	var res entity.CreateStreamRes
+	e.do(t, http.MethodPost, "/v1/stream/create", entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute)}, http.StatusOK, &res)
+
+	return res
+}
+
+// startStream connects to the stream and authenticates with token.
+func (e *e2eEnv) startStream(t *testing.T, channel, token string) *websocket.Conn {
+	t.Helper()
+
+	return e.dialStream(t, entity.WsAuthData{Channel: channel, Token: token})
+}
+
+// dialStream connects to the stream and authenticates with auth.
+func (e *e2eEnv) dialStream(t *testing.T, auth entity.WsAuthData) *websocket.Conn {
+	t.Helper()
+
+	header := http.Header{}
+	header.Set("X-Api-Key", e2eApiKey)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(e.server.URL, "http")+"/v1/stream/start", header)
+	if err != nil {
+		t.Fatalf("websocket dial error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	authData, _ := json.Marshal(auth)
+	err = conn.WriteJSON(entity.WsMessage{Type: string(entity.WsMessageTypeAuth), Data: authData})
+	if err != nil {
+		t.Fatalf("auth write error: %v", err)
+	}
+
+	return conn
+}
+
+type receivedMessage struct {
+	entity.WsMessage
+	at time.Time
+}
+
+// readUntilEnd reads up to and including the end message, it stops early on a closed connection.
+func readUntilEnd(t *testing.T, conn *websocket.Conn) ([]receivedMessage, error) {
+	t.Helper()
+
+	msgs := []receivedMessage{}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+		var msg entity.WsMessage
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			return msgs, err
+		}
+
+		msgs = append(msgs, receivedMessage{WsMessage: msg, at: time.Now()})
+
+		if msg.Type == string(entity.WsMessageTypeEnd) {
+			return msgs, nil
+		}
+	}
+}
+
+// expectClosed asserts the server closes the connection with a normal closure.
+func expectClosed(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	_, raw, err := conn.ReadMessage()
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseNormalClosure {
+		t.Fatalf("want a normal close, got message %s error %v", raw, err)
+	}
+}
+
+// waitFor polls cond until it holds or a few seconds went by.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// e2eDefaultSequence is what a replay of the default preset sends, heartbeats aside.
+func e2eDefaultSequence() []string {
+	want := []string{"start", "status streaming"}
+	for i := 0; i < 4; i++ {
+		btc, eth := e2eCandle("BTCUSDT", i), e2eCandle("ETHUSDT", i)
+
+		want = append(want,
+			fmt.Sprintf("candle binance:BTCUSDT %d %s %s", i*60, btc.Open.String(), btc.Close.String()),
+			fmt.Sprintf("candle binance:ETHUSDT %d %s %s", i*60, eth.Open.String(), eth.Close.String()),
+			fmt.Sprintf("bar_close %d 2", i*60),
+		)
+	}
+
+	return append(want, "status finished", "end finished 8")
+}
+
+// describeAll describes every message but the heartbeats.
+func describeAll(msgs []receivedMessage) []string {
+	described := []string{}
+	for _, msg := range msgs {
+		if msg.Type != string(entity.WsMessageTypeHeartbeat) {
+			described = append(described, describe(msg))
+		}
+	}
+
+	return described
+}
+
+func describe(msg receivedMessage) string {
+	switch entity.WsMessageType(msg.Type) {
+	case entity.WsMessageTypeCandle, entity.WsMessageTypeCandleUpdate:
+		var candle entity.Candle
+		json.Unmarshal(msg.Data, &candle)
+
+		return fmt.Sprintf("%s %s %d %s %s", msg.Type, candle.Symbol, candle.Epoch-e2eStart.Unix(), candle.Open.String(), candle.Close.String())
+	case entity.WsMessageTypeBarClose:
+		var barClose entity.BarCloseData
+		json.Unmarshal(msg.Data, &barClose)
+
+		return fmt.Sprintf("bar_close %d %d", barClose.Epoch-e2eStart.Unix(), barClose.Candles)
+	case entity.WsMessageTypeStatus:
+		var status entity.StreamStatusData
+		json.Unmarshal(msg.Data, &status)
+
+		return fmt.Sprintf("status %s", status.Status)
+	case entity.WsMessageTypeEnd:
+		var end entity.StreamEndData
+		json.Unmarshal(msg.Data, &end)
+
+		return fmt.Sprintf("end %s %d", end.Reason, end.Candles)
+	case entity.WsMessageTypeSegmentStart, entity.WsMessageTypeSegmentEnd:
+		var segment entity.SegmentData
+		json.Unmarshal(msg.Data, &segment)
+
+		return fmt.Sprintf("%s %d %s", msg.Type, segment.Index, segment.Name)
+	case entity.WsMessageTypeError:
+		var streamErr entity.StreamErrorData
+		json.Unmarshal(msg.Data, &streamErr)
+
+		return fmt.Sprintf("error %s", streamErr.Message)
+	default:
+		return msg.Type
+	}
+}
+
+func TestE2eImportPagesThroughBinance(t *testing.T) {
+	env := newE2eEnv(t, 1200)
+
+	// 5 bars at 2 a page take 3 pages per symbol, the last page runs past the end
+	if got := env.binance.Requests("/fapi/v1/klines"); got != 6 {
+		t.Fatalf("klines requests = %d, want 6", got)
+	}
+
+	var symbols []entity.SymbolInfo
+	env.do(t, http.MethodGet, "/v1/symbols", nil, http.StatusOK, &symbols)
+
+	if len(symbols) != 2 || symbols[0].Symbol != "binance:BTCUSDT" || !symbols[0].TickSize.Equal(decimal.RequireFromString("0.1")) {
+		t.Fatalf("symbols = %+v", symbols)
+	}
+}
+
+func TestE2eReplayStreamsTheExactSequenceAtPace(t *testing.T) {
+	// a minute bar every 50ms
+	env := newE2eEnv(t, 1200)
+	candleDelay := 50 * time.Millisecond
+
+	stream := env.createStream(t)
+	conn := env.startStream(t, stream.Channel, stream.Token)
+
+	msgs, err := readUntilEnd(t, conn)
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(msgs), err)
+	}
+
+	want := e2eDefaultSequence()
+
+	got := []string{}
+	// the arrival of the candles of every epoch, in epoch order
+	epochTimes := [][]time.Time{}
+	lastEpoch := int64(-1)
+
+	for i, msg := range msgs {
+		if msg.Seq != int64(i+1) {
+			t.Fatalf("message %d has seq %d", i, msg.Seq)
+		}
+
+		if msg.Type == string(entity.WsMessageTypeHeartbeat) {
+			continue
+		}
+
+		got = append(got, describe(msg))
+
+		if msg.Type == string(entity.WsMessageTypeCandle) {
+			var candle entity.Candle
+			json.Unmarshal(msg.Data, &candle)
+
+			if candle.Epoch != lastEpoch {
+				epochTimes = append(epochTimes, nil)
+				lastEpoch = candle.Epoch
+			}
+			epochTimes[len(epochTimes)-1] = append(epochTimes[len(epochTimes)-1], msg.at)
+		}
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("sequence\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var candle entity.Candle
+	json.Unmarshal(msgs[2].Data, &candle)
+	if btc := e2eCandle("BTCUSDT", 0); !candle.High.Equal(btc.High) || !candle.Low.Equal(btc.Low) || !candle.Volume.Buy.Equal(btc.Volume.Buy) || !candle.Volume.Sell.Equal(btc.Volume.Sell) {
+		t.Fatalf("candle = %+v, want %+v", candle, btc)
+	}
+
+	// the sender waits the delay once an epoch is out, whatever its number of symbols,
+	// timers only ever run late
+	for i, times := range epochTimes {
+		if len(times) != 2 {
+			t.Fatalf("epoch %d has %d candles, want 2", i, len(times))
+		}
+
+		if gap := times[1].Sub(times[0]); gap > candleDelay/2 {
+			t.Fatalf("the candles of epoch %d came %s apart, want them back to back", i, gap)
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		if gap := times[0].Sub(epochTimes[i-1][0]); gap < candleDelay*7/10 {
+			t.Fatalf("epoch %d came %s after the previous one, want about %s", i, gap, candleDelay)
+		}
+	}
+
+	first, last := epochTimes[0][0], epochTimes[len(epochTimes)-1][0]
+	if total := last.Sub(first); total > 20*candleDelay*time.Duration(len(epochTimes)) {
+		t.Fatalf("the replay took %s, it is not paced by the playback speed", total)
+	}
+
+	expectClosed(t, conn)
+
+	var info entity.StreamInfo
+	waitFor(t, "the client to be released", func() bool {
+		env.do(t, http.MethodGet, "/v1/streams/"+stream.Channel, nil, http.StatusOK, &info)
+		return info.Clients == 0
+	})
+
+	if info.Status != entity.StreamStatusFinished || info.CursorEpoch != e2eStart.Add(3*time.Minute).Unix() {
+		t.Fatalf("stream info = %+v", info)
+	}
+}
+
+func TestE2eReplayReadsTheRollupOfTheCandleSize(t *testing.T) {
+	env := newE2eEnv(t, 6000)
+
+	var stream entity.CreateStreamRes
+	env.do(t, http.MethodPost, "/v1/stream/create", entity.CreateStreamReq{CandleSize: hEntity.Duration(5 * time.Minute)}, http.StatusOK, &stream)
+
+	conn := env.startStream(t, stream.Channel, stream.Token)
+
+	msgs, err := readUntilEnd(t, conn)
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(msgs), err)
+	}
+
+	// the five imported bars of each symbol make up one 5m bar
+	candles := []entity.Candle{}
+	for _, msg := range msgs {
+		if msg.Type == string(entity.WsMessageTypeCandle) {
+			var candle entity.Candle
+			json.Unmarshal(msg.Data, &candle)
+
+			candles = append(candles, candle)
+		}
+	}
+
+	if len(candles) != 2 {
+		t.Fatalf("got %d candles, want one 5m bar per symbol", len(candles))
+	}
+
+	first, last := e2eCandle("BTCUSDT", 0), e2eCandle("BTCUSDT", e2eBars-1)
+	got := candles[0]
+	if got.Symbol != "binance:BTCUSDT" || got.Epoch != e2eStart.Unix() ||
+		!got.Open.Equal(first.Open) || !got.High.Equal(last.High) || !got.Low.Equal(first.Low) || !got.Close.Equal(last.Close) ||
+		!got.Volume.Total.Equal(first.Volume.Total.Mul(decimal.NewFromInt(e2eBars))) {
+		t.Fatalf("5m bar = %+v", got)
+	}
+
+	var rebuilt entity.RebuildRollupsRes
+	env.do(t, http.MethodPost, "/v1/write/rollups/rebuild", entity.RebuildRollupsReq{
+		StartTimeUnixMilli: e2eStart.UnixMilli(),
+		EndTimeUnixMilli:   e2eStart.Add(time.Hour).UnixMilli(),
+	}, http.StatusOK, &rebuilt)
+
+	// one bar per symbol and rollup interval
+	if rebuilt.Candles != int64(2*len(entity.RollupIntervals)) {
+		t.Fatalf("rebuilt %d candles, want %d", rebuilt.Candles, 2*len(entity.RollupIntervals))
+	}
+}
+
+func TestE2eReplayReadsAheadWithinTheBufferBounds(t *testing.T) {
+	// two bars of read-ahead and room for two messages force a read per bar
+	env := newE2eEnv(t, 1200, func(conf *config.AppConfig) {
+		conf.Service.Replay.Pipeline = entity.ReplayPipelineConfig{
+			ReadAhead:           hEntity.Duration(time.Minute),
+			MinPageSize:         1,
+			MaxPageSize:         1,
+			MaxBufferedMessages: 2,
+		}
+	})
+
+	stream := env.createStream(t)
+	conn := env.startStream(t, stream.Channel, stream.Token)
+
+	msgs, err := readUntilEnd(t, conn)
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(msgs), err)
+	}
+
+	if got, want := describeAll(msgs), e2eDefaultSequence(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("sequence\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var info entity.StreamInfo
+	env.do(t, http.MethodGet, "/v1/streams/"+stream.Channel, nil, http.StatusOK, &info)
+
+	pipeline := info.Pipeline
+	if pipeline == nil {
+		t.Fatalf("stream info has no pipeline stats")
+	}
+
+	// a page has to hold two epochs of both symbols, the window is raised to two bars
+	if pipeline.BufferCapacity != 2 || pipeline.PageSize != 4 || pipeline.Pages < 3 || pipeline.ReadAheadMilli != (2*time.Minute).Milliseconds() {
+		t.Fatalf("pipeline stats = %+v", *pipeline)
+	}
+}
+
+func TestE2eReplayPagesNeverDropOrRepeatBars(t *testing.T) {
+	// pages are at least two epochs of both symbols, 4 candles, up to the whole window
+	for pageSize := 4; pageSize <= 9; pageSize++ {
+		t.Run(fmt.Sprintf("page %d", pageSize), func(t *testing.T) {
+			env := newE2eEnv(t, 60000, func(conf *config.AppConfig) {
+				conf.Service.Replay.Pipeline = entity.ReplayPipelineConfig{
+					MinPageSize: pageSize,
+					MaxPageSize: pageSize,
+				}
+			})
+
+			stream := env.createStream(t)
+			conn := env.startStream(t, stream.Channel, stream.Token)
+
+			msgs, err := readUntilEnd(t, conn)
+			if err != nil {
+				t.Fatalf("read error after %d messages: %v", len(msgs), err)
+			}
+
+			if got, want := describeAll(msgs), e2eDefaultSequence(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Fatalf("sequence\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestE2eReplaySkipsTheTimeTheCalendarExcludes(t *testing.T) {
+	// a minute bar every 50ms
+	env := newE2eEnv(t, 1200)
+	candleDelay := 50 * time.Millisecond
+
+	conf := entity.ReplayConfiguration{
+		Symbols:            []string{"binance:BTCUSDT", "binance:ETHUSDT"},
+		PlaybackSpeed:      1200,
+		StartTimeUnixMilli: e2eStart.UnixMilli(),
+		EndTimeUnixMilli:   e2eStart.Add(3 * time.Minute).UnixMilli(),
+		// e2eStart is 07:00 of a monday in jakarta, the session drops bar 0 and the exclusion bar 2
+		Calendar: &entity.Calendar{
+			Timezone: "Asia/Jakarta",
+			Weekdays: []string{"mon", "tue"},
+			Sessions: []entity.CalendarSession{{Start: "07:01", End: "23:00"}},
+			Exclusions: []entity.TimeRange{{
+				StartTimeUnixMilli: e2eStart.Add(2 * time.Minute).UnixMilli(),
+				EndTimeUnixMilli:   e2eStart.Add(2*time.Minute + 30*time.Second).UnixMilli(),
+			}},
+		},
+	}
+
+	env.do(t, http.MethodPut, "/v1/presets/"+entity.ReplayPresetDefault, conf, http.StatusOK, nil)
+
+	stream := env.createStream(t)
+	conn := env.startStream(t, stream.Channel, stream.Token)
+
+	msgs, err := readUntilEnd(t, conn)
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(msgs), err)
+	}
+
+	want := []string{"start", "status streaming"}
+	for _, i := range []int{1, 3} {
+		btc, eth := e2eCandle("BTCUSDT", i), e2eCandle("ETHUSDT", i)
+
+		want = append(want,
+			fmt.Sprintf("candle binance:BTCUSDT %d %s %s", i*60, btc.Open.String(), btc.Close.String()),
+			fmt.Sprintf("candle binance:ETHUSDT %d %s %s", i*60, eth.Open.String(), eth.Close.String()),
+			fmt.Sprintf("bar_close %d 2", i*60),
+		)
+	}
+	want = append(want, "status finished", "end finished 4")
+
+	if got := describeAll(msgs); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("sequence\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// bar 3 follows bar 1 after a single delay, the skipped bar is not slept through
+	candleTimes := []time.Time{}
+	for _, msg := range msgs {
+		if msg.Type == string(entity.WsMessageTypeCandle) {
+			candleTimes = append(candleTimes, msg.at)
+		}
+	}
+
+	if gap := candleTimes[2].Sub(candleTimes[1]); gap > 3*candleDelay {
+		t.Fatalf("bar 3 came %s after bar 1, want about %s", gap, candleDelay)
+	}
+
+	conf.Calendar = &entity.Calendar{Timezone: "Mars/Olympus_Mons"}
+	env.do(t, http.MethodPut, "/v1/presets/"+entity.ReplayPresetDefault, conf, http.StatusUnprocessableEntity, nil)
+}
+
+func TestE2eReplayPlaysItsWindowsBackToBack(t *testing.T) {
+	env := newE2eEnv(t, 6000)
+
+	conf := entity.ReplayConfiguration{
+		Symbols:       []string{"binance:BTCUSDT", "binance:ETHUSDT"},
+		PlaybackSpeed: 6000,
+		Windows: []entity.ReplayWindow{
+			{Name: "first", StartTimeUnixMilli: e2eStart.UnixMilli(), EndTimeUnixMilli: e2eStart.Add(time.Minute).UnixMilli()},
+			{Name: "last", StartTimeUnixMilli: e2eStart.Add(3 * time.Minute).UnixMilli(), EndTimeUnixMilli: e2eStart.Add(4 * time.Minute).UnixMilli()},
+		},
+	}
+
+	env.do(t, http.MethodPut, "/v1/presets/"+entity.ReplayPresetDefault, conf, http.StatusOK, nil)
+
+	stream := env.createStream(t)
+	conn := env.startStream(t, stream.Channel, stream.Token)
+
+	msgs, err := readUntilEnd(t, conn)
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(msgs), err)
+	}
+
+	want := []string{"start", "status streaming"}
+	for segment, bars := range [][]int{{0, 1}, {3, 4}} {
+		want = append(want, fmt.Sprintf("segment_start %d %s", segment, conf.Windows[segment].Name))
+
+		for _, i := range bars {
+			btc, eth := e2eCandle("BTCUSDT", i), e2eCandle("ETHUSDT", i)
+
+			want = append(want,
+				fmt.Sprintf("candle binance:BTCUSDT %d %s %s", i*60, btc.Open.String(), btc.Close.String()),
+				fmt.Sprintf("candle binance:ETHUSDT %d %s %s", i*60, eth.Open.String(), eth.Close.String()),
+				fmt.Sprintf("bar_close %d 2", i*60),
+			)
+		}
+
+		want = append(want, fmt.Sprintf("segment_end %d %s", segment, conf.Windows[segment].Name))
+	}
+	want = append(want, "status finished", "end finished 8")
+
+	if got := describeAll(msgs); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("sequence\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// the windows have to follow each other
+	conf.Windows[1].StartTimeUnixMilli = conf.Windows[0].EndTimeUnixMilli
+	env.do(t, http.MethodPut, "/v1/presets/"+entity.ReplayPresetDefault, conf, http.StatusUnprocessableEntity, nil)
+}
+
+// replayScenario plays a stream of req through and describes what it sent.
+func (e *e2eEnv) replayScenario(t *testing.T, req entity.CreateStreamReq) (entity.CreateStreamRes, []receivedMessage) {
+	t.Helper()
+
+	var stream entity.CreateStreamRes
+	e.do(t, http.MethodPost, "/v1/stream/create", req, http.StatusOK, &stream)
+
+	conn := e.startStream(t, stream.Channel, stream.Token)
+
+	msgs, err := readUntilEnd(t, conn)
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(msgs), err)
+	}
+
+	return stream, msgs
+}
+
+func TestE2eScenariosRepeatFromTheirSeed(t *testing.T) {
+	// pages of two epochs read the bars of every epoch twice, the noise must not change in between
+	env := newE2eEnv(t, 60000, func(conf *config.AppConfig) {
+		conf.Service.Replay.Pipeline = entity.ReplayPipelineConfig{MinPageSize: 4, MaxPageSize: 4}
+	})
+
+	scenarios := []entity.Scenario{
+		{
+			Mode:                    entity.ScenarioModeRandomStart,
+			RangeStartTimeUnixMilli: e2eStart.UnixMilli(),
+			RangeEndTimeUnixMilli:   e2eStart.Add(4 * time.Minute).UnixMilli(),
+			Length:                  hEntity.Duration(2 * time.Minute),
+			Jitter:                  0.01,
+		},
+		{Mode: entity.ScenarioModeJitter, Jitter: 0.01},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(string(scenario.Mode), func(t *testing.T) {
+			first, firstMsgs := env.replayScenario(t, entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Scenario: &scenario})
+
+			drawn := first.Scenario
+			if drawn == nil || drawn.Seed == 0 || drawn.EndTimeUnixMilli < drawn.StartTimeUnixMilli {
+				t.Fatalf("scenario = %+v", drawn)
+			}
+
+			// the drawn scenario repeats the run
+			again, againMsgs := env.replayScenario(t, entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Scenario: drawn})
+
+			got, want := describeAll(againMsgs), describeAll(firstMsgs)
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Fatalf("repeated run\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+
+			if again.Scenario.StartTimeUnixMilli != drawn.StartTimeUnixMilli || again.Scenario.Seed != drawn.Seed {
+				t.Fatalf("repeated scenario = %+v, want %+v", *again.Scenario, *drawn)
+			}
+
+			bars := (drawn.EndTimeUnixMilli-drawn.StartTimeUnixMilli)/time.Minute.Milliseconds() + 1
+			if got := strings.Count(strings.Join(got, "\n"), "bar_close"); int64(got) != bars {
+				t.Fatalf("got %d bars, want %d\n%s", got, bars, strings.Join(want, "\n"))
+			}
+
+			// the jitter moves every price off the stored one
+			for _, msg := range againMsgs {
+				if msg.Type != string(entity.WsMessageTypeCandle) {
+					continue
+				}
+
+				var candle entity.Candle
+				json.Unmarshal(msg.Data, &candle)
+
+				stored := e2eCandle(candle.Pair, int(candle.Epoch-e2eStart.Unix())/60)
+				if candle.Open.Equal(stored.Open) || candle.High.LessThan(decimal.Max(candle.Open, candle.Close)) || candle.Low.GreaterThan(decimal.Min(candle.Open, candle.Close)) {
+					t.Fatalf("candle %+v against stored %+v", candle, stored)
+				}
+			}
+		})
+	}
+}
+
+func TestE2eBootstrapChainsTheDrawnDays(t *testing.T) {
+	env := newE2eEnv(t, 60000)
+
+	stream, msgs := env.replayScenario(t, entity.CreateStreamReq{
+		CandleSize: hEntity.Duration(time.Minute),
+		Scenario: &entity.Scenario{
+			Mode:      entity.ScenarioModeBlockBootstrap,
+			Seed:      7,
+			BlockDays: 1,
+			Days:      2,
+		},
+	})
+
+	// the range holds the one stored day, it is drawn for both days of the path
+	if got := stream.Scenario; got.Days != 2 || len(got.Blocks) != 2 || got.Blocks[1] != e2eStart.UnixMilli() ||
+		got.StartTimeUnixMilli != e2eStart.UnixMilli() || got.EndTimeUnixMilli != e2eStart.Add(48*time.Hour-time.Second).UnixMilli() {
+		t.Fatalf("scenario = %+v", *got)
+	}
+
+	btc := []entity.Candle{}
+	for _, msg := range msgs {
+		var candle entity.Candle
+		if msg.Type == string(entity.WsMessageTypeCandle) && json.Unmarshal(msg.Data, &candle) == nil && candle.Pair == "BTCUSDT" {
+			btc = append(btc, candle)
+		}
+	}
+
+	if len(btc) != 2*e2eBars {
+		t.Fatalf("got %d BTCUSDT bars, want %d", len(btc), 2*e2eBars)
+	}
+
+	// the second day plays the bars of the first again, going on from its close
+	first, second := btc[0], btc[e2eBars]
+	if second.Epoch != first.Epoch+24*60*60 || !second.Open.Equal(btc[e2eBars-1].Close) || !first.Open.Equal(e2eCandle("BTCUSDT", 0).Open) {
+		t.Fatalf("first day opens with %+v, second day with %+v", first, second)
+	}
+}
+
+// syntheticCandles are the candles of a replay, checked to be the bars market generates from e2eStart.
+func syntheticCandles(t *testing.T, market entity.SyntheticMarket, msgs []receivedMessage) []entity.Candle {
+	t.Helper()
+
+	generator, err := synthetic.NewGenerator(market, e2eStart)
+	if err != nil {
+		t.Fatalf("synthetic.NewGenerator error: %v", err)
+	}
+
+	candles := []entity.Candle{}
+	generated := []entity.Candle{}
+	for _, msg := range msgs {
+		var candle entity.Candle
+		if msg.Type != string(entity.WsMessageTypeCandle) || json.Unmarshal(msg.Data, &candle) != nil {
+			continue
+		}
+
+		if len(generated) == 0 {
+			generated = generator.Next()
+		}
+		want := generated[0]
+		generated = generated[1:]
+
+		if candle.Symbol != want.Exchange+":"+want.Pair || candle.Epoch != want.Epoch || !candle.Open.Equal(want.Open) || !candle.High.Equal(want.High) ||
+			!candle.Low.Equal(want.Low) || !candle.Close.Equal(want.Close) || !candle.Volume.Total.Equal(want.Volume.Total) || !candle.Volume.Buy.Equal(want.Volume.Buy) {
+			t.Fatalf("candle %+v, generated %+v", candle, want)
+		}
+
+		if candle.High.LessThan(decimal.Max(candle.Open, candle.Close)) || candle.Low.GreaterThan(decimal.Min(candle.Open, candle.Close)) ||
+			!candle.Volume.Buy.Add(candle.Volume.Sell).Equal(candle.Volume.Total) {
+			t.Fatalf("candle %+v is not a valid bar", candle)
+		}
+
+		candles = append(candles, candle)
+	}
+
+	return candles
+}
+
+func TestE2eSyntheticMarketsRepeatFromTheirSeed(t *testing.T) {
+	// pages of two epochs make the generator go on across reads
+	env := newE2eEnv(t, 60000, func(conf *config.AppConfig) {
+		conf.Service.Replay.Pipeline = entity.ReplayPipelineConfig{MinPageSize: 4, MaxPageSize: 4}
+	})
+
+	markets := []entity.SyntheticMarket{
+		{Model: entity.SyntheticModelGbm, Pairs: []string{"BBB", "AAA"}, Drift: 0.1, Volatility: 0.8},
+		{Model: entity.SyntheticModelOu, Pairs: []string{"AAA", "BBB"}, Volatility: 0.8, MeanReversion: 50},
+		{Model: entity.SyntheticModelJumpDiffusion, Pairs: []string{"AAA", "BBB"}, Volatility: 0.8, JumpsPerDay: 500, JumpVolatility: 0.01},
+		{
+			Model:          entity.SyntheticModelRegimeSwitching,
+			Pairs:          []string{"AAA", "BBB"},
+			Regimes:        []entity.SyntheticRegime{{Volatility: 0.2}, {Drift: -1, Volatility: 2}},
+			SwitchesPerDay: 500,
+		},
+	}
+
+	for _, market := range markets {
+		t.Run(string(market.Model), func(t *testing.T) {
+			first, firstMsgs := env.replayScenario(t, entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Synthetic: &market})
+
+			drawn := first.Synthetic
+			if drawn == nil || drawn.Seed == 0 || drawn.Exchange != entity.SyntheticExchangeDefault || drawn.StartPrice != 100 {
+				t.Fatalf("synthetic = %+v", drawn)
+			}
+
+			// the drawn market repeats the run
+			_, againMsgs := env.replayScenario(t, entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Synthetic: drawn})
+
+			got, want := describeAll(againMsgs), describeAll(firstMsgs)
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Fatalf("repeated run\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+
+			// the four bars of the preset window, of both pairs in place of the preset symbols
+			candles := syntheticCandles(t, *drawn, againMsgs)
+			if len(candles) != 8 || candles[0].Symbol != "synthetic:AAA" || candles[1].Symbol != "synthetic:BBB" {
+				t.Fatalf("got %d candles\n%s", len(candles), strings.Join(got, "\n"))
+			}
+
+			if !strings.HasSuffix(strings.Join(got, "\n"), "end finished 8") {
+				t.Fatalf("sequence\n%s", strings.Join(got, "\n"))
+			}
+		})
+	}
+
+	env.do(t, http.MethodPost, "/v1/stream/create", entity.CreateStreamReq{
+		CandleSize: hEntity.Duration(time.Minute),
+		Synthetic:  &entity.SyntheticMarket{Model: "brownian", Pairs: []string{"AAA"}},
+	}, http.StatusUnprocessableEntity, nil)
+}
+
+func TestE2eSyntheticChannelReplaysTheSameBarsOnEveryStart(t *testing.T) {
+	env := newE2eEnv(t, 60000, func(conf *config.AppConfig) {
+		conf.Service.Replay.Pipeline = entity.ReplayPipelineConfig{MinPageSize: 4, MaxPageSize: 4}
+	})
+
+	var stream entity.CreateStreamRes
+	env.do(t, http.MethodPost, "/v1/stream/create", entity.CreateStreamReq{
+		CandleSize: hEntity.Duration(time.Minute),
+		Synthetic:  &entity.SyntheticMarket{Model: entity.SyntheticModelGbm, Pairs: []string{"AAA", "BBB"}, Volatility: 0.8},
+	}, http.StatusOK, &stream)
+
+	first, err := readUntilEnd(t, env.startStream(t, stream.Channel, stream.Token))
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(first), err)
+	}
+
+	want := describeAll(first)
+	if candles := syntheticCandles(t, *stream.Synthetic, first); len(candles) != 8 {
+		t.Fatalf("got %d candles\n%s", len(candles), strings.Join(want, "\n"))
+	}
+
+	// a start after the first one and two at once all play the market from its seed
+	conns := []*websocket.Conn{
+		env.startStream(t, stream.Channel, stream.Token),
+		env.startStream(t, stream.Channel, stream.Token),
+	}
+
+	runs := make([][]receivedMessage, len(conns))
+	errs := make([]error, len(conns))
+
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			runs[i], errs[i] = readUntilEnd(t, conn)
+		}()
+	}
+	wg.Wait()
+
+	for i, msgs := range runs {
+		if errs[i] != nil {
+			t.Fatalf("run %d read error after %d messages: %v", i, len(msgs), errs[i])
+		}
+
+		if got := describeAll(msgs); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("run %d\n%s\nwant\n%s", i, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+func TestE2eWrittenSyntheticMarketReplaysLikeStoredHistory(t *testing.T) {
+	env := newE2eEnv(t, 60000)
+
+	var written entity.WriteSyntheticRes
+	env.do(t, http.MethodPost, "/v1/write/synthetic", entity.WriteSyntheticReq{
+		Market:             entity.SyntheticMarket{Model: entity.SyntheticModelGbm, Seed: 11, Exchange: "sim", Pairs: []string{"AAA"}, Volatility: 0.5},
+		StartTimeUnixMilli: e2eStart.UnixMilli(),
+		EndTimeUnixMilli:   e2eStart.Add(3 * time.Minute).UnixMilli(),
+	}, http.StatusOK, &written)
+
+	if written.Candles != 4 || strings.Join(written.Symbols, ",") != "sim:AAA" || written.Market.Seed != 11 {
+		t.Fatalf("written = %+v", written)
+	}
+
+	conf := entity.ReplayConfiguration{
+		Symbols:            written.Symbols,
+		PlaybackSpeed:      60000,
+		StartTimeUnixMilli: e2eStart.UnixMilli(),
+		EndTimeUnixMilli:   e2eStart.Add(3 * time.Minute).UnixMilli(),
+	}
+	env.do(t, http.MethodPut, "/v1/presets/"+entity.ReplayPresetDefault, conf, http.StatusOK, nil)
+
+	_, msgs := env.replayScenario(t, entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute)})
+
+	if candles := syntheticCandles(t, written.Market, msgs); len(candles) != 4 {
+		t.Fatalf("got %d candles\n%s", len(candles), strings.Join(describeAll(msgs), "\n"))
+	}
+
+	env.do(t, http.MethodPost, "/v1/write/synthetic", entity.WriteSyntheticReq{
+		Market:             entity.SyntheticMarket{Model: entity.SyntheticModelOu, Pairs: []string{"AAA"}},
+		StartTimeUnixMilli: e2eStart.UnixMilli(),
+		EndTimeUnixMilli:   e2eStart.Add(3 * time.Minute).UnixMilli(),
+	}, http.StatusUnprocessableEntity, nil)
+}
+
+func TestE2eDeleteEndsARunningStream(t *testing.T) {
+	// a bar every second, the stream is deleted long before it finishes
+	env := newE2eEnv(t, 60)
+
+	stream := env.createStream(t)
+	conn := env.startStream(t, stream.Channel, stream.Token)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		var msg entity.WsMessage
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			t.Fatalf("read error before the first candle: %v", err)
+		}
+
+		if msg.Type == string(entity.WsMessageTypeCandle) {
+			break
+		}
+	}
+
+	env.do(t, http.MethodDelete, "/v1/streams/"+stream.Channel, nil, http.StatusOK, nil)
+
+	msgs, err := readUntilEnd(t, conn)
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(msgs), err)
+	}
+
+	if last := describe(msgs[len(msgs)-1]); !strings.HasPrefix(last, "end deleted") {
+		t.Fatalf("last message = %s, want the deleted end", last)
+	}
+
+	expectClosed(t, conn)
+
+	env.do(t, http.MethodGet, "/v1/streams/"+stream.Channel, nil, http.StatusNotFound, nil)
+}
+
+func TestE2eClientLeavingReleasesTheStream(t *testing.T) {
+	env := newE2eEnv(t, 60)
+
+	stream := env.createStream(t)
+	conn := env.startStream(t, stream.Channel, stream.Token)
+
+	var usage entity.Usage
+	waitFor(t, "the stream to start", func() bool {
+		env.do(t, http.MethodGet, "/v1/usage", nil, http.StatusOK, &usage)
+		return usage.ConcurrentStreams == 1
+	})
+
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "leaving"))
+	conn.Close()
+
+	waitFor(t, "the stream slot to be released", func() bool {
+		env.do(t, http.MethodGet, "/v1/usage", nil, http.StatusOK, &usage)
+		return usage.ConcurrentStreams == 0
+	})
+
+	var info entity.StreamInfo
+	env.do(t, http.MethodGet, "/v1/streams/"+stream.Channel, nil, http.StatusOK, &info)
+	if info.Clients != 0 || info.Status == entity.StreamStatusFinished {
+		t.Fatalf("stream info = %+v", info)
+	}
+}
+
+// readUntilCandle reads up to and including the first candle.
+func readUntilCandle(t *testing.T, conn *websocket.Conn) []receivedMessage {
+	t.Helper()
+
+	msgs := []receivedMessage{}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+		var msg entity.WsMessage
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			t.Fatalf("read error after %d messages: %v", len(msgs), err)
+		}
+
+		msgs = append(msgs, receivedMessage{WsMessage: msg, at: time.Now()})
+
+		if msg.Type == string(entity.WsMessageTypeCandle) {
+			return msgs
+		}
+	}
+}
+
+func TestE2eLateSubscriberCatchesUpOnTheSharedSession(t *testing.T) {
+	// a bar every 200ms, the second subscriber joins after the first bar went out
+	env := newE2eEnv(t, 300)
+
+	var stream entity.CreateStreamRes
+	env.do(t, http.MethodPost, "/v1/stream/create", entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Shared: true}, http.StatusOK, &stream)
+
+	first := env.startStream(t, stream.Channel, stream.Token)
+	firstMsgs := readUntilCandle(t, first)
+
+	late := env.dialStream(t, entity.WsAuthData{Channel: stream.Channel, Token: stream.Token, CatchUp: true})
+
+	lateMsgs, err := readUntilEnd(t, late)
+	if err != nil {
+		t.Fatalf("late read error after %d messages: %v", len(lateMsgs), err)
+	}
+
+	rest, err := readUntilEnd(t, first)
+	if err != nil {
+		t.Fatalf("first read error after %d messages: %v", len(rest), err)
+	}
+	firstMsgs = append(firstMsgs, rest...)
+
+	// both saw the one session, the late one from its start on
+	want := strings.Join(e2eDefaultSequence(), "\n")
+	for name, msgs := range map[string][]receivedMessage{"first": firstMsgs, "late": lateMsgs} {
+		if got := strings.Join(describeAll(msgs), "\n"); got != want {
+			t.Fatalf("%s subscriber got\n%s\nwant\n%s", name, got, want)
+		}
+	}
+
+	var info entity.StreamInfo
+	env.do(t, http.MethodGet, "/v1/streams/"+stream.Channel, nil, http.StatusOK, &info)
+	if info.Status != entity.StreamStatusFinished {
+		t.Fatalf("stream info = %+v", info)
+	}
+}
+
+func TestE2eLastSubscriberLeavingStopsTheSharedSession(t *testing.T) {
+	// a bar every 500ms, the session would go on for a while without its subscriber
+	env := newE2eEnv(t, 120)
+
+	var stream entity.CreateStreamRes
+	env.do(t, http.MethodPost, "/v1/stream/create", entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Shared: true}, http.StatusOK, &stream)
+
+	conn := env.startStream(t, stream.Channel, stream.Token)
+	readUntilCandle(t, conn)
+
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "leaving"))
+	conn.Close()
+
+	// the run is over long before the last bar was due, not finished but ready to start again
+	var info entity.StreamInfo
+	waitFor(t, "the session to stop", func() bool {
+		env.do(t, http.MethodGet, "/v1/streams/"+stream.Channel, nil, http.StatusOK, &info)
+		return info.Clients == 0 && info.Status == entity.StreamStatusCreated
+	})
+
+	var usage entity.Usage
+	env.do(t, http.MethodGet, "/v1/usage", nil, http.StatusOK, &usage)
+	if usage.ConcurrentStreams != 0 {
+		t.Fatalf("usage = %+v", usage)
+	}
+
+	// the next subscriber starts a new session from the beginning
+	again := env.startStream(t, stream.Channel, stream.Token)
+
+	msgs, err := readUntilEnd(t, again)
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(msgs), err)
+	}
+
+	if got, want := strings.Join(describeAll(msgs), "\n"), strings.Join(e2eDefaultSequence(), "\n"); got != want {
+		t.Fatalf("sequence\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestE2eWrongTokenIsRefused(t *testing.T) {
+	env := newE2eEnv(t, 1200)
+
+	stream := env.createStream(t)
+	conn := env.startStream(t, stream.Channel, "not-the-token")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg entity.WsMessage
+	err := conn.ReadJSON(&msg)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+
+	if got := describe(receivedMessage{WsMessage: msg}); got != "error invalid token" || msg.Seq != 0 {
+		t.Fatalf("message = %s seq %d, want a standalone invalid token error", got, msg.Seq)
+	}
+
+	expectClosed(t, conn)
+}
+
+// readNext reads the next n messages, heartbeats aside, and describes them.
+func readNext(t *testing.T, conn *websocket.Conn, n int) []string {
+	t.Helper()
+
+	described := []string{}
+
+	for len(described) < n {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+		var msg entity.WsMessage
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			t.Fatalf("read error after %v: %v", described, err)
+		}
+
+		if msg.Type != string(entity.WsMessageTypeHeartbeat) {
+			described = append(described, describe(receivedMessage{WsMessage: msg, at: time.Now()}))
+		}
+	}
+
+	return described
+}
+
+func TestE2eLiveStreamPassesBinanceThroughAcrossReconnects(t *testing.T) {
+	binanceWs := binancewstest.NewServer()
+	t.Cleanup(binanceWs.Close)
+
+	env := newE2eEnv(t, 1200, func(conf *config.AppConfig) {
+		conf.Adapter.BinanceWs.FstreamBaseUrl = binanceWs.FstreamBaseUrl()
+	})
+
+	var stream entity.CreateStreamRes
+	env.do(t, http.MethodPost, "/v1/stream/create", entity.CreateStreamReq{
+		CandleSize:  hEntity.Duration(time.Minute),
+		Type:        entity.StreamTypeLive,
+		LiveUpdates: true,
+		Persist:     true,
+	}, http.StatusOK, &stream)
+
+	conn := env.startStream(t, stream.Channel, stream.Token)
+
+	if got := readNext(t, conn, 2); strings.Join(got, "\n") != "start\nstatus streaming" {
+		t.Fatalf("opening = %v", got)
+	}
+
+	waitFor(t, "the live feed to connect", func() bool { return binanceWs.Open() == 1 })
+
+	// bar 5 and 6 are past what the fake binance serves over http, only the live feed has them
+	btc, eth := e2eCandle("BTCUSDT", 5), e2eCandle("ETHUSDT", 5)
+	inProgress := btc
+	inProgress.Close = btc.Open
+
+	binanceWs.SendKline(inProgress, false)
+	binanceWs.SendKline(btc, true)
+	binanceWs.SendKline(eth, true)
+
+	want := []string{
+		fmt.Sprintf("candle_update binance:BTCUSDT 300 %s %s", btc.Open.String(), btc.Open.String()),
+		fmt.Sprintf("candle binance:BTCUSDT 300 %s %s", btc.Open.String(), btc.Close.String()),
+		fmt.Sprintf("candle binance:ETHUSDT 300 %s %s", eth.Open.String(), eth.Close.String()),
+		"bar_close 300 2",
+	}
+	if got := readNext(t, conn, len(want)); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("live sequence\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	binanceWs.DropConnections()
+
+	if got := readNext(t, conn, 1); got[0] != "status reconnecting" {
+		t.Fatalf("after the drop = %v, want status reconnecting", got)
+	}
+
+	// the first retry waits a second
+	waitFor(t, "the live feed to reconnect", func() bool { return binanceWs.Open() == 1 })
+	if got := binanceWs.Connections(); got != 2 {
+		t.Fatalf("connections = %d, want 2", got)
+	}
+
+	btc = e2eCandle("BTCUSDT", 6)
+	binanceWs.SendKline(btc, true)
+
+	want = []string{
+		"status streaming",
+		fmt.Sprintf("candle binance:BTCUSDT 360 %s %s", btc.Open.String(), btc.Close.String()),
+	}
+	if got := readNext(t, conn, len(want)); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("after reconnecting\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	conn.Close()
+
+	// the closed bars were persisted, a replay of their window plays them
+	env.do(t, http.MethodPut, "/v1/presets/"+entity.ReplayPresetDefault, entity.ReplayConfiguration{
+		Symbols:            []string{"binance:BTCUSDT", "binance:ETHUSDT"},
+		PlaybackSpeed:      1200,
+		StartTimeUnixMilli: e2eStart.Add(5 * time.Minute).UnixMilli(),
+		EndTimeUnixMilli:   e2eStart.Add(6 * time.Minute).UnixMilli(),
+	}, http.StatusOK, nil)
+
+	replay := env.createStream(t)
+	msgs, err := readUntilEnd(t, env.startStream(t, replay.Channel, replay.Token))
+	if err != nil {
+		t.Fatalf("read error after %d messages: %v", len(msgs), err)
+	}
+
+	eth = e2eCandle("ETHUSDT", 5)
+	btc5 := e2eCandle("BTCUSDT", 5)
+	want = []string{
+		"start",
+		"status streaming",
+		fmt.Sprintf("candle binance:BTCUSDT 300 %s %s", btc5.Open.String(), btc5.Close.String()),
+		fmt.Sprintf("candle binance:ETHUSDT 300 %s %s", eth.Open.String(), eth.Close.String()),
+		"bar_close 300 2",
+		fmt.Sprintf("candle binance:BTCUSDT 360 %s %s", btc.Open.String(), btc.Close.String()),
+		"bar_close 360 1",
+		"status finished",
+		"end finished 3",
+	}
+	if got := describeAll(msgs); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("replay of the persisted bars\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestE2eCorsAllowsTheApiKeyHeader(t *testing.T) {
+	env := newE2eEnv(t, 1200)
+
+	req, err := http.NewRequest(http.MethodOptions, env.server.URL+"/v1/streams", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest error: %v", err)
+	}
+	req.Header.Set("Origin", "http://localhost")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "X-Api-Key")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("preflight error: %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent || !strings.Contains(strings.ToLower(res.Header.Get("Access-Control-Allow-Headers")), "x-api-key") {
+		t.Fatalf("preflight status %d allows %q, want the api key header allowed", res.StatusCode, res.Header.Get("Access-Control-Allow-Headers"))
+	}
+}
+
+func TestE2eQueryCredentialsOnlyOpenTheUpgrade(t *testing.T) {
+	env := newE2eEnv(t, 1200)
+
+	var token entity.IssueTokenRes
+	env.do(t, http.MethodPost, "/v1/auth/token", nil, http.StatusOK, &token)
+
+	// a plain route ignores the query, whatever credential it carries
+	for _, query := range []string{"api_key=" + e2eApiKey, "access_token=" + token.Token} {
+		res, err := http.Get(env.server.URL + "/v1/streams?" + query)
+		if err != nil {
+			t.Fatalf("GET /v1/streams error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("GET /v1/streams?%s status %d, want %d", query, res.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"an access token", "access_token=" + token.Token},
+		{"an api key", "api_key=" + e2eApiKey},
+		{"the access token goes before the api key", "api_key=not-a-key&access_token=" + token.Token},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream := env.createStream(t)
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(env.server.URL, "http")+"/v1/stream/start?"+test.query, nil)
+			if err != nil {
+				t.Fatalf("websocket dial error: %v", err)
+			}
+			defer conn.Close()
+
+			authData, _ := json.Marshal(entity.WsAuthData{Channel: stream.Channel, Token: stream.Token})
+			err = conn.WriteJSON(entity.WsMessage{Type: string(entity.WsMessageTypeAuth), Data: authData})
+			if err != nil {
+				t.Fatalf("auth write error: %v", err)
+			}
+
+			if got := readNext(t, conn, 2); fmt.Sprint(got) != "[start status streaming]" {
+				t.Fatalf("messages = %q, want the stream to start", got)
+			}
+		})
+	}
+}
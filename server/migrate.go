@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"michaelyusak/go-quant-replay-engine.git/config"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+
+	hHelper "github.com/michaelyusak/go-helper/helper"
+	"github.com/sirupsen/logrus"
+)
+
+// Migrate runs the migrate subcommand, "up" applies the pending migrations and
+// "status" lists every migration with whether it is applied.
+func Migrate(args []string) {
+	conf, err := config.Init()
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	err = hHelper.SetupLogrus(conf.Log.Level, conf.Log.Dir)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	db, dialect, err := openStorage(conf.Service)
+	if err != nil {
+		logrus.Panicf("Failed to connect to db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		err = migrate(ctx, db, dialect)
+		if err != nil {
+			logrus.Fatalf("Failed to migrate the db: %v", err)
+		}
+	case "status":
+		migrator, err := migration.NewMigrator(db, dialect)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		migrations, err := migrator.Status(ctx)
+		if err != nil {
+			logrus.Fatalf("Failed to read the migration status: %v", err)
+		}
+
+		for _, m := range migrations {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+			}
+
+			fmt.Fprintf(os.Stdout, "%04d %-24s %s\n", m.Version, m.Name, state)
+		}
+	default:
+		logrus.Fatalf("Unknown migrate command '%s', expected 'up' or 'status'", command)
+	}
+}
+
+func migrate(ctx context.Context, db *sql.DB, dialect migration.Dialect) error {
+	migrator, err := migration.NewMigrator(db, dialect)
+	if err != nil {
+		return fmt.Errorf("[server][migrate][migration.NewMigrator] error: %w", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		logrus.
+			WithField("version", m.Version).
+			WithField("name", m.Name).
+			Info("[server][migrate] migration applied")
+	}
+	if err != nil {
+		return fmt.Errorf("[server][migrate][migrator.Up] error: %w", err)
+	}
+
+	if len(applied) == 0 {
+		logrus.Info("[server][migrate] schema is up to date")
+	}
+
+	return nil
+}
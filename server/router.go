@@ -1,65 +1,117 @@
 package server
 
 import (
+	"context"
 	binancehttp "michaelyusak/go-quant-replay-engine.git/adapter/binance_http"
+	binancews "michaelyusak/go-quant-replay-engine.git/adapter/binance_ws"
 	"michaelyusak/go-quant-replay-engine.git/config"
+	"michaelyusak/go-quant-replay-engine.git/entity"
 	"michaelyusak/go-quant-replay-engine.git/handler"
-	"michaelyusak/go-quant-replay-engine.git/repository/quest"
+	"michaelyusak/go-quant-replay-engine.git/middleware"
 	"michaelyusak/go-quant-replay-engine.git/service"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
-	hAdaptor "github.com/michaelyusak/go-helper/adaptor"
 	hHandler "github.com/michaelyusak/go-helper/handler"
+	hHelper "github.com/michaelyusak/go-helper/helper"
 	hMiddleware "github.com/michaelyusak/go-helper/middleware"
 	"github.com/sirupsen/logrus"
 )
 
 type routerOpts struct {
 	handler struct {
-		common *hHandler.Common
-		write  *handler.Write
-		replay *handler.Replay
+		common  *hHandler.Common
+		write   *handler.Write
+		replay  *handler.Replay
+		auth    *handler.Auth
+		quota   *handler.Quota
+		symbol  *handler.Symbol
+		quality *handler.Quality
+	}
+	middleware struct {
+		auth      *middleware.Auth
+		rateLimit *middleware.RateLimit
 	}
 }
 
 func newRouter(config *config.AppConfig) *gin.Engine {
-	db, err := hAdaptor.ConnectDB(hAdaptor.PSQL, config.Service.Db)
+	repos, err := openRepositories(context.Background(), config.Service)
 	if err != nil {
-		logrus.Panicf("Failed to connect to db: %v", err)
+		logrus.Panicf("Failed to open the storage: %v", err)
 	}
-	logrus.Info("Connected to postgres")
 
-	candles1mRepo := quest.NewCandles1m(db)
+	candlesRepo := repos.candles
+	candles1mRepo := repos.candles1m
+	fundingRatesRepo := repos.fundingRates
+	openInterestsRepo := repos.openInterests
+	priceCandles1mRepo := repos.priceCandles1m
+	replayPresetsRepo := repos.replayPresets
+	symbolsRepo := repos.symbols
+	anomaliesRepo := repos.anomalies
 
-	binanceHttpAdapter := binancehttp.NewAdapter(config.Adapter.BinanceHttp.FapiBaseUrl)
+	binanceHttpAdapter := binancehttp.NewAdapter(config.Adapter.BinanceHttp.FapiBaseUrl, config.Adapter.BinanceHttp.FuturesDataBaseUrl)
+	binanceWsAdapter := binancews.NewAdapter(config.Adapter.BinanceWs.FstreamBaseUrl)
 
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin:     checkOrigin(config.Cors.AllowedOrigins),
 	}
 
-	writeService := service.NewWrite(candles1mRepo, binanceHttpAdapter)
-	replayService := service.NewReplay(candles1mRepo, config.Service.Replay.Stream.Default)
+	jwtHelper := hHelper.NewJWTHelper(config.Auth.Jwt, jwt.SigningMethodHS256)
+
+	quotaService := service.NewQuota(config.Auth.DefaultQuota, config.Auth.ApiKeys)
+	qualityService := service.NewQuality(anomaliesRepo, config.Service.Quality)
+	writeService := service.NewWrite(candlesRepo, candles1mRepo, fundingRatesRepo, openInterestsRepo, priceCandles1mRepo, symbolsRepo, binanceHttpAdapter, quotaService, qualityService)
+	replayService := service.NewReplay(candlesRepo, candles1mRepo, fundingRatesRepo, openInterestsRepo, priceCandles1mRepo, replayPresetsRepo, symbolsRepo, binanceWsAdapter, quotaService, qualityService, config.Service.Replay.Pipeline)
+	symbolService := service.NewSymbol(symbolsRepo, binanceHttpAdapter, quotaService)
+
+	err = replayService.SeedDefaultPreset(context.Background(), config.Service.Replay.Stream.Default)
+	if err != nil {
+		logrus.Panicf("Failed to seed the default replay preset: %v", err)
+	}
+	authService := service.NewAuth(config.Auth.ApiKeys, jwtHelper, time.Duration(config.Auth.TokenDuration))
 
 	commonHandler := hHandler.NewCommon(&APP_HEALTHY)
 	writeHandler := handler.NewWrite(writeService)
 	replayHandler := handler.NewReplay(replayService, upgrader)
+	authHandler := handler.NewAuth(authService)
+	quotaHandler := handler.NewQuota(quotaService)
+	symbolHandler := handler.NewSymbol(symbolService)
+	qualityHandler := handler.NewQuality(qualityService)
+
+	authMiddleware := middleware.NewAuth(authService)
+	rateLimitMiddleware := middleware.NewRateLimit(quotaService)
 
 	return createRouter(routerOpts{
 		handler: struct {
-			common *hHandler.Common
-			write  *handler.Write
-			replay *handler.Replay
+			common  *hHandler.Common
+			write   *handler.Write
+			replay  *handler.Replay
+			auth    *handler.Auth
+			quota   *handler.Quota
+			symbol  *handler.Symbol
+			quality *handler.Quality
 		}{
-			common: commonHandler,
-			write:  writeHandler,
-			replay: replayHandler,
+			common:  commonHandler,
+			write:   writeHandler,
+			replay:  replayHandler,
+			auth:    authHandler,
+			quota:   quotaHandler,
+			symbol:  symbolHandler,
+			quality: qualityHandler,
+		},
+		middleware: struct {
+			auth      *middleware.Auth
+			rateLimit *middleware.RateLimit
+		}{
+			auth:      authMiddleware,
+			rateLimit: rateLimitMiddleware,
 		},
 	},
 		config.Cors.AllowedOrigins,
@@ -74,6 +126,7 @@ func createRouter(opts routerOpts, allowedOrigins []string) *gin.Engine {
 	router.ContextWithFallback = true
 
 	router.Use(
+		middleware.RedactQueryCredentials,
 		hMiddleware.Logger(logrus.New()),
 		hMiddleware.RequestIdHandlerMiddleware,
 		hMiddleware.ErrorHandlerMiddleware,
@@ -82,8 +135,16 @@ func createRouter(opts routerOpts, allowedOrigins []string) *gin.Engine {
 
 	corsRouting(router, corsConfig, allowedOrigins)
 	commonRouting(router, opts.handler.common)
-	writeRouting(router, opts.handler.write)
-	replayRouting(router, opts.handler.replay)
+
+	authed := router.Group("", opts.middleware.auth.Authenticate, opts.middleware.rateLimit.Limit)
+	upgrade := router.Group("", opts.middleware.auth.AuthenticateUpgrade, opts.middleware.rateLimit.Limit)
+
+	authRouting(authed, opts.handler.auth)
+	quotaRouting(authed, opts.middleware.auth, opts.handler.quota)
+	writeRouting(authed, opts.middleware.auth, opts.handler.write)
+	replayRouting(authed, upgrade, opts.middleware.auth, opts.handler.replay)
+	symbolRouting(authed, opts.middleware.auth, opts.handler.symbol)
+	qualityRouting(authed, opts.middleware.auth, opts.handler.quality)
 
 	return router
 }
@@ -91,7 +152,7 @@ func createRouter(opts routerOpts, allowedOrigins []string) *gin.Engine {
 func corsRouting(router *gin.Engine, corsConfig cors.Config, allowedOrigins []string) {
 	corsConfig.AllowOrigins = allowedOrigins
 	corsConfig.AllowMethods = []string{"POST", "GET", "PUT", "PATCH", "DELETE"}
-	corsConfig.AllowHeaders = []string{"Origin", "Authorization", "Content-Type", "Accept", "User-Agent", "Cache-Control", "Device-Info", "X-Device-Id"}
+	corsConfig.AllowHeaders = []string{"Origin", "Authorization", "X-Api-Key", "Content-Type", "Accept", "User-Agent", "Cache-Control", "Device-Info", "X-Device-Id"}
 	corsConfig.ExposeHeaders = []string{"Content-Length"}
 	corsConfig.AllowCredentials = true
 	router.Use(cors.New(corsConfig))
@@ -106,16 +167,81 @@ func staticRouting(router *gin.Engine, localStorageStaticPath, localStorageDirec
 	router.Static(localStorageStaticPath, localStorageDirectory)
 }
 
-func writeRouting(router *gin.Engine, handler *handler.Write) {
-	router.POST("/v1/write/binance", handler.ImportFromBinance)
+func authRouting(router *gin.RouterGroup, handler *handler.Auth) {
+	router.POST("/v1/auth/token", handler.IssueToken)
+}
+
+func quotaRouting(router *gin.RouterGroup, auth *middleware.Auth, handler *handler.Quota) {
+	reader := router.Group("", auth.RequireRole(entity.RoleReader))
+
+	reader.GET("/v1/usage", handler.GetUsage)
 }
 
-func replayRouting(router *gin.Engine, handler *handler.Replay) {
-	router.POST("/v1/stream/create", handler.Create)
-	router.GET("/v1/stream/start", handler.Start)
+func writeRouting(router *gin.RouterGroup, auth *middleware.Auth, handler *handler.Write) {
+	writer := router.Group("", auth.RequireRole(entity.RoleWriter))
+
+	writer.POST("/v1/write/binance", handler.ImportFromBinance)
+	writer.POST("/v1/write/binance/funding-rate", handler.ImportFundingRateFromBinance)
+	writer.POST("/v1/write/binance/open-interest", handler.ImportOpenInterestFromBinance)
+	writer.POST("/v1/write/binance/mark-price", handler.ImportMarkPriceFromBinance)
+	writer.POST("/v1/write/binance/index-price", handler.ImportIndexPriceFromBinance)
+	writer.POST("/v1/write/rollups/rebuild", handler.RebuildRollups)
+	writer.POST("/v1/write/synthetic", handler.WriteSynthetic)
+}
+
+// replayRouting takes the websocket upgrade on its own group, the only one that accepts
+// credentials in the query.
+func replayRouting(router *gin.RouterGroup, upgrade *gin.RouterGroup, auth *middleware.Auth, handler *handler.Replay) {
+	reader := router.Group("", auth.RequireRole(entity.RoleReader))
+	replayer := router.Group("", auth.RequireRole(entity.RoleReplayer))
+	admin := router.Group("", auth.RequireRole(entity.RoleAdmin))
+
+	replayer.POST("/v1/stream/create", handler.Create)
+	upgrade.GET("/v1/stream/start", auth.RequireRole(entity.RoleReplayer), handler.Start)
+
+	reader.GET("/v1/stream/config", handler.GetConfig)
+	admin.PUT("/v1/stream/config", handler.UpdateConfig)
+
+	reader.GET("/v1/stream/listened-symbol", handler.GetListenedSymbols)
+
+	reader.GET("/v1/streams", handler.ListStreams)
+	reader.GET("/v1/streams/:channel", handler.GetStream)
+	replayer.DELETE("/v1/streams/:channel", handler.DeleteStream)
+	replayer.POST("/v1/streams/:channel/pause", handler.PauseStream)
+	replayer.POST("/v1/streams/:channel/resume", handler.ResumeStream)
+
+	reader.GET("/v1/presets", handler.ListPresets)
+	reader.GET("/v1/presets/:name", handler.GetPreset)
+	admin.POST("/v1/presets", handler.CreatePreset)
+	admin.PUT("/v1/presets/:name", handler.UpdatePreset)
+	admin.DELETE("/v1/presets/:name", handler.DeletePreset)
+}
+
+func symbolRouting(router *gin.RouterGroup, auth *middleware.Auth, handler *handler.Symbol) {
+	reader := router.Group("", auth.RequireRole(entity.RoleReader))
+	writer := router.Group("", auth.RequireRole(entity.RoleWriter))
+
+	writer.POST("/v1/write/binance/symbols", handler.SyncFromBinance)
+
+	reader.GET("/v1/symbols", handler.ListSymbols)
+	reader.GET("/v1/symbols/:symbol", handler.GetSymbol)
+}
+
+// checkOrigin lets websocket handshakes in from the cors origins only. Requests without
+// an origin do not come from a browser and are left to the auth middleware.
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+
+		return slices.Contains(allowedOrigins, "*") || slices.Contains(allowedOrigins, origin)
+	}
+}
 
-	router.GET("/v1/stream/config", handler.GetConfig)
-	router.PUT("/v1/stream/config", handler.UpdateConfig)
+func qualityRouting(router *gin.RouterGroup, auth *middleware.Auth, handler *handler.Quality) {
+	reader := router.Group("", auth.RequireRole(entity.RoleReader))
 
-	router.GET("/v1/stream/listened-symbol", handler.GetListenedSymbols)
+	reader.GET("/v1/anomalies", handler.ListAnomalies)
 }
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"michaelyusak/go-quant-replay-engine.git/config"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"michaelyusak/go-quant-replay-engine.git/repository/memory"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+	"michaelyusak/go-quant-replay-engine.git/repository/quest"
+	"michaelyusak/go-quant-replay-engine.git/repository/sqlite"
+
+	hAdaptor "github.com/michaelyusak/go-helper/adaptor"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	storageBackendQuestDB = "questdb"
+	storageBackendSQLite  = "sqlite"
+	storageBackendMemory  = "memory"
+)
+
+type repositories struct {
+	candles        repository.Candles
+	candles1m      repository.Candles1m
+	fundingRates   repository.FundingRates
+	openInterests  repository.OpenInterests
+	priceCandles1m repository.PriceCandles1m
+	replayPresets  repository.ReplayPresets
+	symbols        repository.Symbols
+	anomalies      repository.Anomalies
+}
+
+// openStorage connects the configured backend and returns the migration dialect it takes.
+func openStorage(conf config.ServiceConfig) (*sql.DB, migration.Dialect, error) {
+	switch conf.Storage.Backend {
+	case "", storageBackendQuestDB:
+		db, err := hAdaptor.ConnectDB(hAdaptor.PSQL, conf.Db)
+		if err != nil {
+			return nil, "", fmt.Errorf("[server][openStorage][hAdaptor.ConnectDB] error: %w", err)
+		}
+
+		return db, migration.Dialect(conf.Migration.Dialect), nil
+	case storageBackendMemory:
+		return nil, "", fmt.Errorf("[server][openStorage] the memory backend has no database to open")
+	case storageBackendSQLite:
+		if conf.Storage.Path == "" {
+			return nil, "", fmt.Errorf("[server][openStorage] the sqlite backend needs a path")
+		}
+
+		db, err := sqlite.Open(conf.Storage.Path)
+		if err != nil {
+			return nil, "", fmt.Errorf("[server][openStorage][sqlite.Open] error: %w", err)
+		}
+
+		return db, migration.DialectSQLite, nil
+	default:
+		return nil, "", fmt.Errorf("[server][openStorage] unknown storage backend '%s'", conf.Storage.Backend)
+	}
+}
+
+// openRepositories builds the repositories of the configured backend, migrating the
+// database first when the config asks for it. The memory backend keeps nothing across
+// restarts, it backs tests and throwaway runs.
+func openRepositories(ctx context.Context, conf config.ServiceConfig) (repositories, error) {
+	if conf.Storage.Backend == storageBackendMemory {
+		candles1m := memory.NewCandles1m()
+
+		return repositories{
+			candles:        memory.NewCandles(candles1m),
+			candles1m:      candles1m,
+			fundingRates:   memory.NewFundingRates(),
+			openInterests:  memory.NewOpenInterests(),
+			priceCandles1m: memory.NewPriceCandles1m(),
+			replayPresets:  memory.NewReplayPresets(),
+			symbols:        memory.NewSymbols(),
+			anomalies:      memory.NewAnomalies(),
+		}, nil
+	}
+
+	db, dialect, err := openStorage(conf)
+	if err != nil {
+		return repositories{}, fmt.Errorf("[server][openRepositories][openStorage] error: %w", err)
+	}
+	logrus.WithField("dialect", dialect).Info("Connected to the db")
+
+	// a sqlite file may have just been created, it is always brought up to date
+	if conf.Migration.AutoMigrate || dialect == migration.DialectSQLite {
+		err = migrate(ctx, db, dialect)
+		if err != nil {
+			return repositories{}, fmt.Errorf("[server][openRepositories][migrate] error: %w", err)
+		}
+	}
+
+	return newRepositories(db, dialect), nil
+}
+
+func newRepositories(db *sql.DB, dialect migration.Dialect) repositories {
+	if dialect == migration.DialectSQLite {
+		return repositories{
+			candles:        sqlite.NewCandles(db),
+			candles1m:      sqlite.NewCandles1m(db),
+			fundingRates:   sqlite.NewFundingRates(db),
+			openInterests:  sqlite.NewOpenInterests(db),
+			priceCandles1m: sqlite.NewPriceCandles1m(db),
+			replayPresets:  sqlite.NewReplayPresets(db),
+			symbols:        sqlite.NewSymbols(db),
+			anomalies:      sqlite.NewAnomalies(db),
+		}
+	}
+
+	return repositories{
+		candles:        quest.NewCandles(db, dialect),
+		candles1m:      quest.NewCandles1m(db, dialect),
+		fundingRates:   quest.NewFundingRates(db, dialect),
+		openInterests:  quest.NewOpenInterests(db, dialect),
+		priceCandles1m: quest.NewPriceCandles1m(db, dialect),
+		replayPresets:  quest.NewReplayPresets(db, dialect),
+		symbols:        quest.NewSymbols(db, dialect),
+		anomalies:      quest.NewAnomalies(db, dialect),
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"michaelyusak/go-quant-replay-engine.git/config"
+	"michaelyusak/go-quant-replay-engine.git/repository/migration"
+)
+
+// backendsOf lists the package of every repository, a nil one shows as nil
+func backendsOf(repos repositories) map[string]string {
+	backends := map[string]string{}
+
+	value := reflect.ValueOf(repos)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.IsNil() {
+			backends[value.Type().Field(i).Name] = "nil"
+			continue
+		}
+
+		backends[value.Type().Field(i).Name] = reflect.Indirect(field.Elem()).Type().PkgPath()
+	}
+
+	return backends
+}
+
+func TestOpenRepositoriesOfTheMemoryBackend(t *testing.T) {
+	conf := config.ServiceConfig{
+		Storage:   config.StorageConfig{Backend: storageBackendMemory},
+		Migration: config.MigrationConfig{AutoMigrate: true},
+	}
+
+	repos, err := openRepositories(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("openRepositories error: %v", err)
+	}
+
+	for name, backend := range backendsOf(repos) {
+		if !strings.HasSuffix(backend, "/repository/memory") {
+			t.Errorf("%s is backed by %s, want the memory repositories", name, backend)
+		}
+	}
+
+	// there is no database to migrate, the migrate subcommand refuses the backend
+	_, _, err = openStorage(conf)
+	if err == nil {
+		t.Errorf("openStorage error = nil, want the memory backend refused")
+	}
+}
+
+func TestOpenRepositoriesMigratesTheSQLiteBackendOnce(t *testing.T) {
+	ctx := context.Background()
+	conf := config.ServiceConfig{
+		Storage: config.StorageConfig{Backend: storageBackendSQLite, Path: filepath.Join(t.TempDir(), "replay.db")},
+	}
+
+	for i := 0; i < 2; i++ {
+		repos, err := openRepositories(ctx, conf)
+		if err != nil {
+			t.Fatalf("open %d: openRepositories error: %v", i+1, err)
+		}
+
+		for name, backend := range backendsOf(repos) {
+			if !strings.HasSuffix(backend, "/repository/sqlite") {
+				t.Errorf("open %d: %s is backed by %s, want the sqlite repositories", i+1, name, backend)
+			}
+		}
+	}
+
+	db, dialect, err := openStorage(conf)
+	if err != nil {
+		t.Fatalf("openStorage error: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migration.NewMigrator(db, dialect)
+	if err != nil {
+		t.Fatalf("NewMigrator error: %v", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up error: %v", err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("Up after opening applied %d migrations, want none pending", len(applied))
+	}
+}
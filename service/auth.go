@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/michaelyusak/go-helper/helper"
+	"github.com/sirupsen/logrus"
+)
+
+type auth struct {
+	apiKeys       []entity.ApiKey
+	jwtHelper     helper.JWTHelper
+	tokenDuration time.Duration
+}
+
+func NewAuth(
+	apiKeys []entity.ApiKey,
+	jwtHelper helper.JWTHelper,
+	tokenDuration time.Duration,
+) *auth {
+	validKeys := []entity.ApiKey{}
+
+	for _, apiKey := range apiKeys {
+		if apiKey.Key == "" || apiKey.UserId == "" || !apiKey.Role.IsValid() {
+			logrus.
+				WithField("user_id", apiKey.UserId).
+				WithField("role", apiKey.Role).
+				Warn("[service][auth][NewAuth] skipping invalid api key")
+			continue
+		}
+
+		validKeys = append(validKeys, apiKey)
+	}
+
+	return &auth{
+		apiKeys:       validKeys,
+		jwtHelper:     jwtHelper,
+		tokenDuration: tokenDuration,
+	}
+}
+
+func (s *auth) AuthenticateApiKey(ctx context.Context, key string) (entity.AuthUser, error) {
+	var user entity.AuthUser
+	found := false
+
+	// every key is compared so the time taken does not tell which one matched
+	for _, apiKey := range s.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(apiKey.Key), []byte(key)) == 1 {
+			user = entity.AuthUser{UserId: apiKey.UserId, Role: apiKey.Role}
+			found = true
+		}
+	}
+
+	if !found {
+		return entity.AuthUser{}, apperror.UnauthorizedError(apperror.AppErrorOpt{
+			ResponseMessage: "invalid api key",
+			Message:         "[service][auth][AuthenticateApiKey] invalid api key",
+		})
+	}
+
+	return user, nil
+}
+
+func (s *auth) AuthenticateToken(ctx context.Context, token string) (entity.AuthUser, error) {
+	data, err := s.jwtHelper.ParseAndVerify(token)
+	if err != nil || data == nil {
+		return entity.AuthUser{}, apperror.UnauthorizedError(apperror.AppErrorOpt{
+			ResponseMessage: "invalid or expired token",
+			Message:         fmt.Sprintf("[service][auth][AuthenticateToken][jwtHelper.ParseAndVerify] error: %v", err),
+		})
+	}
+
+	var user entity.AuthUser
+	err = json.Unmarshal(data, &user)
+	if err != nil || user.UserId == "" || !user.Role.IsValid() {
+		return entity.AuthUser{}, apperror.UnauthorizedError(apperror.AppErrorOpt{
+			ResponseMessage: "invalid or expired token",
+			Message:         fmt.Sprintf("[service][auth][AuthenticateToken][json.Unmarshal] invalid claims: %v", err),
+		})
+	}
+
+	return user, nil
+}
+
+func (s *auth) IssueToken(ctx context.Context, user entity.AuthUser) (entity.IssueTokenRes, error) {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return entity.IssueTokenRes{}, fmt.Errorf("[service][auth][IssueToken][json.Marshal] error: %w", err)
+	}
+
+	expiredAt := time.Now().Add(s.tokenDuration)
+
+	token, err := s.jwtHelper.CreateAndSign(data, expiredAt.Unix())
+	if err != nil {
+		return entity.IssueTokenRes{}, fmt.Errorf("[service][auth][IssueToken][jwtHelper.CreateAndSign] error: %w", err)
+	}
+
+	return entity.IssueTokenRes{
+		Token:              token,
+		ExpiredAtUnixMilli: expiredAt.UnixMilli(),
+	}, nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/michaelyusak/go-helper/helper"
+)
+
+func TestAuthenticateApiKey(t *testing.T) {
+	s := NewAuth([]entity.ApiKey{
+		{Key: "reader-key", UserId: "alice", Role: entity.RoleReader},
+		{Key: "admin-key", UserId: "bob", Role: entity.RoleAdmin},
+		{Key: "root-key", UserId: "carol", Role: "root"},
+		{Key: "", UserId: "dave", Role: entity.RoleWriter},
+	}, nil, time.Hour)
+
+	tests := []struct {
+		key  string
+		want entity.AuthUser
+		ok   bool
+	}{
+		{"reader-key", entity.AuthUser{UserId: "alice", Role: entity.RoleReader}, true},
+		{"admin-key", entity.AuthUser{UserId: "bob", Role: entity.RoleAdmin}, true},
+		{"admin-key ", entity.AuthUser{}, false},
+		// keys of an unknown role or without a key are skipped
+		{"root-key", entity.AuthUser{}, false},
+		{"", entity.AuthUser{}, false},
+	}
+
+	for _, test := range tests {
+		user, err := s.AuthenticateApiKey(context.Background(), test.key)
+		if test.ok != (err == nil) || user != test.want {
+			t.Errorf("AuthenticateApiKey(%q) = %+v, %v, want %+v ok %v", test.key, user, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	conf := helper.JwtConfig{Issuer: "replay", Key: "secret"}
+	jwtHelper := helper.NewJWTHelper(conf, jwt.SigningMethodHS256)
+
+	sign := func(claims string, expiredAt time.Time) string {
+		token, err := jwtHelper.CreateAndSign([]byte(claims), expiredAt.Unix())
+		if err != nil {
+			t.Fatalf("CreateAndSign error: %v", err)
+		}
+
+		return token
+	}
+
+	s := NewAuth(nil, jwtHelper, time.Hour)
+
+	issued, err := s.IssueToken(context.Background(), entity.AuthUser{UserId: "alice", Role: entity.RoleWriter})
+	if err != nil {
+		t.Fatalf("IssueToken error: %v", err)
+	}
+
+	other := helper.NewJWTHelper(helper.JwtConfig{Issuer: "replay", Key: "other"}, jwt.SigningMethodHS256)
+	forged, _ := other.CreateAndSign([]byte(`{"user_id":"alice","role":"admin"}`), time.Now().Add(time.Hour).Unix())
+
+	tests := []struct {
+		name  string
+		token string
+		want  entity.AuthUser
+		ok    bool
+	}{
+		{"an issued token", issued.Token, entity.AuthUser{UserId: "alice", Role: entity.RoleWriter}, true},
+		{"an expired token", sign(`{"user_id":"alice","role":"writer"}`, time.Now().Add(-time.Minute)), entity.AuthUser{}, false},
+		{"a token of another key", forged, entity.AuthUser{}, false},
+		{"a token of an unknown role", sign(`{"user_id":"alice","role":"root"}`, time.Now().Add(time.Hour)), entity.AuthUser{}, false},
+		{"a token without a user", sign(`{"role":"admin"}`, time.Now().Add(time.Hour)), entity.AuthUser{}, false},
+		{"not a token", "not-a-token", entity.AuthUser{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, err := s.AuthenticateToken(context.Background(), test.token)
+			if test.ok != (err == nil) || user != test.want {
+				t.Errorf("AuthenticateToken = %+v, %v, want %+v ok %v", user, err, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestRoleIncludes(t *testing.T) {
+	roles := []entity.Role{entity.RoleReader, entity.RoleReplayer, entity.RoleWriter, entity.RoleAdmin}
+
+	for i, role := range roles {
+		for j, other := range roles {
+			if got := role.Includes(other); got != (i >= j) {
+				t.Errorf("%s.Includes(%s) = %v", role, other, got)
+			}
+		}
+	}
+
+	if entity.Role("root").Includes(entity.RoleReader) {
+		t.Error("an unknown role includes the reader role")
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	owned := streamHandler{owner: "alice"}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		handler streamHandler
+		want    bool
+	}{
+		{"the owner", roleContext("alice", entity.RoleReplayer), owned, true},
+		{"another replayer", roleContext("bob", entity.RoleWriter), owned, false},
+		{"an admin", roleContext("carol", entity.RoleAdmin), owned, true},
+		{"no user on an owned stream", context.Background(), owned, false},
+		{"no user on a stream without an owner", context.Background(), streamHandler{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := canAccess(test.ctx, test.handler); got != test.want {
+				t.Errorf("canAccess = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func roleContext(userId string, role entity.Role) context.Context {
+	ctx := context.WithValue(context.Background(), entity.UserIdKey, userId)
+
+	return context.WithValue(ctx, entity.RoleKey, role)
+}
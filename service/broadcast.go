@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const subscriberBufferSize = 1024
+
+var (
+	errSessionFinished    = errors.New("stream already finished")
+	errCatchUpUnavailable = errors.New("catch up unavailable, session history exceeds the limit")
+	errSubscriberTooSlow  = errors.New("subscriber too slow, dropped from the session")
+	errSessionAbandoned   = errors.New("session abandoned, its last subscriber left")
+)
+
+type subscriber struct {
+	ch      chan []byte
+	dropped bool
+}
+
+// broadcastSession fans one replay out to every subscriber of a shared channel.
+// publish never blocks on a subscriber, one that can not keep up is dropped so the
+// others keep seeing the bars at the same time. The session is abandoned once its last
+// subscriber is gone, nobody holds a stream slot for it anymore.
+type broadcastSession struct {
+	history          [][]byte
+	historyLimit     int
+	historyTruncated bool
+
+	subscribers map[*subscriber]struct{}
+	finished    bool
+	abandoned   bool
+
+	// ctx is what the session runs under, it is cancelled once the session is abandoned
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu sync.Mutex
+}
+
+func newBroadcastSession(historyLimit int) *broadcastSession {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	return &broadcastSession{
+		history:      [][]byte{},
+		historyLimit: historyLimit,
+		subscribers:  map[*subscriber]struct{}{},
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+func (b *broadcastSession) publish(ctx context.Context, msg []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.history) < b.historyLimit {
+		b.history = append(b.history, msg)
+	} else {
+		b.historyTruncated = true
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.ch <- msg:
+		default:
+			sub.dropped = true
+			close(sub.ch)
+			delete(b.subscribers, sub)
+		}
+	}
+
+	b.abandonIfEmpty()
+
+	return nil
+}
+
+// subscribe registers a new subscriber and returns what it has to receive before the
+// live messages: the whole history when catching up, otherwise only the start message.
+func (b *broadcastSession) subscribe(catchUp bool) ([][]byte, *subscriber, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.abandoned {
+		return nil, nil, errSessionAbandoned
+	}
+
+	if catchUp && b.historyTruncated {
+		return nil, nil, errCatchUpUnavailable
+	}
+
+	backlog := b.history
+	if !catchUp && len(backlog) > 1 {
+		backlog = backlog[:1]
+	}
+	backlog = append([][]byte{}, backlog...)
+
+	if b.finished {
+		if !catchUp {
+			return nil, nil, errSessionFinished
+		}
+
+		return backlog, nil, nil
+	}
+
+	sub := &subscriber{
+		ch: make(chan []byte, subscriberBufferSize),
+	}
+	b.subscribers[sub] = struct{}{}
+
+	return backlog, sub, nil
+}
+
+func (b *broadcastSession) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		close(sub.ch)
+		delete(b.subscribers, sub)
+	}
+
+	b.abandonIfEmpty()
+}
+
+// isAbandoned tells whether a new subscriber needs a new session.
+func (b *broadcastSession) isAbandoned() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.abandoned
+}
+
+// abandonIfEmpty stops a running session nobody subscribes to anymore, it must be called
+// with b.mu held.
+func (b *broadcastSession) abandonIfEmpty() {
+	if b.finished || b.abandoned || len(b.subscribers) > 0 {
+		return
+	}
+
+	b.abandoned = true
+	b.cancel(errSessionAbandoned)
+}
+
+func (b *broadcastSession) isDropped(sub *subscriber) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return sub.dropped
+}
+
+func (b *broadcastSession) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.finished = true
+	b.cancel(nil)
+
+	for sub := range b.subscribers {
+		close(sub.ch)
+		delete(b.subscribers, sub)
+	}
+}
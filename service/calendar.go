@@ -0,0 +1,314 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var calendarWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// calendarSpan is the allowed time from its from epoch up to its to epoch, to excluded.
+type calendarSpan struct {
+	from int64
+	to   int64
+	// window is the index of the replay window the span is part of
+	window int
+}
+
+// sessionClock is a session in minutes of the day.
+type sessionClock struct {
+	start int
+	end   int
+}
+
+type compiledCalendar struct {
+	loc        *time.Location
+	weekdays   [7]bool
+	sessions   []sessionClock
+	exclusions []calendarSpan
+	// daily is set once the weekdays or the sessions limit the days
+	daily bool
+}
+
+func compileCalendar(cal entity.Calendar) (compiledCalendar, error) {
+	compiled := compiledCalendar{
+		loc:   time.UTC,
+		daily: len(cal.Weekdays) > 0 || len(cal.Sessions) > 0,
+	}
+
+	if cal.Timezone != "" {
+		loc, err := time.LoadLocation(cal.Timezone)
+		if err != nil {
+			return compiledCalendar{}, fmt.Errorf("the calendar timezone '%s' is unknown", cal.Timezone)
+		}
+
+		compiled.loc = loc
+	}
+
+	for _, name := range cal.Weekdays {
+		weekday, ok := calendarWeekdays[name]
+		if !ok {
+			return compiledCalendar{}, fmt.Errorf("the calendar weekday '%s' is not one of sun, mon, tue, wed, thu, fri or sat", name)
+		}
+
+		compiled.weekdays[weekday] = true
+	}
+	if len(cal.Weekdays) == 0 {
+		for i := range compiled.weekdays {
+			compiled.weekdays[i] = true
+		}
+	}
+
+	for _, session := range cal.Sessions {
+		start, err := parseSessionClock(session.Start)
+		if err != nil {
+			return compiledCalendar{}, err
+		}
+
+		end, err := parseSessionClock(session.End)
+		if err != nil {
+			return compiledCalendar{}, err
+		}
+
+		compiled.sessions = append(compiled.sessions, sessionClock{start: start, end: end})
+	}
+
+	for _, exclusion := range cal.Exclusions {
+		if exclusion.EndTimeUnixMilli <= exclusion.StartTimeUnixMilli {
+			return compiledCalendar{}, errors.New("a calendar exclusion has to end after it starts")
+		}
+
+		// a bar is excluded when its open falls in the range
+		compiled.exclusions = append(compiled.exclusions, calendarSpan{
+			from: ceilSeconds(exclusion.StartTimeUnixMilli),
+			to:   ceilSeconds(exclusion.EndTimeUnixMilli),
+		})
+	}
+
+	sort.Slice(compiled.exclusions, func(i, j int) bool {
+		return compiled.exclusions[i].from < compiled.exclusions[j].from
+	})
+
+	return compiled, nil
+}
+
+// parseSessionClock reads an HH:MM clock time into minutes of the day, 24:00 included.
+func parseSessionClock(clock string) (int, error) {
+	invalid := fmt.Errorf("the calendar session time '%s' is not an HH:MM time", clock)
+
+	if len(clock) != 5 || clock[2] != ':' {
+		return 0, invalid
+	}
+
+	hours, err := strconv.Atoi(clock[:2])
+	if err != nil {
+		return 0, invalid
+	}
+
+	minutes, err := strconv.Atoi(clock[3:])
+	if err != nil {
+		return 0, invalid
+	}
+
+	if hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || (hours == 24 && minutes > 0) {
+		return 0, invalid
+	}
+
+	return hours*60 + minutes, nil
+}
+
+func ceilSeconds(unixMilli int64) int64 {
+	seconds := unixMilli / 1000
+	if unixMilli%1000 > 0 {
+		seconds++
+	}
+
+	return seconds
+}
+
+// spans lists the allowed time of the replay window in order, end being its last second.
+func (c compiledCalendar) spans(start, end time.Time) []calendarSpan {
+	window := calendarSpan{from: ceilSeconds(start.UnixMilli()), to: end.Unix() + 1}
+	if window.to <= window.from {
+		return nil
+	}
+
+	allowed := []calendarSpan{window}
+	if c.daily {
+		allowed = c.dailySpans(window)
+	}
+
+	return subtractSpans(allowed, c.exclusions)
+}
+
+// windowSpans lists the allowed time of every window, the windows being ordered.
+func (c compiledCalendar) windowSpans(windows []entity.ReplayWindow) []calendarSpan {
+	spans := []calendarSpan{}
+	for i, window := range windows {
+		for _, span := range c.spans(time.UnixMilli(window.StartTimeUnixMilli), time.UnixMilli(window.EndTimeUnixMilli)) {
+			span.window = i
+			spans = append(spans, span)
+		}
+	}
+
+	return spans
+}
+
+// dailySpans lists the sessions of the allowed days within window, merged where they touch.
+func (c compiledCalendar) dailySpans(window calendarSpan) []calendarSpan {
+	first := time.Unix(window.from, 0).In(c.loc)
+	last := time.Unix(window.to, 0)
+
+	spans := []calendarSpan{}
+	add := func(from, to time.Time) {
+		span := calendarSpan{from: max(from.Unix(), window.from), to: min(to.Unix(), window.to)}
+		if span.from < span.to {
+			spans = append(spans, span)
+		}
+	}
+
+	// the days are counted from the day before the window, its session can run into it
+	year, month, day := first.Date()
+	for i := -1; ; i++ {
+		midnight := time.Date(year, month, day+i, 0, 0, 0, 0, c.loc)
+		if midnight.After(last) {
+			break
+		}
+
+		// noon is clear of the daylight saving shifts
+		if !c.weekdays[time.Date(year, month, day+i, 12, 0, 0, 0, c.loc).Weekday()] {
+			continue
+		}
+
+		if len(c.sessions) == 0 {
+			add(midnight, time.Date(year, month, day+i+1, 0, 0, 0, 0, c.loc))
+			continue
+		}
+
+		for _, session := range c.sessions {
+			endDay := day + i
+			if session.end <= session.start {
+				endDay++
+			}
+
+			add(time.Date(year, month, day+i, 0, session.start, 0, 0, c.loc), time.Date(year, month, endDay, 0, session.end, 0, 0, c.loc))
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].from < spans[j].from
+	})
+
+	merged := []calendarSpan{}
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span.from <= merged[n-1].to {
+			merged[n-1].to = max(merged[n-1].to, span.to)
+			continue
+		}
+
+		merged = append(merged, span)
+	}
+
+	return merged
+}
+
+// subtractSpans cuts the exclusions, ordered by their start, out of the ordered spans.
+func subtractSpans(spans, exclusions []calendarSpan) []calendarSpan {
+	left := []calendarSpan{}
+
+	for _, span := range spans {
+		from := span.from
+
+		for _, exclusion := range exclusions {
+			if exclusion.to <= from || exclusion.from >= span.to {
+				continue
+			}
+
+			if exclusion.from > from {
+				left = append(left, calendarSpan{from: from, to: exclusion.from})
+			}
+
+			from = max(from, exclusion.to)
+		}
+
+		if from < span.to {
+			left = append(left, calendarSpan{from: from, to: span.to})
+		}
+	}
+
+	return left
+}
+
+// spanFrom returns the span holding epoch or else the first one after it, false past the last.
+func spanFrom(spans []calendarSpan, epoch int64) (calendarSpan, bool) {
+	i := sort.Search(len(spans), func(i int) bool {
+		return spans[i].to > epoch
+	})
+	if i == len(spans) {
+		return calendarSpan{}, false
+	}
+
+	return spans[i], true
+}
+
+// allowedSeconds counts the allowed seconds from from up to to.
+func allowedSeconds(spans []calendarSpan, from, to int64) int64 {
+	total := int64(0)
+
+	i := sort.Search(len(spans), func(i int) bool {
+		return spans[i].to > from
+	})
+	for ; i < len(spans) && spans[i].from < to; i++ {
+		total += min(spans[i].to, to) - max(spans[i].from, from)
+	}
+
+	return total
+}
+
+// boundWindows ends a window left without an end at now, a preset without a time range
+// replays the whole stored history. Only the first window can be left open.
+func boundWindows(windows []entity.ReplayWindow, now time.Time) []entity.ReplayWindow {
+	bounded := make([]entity.ReplayWindow, len(windows))
+	copy(bounded, windows)
+
+	for i, window := range bounded {
+		if window.StartTimeUnixMilli == 0 && window.EndTimeUnixMilli == 0 {
+			bounded[i].EndTimeUnixMilli = now.UnixMilli()
+		}
+	}
+
+	return bounded
+}
+
+// validateWindows checks the windows follow each other without overlapping.
+func validateWindows(windows []entity.ReplayWindow) error {
+	for i, window := range windows {
+		if window.EndTimeUnixMilli < window.StartTimeUnixMilli {
+			return fmt.Errorf("the window %d ends before it starts", i)
+		}
+
+		if i > 0 && window.StartTimeUnixMilli <= windows[i-1].EndTimeUnixMilli {
+			return fmt.Errorf("the window %d has to start after the window before it ends", i)
+		}
+	}
+
+	return nil
+}
+
+func validateCalendar(cal entity.Calendar) error {
+	_, err := compileCalendar(cal)
+
+	return err
+}
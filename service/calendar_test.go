@@ -0,0 +1,198 @@
+package service
+
+import (
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"testing"
+	"time"
+)
+
+// calendarMonday is the midnight a monday starts at in utc
+var calendarMonday = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func at(d time.Duration) int64 {
+	return calendarMonday.Add(d).Unix()
+}
+
+func TestCalendarSpans(t *testing.T) {
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name       string
+		cal        entity.Calendar
+		start, end time.Time
+		want       []calendarSpan
+	}{
+		{
+			name:  "no calendar allows the whole window, its end second included",
+			start: calendarMonday,
+			end:   calendarMonday.Add(3 * time.Minute),
+			want:  []calendarSpan{{from: at(0), to: at(3*time.Minute + time.Second)}},
+		},
+		{
+			name:  "a window ending before it starts allows nothing",
+			start: calendarMonday.Add(time.Minute),
+			end:   calendarMonday,
+			want:  nil,
+		},
+		{
+			name:  "a start within a second begins at the next one",
+			start: calendarMonday.Add(1500 * time.Millisecond),
+			end:   calendarMonday.Add(time.Minute),
+			want:  []calendarSpan{{from: at(2 * time.Second), to: at(time.Minute + time.Second)}},
+		},
+		{
+			name:  "weekdays keep their whole days",
+			cal:   entity.Calendar{Weekdays: []string{"mon", "wed"}},
+			start: calendarMonday,
+			end:   calendarMonday.Add(3*day - time.Second),
+			want: []calendarSpan{
+				{from: at(0), to: at(day)},
+				{from: at(2 * day), to: at(3 * day)},
+			},
+		},
+		{
+			name:  "sessions are read in the calendar timezone",
+			cal:   entity.Calendar{Timezone: "Asia/Jakarta", Sessions: []entity.CalendarSession{{Start: "09:00", End: "16:00"}}},
+			start: calendarMonday,
+			end:   calendarMonday.Add(day + 3*time.Hour),
+			want: []calendarSpan{
+				{from: at(2 * time.Hour), to: at(9 * time.Hour)},
+				{from: at(day + 2*time.Hour), to: at(day + 3*time.Hour + time.Second)},
+			},
+		},
+		{
+			name:  "an overnight session of the day before runs into the window",
+			cal:   entity.Calendar{Sessions: []entity.CalendarSession{{Start: "22:00", End: "02:00"}}},
+			start: calendarMonday,
+			end:   calendarMonday.Add(day - time.Second),
+			want: []calendarSpan{
+				{from: at(0), to: at(2 * time.Hour)},
+				{from: at(22 * time.Hour), to: at(day)},
+			},
+		},
+		{
+			name: "touching sessions merge",
+			cal: entity.Calendar{Sessions: []entity.CalendarSession{
+				{Start: "12:00", End: "14:00"},
+				{Start: "09:00", End: "12:00"},
+			}},
+			start: calendarMonday,
+			end:   calendarMonday.Add(day - time.Second),
+			want:  []calendarSpan{{from: at(9 * time.Hour), to: at(14 * time.Hour)}},
+		},
+		{
+			name: "exclusions are cut out, a bar opening in one is dropped",
+			cal: entity.Calendar{Exclusions: []entity.TimeRange{
+				{StartTimeUnixMilli: calendarMonday.Add(2 * time.Minute).UnixMilli(), EndTimeUnixMilli: calendarMonday.Add(2*time.Minute + 30*time.Second).UnixMilli()},
+				{StartTimeUnixMilli: calendarMonday.Add(-time.Hour).UnixMilli(), EndTimeUnixMilli: calendarMonday.Add(time.Minute).UnixMilli()},
+			}},
+			start: calendarMonday,
+			end:   calendarMonday.Add(4 * time.Minute),
+			want: []calendarSpan{
+				{from: at(time.Minute), to: at(2 * time.Minute)},
+				{from: at(2*time.Minute + 30*time.Second), to: at(4*time.Minute + time.Second)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compiled, err := compileCalendar(test.cal)
+			if err != nil {
+				t.Fatalf("compileCalendar error: %v", err)
+			}
+
+			got := compiled.spans(test.start, test.end)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("spans = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBoundWindows(t *testing.T) {
+	now := calendarMonday.Add(90 * 24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		windows []entity.ReplayWindow
+		want    []entity.ReplayWindow
+	}{
+		{
+			name:    "a window without a time range runs up to now",
+			windows: []entity.ReplayWindow{{}},
+			want:    []entity.ReplayWindow{{EndTimeUnixMilli: now.UnixMilli()}},
+		},
+		{
+			name:    "a bounded window is kept",
+			windows: []entity.ReplayWindow{{StartTimeUnixMilli: calendarMonday.UnixMilli(), EndTimeUnixMilli: calendarMonday.Add(time.Hour).UnixMilli()}},
+			want:    []entity.ReplayWindow{{StartTimeUnixMilli: calendarMonday.UnixMilli(), EndTimeUnixMilli: calendarMonday.Add(time.Hour).UnixMilli()}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := boundWindows(test.windows, now)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Fatalf("boundWindows = %v, want %v", got, test.want)
+			}
+
+			// the whole of it plays, not only the first second
+			spans := compiledCalendar{}.windowSpans(got)
+			if len(spans) != 1 || spans[0].to != time.UnixMilli(test.want[0].EndTimeUnixMilli).Unix()+1 {
+				t.Errorf("windowSpans = %v", spans)
+			}
+		})
+	}
+}
+
+func TestCompileCalendarRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		cal  entity.Calendar
+	}{
+		{"an unknown timezone", entity.Calendar{Timezone: "Mars/Olympus"}},
+		{"an unknown weekday", entity.Calendar{Weekdays: []string{"monday"}}},
+		{"a session past midnight", entity.Calendar{Sessions: []entity.CalendarSession{{Start: "09:00", End: "24:30"}}}},
+		{"a session without minutes", entity.Calendar{Sessions: []entity.CalendarSession{{Start: "9", End: "17:00"}}}},
+		{"an exclusion ending at its start", entity.Calendar{Exclusions: []entity.TimeRange{{StartTimeUnixMilli: 1000, EndTimeUnixMilli: 1000}}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := compileCalendar(test.cal)
+			if err == nil {
+				t.Error("compileCalendar returned no error")
+			}
+		})
+	}
+}
+
+func TestAllowedSeconds(t *testing.T) {
+	spans := []calendarSpan{{from: 0, to: 60}, {from: 120, to: 180}}
+
+	tests := []struct {
+		from, to int64
+		want     int64
+	}{
+		{0, 180, 120},
+		{30, 150, 60},
+		{60, 120, 0},
+		{170, 400, 10},
+	}
+
+	for _, test := range tests {
+		if got := allowedSeconds(spans, test.from, test.to); got != test.want {
+			t.Errorf("allowedSeconds(%d, %d) = %d, want %d", test.from, test.to, got, test.want)
+		}
+	}
+
+	if span, ok := spanFrom(spans, 90); !ok || span.from != 120 {
+		t.Errorf("spanFrom(90) = %v, %v, want the span from 120", span, ok)
+	}
+
+	if _, ok := spanFrom(spans, 180); ok {
+		t.Error("spanFrom past the last span found one")
+	}
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/shopspring/decimal"
+)
+
+var instrumentNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// rollLookback bounds how far before a roll the last common bar of both legs is looked for.
+const rollLookback = time.Hour
+
+// stitchedInstrument is a continuous instrument with its back-adjustment worked out,
+// it is read only once the stream is created.
+type stitchedInstrument struct {
+	name string
+	legs []stitchedLeg
+}
+
+type stitchedLeg struct {
+	symbol string
+	// from and until bound the leg in epoch seconds, until is 0 on the last leg
+	from  int64
+	until int64
+	scale decimal.Decimal
+	// factor and offset are the back-adjustment, applied after the scale
+	factor decimal.Decimal
+	offset decimal.Decimal
+	// rollAdjustment is the ratio or gap found at the roll out of this leg
+	rollAdjustment decimal.Decimal
+}
+
+func isContinuousSymbol(symbol string) bool {
+	return strings.HasPrefix(symbol, entity.ContinuousInstrumentPrefix)
+}
+
+// splitSymbols separates the stored exchange:pair symbols from the continuous instruments.
+func splitSymbols(symbols []string) ([]string, []string) {
+	plain := []string{}
+	continuous := []string{}
+
+	for _, symbol := range symbols {
+		if isContinuousSymbol(symbol) {
+			continuous = append(continuous, strings.TrimPrefix(symbol, entity.ContinuousInstrumentPrefix))
+		} else {
+			plain = append(plain, symbol)
+		}
+	}
+
+	return plain, continuous
+}
+
+func (l stitchedLeg) activeAt(epoch int64) bool {
+	return epoch >= l.from && (l.until == 0 || epoch < l.until)
+}
+
+// overlaps tells whether the leg plays anywhere within [from, to].
+func (l stitchedLeg) overlaps(from, to int64) bool {
+	return to >= l.from && (l.until == 0 || from < l.until)
+}
+
+func (l stitchedLeg) apply(candle entity.Candle, name string) entity.Candle {
+	price := func(p decimal.Decimal) decimal.Decimal {
+		return p.Mul(l.scale).Mul(l.factor).Add(l.offset)
+	}
+
+	candle.Exchange = strings.TrimSuffix(entity.ContinuousInstrumentPrefix, ":")
+	candle.Pair = name
+	candle.Symbol = entity.ContinuousInstrumentPrefix + name
+	candle.Open = price(candle.Open)
+	candle.High = price(candle.High)
+	candle.Low = price(candle.Low)
+	candle.Close = price(candle.Close)
+	candle.Volume = entity.CandleVolume{
+		Total: candle.Volume.Total.Div(l.scale),
+		Buy:   candle.Volume.Buy.Div(l.scale),
+		Sell:  candle.Volume.Sell.Div(l.scale),
+	}
+
+	return candle
+}
+
+// legSymbols lists the stored symbols the instruments play within [from, to].
+func legSymbols(instruments []*stitchedInstrument, from, to time.Time) []string {
+	symbols := []string{}
+	seen := map[string]bool{}
+
+	for _, instrument := range instruments {
+		for _, leg := range instrument.legs {
+			if !seen[leg.symbol] && leg.overlaps(from.Unix(), to.Unix()) {
+				seen[leg.symbol] = true
+				symbols = append(symbols, leg.symbol)
+			}
+		}
+	}
+
+	return symbols
+}
+
+// mapInstruments keeps the candles of the plain symbols and turns the candles of active
+// legs into candles of their instrument. The epoch order of the page is kept.
+func mapInstruments(candles []entity.Candle, plain []string, instruments []*stitchedInstrument) []entity.Candle {
+	if len(instruments) == 0 {
+		return candles
+	}
+
+	isPlain := map[string]bool{}
+	for _, symbol := range plain {
+		isPlain[symbol] = true
+	}
+
+	mapped := make([]entity.Candle, 0, len(candles))
+
+	for _, candle := range candles {
+		if isPlain[candle.Symbol] {
+			mapped = append(mapped, candle)
+		}
+
+		for _, instrument := range instruments {
+			for _, leg := range instrument.legs {
+				if leg.symbol == candle.Symbol && leg.activeAt(candle.Epoch) {
+					mapped = append(mapped, leg.apply(candle, instrument.name))
+				}
+			}
+		}
+	}
+
+	return mapped
+}
+
+// rollMessages returns the rolls of the instruments within [start, end).
+func rollMessages(instruments []*stitchedInstrument, start, end time.Time) ([]replayMessage, error) {
+	msgs := []replayMessage{}
+
+	for _, instrument := range instruments {
+		for i, leg := range instrument.legs {
+			if leg.until == 0 || leg.until < start.Unix() || leg.until >= end.Unix() {
+				continue
+			}
+
+			data, err := json.Marshal(entity.RollData{
+				Epoch:      leg.until,
+				Instrument: entity.ContinuousInstrumentPrefix + instrument.name,
+				From:       leg.symbol,
+				To:         instrument.legs[i+1].symbol,
+				Adjustment: leg.rollAdjustment,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("[service][replay][rollMessages][json.Marshal] error: %w", err)
+			}
+
+			msgs = append(msgs, replayMessage{epoch: leg.until, rank: replayMessageRankUniverse, msgType: entity.WsMessageTypeRoll, data: data})
+		}
+	}
+
+	return msgs, nil
+}
+
+// stitchInstruments resolves the continuous instruments the symbols refer to and works out
+// their back-adjustment from the last bar both legs have before each roll.
+func (s *replay) stitchInstruments(ctx context.Context, definitions []entity.ContinuousInstrument, names []string) ([]*stitchedInstrument, error) {
+	byName := map[string]entity.ContinuousInstrument{}
+	for _, definition := range definitions {
+		byName[definition.Name] = definition
+	}
+
+	instruments := []*stitchedInstrument{}
+
+	for _, name := range names {
+		definition, ok := byName[name]
+		if !ok {
+			return nil, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: fmt.Sprintf("the instrument '%s' is not defined", name),
+				Message:         fmt.Sprintf("[service][replay][stitchInstruments] instrument '%s' not defined", name),
+			})
+		}
+
+		legs := make([]stitchedLeg, len(definition.Legs))
+		for i, leg := range definition.Legs {
+			scale := leg.Scale
+			if scale.IsZero() {
+				scale = decimal.NewFromInt(1)
+			}
+
+			legs[i] = stitchedLeg{
+				symbol:         leg.Symbol,
+				until:          leg.RollAtUnixMilli / 1000,
+				scale:          scale,
+				factor:         decimal.NewFromInt(1),
+				offset:         decimal.Zero,
+				rollAdjustment: decimal.Zero,
+			}
+			if i > 0 {
+				legs[i].from = legs[i-1].until
+			}
+		}
+
+		if definition.BackAdjustment == entity.BackAdjustmentRatio || definition.BackAdjustment == entity.BackAdjustmentDifference {
+			// the last leg is played as stored, every earlier leg is adjusted onto the one after it
+			for i := len(legs) - 2; i >= 0; i-- {
+				oldClose, newClose, err := s.rollCloses(ctx, legs[i], legs[i+1])
+				if err != nil {
+					return nil, err
+				}
+
+				if definition.BackAdjustment == entity.BackAdjustmentRatio {
+					legs[i].rollAdjustment = newClose.Div(oldClose)
+					legs[i].factor = legs[i+1].factor.Mul(legs[i].rollAdjustment)
+				} else {
+					legs[i].rollAdjustment = newClose.Sub(oldClose)
+					legs[i].offset = legs[i+1].offset.Add(legs[i].rollAdjustment)
+				}
+			}
+		}
+
+		instruments = append(instruments, &stitchedInstrument{
+			name: name,
+			legs: legs,
+		})
+	}
+
+	return instruments, nil
+}
+
+// rollCloses returns the scaled closes of both legs at the last bar they share before the roll.
+func (s *replay) rollCloses(ctx context.Context, from, to stitchedLeg) (decimal.Decimal, decimal.Decimal, error) {
+	roll := time.Unix(from.until, 0)
+
+	candles, err := s.candlesRepo.GetCandles(ctx, entity.CandleInterval1m, []string{from.symbol, to.symbol}, roll.Add(-rollLookback), roll.Add(-time.Second), nil, 0)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][replay][rollCloses][candlesRepo.GetCandles] error: %v", err),
+		})
+	}
+
+	closes := map[int64]map[string]decimal.Decimal{}
+	for _, candle := range candles {
+		if closes[candle.Epoch] == nil {
+			closes[candle.Epoch] = map[string]decimal.Decimal{}
+		}
+
+		closes[candle.Epoch][candle.Symbol] = candle.Close
+	}
+
+	for i := len(candles) - 1; i >= 0; i-- {
+		epochCloses := closes[candles[i].Epoch]
+
+		oldClose, hasOld := epochCloses[from.symbol]
+		newClose, hasNew := epochCloses[to.symbol]
+		if !hasOld || !hasNew || !oldClose.IsPositive() || !newClose.IsPositive() {
+			continue
+		}
+
+		return oldClose.Mul(from.scale), newClose.Mul(to.scale), nil
+	}
+
+	return decimal.Zero, decimal.Zero, apperror.BadRequestError(apperror.AppErrorOpt{
+		Code:            http.StatusUnprocessableEntity,
+		ResponseMessage: fmt.Sprintf("'%s' and '%s' have no common bar in the %s before their roll at %s", from.symbol, to.symbol, rollLookback.String(), roll.UTC().Format(time.RFC3339)),
+		Message:         fmt.Sprintf("[service][replay][rollCloses] no common bar of '%s' and '%s' before the roll", from.symbol, to.symbol),
+	})
+}
+
+func validateInstruments(instruments []entity.ContinuousInstrument, symbols []string) error {
+	names := map[string]bool{}
+
+	for _, instrument := range instruments {
+		if !instrumentNamePattern.MatchString(instrument.Name) {
+			return fmt.Errorf("the instrument name '%s' is invalid", instrument.Name)
+		}
+
+		if names[instrument.Name] {
+			return fmt.Errorf("the instrument '%s' is defined twice", instrument.Name)
+		}
+		names[instrument.Name] = true
+
+		switch instrument.BackAdjustment {
+		case "", entity.BackAdjustmentNone, entity.BackAdjustmentRatio, entity.BackAdjustmentDifference:
+		default:
+			return fmt.Errorf("the back adjustment '%s' is not supported", instrument.BackAdjustment)
+		}
+
+		if len(instrument.Legs) == 0 {
+			return fmt.Errorf("the instrument '%s' has no legs", instrument.Name)
+		}
+
+		for i, leg := range instrument.Legs {
+			if len(strings.Split(leg.Symbol, ":")) != 2 || isContinuousSymbol(leg.Symbol) {
+				return fmt.Errorf("the leg '%s' of '%s' is not a stored exchange:pair symbol", leg.Symbol, instrument.Name)
+			}
+
+			if leg.Scale.IsNegative() {
+				return fmt.Errorf("the leg '%s' of '%s' has a negative scale", leg.Symbol, instrument.Name)
+			}
+
+			isLast := i == len(instrument.Legs)-1
+			if isLast && leg.RollAtUnixMilli != 0 {
+				return fmt.Errorf("the last leg of '%s' can not roll", instrument.Name)
+			}
+			if !isLast && leg.RollAtUnixMilli <= 0 {
+				return fmt.Errorf("every leg of '%s' but the last needs a roll time", instrument.Name)
+			}
+			if i > 0 && !isLast && leg.RollAtUnixMilli <= instrument.Legs[i-1].RollAtUnixMilli {
+				return fmt.Errorf("the rolls of '%s' must be in increasing order", instrument.Name)
+			}
+		}
+	}
+
+	_, continuous := splitSymbols(symbols)
+	for _, name := range continuous {
+		if !names[name] {
+			return fmt.Errorf("the instrument '%s' is not defined", name)
+		}
+	}
+
+	return nil
+}
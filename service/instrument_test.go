@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// legCandle is a 1m bar of a leg closing at close, the other prices are the close.
+func legCandle(symbol string, at time.Time, close string) entity.Candle {
+	exchange, pair, _ := strings.Cut(symbol, ":")
+	price := decimal.RequireFromString(close)
+
+	return entity.Candle{
+		Epoch:    at.Unix(),
+		Exchange: exchange,
+		Pair:     pair,
+		Symbol:   symbol,
+		Open:     price,
+		High:     price,
+		Low:      price,
+		Close:    price,
+		Volume:   entity.CandleVolume{Total: decimal.NewFromInt(1000), Buy: decimal.NewFromInt(600), Sell: decimal.NewFromInt(400)},
+	}
+}
+
+func describeLegs(legs []stitchedLeg) []string {
+	described := []string{}
+	for _, leg := range legs {
+		described = append(described, fmt.Sprintf("%s %d %d %s %s %s", leg.symbol, leg.from, leg.until, leg.factor, leg.offset, leg.rollAdjustment))
+	}
+
+	return described
+}
+
+func TestStitchInstruments(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryReplay(t)
+
+	firstRoll := calendarMonday.Add(2 * time.Hour)
+	secondRoll := calendarMonday.Add(4 * time.Hour)
+	first, second := firstRoll.Unix(), secondRoll.Unix()
+
+	// the bar a minute before the first roll has no bar of the next leg, so the one before it is used
+	err := s.candles1mRepo.InsertMany(ctx, []entity.Candle{
+		legCandle("binance:BTCUSDT_240329", firstRoll.Add(-2*time.Minute), "100"),
+		legCandle("binance:BTCUSDT_240628", firstRoll.Add(-2*time.Minute), "110"),
+		legCandle("binance:BTCUSDT_240329", firstRoll.Add(-time.Minute), "999"),
+		legCandle("binance:BTCUSDT_240628", secondRoll.Add(-time.Minute), "120"),
+		legCandle("binance:BTCUSDT_240927", secondRoll.Add(-time.Minute), "126"),
+	})
+	if err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+
+	legs := []entity.InstrumentLeg{
+		{Symbol: "binance:BTCUSDT_240329", RollAtUnixMilli: firstRoll.UnixMilli()},
+		{Symbol: "binance:BTCUSDT_240628", RollAtUnixMilli: secondRoll.UnixMilli()},
+		{Symbol: "binance:BTCUSDT_240927"},
+	}
+
+	// one bar of each leg around the rolls, the bar of a leg it is not active at is dropped
+	page := []entity.Candle{
+		legCandle("binance:BTCUSDT", firstRoll.Add(-2*time.Minute), "43000"),
+		legCandle("binance:BTCUSDT_240329", firstRoll.Add(-2*time.Minute), "100"),
+		legCandle("binance:BTCUSDT_240628", firstRoll.Add(-2*time.Minute), "110"),
+		legCandle("binance:BTCUSDT_240628", firstRoll, "110"),
+		legCandle("binance:BTCUSDT_240927", secondRoll, "126"),
+	}
+
+	tests := []struct {
+		name           string
+		backAdjustment entity.BackAdjustment
+		// legs is symbol from until factor offset rollAdjustment
+		legs   []string
+		closes []string
+	}{
+		{
+			name:           "played as stored",
+			backAdjustment: entity.BackAdjustmentNone,
+			legs: []string{
+				fmt.Sprintf("binance:BTCUSDT_240329 0 %d 1 0 0", first),
+				fmt.Sprintf("binance:BTCUSDT_240628 %d %d 1 0 0", first, second),
+				fmt.Sprintf("binance:BTCUSDT_240927 %d 0 1 0 0", second),
+			},
+			closes: []string{"binance:BTCUSDT 43000", "cont:BTC 100", "cont:BTC 110", "cont:BTC 126"},
+		},
+		{
+			name:           "ratio chains the factors back from the last leg",
+			backAdjustment: entity.BackAdjustmentRatio,
+			legs: []string{
+				fmt.Sprintf("binance:BTCUSDT_240329 0 %d 1.155 0 1.1", first),
+				fmt.Sprintf("binance:BTCUSDT_240628 %d %d 1.05 0 1.05", first, second),
+				fmt.Sprintf("binance:BTCUSDT_240927 %d 0 1 0 0", second),
+			},
+			closes: []string{"binance:BTCUSDT 43000", "cont:BTC 115.5", "cont:BTC 115.5", "cont:BTC 126"},
+		},
+		{
+			name:           "difference sums the gaps back from the last leg",
+			backAdjustment: entity.BackAdjustmentDifference,
+			legs: []string{
+				fmt.Sprintf("binance:BTCUSDT_240329 0 %d 1 16 10", first),
+				fmt.Sprintf("binance:BTCUSDT_240628 %d %d 1 6 6", first, second),
+				fmt.Sprintf("binance:BTCUSDT_240927 %d 0 1 0 0", second),
+			},
+			closes: []string{"binance:BTCUSDT 43000", "cont:BTC 116", "cont:BTC 116", "cont:BTC 126"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			definitions := []entity.ContinuousInstrument{{Name: "BTC", Legs: legs, BackAdjustment: test.backAdjustment}}
+
+			instruments, err := s.stitchInstruments(ctx, definitions, []string{"BTC"})
+			if err != nil {
+				t.Fatalf("stitchInstruments error: %v", err)
+			}
+
+			if got := describeLegs(instruments[0].legs); fmt.Sprint(got) != fmt.Sprint(test.legs) {
+				t.Errorf("legs = %q, want %q", got, test.legs)
+			}
+
+			closes := []string{}
+			for _, candle := range mapInstruments(page, []string{"binance:BTCUSDT"}, instruments) {
+				closes = append(closes, candle.Symbol+" "+candle.Close.String())
+			}
+			if fmt.Sprint(closes) != fmt.Sprint(test.closes) {
+				t.Errorf("mapInstruments closes = %q, want %q", closes, test.closes)
+			}
+		})
+	}
+}
+
+func TestStitchInstrumentsRejects(t *testing.T) {
+	s := newMemoryReplay(t)
+	roll := calendarMonday.Add(2 * time.Hour)
+
+	// the only common bar is older than the lookback before the roll
+	err := s.candles1mRepo.InsertMany(context.Background(), []entity.Candle{
+		legCandle("binance:BTCUSDT_240329", roll.Add(-rollLookback-time.Minute), "100"),
+		legCandle("binance:BTCUSDT_240628", roll.Add(-rollLookback-time.Minute), "110"),
+		legCandle("binance:BTCUSDT_240329", roll.Add(-time.Minute), "100"),
+	})
+	if err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+
+	definitions := []entity.ContinuousInstrument{{
+		Name: "BTC",
+		Legs: []entity.InstrumentLeg{
+			{Symbol: "binance:BTCUSDT_240329", RollAtUnixMilli: roll.UnixMilli()},
+			{Symbol: "binance:BTCUSDT_240628"},
+		},
+		BackAdjustment: entity.BackAdjustmentRatio,
+	}}
+
+	tests := []struct {
+		name  string
+		names []string
+	}{
+		{"an undefined instrument", []string{"ETH"}},
+		{"no common bar within the lookback", []string{"BTC"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.stitchInstruments(context.Background(), definitions, test.names)
+			if code := appErrorCode(err); code != http.StatusUnprocessableEntity {
+				t.Errorf("stitchInstruments gave %d (%v), want %d", code, err, http.StatusUnprocessableEntity)
+			}
+		})
+	}
+}
+
+func TestLegApplyScales(t *testing.T) {
+	leg := stitchedLeg{
+		symbol: "binance:SHIBUSDT",
+		scale:  decimal.NewFromInt(1000),
+		factor: decimal.RequireFromString("1.5"),
+		offset: decimal.RequireFromString("0.001"),
+	}
+
+	got := leg.apply(legCandle("binance:SHIBUSDT", calendarMonday, "0.00001"), "SHIB")
+
+	if got.Exchange != "cont" || got.Pair != "SHIB" || got.Symbol != "cont:SHIB" {
+		t.Errorf("apply gave %s %s %s, want cont SHIB cont:SHIB", got.Exchange, got.Pair, got.Symbol)
+	}
+
+	// 0.00001 * 1000 * 1.5 + 0.001
+	if !got.Close.Equal(decimal.RequireFromString("0.016")) {
+		t.Errorf("apply close = %s, want 0.016", got.Close)
+	}
+
+	if !got.Volume.Total.Equal(decimal.NewFromInt(1)) || !got.Volume.Buy.Equal(decimal.RequireFromString("0.6")) || !got.Volume.Sell.Equal(decimal.RequireFromString("0.4")) {
+		t.Errorf("apply volume = %+v, want the volumes divided by the scale", got.Volume)
+	}
+}
+
+func TestRollMessages(t *testing.T) {
+	first := calendarMonday.Add(2 * time.Hour)
+	second := calendarMonday.Add(4 * time.Hour)
+
+	instruments := []*stitchedInstrument{{
+		name: "BTC",
+		legs: []stitchedLeg{
+			{symbol: "binance:BTCUSDT_240329", until: first.Unix(), rollAdjustment: decimal.RequireFromString("1.1")},
+			{symbol: "binance:BTCUSDT_240628", from: first.Unix(), until: second.Unix(), rollAdjustment: decimal.RequireFromString("1.05")},
+			{symbol: "binance:BTCUSDT_240927", from: second.Unix()},
+		},
+	}}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       []string
+	}{
+		{"both rolls", calendarMonday, second.Add(time.Second), []string{
+			fmt.Sprintf("%d cont:BTC binance:BTCUSDT_240329>binance:BTCUSDT_240628 1.1", first.Unix()),
+			fmt.Sprintf("%d cont:BTC binance:BTCUSDT_240628>binance:BTCUSDT_240927 1.05", second.Unix()),
+		}},
+		{"a roll at the start is sent", first, second, []string{
+			fmt.Sprintf("%d cont:BTC binance:BTCUSDT_240329>binance:BTCUSDT_240628 1.1", first.Unix()),
+		}},
+		{"a roll at the end is not", first.Add(time.Second), second, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msgs, err := rollMessages(instruments, test.start, test.end)
+			if err != nil {
+				t.Fatalf("rollMessages error: %v", err)
+			}
+
+			got := []string{}
+			for _, msg := range msgs {
+				var roll entity.RollData
+				err := json.Unmarshal(msg.data, &roll)
+				if err != nil {
+					t.Fatalf("json.Unmarshal error: %v", err)
+				}
+
+				if msg.msgType != entity.WsMessageTypeRoll || msg.epoch != roll.Epoch {
+					t.Errorf("message %s at %d does not match its roll at %d", msg.msgType, msg.epoch, roll.Epoch)
+				}
+
+				got = append(got, fmt.Sprintf("%d %s %s>%s %s", roll.Epoch, roll.Instrument, roll.From, roll.To, roll.Adjustment))
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("rollMessages = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLegSymbols(t *testing.T) {
+	first := calendarMonday.Add(2 * time.Hour)
+
+	instruments := []*stitchedInstrument{
+		{name: "BTC", legs: []stitchedLeg{
+			{symbol: "binance:BTCUSDT_240329", until: first.Unix()},
+			{symbol: "binance:BTCUSDT_240628", from: first.Unix()},
+		}},
+		{name: "ALSO_BTC", legs: []stitchedLeg{
+			{symbol: "binance:BTCUSDT_240628"},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []string
+	}{
+		{"before the roll", calendarMonday, first.Add(-time.Second), []string{"binance:BTCUSDT_240329", "binance:BTCUSDT_240628"}},
+		{"across the roll", calendarMonday, first, []string{"binance:BTCUSDT_240329", "binance:BTCUSDT_240628"}},
+		{"from the roll", first, first.Add(time.Hour), []string{"binance:BTCUSDT_240628"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := legSymbols(instruments, test.from, test.to)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("legSymbols = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateInstruments(t *testing.T) {
+	roll := calendarMonday.UnixMilli()
+	legs := func(rolls ...int64) []entity.InstrumentLeg {
+		legs := []entity.InstrumentLeg{}
+		for i, rollAt := range rolls {
+			legs = append(legs, entity.InstrumentLeg{Symbol: fmt.Sprintf("binance:BTCUSDT_%d", i), RollAtUnixMilli: rollAt})
+		}
+
+		return legs
+	}
+
+	tests := []struct {
+		name        string
+		instruments []entity.ContinuousInstrument
+		symbols     []string
+		wantErr     string
+	}{
+		{"a valid instrument", []entity.ContinuousInstrument{{Name: "BTC", Legs: legs(roll, roll+1000, 0), BackAdjustment: entity.BackAdjustmentRatio}}, []string{"cont:BTC", "binance:ETHUSDT"}, ""},
+		{"a single leg", []entity.ContinuousInstrument{{Name: "BTC", Legs: legs(0)}}, []string{"cont:BTC"}, ""},
+		{"an invalid name", []entity.ContinuousInstrument{{Name: "BTC perp", Legs: legs(0)}}, nil, "name 'BTC perp' is invalid"},
+		{"a name defined twice", []entity.ContinuousInstrument{{Name: "BTC", Legs: legs(0)}, {Name: "BTC", Legs: legs(0)}}, nil, "defined twice"},
+		{"an unknown back adjustment", []entity.ContinuousInstrument{{Name: "BTC", Legs: legs(0), BackAdjustment: "panama"}}, nil, "'panama' is not supported"},
+		{"no legs", []entity.ContinuousInstrument{{Name: "BTC"}}, nil, "has no legs"},
+		{"a leg without an exchange", []entity.ContinuousInstrument{{Name: "BTC", Legs: []entity.InstrumentLeg{{Symbol: "BTCUSDT"}}}}, nil, "not a stored exchange:pair symbol"},
+		{"a continuous leg", []entity.ContinuousInstrument{{Name: "BTC", Legs: []entity.InstrumentLeg{{Symbol: "cont:ETH"}}}}, nil, "not a stored exchange:pair symbol"},
+		{"a negative scale", []entity.ContinuousInstrument{{Name: "BTC", Legs: []entity.InstrumentLeg{{Symbol: "binance:BTCUSDT", Scale: decimal.NewFromInt(-1)}}}}, nil, "negative scale"},
+		{"a last leg that rolls", []entity.ContinuousInstrument{{Name: "BTC", Legs: legs(roll, roll+1000)}}, nil, "last leg of 'BTC' can not roll"},
+		{"a leg without a roll", []entity.ContinuousInstrument{{Name: "BTC", Legs: legs(roll, 0, 0)}}, nil, "needs a roll time"},
+		{"rolls out of order", []entity.ContinuousInstrument{{Name: "BTC", Legs: legs(roll, roll, 0)}}, nil, "increasing order"},
+		{"an undefined instrument", []entity.ContinuousInstrument{{Name: "BTC", Legs: legs(0)}}, []string{"cont:ETH"}, "'ETH' is not defined"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateInstruments(test.instruments, test.symbols)
+
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateInstruments error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("validateInstruments = %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
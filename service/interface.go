@@ -3,16 +3,60 @@ package service
 import (
 	"context"
 	"michaelyusak/go-quant-replay-engine.git/entity"
+	"time"
 )
 
 type Write interface {
 	ImportFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error
+	ImportFundingRateFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error
+	ImportOpenInterestFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error
+	ImportMarkPriceFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error
+	ImportIndexPriceFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error
+	RebuildRollups(ctx context.Context, req entity.RebuildRollupsReq) (entity.RebuildRollupsRes, error)
+	WriteSynthetic(ctx context.Context, req entity.WriteSyntheticReq) (entity.WriteSyntheticRes, error)
 }
 
 type Replay interface {
 	CreateStream(ctx context.Context, req entity.CreateStreamReq) (entity.CreateStreamRes, error)
-	StreamReplay(ctx context.Context, ch chan []byte, channel, token string) error
-	GetConfiguration(ctx context.Context) entity.ReplayConfiguration
-	UpdateConfiguration(ctx context.Context, newConf entity.ReplayConfiguration)
-	GetListenedSymbols() []string
+	StreamReplay(ctx context.Context, ch chan []byte, auth entity.WsAuthData) error
+	GetConfiguration(ctx context.Context) (entity.ReplayConfiguration, error)
+	UpdateConfiguration(ctx context.Context, newConf entity.ReplayConfiguration) error
+	GetListenedSymbols(ctx context.Context) ([]string, error)
+	ListStreams(ctx context.Context) []entity.StreamInfo
+	GetStream(ctx context.Context, channel string) (entity.StreamInfo, error)
+	DeleteStream(ctx context.Context, channel string) error
+	PauseStream(ctx context.Context, channel string) error
+	ResumeStream(ctx context.Context, channel string) error
+	SeedDefaultPreset(ctx context.Context, conf entity.ReplayConfiguration) error
+	ListPresets(ctx context.Context) ([]entity.ReplayPreset, error)
+	GetPreset(ctx context.Context, name string) (entity.ReplayPreset, error)
+	CreatePreset(ctx context.Context, preset entity.ReplayPreset) (entity.ReplayPreset, error)
+	UpdatePreset(ctx context.Context, name string, conf entity.ReplayConfiguration) (entity.ReplayPreset, error)
+	DeletePreset(ctx context.Context, name string) error
+}
+
+type Auth interface {
+	AuthenticateApiKey(ctx context.Context, key string) (entity.AuthUser, error)
+	AuthenticateToken(ctx context.Context, token string) (entity.AuthUser, error)
+	IssueToken(ctx context.Context, user entity.AuthUser) (entity.IssueTokenRes, error)
+}
+
+type Quota interface {
+	AllowRequest(ctx context.Context) error
+	CheckStream(ctx context.Context, symbolCount int, window time.Duration) error
+	AcquireStream(ctx context.Context) (func(), error)
+	AcquireImport(ctx context.Context) (func(), error)
+	GetUsage(ctx context.Context) entity.Usage
+}
+
+type Symbol interface {
+	SyncFromBinance(ctx context.Context) (int, error)
+	ListSymbols(ctx context.Context) ([]entity.SymbolInfo, error)
+	GetSymbol(ctx context.Context, symbol string) (entity.SymbolInfo, error)
+}
+
+type Quality interface {
+	ValidateCandles(ctx context.Context, source entity.AnomalySource, candles []entity.Candle) ([]entity.Candle, error)
+	ValidatePriceCandles(ctx context.Context, source entity.AnomalySource, candles []entity.PriceCandle) ([]entity.PriceCandle, error)
+	ListAnomalies(ctx context.Context, req entity.GetAnomaliesReq) ([]entity.Anomaly, error)
 }
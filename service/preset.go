@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// SeedDefaultPreset stores conf as the default preset unless one is already persisted.
+func (s *replay) SeedDefaultPreset(ctx context.Context, conf entity.ReplayConfiguration) error {
+	s.presetMu.Lock()
+	defer s.presetMu.Unlock()
+
+	_, found, err := s.replayPresetsRepo.GetPreset(ctx, entity.ReplayPresetDefault)
+	if err != nil {
+		return fmt.Errorf("[service][replay][SeedDefaultPreset][replayPresetsRepo.GetPreset] error: %w", err)
+	}
+
+	if found {
+		return nil
+	}
+
+	err = validateReplayConfiguration(conf)
+	if err != nil {
+		return fmt.Errorf("[service][replay][SeedDefaultPreset][validateReplayConfiguration] error: %w", err)
+	}
+
+	err = s.replayPresetsRepo.Save(ctx, entity.ReplayPreset{
+		Name:               entity.ReplayPresetDefault,
+		Config:             conf,
+		UpdatedAtUnixMilli: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return fmt.Errorf("[service][replay][SeedDefaultPreset][replayPresetsRepo.Save] error: %w", err)
+	}
+
+	logrus.Info("[service][replay][SeedDefaultPreset] default preset seeded from the config")
+
+	return nil
+}
+
+func (s *replay) ListPresets(ctx context.Context) ([]entity.ReplayPreset, error) {
+	presets, err := s.replayPresetsRepo.GetPresets(ctx)
+	if err != nil {
+		return []entity.ReplayPreset{}, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][replay][ListPresets][replayPresetsRepo.GetPresets] error: %v", err),
+		})
+	}
+
+	return presets, nil
+}
+
+func (s *replay) GetPreset(ctx context.Context, name string) (entity.ReplayPreset, error) {
+	preset, found, err := s.replayPresetsRepo.GetPreset(ctx, name)
+	if err != nil {
+		return entity.ReplayPreset{}, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][replay][GetPreset][replayPresetsRepo.GetPreset] error: %v", err),
+		})
+	}
+
+	if !found {
+		return entity.ReplayPreset{}, presetNotFoundError(name, "GetPreset")
+	}
+
+	return preset, nil
+}
+
+func (s *replay) CreatePreset(ctx context.Context, preset entity.ReplayPreset) (entity.ReplayPreset, error) {
+	if !presetNamePattern.MatchString(preset.Name) {
+		return entity.ReplayPreset{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: "preset names are 1 to 64 lowercase letters, digits, '.', '_' or '-'",
+			Message:         fmt.Sprintf("[service][replay][CreatePreset] invalid preset name '%s'", preset.Name),
+		})
+	}
+
+	s.presetMu.Lock()
+	defer s.presetMu.Unlock()
+
+	_, found, err := s.replayPresetsRepo.GetPreset(ctx, preset.Name)
+	if err != nil {
+		return entity.ReplayPreset{}, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][replay][CreatePreset][replayPresetsRepo.GetPreset] error: %v", err),
+		})
+	}
+
+	if found {
+		return entity.ReplayPreset{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusConflict,
+			ResponseMessage: fmt.Sprintf("the preset '%s' already exists", preset.Name),
+			Message:         fmt.Sprintf("[service][replay][CreatePreset] preset '%s' already exists", preset.Name),
+		})
+	}
+
+	return s.savePreset(ctx, "CreatePreset", preset.Name, preset.Config)
+}
+
+func (s *replay) UpdatePreset(ctx context.Context, name string, conf entity.ReplayConfiguration) (entity.ReplayPreset, error) {
+	s.presetMu.Lock()
+	defer s.presetMu.Unlock()
+
+	_, found, err := s.replayPresetsRepo.GetPreset(ctx, name)
+	if err != nil {
+		return entity.ReplayPreset{}, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][replay][UpdatePreset][replayPresetsRepo.GetPreset] error: %v", err),
+		})
+	}
+
+	if !found {
+		return entity.ReplayPreset{}, presetNotFoundError(name, "UpdatePreset")
+	}
+
+	return s.savePreset(ctx, "UpdatePreset", name, conf)
+}
+
+func (s *replay) DeletePreset(ctx context.Context, name string) error {
+	if name == entity.ReplayPresetDefault {
+		return apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: "the default preset can not be deleted",
+			Message:         "[service][replay][DeletePreset] the default preset can not be deleted",
+		})
+	}
+
+	s.presetMu.Lock()
+	defer s.presetMu.Unlock()
+
+	_, found, err := s.replayPresetsRepo.GetPreset(ctx, name)
+	if err != nil {
+		return apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][replay][DeletePreset][replayPresetsRepo.GetPreset] error: %v", err),
+		})
+	}
+
+	if !found {
+		return presetNotFoundError(name, "DeletePreset")
+	}
+
+	err = s.replayPresetsRepo.Delete(ctx, name)
+	if err != nil {
+		return apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][replay][DeletePreset][replayPresetsRepo.Delete] error: %v", err),
+		})
+	}
+
+	return nil
+}
+
+func (s *replay) GetConfiguration(ctx context.Context) (entity.ReplayConfiguration, error) {
+	preset, err := s.GetPreset(ctx, entity.ReplayPresetDefault)
+	if err != nil {
+		return entity.ReplayConfiguration{}, err
+	}
+
+	return preset.Config, nil
+}
+
+// UpdateConfiguration replaces the default preset.
+func (s *replay) UpdateConfiguration(ctx context.Context, newConf entity.ReplayConfiguration) error {
+	s.presetMu.Lock()
+	defer s.presetMu.Unlock()
+
+	_, err := s.savePreset(ctx, "UpdateConfiguration", entity.ReplayPresetDefault, newConf)
+
+	return err
+}
+
+// savePreset must be called with s.presetMu held.
+func (s *replay) savePreset(ctx context.Context, method, name string, conf entity.ReplayConfiguration) (entity.ReplayPreset, error) {
+	err := validateReplayConfiguration(conf)
+	if err != nil {
+		return entity.ReplayPreset{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: err.Error(),
+			Message:         fmt.Sprintf("[service][replay][%s][validateReplayConfiguration] error: %v", method, err),
+		})
+	}
+
+	preset := entity.ReplayPreset{
+		Name:               name,
+		Config:             conf,
+		UpdatedAtUnixMilli: time.Now().UnixMilli(),
+	}
+
+	err = s.replayPresetsRepo.Save(ctx, preset)
+	if err != nil {
+		return entity.ReplayPreset{}, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][replay][%s][replayPresetsRepo.Save] error: %v", method, err),
+		})
+	}
+
+	return preset, nil
+}
+
+func validateReplayConfiguration(conf entity.ReplayConfiguration) error {
+	if conf.Universe != nil {
+		if len(conf.Symbols) > 0 {
+			return errors.New("symbols and a universe can not be combined")
+		}
+
+		err := validateUniverse(*conf.Universe)
+		if err != nil {
+			return err
+		}
+	} else if len(conf.Symbols) == 0 {
+		return errors.New("at least one symbol or a universe is required")
+	}
+
+	if conf.PlaybackSpeed <= 0 {
+		return errors.New("the playback speed must be positive")
+	}
+
+	if conf.EndTimeUnixMilli < conf.StartTimeUnixMilli {
+		return errors.New("the end time can not be before the start time")
+	}
+
+	if len(conf.Windows) > 0 {
+		if conf.StartTimeUnixMilli != 0 || conf.EndTimeUnixMilli != 0 {
+			return errors.New("a start and end time can not be combined with windows")
+		}
+
+		err := validateWindows(conf.Windows)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, series := range conf.Series {
+		switch series {
+		case entity.MarketSeriesFundingRate, entity.MarketSeriesOpenInterest, entity.MarketSeriesMarkPrice, entity.MarketSeriesIndexPrice:
+		default:
+			return fmt.Errorf("the series '%s' is not supported", series)
+		}
+	}
+
+	err := validateInstruments(conf.Instruments, conf.Symbols)
+	if err != nil {
+		return err
+	}
+
+	if conf.Calendar != nil {
+		err = validateCalendar(*conf.Calendar)
+		if err != nil {
+			return err
+		}
+	}
+
+	return validateTickSynthesis(conf.TickSynthesis)
+}
+
+func presetNotFoundError(name, method string) error {
+	return apperror.BadRequestError(apperror.AppErrorOpt{
+		Code:            http.StatusNotFound,
+		ResponseMessage: fmt.Sprintf("the preset '%s' does not exist", name),
+		Message:         fmt.Sprintf("[service][replay][%s] preset '%s' not found", method, name),
+	})
+}
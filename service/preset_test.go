@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/memory"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	hEntity "github.com/michaelyusak/go-helper/entity"
+)
+
+func appErrorCode(err error) int {
+	var appErr *apperror.AppError
+	if !errors.As(err, &appErr) {
+		return 0
+	}
+
+	return appErr.Code
+}
+
+// newMemoryReplay is a replay on the memory backend with btc and eth registered.
+func newMemoryReplay(t *testing.T) *replay {
+	t.Helper()
+
+	candles1mRepo := memory.NewCandles1m()
+	symbolsRepo := memory.NewSymbols()
+
+	err := symbolsRepo.InsertMany(context.Background(), []entity.SymbolInfo{
+		{Exchange: "binance", Pair: "BTCUSDT"},
+		{Exchange: "binance", Pair: "ETHUSDT"},
+	})
+	if err != nil {
+		t.Fatalf("symbolsRepo.InsertMany error: %v", err)
+	}
+
+	return NewReplay(
+		memory.NewCandles(candles1mRepo),
+		candles1mRepo,
+		memory.NewFundingRates(),
+		memory.NewOpenInterests(),
+		memory.NewPriceCandles1m(),
+		memory.NewReplayPresets(),
+		symbolsRepo,
+		nil,
+		NewQuota(entity.Quota{}, nil),
+		NewQuality(memory.NewAnomalies(), entity.QualityConfig{}),
+		entity.ReplayPipelineConfig{},
+	)
+}
+
+func presetConf(speed float32, symbols ...string) entity.ReplayConfiguration {
+	return entity.ReplayConfiguration{
+		Symbols:            symbols,
+		PlaybackSpeed:      speed,
+		StartTimeUnixMilli: calendarMonday.UnixMilli(),
+		EndTimeUnixMilli:   calendarMonday.Add(time.Hour).UnixMilli(),
+	}
+}
+
+func TestValidateReplayConfiguration(t *testing.T) {
+	tests := []struct {
+		name string
+		conf func(conf *entity.ReplayConfiguration)
+		ok   bool
+	}{
+		{"a plain preset", func(conf *entity.ReplayConfiguration) {}, true},
+		{"no symbols", func(conf *entity.ReplayConfiguration) { conf.Symbols = nil }, false},
+		{"no playback speed", func(conf *entity.ReplayConfiguration) { conf.PlaybackSpeed = 0 }, false},
+		{"an end before the start", func(conf *entity.ReplayConfiguration) { conf.EndTimeUnixMilli = conf.StartTimeUnixMilli - 1 }, false},
+		{"no time range", func(conf *entity.ReplayConfiguration) { conf.StartTimeUnixMilli, conf.EndTimeUnixMilli = 0, 0 }, true},
+		{"windows and a time range", func(conf *entity.ReplayConfiguration) {
+			conf.Windows = []entity.ReplayWindow{{StartTimeUnixMilli: 1000, EndTimeUnixMilli: 2000}}
+		}, false},
+		{"windows alone", func(conf *entity.ReplayConfiguration) {
+			conf.StartTimeUnixMilli, conf.EndTimeUnixMilli = 0, 0
+			conf.Windows = []entity.ReplayWindow{{StartTimeUnixMilli: 1000, EndTimeUnixMilli: 2000}, {StartTimeUnixMilli: 3000, EndTimeUnixMilli: 4000}}
+		}, true},
+		{"overlapping windows", func(conf *entity.ReplayConfiguration) {
+			conf.StartTimeUnixMilli, conf.EndTimeUnixMilli = 0, 0
+			conf.Windows = []entity.ReplayWindow{{StartTimeUnixMilli: 1000, EndTimeUnixMilli: 2000}, {StartTimeUnixMilli: 2000, EndTimeUnixMilli: 4000}}
+		}, false},
+		{"a known series", func(conf *entity.ReplayConfiguration) {
+			conf.Series = []entity.MarketSeries{entity.MarketSeriesFundingRate}
+		}, true},
+		{"an unknown series", func(conf *entity.ReplayConfiguration) { conf.Series = []entity.MarketSeries{"liquidations"} }, false},
+		{"an invalid calendar", func(conf *entity.ReplayConfiguration) {
+			conf.Calendar = &entity.Calendar{Weekdays: []string{"someday"}}
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := presetConf(1, "binance:BTCUSDT")
+			test.conf(&conf)
+
+			err := validateReplayConfiguration(conf)
+			if test.ok != (err == nil) {
+				t.Errorf("validateReplayConfiguration error = %v, want ok %v", err, test.ok)
+			}
+		})
+	}
+}
+
+func TestPresetLifecycle(t *testing.T) {
+	s := newMemoryReplay(t)
+	ctx := context.Background()
+
+	err := s.SeedDefaultPreset(ctx, presetConf(1, "binance:BTCUSDT"))
+	if err != nil {
+		t.Fatalf("SeedDefaultPreset error: %v", err)
+	}
+
+	// a seed on a later start keeps what was saved since
+	err = s.UpdateConfiguration(ctx, presetConf(2, "binance:BTCUSDT"))
+	if err != nil {
+		t.Fatalf("UpdateConfiguration error: %v", err)
+	}
+	err = s.SeedDefaultPreset(ctx, presetConf(1, "binance:BTCUSDT"))
+	if err != nil {
+		t.Fatalf("SeedDefaultPreset error: %v", err)
+	}
+
+	conf, err := s.GetConfiguration(ctx)
+	if err != nil || conf.PlaybackSpeed != 2 {
+		t.Fatalf("GetConfiguration = %+v, %v, want the updated default", conf, err)
+	}
+
+	steps := []struct {
+		name string
+		do   func() error
+		code int
+	}{
+		{"an invalid name", func() error {
+			_, err := s.CreatePreset(ctx, entity.ReplayPreset{Name: "Fast Lane", Config: presetConf(1, "binance:BTCUSDT")})
+			return err
+		}, http.StatusUnprocessableEntity},
+		{"an invalid configuration", func() error {
+			_, err := s.CreatePreset(ctx, entity.ReplayPreset{Name: "fast", Config: presetConf(0, "binance:BTCUSDT")})
+			return err
+		}, http.StatusUnprocessableEntity},
+		{"a new preset", func() error {
+			_, err := s.CreatePreset(ctx, entity.ReplayPreset{Name: "fast", Config: presetConf(4, "binance:ETHUSDT")})
+			return err
+		}, 0},
+		{"a preset of a taken name", func() error {
+			_, err := s.CreatePreset(ctx, entity.ReplayPreset{Name: "fast", Config: presetConf(1, "binance:BTCUSDT")})
+			return err
+		}, http.StatusConflict},
+		{"an update of a missing preset", func() error {
+			_, err := s.UpdatePreset(ctx, "slow", presetConf(1, "binance:BTCUSDT"))
+			return err
+		}, http.StatusNotFound},
+		{"a delete of the default preset", func() error { return s.DeletePreset(ctx, entity.ReplayPresetDefault) }, http.StatusUnprocessableEntity},
+		{"a delete of a missing preset", func() error { return s.DeletePreset(ctx, "slow") }, http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		if code := appErrorCode(step.do()); code != step.code {
+			t.Fatalf("%s gave %d, want %d", step.name, code, step.code)
+		}
+	}
+
+	presets, err := s.ListPresets(ctx)
+	if err != nil || len(presets) != 2 {
+		t.Fatalf("ListPresets = %+v, %v, want the default and fast", presets, err)
+	}
+
+	err = s.DeletePreset(ctx, "fast")
+	if err != nil {
+		t.Fatalf("DeletePreset error: %v", err)
+	}
+
+	if _, err := s.GetPreset(ctx, "fast"); appErrorCode(err) != http.StatusNotFound {
+		t.Fatalf("GetPreset of a deleted preset error = %v, want a 404", err)
+	}
+}
+
+func TestCreateStreamResolvesThePreset(t *testing.T) {
+	s := newMemoryReplay(t)
+	ctx := context.Background()
+
+	err := s.SeedDefaultPreset(ctx, presetConf(1, "binance:BTCUSDT"))
+	if err != nil {
+		t.Fatalf("SeedDefaultPreset error: %v", err)
+	}
+
+	_, err = s.CreatePreset(ctx, entity.ReplayPreset{Name: "fast", Config: presetConf(4, "binance:ETHUSDT")})
+	if err != nil {
+		t.Fatalf("CreatePreset error: %v", err)
+	}
+
+	tests := []struct {
+		preset  string
+		code    int
+		want    string
+		speed   float32
+		symbols string
+	}{
+		{"", 0, entity.ReplayPresetDefault, 1, "binance:BTCUSDT"},
+		{"fast", 0, "fast", 4, "binance:ETHUSDT"},
+		{"slow", http.StatusNotFound, "", 0, ""},
+	}
+
+	for _, test := range tests {
+		res, err := s.CreateStream(ctx, entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Preset: test.preset})
+		if code := appErrorCode(err); code != test.code {
+			t.Fatalf("CreateStream of preset %q gave %d (%v), want %d", test.preset, code, err, test.code)
+		}
+
+		if test.code != 0 {
+			continue
+		}
+
+		handler := s.chMap[res.Channel]
+		if handler.preset != test.want || handler.playbackSpeed != test.speed || len(handler.symbols) != 1 || handler.symbols[0] != test.symbols {
+			t.Errorf("stream of preset %q plays %s at %v of %v", test.preset, handler.preset, handler.playbackSpeed, handler.symbols)
+		}
+	}
+}
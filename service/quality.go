@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var defaultAnomalyPolicies = map[entity.AnomalyRule]entity.AnomalyPolicy{
+	entity.AnomalyRuleNonPositivePrice: entity.AnomalyPolicyReject,
+	entity.AnomalyRuleHighBelowBody:    entity.AnomalyPolicyRepair,
+	entity.AnomalyRuleLowAboveBody:     entity.AnomalyPolicyRepair,
+	entity.AnomalyRuleNegativeVolume:   entity.AnomalyPolicyReject,
+	entity.AnomalyRuleBuyAboveTotal:    entity.AnomalyPolicyRepair,
+	entity.AnomalyRuleZeroVolume:       entity.AnomalyPolicyFlag,
+	entity.AnomalyRuleExtremeWick:      entity.AnomalyPolicyFlag,
+}
+
+var defaultExtremeWickRatio = decimal.NewFromFloat(0.2)
+
+type quality struct {
+	anomaliesRepo    repository.Anomalies
+	policies         map[entity.AnomalyRule]entity.AnomalyPolicy
+	extremeWickRatio decimal.Decimal
+
+	getAnomaliesMaxLimit int
+}
+
+func NewQuality(
+	anomaliesRepo repository.Anomalies,
+	conf entity.QualityConfig,
+) *quality {
+	policies := map[entity.AnomalyRule]entity.AnomalyPolicy{}
+	for rule, policy := range defaultAnomalyPolicies {
+		policies[rule] = policy
+	}
+
+	for rule, policy := range conf.Rules {
+		if _, ok := defaultAnomalyPolicies[rule]; !ok {
+			logrus.
+				WithField("rule", rule).
+				Warn("[service][quality][NewQuality] unknown rule skipped")
+			continue
+		}
+
+		switch policy {
+		case entity.AnomalyPolicyReject, entity.AnomalyPolicyFlag, entity.AnomalyPolicyRepair, entity.AnomalyPolicyIgnore:
+			policies[rule] = policy
+		default:
+			logrus.
+				WithField("rule", rule).
+				WithField("policy", policy).
+				Warn("[service][quality][NewQuality] unknown policy skipped")
+		}
+	}
+
+	extremeWickRatio := conf.ExtremeWickRatio
+	if !extremeWickRatio.IsPositive() {
+		extremeWickRatio = defaultExtremeWickRatio
+	}
+
+	return &quality{
+		anomaliesRepo:    anomaliesRepo,
+		policies:         policies,
+		extremeWickRatio: extremeWickRatio,
+
+		getAnomaliesMaxLimit: 10000,
+	}
+}
+
+// candleCheck is one validated bar, price only bars leave the volume nil.
+type candleCheck struct {
+	open, high, low, close *decimal.Decimal
+	volume                 *entity.CandleVolume
+
+	rejected bool
+	dirty    bool
+}
+
+// check runs every rule over the bar, repairing it in place where the policy says so.
+func (s *quality) check(c *candleCheck) []entity.Anomaly {
+	anomalies := []entity.Anomaly{}
+
+	apply := func(rule entity.AnomalyRule, detail string, repair func() bool) {
+		policy := s.policies[rule]
+		// a rejected bar is not stored, the rules after the one rejecting it add nothing
+		if policy == entity.AnomalyPolicyIgnore || c.rejected {
+			return
+		}
+
+		switch policy {
+		case entity.AnomalyPolicyReject:
+			c.rejected = true
+		case entity.AnomalyPolicyRepair:
+			if repair == nil || !repair() {
+				policy = entity.AnomalyPolicyFlag
+			}
+			c.dirty = true
+		default:
+			c.dirty = true
+		}
+
+		anomalies = append(anomalies, entity.Anomaly{Rule: rule, Policy: policy, Detail: detail})
+	}
+
+	if !c.open.IsPositive() || !c.high.IsPositive() || !c.low.IsPositive() || !c.close.IsPositive() {
+		apply(entity.AnomalyRuleNonPositivePrice, fmt.Sprintf("o=%s h=%s l=%s c=%s", c.open, c.high, c.low, c.close), nil)
+	}
+
+	bodyHigh := decimal.Max(*c.open, *c.close)
+	if c.high.LessThan(bodyHigh) {
+		apply(entity.AnomalyRuleHighBelowBody, fmt.Sprintf("high %s < %s", c.high, bodyHigh), func() bool {
+			*c.high = bodyHigh
+			return true
+		})
+	}
+
+	bodyLow := decimal.Min(*c.open, *c.close)
+	if c.low.GreaterThan(bodyLow) {
+		apply(entity.AnomalyRuleLowAboveBody, fmt.Sprintf("low %s > %s", c.low, bodyLow), func() bool {
+			*c.low = bodyLow
+			return true
+		})
+	}
+
+	if c.volume != nil {
+		v := c.volume
+
+		if v.Total.IsNegative() || v.Buy.IsNegative() || v.Sell.IsNegative() {
+			apply(entity.AnomalyRuleNegativeVolume, fmt.Sprintf("total=%s buy=%s sell=%s", v.Total, v.Buy, v.Sell), func() bool {
+				v.Total = decimal.Max(v.Total, decimal.Zero)
+				v.Buy = decimal.Max(v.Buy, decimal.Zero)
+				v.Sell = decimal.Max(v.Sell, decimal.Zero)
+				return true
+			})
+		}
+
+		if v.Buy.GreaterThan(v.Total) {
+			apply(entity.AnomalyRuleBuyAboveTotal, fmt.Sprintf("buy %s > total %s", v.Buy, v.Total), func() bool {
+				v.Buy = v.Total
+				v.Sell = decimal.Zero
+				return true
+			})
+		}
+
+		if v.Total.IsZero() {
+			apply(entity.AnomalyRuleZeroVolume, "no volume traded", nil)
+		}
+	}
+
+	if c.close.IsPositive() {
+		ratio := c.high.Sub(*c.low).Div(*c.close)
+		if ratio.GreaterThan(s.extremeWickRatio) {
+			apply(entity.AnomalyRuleExtremeWick, fmt.Sprintf("range is %s of the close", ratio.StringFixed(4)), nil)
+		}
+	}
+
+	return anomalies
+}
+
+// ValidateCandles runs the rules over candles before they are stored. Rejected candles are
+// left out, flagged and repaired ones come back dirty. Every anomaly goes to the anomaly log.
+func (s *quality) ValidateCandles(ctx context.Context, source entity.AnomalySource, candles []entity.Candle) ([]entity.Candle, error) {
+	valid := make([]entity.Candle, 0, len(candles))
+	logged := []entity.Anomaly{}
+
+	for _, candle := range candles {
+		c := candleCheck{
+			open:   &candle.Open,
+			high:   &candle.High,
+			low:    &candle.Low,
+			close:  &candle.Close,
+			volume: &candle.Volume,
+		}
+
+		for _, anomaly := range s.check(&c) {
+			logged = append(logged, s.fillAnomaly(anomaly, source, candle.Epoch, candle.Exchange, candle.Pair))
+		}
+
+		if c.rejected {
+			continue
+		}
+
+		candle.Dirty = candle.Dirty || c.dirty
+
+		valid = append(valid, candle)
+	}
+
+	err := s.logAnomalies(ctx, "ValidateCandles", logged)
+	if err != nil {
+		return nil, err
+	}
+
+	return valid, nil
+}
+
+// ValidatePriceCandles runs the price rules over mark or index bars. They have no dirty
+// column, a flagged bar is stored as is and only shows up in the anomaly log.
+func (s *quality) ValidatePriceCandles(ctx context.Context, source entity.AnomalySource, candles []entity.PriceCandle) ([]entity.PriceCandle, error) {
+	valid := make([]entity.PriceCandle, 0, len(candles))
+	logged := []entity.Anomaly{}
+
+	for _, candle := range candles {
+		c := candleCheck{
+			open:  &candle.Open,
+			high:  &candle.High,
+			low:   &candle.Low,
+			close: &candle.Close,
+		}
+
+		for _, anomaly := range s.check(&c) {
+			logged = append(logged, s.fillAnomaly(anomaly, source, candle.Epoch, candle.Exchange, candle.Pair))
+		}
+
+		if c.rejected {
+			continue
+		}
+
+		valid = append(valid, candle)
+	}
+
+	err := s.logAnomalies(ctx, "ValidatePriceCandles", logged)
+	if err != nil {
+		return nil, err
+	}
+
+	return valid, nil
+}
+
+func (s *quality) fillAnomaly(anomaly entity.Anomaly, source entity.AnomalySource, epoch int64, exchange, pair string) entity.Anomaly {
+	anomaly.Epoch = epoch
+	anomaly.Exchange = exchange
+	anomaly.Pair = pair
+	anomaly.Symbol = fmt.Sprintf("%s:%s", exchange, pair)
+	anomaly.Source = source
+	anomaly.DetectedAtUnixMilli = time.Now().UnixMilli()
+
+	return anomaly
+}
+
+func (s *quality) logAnomalies(ctx context.Context, method string, anomalies []entity.Anomaly) error {
+	if len(anomalies) == 0 {
+		return nil
+	}
+
+	logrus.
+		WithField("anomalies", len(anomalies)).
+		WithField("symbol", anomalies[0].Symbol).
+		WithField("source", anomalies[0].Source).
+		Warnf("[service][quality][%s] anomalies found", method)
+
+	err := s.anomaliesRepo.InsertMany(ctx, anomalies)
+	if err != nil {
+		return fmt.Errorf("[service][quality][%s][anomaliesRepo.InsertMany] error: %w", method, err)
+	}
+
+	return nil
+}
+
+func (s *quality) ListAnomalies(ctx context.Context, req entity.GetAnomaliesReq) ([]entity.Anomaly, error) {
+	if len(strings.Split(req.Symbol, ":")) != 2 {
+		return []entity.Anomaly{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: "symbol is required in exchange:pair form",
+			Message:         fmt.Sprintf("[service][quality][ListAnomalies] invalid symbol '%s'", req.Symbol),
+		})
+	}
+
+	limit := req.Limit
+	if limit <= 0 || limit > s.getAnomaliesMaxLimit {
+		limit = s.getAnomaliesMaxLimit
+	}
+
+	anomalies, err := s.anomaliesRepo.GetAnomalies(ctx, req.Symbol, time.UnixMilli(req.StartTimeUnixMilli), time.UnixMilli(req.EndTimeUnixMilli), limit)
+	if err != nil {
+		return []entity.Anomaly{}, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][quality][ListAnomalies][anomaliesRepo.GetAnomalies] error: %v", err),
+		})
+	}
+
+	return anomalies, nil
+}
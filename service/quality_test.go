@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/memory"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// qualityBar is a bar as o h l c total buy sell, the volumes left out for a price only bar.
+func qualityBar(fields string) candleCheck {
+	ds := []decimal.Decimal{}
+	for _, field := range strings.Fields(fields) {
+		ds = append(ds, decimal.RequireFromString(field))
+	}
+
+	c := candleCheck{open: &ds[0], high: &ds[1], low: &ds[2], close: &ds[3]}
+	if len(ds) == 7 {
+		c.volume = &entity.CandleVolume{Total: ds[4], Buy: ds[5], Sell: ds[6]}
+	}
+
+	return c
+}
+
+func (c candleCheck) String() string {
+	s := fmt.Sprintf("%s %s %s %s", c.open, c.high, c.low, c.close)
+	if c.volume != nil {
+		s += fmt.Sprintf(" %s %s %s", c.volume.Total, c.volume.Buy, c.volume.Sell)
+	}
+
+	return s
+}
+
+func TestQualityCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[entity.AnomalyRule]entity.AnomalyPolicy
+		bar   string
+		// found lists rule:policy of every anomaly in order
+		found    []string
+		rejected bool
+		dirty    bool
+		// after is the bar once repaired, it defaults to the bar as it came in
+		after string
+	}{
+		{
+			name:  "a clean bar",
+			bar:   "100 101 99 100.5 12.5 7.25 5.25",
+			found: []string{},
+		},
+		{
+			name:     "a non positive price is rejected",
+			bar:      "0 101 99 100.5 12.5 7.25 5.25",
+			found:    []string{"non_positive_price:reject"},
+			rejected: true,
+		},
+		{
+			name:     "a rejected bar stops the rules after it",
+			bar:      "-1 101 99 100.5 0 0 0",
+			found:    []string{"non_positive_price:reject"},
+			rejected: true,
+		},
+		{
+			name:  "the high and low are repaired onto the body",
+			bar:   "100 99.5 100.2 100.5 12.5 7.25 5.25",
+			found: []string{"high_below_body:repair", "low_above_body:repair"},
+			dirty: true,
+			after: "100 100.5 100 100.5 12.5 7.25 5.25",
+		},
+		{
+			name:     "a negative volume is rejected",
+			bar:      "100 101 99 100.5 -1 0 0",
+			found:    []string{"negative_volume:reject"},
+			rejected: true,
+		},
+		{
+			name:  "a negative volume repaired to zero is then flagged as no volume",
+			rules: map[entity.AnomalyRule]entity.AnomalyPolicy{entity.AnomalyRuleNegativeVolume: entity.AnomalyPolicyRepair},
+			bar:   "100 101 99 100.5 -1 0 0",
+			found: []string{"negative_volume:repair", "zero_volume:flag"},
+			dirty: true,
+			after: "100 101 99 100.5 0 0 0",
+		},
+		{
+			name:     "a negative sell is rejected before the buy is looked at",
+			bar:      "100 101 99 100.5 12.5 13 -0.5",
+			found:    []string{"negative_volume:reject"},
+			rejected: true,
+		},
+		{
+			name:  "a buy above the total is capped and the sell zeroed",
+			bar:   "100 101 99 100.5 12.5 13 0",
+			found: []string{"buy_above_total:repair"},
+			dirty: true,
+			after: "100 101 99 100.5 12.5 12.5 0",
+		},
+		{
+			name:  "an extreme wick is flagged",
+			bar:   "100 130 99 100.5 12.5 7.25 5.25",
+			found: []string{"extreme_wick:flag"},
+			dirty: true,
+		},
+		{
+			name:  "an ignored rule finds nothing",
+			rules: map[entity.AnomalyRule]entity.AnomalyPolicy{entity.AnomalyRuleExtremeWick: entity.AnomalyPolicyIgnore},
+			bar:   "100 130 99 100.5 12.5 7.25 5.25",
+			found: []string{},
+		},
+		{
+			name:  "a rule that can not be repaired is flagged",
+			rules: map[entity.AnomalyRule]entity.AnomalyPolicy{entity.AnomalyRuleZeroVolume: entity.AnomalyPolicyRepair},
+			bar:   "100 101 99 100.5 0 0 0",
+			found: []string{"zero_volume:flag"},
+			dirty: true,
+		},
+		{
+			name:  "a price only bar skips the volume rules",
+			bar:   "100 99 99 100.5",
+			found: []string{"high_below_body:repair"},
+			dirty: true,
+			after: "100 100.5 99 100.5",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewQuality(memory.NewAnomalies(), entity.QualityConfig{Rules: test.rules})
+
+			c := qualityBar(test.bar)
+
+			found := []string{}
+			for _, anomaly := range s.check(&c) {
+				found = append(found, fmt.Sprintf("%s:%s", anomaly.Rule, anomaly.Policy))
+			}
+
+			if strings.Join(found, ",") != strings.Join(test.found, ",") {
+				t.Errorf("found %v, want %v", found, test.found)
+			}
+
+			if c.rejected != test.rejected || c.dirty != test.dirty {
+				t.Errorf("rejected %v dirty %v, want %v %v", c.rejected, c.dirty, test.rejected, test.dirty)
+			}
+
+			after := test.after
+			if after == "" {
+				after = qualityBar(test.bar).String()
+			}
+			if c.String() != after {
+				t.Errorf("bar after the check is %s, want %s", c, after)
+			}
+		})
+	}
+}
+
+func TestValidateCandlesLogsEveryAnomaly(t *testing.T) {
+	anomaliesRepo := memory.NewAnomalies()
+	s := NewQuality(anomaliesRepo, entity.QualityConfig{})
+
+	bar := func(epoch int64, fields string) entity.Candle {
+		c := qualityBar(fields)
+
+		return entity.Candle{
+			Epoch: epoch, Exchange: "binance", Pair: "BTCUSDT",
+			Open: *c.open, High: *c.high, Low: *c.low, Close: *c.close,
+			Volume: *c.volume,
+		}
+	}
+
+	valid, err := s.ValidateCandles(context.Background(), entity.AnomalySourceImport, []entity.Candle{
+		bar(0, "100 101 99 100.5 12.5 7.25 5.25"),
+		bar(60, "0 101 99 100.5 12.5 7.25 5.25"),
+		bar(120, "100 99.5 99 100.5 12.5 7.25 5.25"),
+	})
+	if err != nil {
+		t.Fatalf("ValidateCandles error: %v", err)
+	}
+
+	if len(valid) != 2 || valid[0].Dirty || !valid[1].Dirty || valid[1].Epoch != 120 || !valid[1].High.Equal(decimal.RequireFromString("100.5")) {
+		t.Fatalf("valid = %+v, want the clean bar and the repaired one", valid)
+	}
+
+	logged, err := anomaliesRepo.GetAnomalies(context.Background(), "binance:BTCUSDT", time.Unix(0, 0), time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("GetAnomalies error: %v", err)
+	}
+
+	got := []string{}
+	for _, anomaly := range logged {
+		got = append(got, fmt.Sprintf("%d %s %s %s", anomaly.Epoch, anomaly.Source, anomaly.Rule, anomaly.Policy))
+	}
+
+	want := []string{"60 import non_positive_price reject", "120 import high_below_body repair"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("logged %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"golang.org/x/time/rate"
+)
+
+type userUsage struct {
+	streams int
+	imports int
+	limiter *rate.Limiter
+}
+
+type quota struct {
+	defaultQuota entity.Quota
+	userQuotas   map[string]entity.Quota
+
+	usages map[string]*userUsage
+
+	mu sync.Mutex
+}
+
+func NewQuota(
+	defaultQuota entity.Quota,
+	apiKeys []entity.ApiKey,
+) *quota {
+	userQuotas := map[string]entity.Quota{}
+
+	for _, apiKey := range apiKeys {
+		if apiKey.Quota != nil {
+			userQuotas[apiKey.UserId] = *apiKey.Quota
+		}
+	}
+
+	return &quota{
+		defaultQuota: defaultQuota,
+		userQuotas:   userQuotas,
+		usages:       map[string]*userUsage{},
+	}
+}
+
+func (s *quota) quotaOf(userId string) entity.Quota {
+	if q, ok := s.userQuotas[userId]; ok {
+		return q
+	}
+
+	return s.defaultQuota
+}
+
+// usageOf must be called with s.mu held.
+func (s *quota) usageOf(userId string) *userUsage {
+	usage, ok := s.usages[userId]
+	if ok {
+		return usage
+	}
+
+	q := s.quotaOf(userId)
+
+	usage = &userUsage{}
+	if q.RequestsPerSecond > 0 {
+		burst := q.RequestBurst
+		if burst < 1 {
+			burst = 1
+		}
+
+		usage.limiter = rate.NewLimiter(rate.Limit(q.RequestsPerSecond), burst)
+	}
+
+	s.usages[userId] = usage
+
+	return usage
+}
+
+func userIdOf(ctx context.Context) string {
+	user, _ := common.AuthUserFromContext(ctx)
+	return user.UserId
+}
+
+func tooManyRequestsError(responseMessage, method string) error {
+	return apperror.NewAppError(apperror.AppErrorOpt{
+		Code:            http.StatusTooManyRequests,
+		ResponseMessage: responseMessage,
+		Message:         fmt.Sprintf("[service][quota][%s] %s", method, responseMessage),
+	})
+}
+
+func (s *quota) AllowRequest(ctx context.Context) error {
+	s.mu.Lock()
+	usage := s.usageOf(userIdOf(ctx))
+	s.mu.Unlock()
+
+	if usage.limiter != nil && !usage.limiter.Allow() {
+		return tooManyRequestsError("request rate limit exceeded", "AllowRequest")
+	}
+
+	return nil
+}
+
+// CheckStream checks a stream of symbolCount symbols playing window of market time.
+func (s *quota) CheckStream(ctx context.Context, symbolCount int, window time.Duration) error {
+	q := s.quotaOf(userIdOf(ctx))
+
+	if q.MaxSymbolsPerStream > 0 && symbolCount > q.MaxSymbolsPerStream {
+		return tooManyRequestsError(fmt.Sprintf("a stream can have at most %d symbols", q.MaxSymbolsPerStream), "CheckStream")
+	}
+
+	if q.MaxReplayWindow > 0 && window > time.Duration(q.MaxReplayWindow) {
+		return tooManyRequestsError(fmt.Sprintf("the replay window can be at most %s", time.Duration(q.MaxReplayWindow).String()), "CheckStream")
+	}
+
+	return nil
+}
+
+// AcquireStream takes one of the concurrent stream slots of the user, release gives it back.
+func (s *quota) AcquireStream(ctx context.Context) (func(), error) {
+	userId := userIdOf(ctx)
+	q := s.quotaOf(userId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := s.usageOf(userId)
+	if q.MaxConcurrentStreams > 0 && usage.streams >= q.MaxConcurrentStreams {
+		return nil, tooManyRequestsError(fmt.Sprintf("at most %d streams can run at the same time", q.MaxConcurrentStreams), "AcquireStream")
+	}
+
+	usage.streams++
+
+	return s.releaseFunc(func() { usage.streams-- }), nil
+}
+
+// AcquireImport takes one of the concurrent import slots of the user, release gives it back.
+func (s *quota) AcquireImport(ctx context.Context) (func(), error) {
+	userId := userIdOf(ctx)
+	q := s.quotaOf(userId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := s.usageOf(userId)
+	if q.MaxConcurrentImports > 0 && usage.imports >= q.MaxConcurrentImports {
+		return nil, tooManyRequestsError(fmt.Sprintf("at most %d imports can run at the same time", q.MaxConcurrentImports), "AcquireImport")
+	}
+
+	usage.imports++
+
+	return s.releaseFunc(func() { usage.imports-- }), nil
+}
+
+func (s *quota) releaseFunc(release func()) func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			release()
+		})
+	}
+}
+
+func (s *quota) GetUsage(ctx context.Context) entity.Usage {
+	userId := userIdOf(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := s.usageOf(userId)
+
+	requestTokens := float64(-1)
+	if usage.limiter != nil {
+		requestTokens = usage.limiter.Tokens()
+	}
+
+	return entity.Usage{
+		UserId:            userId,
+		ConcurrentStreams: usage.streams,
+		ConcurrentImports: usage.imports,
+		RequestTokens:     requestTokens,
+		Quota:             s.quotaOf(userId),
+	}
+}
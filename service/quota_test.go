@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	hEntity "github.com/michaelyusak/go-helper/entity"
+)
+
+func userContext(userId string) context.Context {
+	return context.WithValue(context.Background(), entity.UserIdKey, userId)
+}
+
+func isTooManyRequests(err error) bool {
+	var appErr *apperror.AppError
+	return errors.As(err, &appErr) && appErr.Code == http.StatusTooManyRequests
+}
+
+func TestQuotaCheckStream(t *testing.T) {
+	s := NewQuota(
+		entity.Quota{MaxSymbolsPerStream: 2, MaxReplayWindow: hEntity.Duration(24 * time.Hour)},
+		[]entity.ApiKey{{UserId: "big", Quota: &entity.Quota{MaxSymbolsPerStream: 50}}},
+	)
+
+	tests := []struct {
+		name    string
+		userId  string
+		symbols int
+		window  time.Duration
+		refused bool
+	}{
+		{"within the default quota", "small", 2, 24 * time.Hour, false},
+		{"too many symbols", "small", 3, time.Hour, true},
+		{"too long a window", "small", 1, 24*time.Hour + time.Minute, true},
+		{"a user quota replaces the default", "big", 50, 365 * 24 * time.Hour, false},
+		{"a user quota still limits", "big", 51, time.Hour, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := s.CheckStream(userContext(test.userId), test.symbols, test.window)
+			if test.refused != (err != nil) {
+				t.Fatalf("CheckStream error = %v, want refused %v", err, test.refused)
+			}
+
+			if err != nil && !isTooManyRequests(err) {
+				t.Errorf("CheckStream error = %v, want a 429", err)
+			}
+		})
+	}
+}
+
+func TestQuotaConcurrentSlots(t *testing.T) {
+	s := NewQuota(entity.Quota{MaxConcurrentStreams: 2, MaxConcurrentImports: 1}, nil)
+
+	tests := []struct {
+		name    string
+		acquire func(ctx context.Context) (func(), error)
+		limit   int
+		usage   func(usage entity.Usage) int
+	}{
+		{"streams", s.AcquireStream, 2, func(usage entity.Usage) int { return usage.ConcurrentStreams }},
+		{"imports", s.AcquireImport, 1, func(usage entity.Usage) int { return usage.ConcurrentImports }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := userContext("u-" + test.name)
+
+			releases := []func(){}
+			for i := 0; i < test.limit; i++ {
+				release, err := test.acquire(ctx)
+				if err != nil {
+					t.Fatalf("acquire %d error: %v", i, err)
+				}
+				releases = append(releases, release)
+			}
+
+			_, err := test.acquire(ctx)
+			if !isTooManyRequests(err) {
+				t.Fatalf("acquire past the limit error = %v, want a 429", err)
+			}
+
+			// the slots are per user
+			release, err := test.acquire(userContext("other-" + test.name))
+			if err != nil {
+				t.Fatalf("acquire of another user error: %v", err)
+			}
+			release()
+
+			// a release given back twice frees one slot only
+			releases[0]()
+			releases[0]()
+
+			if got := test.usage(s.GetUsage(ctx)); got != test.limit-1 {
+				t.Fatalf("usage after a release = %d, want %d", got, test.limit-1)
+			}
+
+			_, err = test.acquire(ctx)
+			if err != nil {
+				t.Fatalf("acquire after a release error: %v", err)
+			}
+		})
+	}
+}
+
+func TestQuotaAllowRequest(t *testing.T) {
+	s := NewQuota(entity.Quota{RequestsPerSecond: 0.001, RequestBurst: 3}, []entity.ApiKey{{UserId: "free", Quota: &entity.Quota{}}})
+
+	ctx := userContext("limited")
+	for i := 0; i < 3; i++ {
+		err := s.AllowRequest(ctx)
+		if err != nil {
+			t.Fatalf("request %d within the burst error: %v", i, err)
+		}
+	}
+
+	err := s.AllowRequest(ctx)
+	if !isTooManyRequests(err) {
+		t.Fatalf("request past the burst error = %v, want a 429", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		err := s.AllowRequest(userContext("free"))
+		if err != nil {
+			t.Fatalf("unlimited request %d error: %v", i, err)
+		}
+	}
+
+	if tokens := s.GetUsage(userContext("free")).RequestTokens; tokens != -1 {
+		t.Errorf("request tokens of an unlimited user = %v, want -1", tokens)
+	}
+}
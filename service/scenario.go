@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	scenarioDefaultBlockDays = 5
+	scenarioMaxDays          = 3650
+	// a relative noise of 10% already buries any bar in it
+	scenarioMaxJitter = 0.1
+
+	secondsPerDay = int64(24 * time.Hour / time.Second)
+)
+
+// candleSource is what a replay reads its bars from, the stored candles or a scenario
+// generated from them.
+type candleSource interface {
+	GetCandles(ctx context.Context, interval entity.CandleInterval, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error)
+}
+
+// resolveScenario draws what the scenario plays. It returns the scenario with its seed
+// and draws filled in, the windows it plays in place of windows and the source of its bars.
+func (s *replay) resolveScenario(ctx context.Context, scenario entity.Scenario, conf entity.ReplayConfiguration, windows []entity.ReplayWindow, interval entity.CandleInterval) (entity.Scenario, []entity.ReplayWindow, candleSource, error) {
+	err := validateScenario(scenario, conf)
+	if err != nil {
+		return entity.Scenario{}, nil, nil, scenarioError(err, "validateScenario")
+	}
+
+	if scenario.Seed == 0 {
+		scenario.Seed = rand.Uint64()
+	}
+
+	if scenario.RangeStartTimeUnixMilli == 0 && scenario.RangeEndTimeUnixMilli == 0 {
+		scenario.RangeStartTimeUnixMilli = windows[0].StartTimeUnixMilli
+		scenario.RangeEndTimeUnixMilli = windows[len(windows)-1].EndTimeUnixMilli
+	}
+
+	rng := rand.New(rand.NewPCG(scenario.Seed, scenario.Seed))
+
+	var source candleSource = s.candlesRepo
+
+	switch scenario.Mode {
+	case entity.ScenarioModeRandomStart:
+		window, err := drawRandomStart(scenario, interval, rng)
+		if err != nil {
+			return entity.Scenario{}, nil, nil, scenarioError(err, "drawRandomStart")
+		}
+
+		windows = []entity.ReplayWindow{window}
+	case entity.ScenarioModeBlockBootstrap:
+		plain, _ := splitSymbols(conf.Symbols)
+
+		dailies, err := s.candlesRepo.GetCandles(ctx, entity.CandleInterval1d, plain, time.UnixMilli(scenario.RangeStartTimeUnixMilli), time.UnixMilli(scenario.RangeEndTimeUnixMilli), nil, 0)
+		if err != nil {
+			return entity.Scenario{}, nil, nil, apperror.InternalServerError(apperror.AppErrorOpt{
+				Message: fmt.Sprintf("[service][replay][resolveScenario][candlesRepo.GetCandles] error: %v", err),
+			})
+		}
+
+		bootstrap, err := drawBootstrap(&scenario, dailies, rng)
+		if err != nil {
+			return entity.Scenario{}, nil, nil, scenarioError(err, "drawBootstrap")
+		}
+		bootstrap.candlesRepo = s.candlesRepo
+
+		windows = []entity.ReplayWindow{{
+			StartTimeUnixMilli: bootstrap.start * 1000,
+			EndTimeUnixMilli:   (bootstrap.start + int64(len(bootstrap.days))*secondsPerDay - 1) * 1000,
+		}}
+		source = bootstrap
+	}
+
+	if scenario.Jitter > 0 {
+		source = jitterSource{source: source, seed: scenario.Seed, jitter: scenario.Jitter}
+	}
+
+	scenario.StartTimeUnixMilli = windows[0].StartTimeUnixMilli
+	scenario.EndTimeUnixMilli = windows[len(windows)-1].EndTimeUnixMilli
+
+	return scenario, windows, source, nil
+}
+
+func scenarioError(err error, call string) error {
+	return apperror.BadRequestError(apperror.AppErrorOpt{
+		Code:            http.StatusUnprocessableEntity,
+		ResponseMessage: err.Error(),
+		Message:         fmt.Sprintf("[service][replay][resolveScenario][%s] error: %v", call, err),
+	})
+}
+
+func validateScenario(scenario entity.Scenario, conf entity.ReplayConfiguration) error {
+	switch scenario.Mode {
+	case entity.ScenarioModeRandomStart:
+		if scenario.Length <= 0 {
+			return errors.New("a random start needs a positive length")
+		}
+	case entity.ScenarioModeBlockBootstrap:
+		// the bootstrapped path only has bars, nothing else of the history lines up with it
+		if conf.Universe != nil || len(conf.Instruments) > 0 || len(conf.Series) > 0 {
+			return errors.New("a bootstrap can not be combined with a universe, continuous instruments or series")
+		}
+
+		if scenario.BlockDays < 0 || scenario.Days < 0 {
+			return errors.New("the block days and days of a bootstrap can not be negative")
+		}
+
+		if scenario.BlockDays > scenarioMaxDays || scenario.Days > scenarioMaxDays {
+			return fmt.Errorf("a bootstrap can be at most %d days", scenarioMaxDays)
+		}
+	case entity.ScenarioModeJitter:
+		if scenario.Jitter <= 0 {
+			return errors.New("a jitter scenario needs a positive jitter")
+		}
+	default:
+		return fmt.Errorf("the scenario mode '%s' is not supported", scenario.Mode)
+	}
+
+	if scenario.Mode != entity.ScenarioModeJitter && len(conf.Windows) > 0 {
+		return errors.New("a scenario drawing its own window can not be combined with windows")
+	}
+
+	if scenario.Jitter < 0 || scenario.Jitter >= scenarioMaxJitter {
+		return fmt.Errorf("the jitter has to be at least 0 and below %v", scenarioMaxJitter)
+	}
+
+	if scenario.RangeEndTimeUnixMilli < scenario.RangeStartTimeUnixMilli {
+		return errors.New("the range can not end before it starts")
+	}
+
+	return nil
+}
+
+// drawRandomStart draws a window of the scenario length starting on a bar of interval within the range.
+func drawRandomStart(scenario entity.Scenario, interval entity.CandleInterval, rng *rand.Rand) (entity.ReplayWindow, error) {
+	step := interval.Duration().Milliseconds()
+	length := time.Duration(scenario.Length).Milliseconds()
+
+	first := scenario.RangeStartTimeUnixMilli
+	if rest := first % step; rest != 0 {
+		first += step - rest
+	}
+
+	// the window ends right before the bar after its length
+	lastStart := scenario.RangeEndTimeUnixMilli + 1 - length
+	if lastStart < first {
+		return entity.ReplayWindow{}, errors.New("the range is shorter than the length")
+	}
+
+	start := first + rng.Int64N((lastStart-first)/step+1)*step
+
+	return entity.ReplayWindow{StartTimeUnixMilli: start, EndTimeUnixMilli: start + length - 1}, nil
+}
+
+// bootstrapSource serves the bars of a bootstrapped path. Every synthetic day plays the
+// bars of the day it was drawn from, scaled to go on from the close of the day before.
+type bootstrapSource struct {
+	candlesRepo repository.Candles
+	// start is the epoch of the first synthetic day
+	start int64
+	days  []bootstrapDay
+}
+
+type bootstrapDay struct {
+	// source is the epoch of the day the bars are read from
+	source int64
+	// scales are by exchange:pair
+	scales map[string]decimal.Decimal
+}
+
+// drawBootstrap draws blocks of consecutive days out of dailies, the 1d bars of the range,
+// and chains them from the first day of the range on.
+func drawBootstrap(scenario *entity.Scenario, dailies []entity.Candle, rng *rand.Rand) (*bootstrapSource, error) {
+	daily := map[int64]map[string]entity.Candle{}
+	for _, candle := range dailies {
+		if daily[candle.Epoch] == nil {
+			daily[candle.Epoch] = map[string]entity.Candle{}
+		}
+
+		daily[candle.Epoch][fmt.Sprintf("%s:%s", candle.Exchange, candle.Pair)] = candle
+	}
+
+	sourceDays := make([]int64, 0, len(daily))
+	for day := range daily {
+		sourceDays = append(sourceDays, day)
+	}
+	sort.Slice(sourceDays, func(i, j int) bool {
+		return sourceDays[i] < sourceDays[j]
+	})
+
+	if scenario.BlockDays == 0 {
+		scenario.BlockDays = min(scenarioDefaultBlockDays, len(sourceDays))
+	}
+	if scenario.Days == 0 {
+		scenario.Days = len(sourceDays)
+	}
+
+	if scenario.BlockDays == 0 || len(sourceDays) < scenario.BlockDays {
+		return nil, fmt.Errorf("the range holds %d days of candles, a block takes %d", len(sourceDays), scenario.BlockDays)
+	}
+
+	drawn := []int64{}
+	scenario.Blocks = []int64{}
+	for len(drawn) < scenario.Days {
+		first := rng.IntN(len(sourceDays) - scenario.BlockDays + 1)
+		scenario.Blocks = append(scenario.Blocks, sourceDays[first]*1000)
+
+		for i := first; i < first+scenario.BlockDays && len(drawn) < scenario.Days; i++ {
+			drawn = append(drawn, sourceDays[i])
+		}
+	}
+
+	bootstrap := &bootstrapSource{
+		start: time.UnixMilli(scenario.RangeStartTimeUnixMilli).Unix() / secondsPerDay * secondsPerDay,
+	}
+
+	// a symbol goes on from its last synthetic close, its first day keeps the prices it had
+	closes := map[string]decimal.Decimal{}
+	for _, day := range drawn {
+		scales := map[string]decimal.Decimal{}
+
+		for symbol, bar := range daily[day] {
+			scale := decimal.NewFromInt(1)
+			if last, ok := closes[symbol]; ok && bar.Open.IsPositive() {
+				scale = last.Div(bar.Open)
+			}
+
+			scales[symbol] = scale
+			closes[symbol] = bar.Close.Mul(scale)
+		}
+
+		bootstrap.days = append(bootstrap.days, bootstrapDay{source: day, scales: scales})
+	}
+
+	return bootstrap, nil
+}
+
+// GetCandles reads the synthetic days within [start, end] off the days they were drawn
+// from, in the order and with the paging of the stored candles.
+func (b *bootstrapSource) GetCandles(ctx context.Context, interval entity.CandleInterval, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error) {
+	candles := []entity.Candle{}
+
+	for k := max((start.Unix()-b.start)/secondsPerDay, 0); k < int64(len(b.days)); k++ {
+		dayStart := b.start + k*secondsPerDay
+		dayEnd := dayStart + secondsPerDay - 1
+		if dayStart > end.Unix() {
+			break
+		}
+
+		if after != nil && after.Epoch > dayEnd {
+			continue
+		}
+
+		day := b.days[k]
+		shift := dayStart - day.source
+
+		var sourceAfter *entity.CandleKey
+		if after != nil && after.Epoch >= dayStart {
+			key := *after
+			key.Epoch -= shift
+			sourceAfter = &key
+		}
+
+		dayLimit := 0
+		if limit > 0 {
+			dayLimit = limit - len(candles)
+		}
+
+		from := time.Unix(max(start.Unix(), dayStart)-shift, 0)
+		to := time.Unix(min(end.Unix(), dayEnd)-shift, 0)
+
+		bars, err := b.candlesRepo.GetCandles(ctx, interval, symbols, from, to, sourceAfter, dayLimit)
+		if err != nil {
+			return nil, fmt.Errorf("[service][replay][bootstrapSource][GetCandles][candlesRepo.GetCandles] error: %w", err)
+		}
+
+		for _, bar := range bars {
+			// a day without its 1d bar was written after the draw, it plays as it is
+			scale, ok := day.scales[fmt.Sprintf("%s:%s", bar.Exchange, bar.Pair)]
+			if !ok {
+				scale = decimal.NewFromInt(1)
+			}
+
+			bar.Epoch += shift
+			bar.Open = bar.Open.Mul(scale).Round(8)
+			bar.High = bar.High.Mul(scale).Round(8)
+			bar.Low = bar.Low.Mul(scale).Round(8)
+			bar.Close = bar.Close.Mul(scale).Round(8)
+
+			candles = append(candles, bar)
+		}
+
+		if limit > 0 && len(candles) >= limit {
+			break
+		}
+	}
+
+	return candles, nil
+}
+
+// jitterSource puts relative noise on the prices of the bars of source.
+type jitterSource struct {
+	source candleSource
+	seed   uint64
+	jitter float64
+}
+
+func (j jitterSource) GetCandles(ctx context.Context, interval entity.CandleInterval, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error) {
+	candles, err := j.source.GetCandles(ctx, interval, symbols, start, end, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, candle := range candles {
+		candles[i] = j.apply(candle)
+	}
+
+	return candles, nil
+}
+
+// apply draws the noise of a bar from the seed and the key of the bar, so a bar read
+// twice across pages gets the same noise.
+func (j jitterSource) apply(candle entity.Candle) entity.Candle {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%s:%s", candle.Epoch, candle.Exchange, candle.Pair)
+
+	rng := rand.New(rand.NewPCG(j.seed, h.Sum64()))
+	noisy := func(price decimal.Decimal) decimal.Decimal {
+		return price.Mul(decimal.NewFromFloat(1 + j.jitter*rng.NormFloat64())).Round(8)
+	}
+
+	open, high, low, close := noisy(candle.Open), noisy(candle.High), noisy(candle.Low), noisy(candle.Close)
+
+	candle.Open = open
+	candle.Close = close
+	candle.High = decimal.Max(high, open, close, low)
+	candle.Low = decimal.Min(low, open, close, high)
+
+	return candle
+}
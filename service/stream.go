@@ -2,57 +2,149 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	binancews "michaelyusak/go-quant-replay-engine.git/adapter/binance_ws"
+	"michaelyusak/go-quant-replay-engine.git/adapter/synthetic"
 	"michaelyusak/go-quant-replay-engine.git/common"
 	"michaelyusak/go-quant-replay-engine.git/entity"
 	"michaelyusak/go-quant-replay-engine.git/repository"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/michaelyusak/go-helper/apperror"
-	"github.com/michaelyusak/go-helper/helper"
 	"github.com/sirupsen/logrus"
 )
 
 type streamHandler struct {
-	interval      entity.CandleInterval
-	symbols       []string
+	preset     string
+	streamType entity.StreamType
+	interval   entity.CandleInterval
+	symbols    []string
+	// delistedAt holds the delisting epoch of the symbols that stop within the replay
+	delistedAt map[string]int64
+	series     []entity.MarketSeries
+	universe   *entity.Universe
+	// candidates are the registry symbols a universe stream picks its members from
+	candidates    []entity.SymbolInfo
+	instruments   []*stitchedInstrument
+	tickSynthesis *entity.TickSynthesis
+	calendar      *entity.Calendar
+	// windows are only set when the replay plays them as segments
+	windows  []entity.ReplayWindow
+	scenario *entity.Scenario
+	// synthetic is the generated market the stream plays in place of its symbols, every run
+	// generates it afresh from its seed
+	synthetic *entity.SyntheticMarket
+	// source serves the bars of the replay, the stored candles unless a scenario generates them.
+	// It is shared by the runs of the stream, a synthetic market has a source of its own per run.
+	source candleSource
+	// spans are the allowed time of the replay windows, all of it without a calendar
+	spans         []calendarSpan
 	playbackSpeed float32
 	startTime     time.Time
 	endTime       time.Time
 	token         string
+	// tokenExpiresAt only bounds starting the stream, a running stream outlives it
+	tokenExpiresAt time.Time
+	oneTimeToken   bool
+	owner          string
+	shared         bool
+	liveUpdates    bool
+	persist        bool
+
+	// session is set once the first subscriber of a shared stream connects
+	session *broadcastSession
+
+	state *streamState
 
 	cleanedAt time.Time
 }
 
 type replay struct {
-	candles1mRepo repository.Candles1m
-	chMap         map[string]streamHandler
-
-	replayConfiguration entity.ReplayConfiguration
+	candlesRepo        repository.Candles
+	candles1mRepo      repository.Candles1m
+	fundingRatesRepo   repository.FundingRates
+	openInterestsRepo  repository.OpenInterests
+	priceCandles1mRepo repository.PriceCandles1m
+	replayPresetsRepo  repository.ReplayPresets
+	symbolsRepo        repository.Symbols
+	binanceWsAdapter   *binancews.Adapter
+	quota              Quota
+	quality            Quality
+	chMap              map[string]streamHandler
+
+	pipelineConf entity.ReplayPipelineConfig
+
+	// presetMu serializes preset writes, the checks before a write would race otherwise
+	presetMu sync.Mutex
 
 	chTtl time.Duration
 
+	heartbeatInterval time.Duration
+
+	sessionHistoryLimit int
+
+	liveMaxReconnects int
+
+	deletedEndTimeout time.Duration
+
 	tokenLen int
 
+	channelIdLen int
+
+	tokenTtl time.Duration
+
 	mu sync.Mutex
 }
 
 func NewReplay(
+	candlesRepo repository.Candles,
 	candles1mRepo repository.Candles1m,
-	defaultConfig entity.ReplayConfiguration,
+	fundingRatesRepo repository.FundingRates,
+	openInterestsRepo repository.OpenInterests,
+	priceCandles1mRepo repository.PriceCandles1m,
+	replayPresetsRepo repository.ReplayPresets,
+	symbolsRepo repository.Symbols,
+	binanceWsAdapter *binancews.Adapter,
+	quota Quota,
+	quality Quality,
+	pipelineConf entity.ReplayPipelineConfig,
 ) *replay {
 	s := replay{
-		candles1mRepo: candles1mRepo,
-		chMap:         map[string]streamHandler{},
-
-		replayConfiguration: defaultConfig,
+		candlesRepo:        candlesRepo,
+		candles1mRepo:      candles1mRepo,
+		fundingRatesRepo:   fundingRatesRepo,
+		openInterestsRepo:  openInterestsRepo,
+		priceCandles1mRepo: priceCandles1mRepo,
+		replayPresetsRepo:  replayPresetsRepo,
+		symbolsRepo:        symbolsRepo,
+		binanceWsAdapter:   binanceWsAdapter,
+		quota:              quota,
+		quality:            quality,
+		chMap:              map[string]streamHandler{},
+
+		pipelineConf: pipelineConf,
 
 		chTtl: 24 * time.Hour,
 
-		tokenLen: 20,
+		heartbeatInterval: 15 * time.Second,
+
+		sessionHistoryLimit: 200000,
+
+		liveMaxReconnects: 5,
+
+		deletedEndTimeout: 5 * time.Second,
+
+		tokenLen: 32,
+
+		channelIdLen: 43,
+
+		tokenTtl: time.Hour,
 	}
 
 	go s.runStreamHandlerCleaner()
@@ -81,61 +173,301 @@ func (s *replay) cleanStreamHandler() {
 	for ch, handler := range s.chMap {
 		if now.Before(handler.cleanedAt) {
 			newMap[ch] = handler
+			continue
 		}
+
+		// nothing can reach the runs of a dropped channel anymore, they end with it
+		handler.state.cancelRuns(errStreamExpired)
+
+		logrus.
+			WithField("channel", ch).
+			Info("[service][replay][cleanStreamHandler] stream expired")
 	}
 
 	s.chMap = newMap
 }
 
-func (s *replay) GetConfiguration(ctx context.Context) entity.ReplayConfiguration {
-	return s.replayConfiguration
-}
+func (s *replay) CreateStream(ctx context.Context, req entity.CreateStreamReq) (entity.CreateStreamRes, error) {
+	interval, ok := entity.CandleIntervalOf(time.Duration(req.CandleSize))
+	if !ok {
+		return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: fmt.Sprintf("the interval '%s' is not supported", time.Duration(req.CandleSize).String()),
+			Message:         fmt.Sprintf("[service][stream][CreateStream] the interval '%s' is not supported", time.Duration(req.CandleSize).String()),
+		})
+	}
 
-func (s *replay) UpdateConfiguration(ctx context.Context, newConf entity.ReplayConfiguration) {
-	s.replayConfiguration = newConf
-}
+	// the rollups are built from the stored 1m bars, a live stream can only add to those
+	if req.Persist && interval != entity.CandleInterval1m {
+		return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: "only 1m live bars can be persisted",
+			Message:         fmt.Sprintf("[service][stream][CreateStream] can not persist %s bars", interval),
+		})
+	}
 
-func (s *replay) CreateStream(ctx context.Context, req entity.CreateStreamReq) (entity.CreateStreamRes, error) {
-	var interval entity.CandleInterval
+	// every subscriber of a shared stream starts it with the same token, the first would use it up
+	if req.OneTimeToken && req.Shared {
+		return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: "a one-time token admits a single client, it can not start a shared stream",
+			Message:         "[service][stream][CreateStream] a one-time token on a shared stream",
+		})
+	}
 
-	switch time.Duration(req.CandleSize) {
-	case time.Minute:
-		interval = entity.CandleInterval1m
+	presetName := req.Preset
+	if presetName == "" {
+		presetName = entity.ReplayPresetDefault
+	}
+
+	preset, err := s.GetPreset(ctx, presetName)
+	if err != nil {
+		return entity.CreateStreamRes{}, err
+	}
+
+	conf := preset.Config
+
+	streamType := req.Type
+	switch streamType {
+	case "":
+		streamType = entity.StreamTypeReplay
+	case entity.StreamTypeReplay:
+	case entity.StreamTypeLive:
+		if conf.Calendar != nil {
+			return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: "calendars skip over stored time, they can only be replayed",
+				Message:         "[service][stream][CreateStream] a live stream can not have a calendar",
+			})
+		}
+
+		if len(conf.Windows) > 0 {
+			return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: "windows are stored time, they can only be replayed",
+				Message:         "[service][stream][CreateStream] a live stream can not have windows",
+			})
+		}
+
+		if req.Scenario != nil {
+			return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: "scenarios are generated from stored candles, they can only be replayed",
+				Message:         "[service][stream][CreateStream] a live stream can not have a scenario",
+			})
+		}
+
+		if req.Synthetic != nil {
+			return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: "synthetic markets are generated as they play, they play at the speed of a replay",
+				Message:         "[service][stream][CreateStream] a live stream can not have a synthetic market",
+			})
+		}
+
+		if conf.Universe != nil {
+			return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: "universes are evaluated from stored candles, they can only be replayed",
+				Message:         "[service][stream][CreateStream] a live stream can not have a universe",
+			})
+		}
+
+		for _, symbol := range conf.Symbols {
+			if !strings.HasPrefix(symbol, "binance:") {
+				return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+					Code:            http.StatusUnprocessableEntity,
+					ResponseMessage: fmt.Sprintf("the symbol '%s' is not available live, only binance symbols are", symbol),
+					Message:         fmt.Sprintf("[service][stream][CreateStream] the symbol '%s' is not available live", symbol),
+				})
+			}
+		}
 	default:
 		return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
 			Code:            http.StatusUnprocessableEntity,
-			ResponseMessage: fmt.Sprintf("the interval '%s' is not supported", time.Duration(req.CandleSize).String()),
-			Message:         fmt.Sprintf("[service][stream][CreateStream] the interval '%s' is not supported", time.Duration(req.CandleSize).String()),
+			ResponseMessage: fmt.Sprintf("the stream type '%s' is not supported", req.Type),
+			Message:         fmt.Sprintf("[service][stream][CreateStream] the stream type '%s' is not supported", req.Type),
+		})
+	}
+
+	symbols := conf.Symbols
+
+	var market *entity.SyntheticMarket
+	if req.Synthetic != nil {
+		resolved, err := resolveSynthetic(*req.Synthetic, conf, req.Scenario != nil)
+		if err != nil {
+			return entity.CreateStreamRes{}, err
+		}
+
+		market = &resolved
+		symbols = synthetic.Symbols(resolved)
+	}
+
+	// windows play back to back, the stream runs from the start of the first to the end of the last
+	windows := conf.Windows
+	if len(windows) == 0 {
+		windows = []entity.ReplayWindow{{StartTimeUnixMilli: conf.StartTimeUnixMilli, EndTimeUnixMilli: conf.EndTimeUnixMilli}}
+	}
+	windows = boundWindows(windows, time.Now())
+
+	var source candleSource = s.candlesRepo
+	var scenario *entity.Scenario
+
+	if req.Scenario != nil {
+		resolved, scenarioWindows, scenarioSource, err := s.resolveScenario(ctx, *req.Scenario, conf, windows, interval)
+		if err != nil {
+			return entity.CreateStreamRes{}, err
+		}
+
+		scenario = &resolved
+		windows = scenarioWindows
+		source = scenarioSource
+	}
+
+	startTime := time.UnixMilli(windows[0].StartTimeUnixMilli)
+	endTime := time.UnixMilli(windows[len(windows)-1].EndTimeUnixMilli)
+
+	var calendar compiledCalendar
+	if conf.Calendar != nil {
+		calendar, err = compileCalendar(*conf.Calendar)
+		if err != nil {
+			return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: err.Error(),
+				Message:         fmt.Sprintf("[service][stream][CreateStream][compileCalendar] error: %v", err),
+			})
+		}
+	}
+
+	spans := calendar.windowSpans(windows)
+
+	// a live stream has no window to limit
+	played := time.Duration(0)
+	if streamType == entity.StreamTypeReplay {
+		for _, window := range windows {
+			played += time.Duration(window.EndTimeUnixMilli-window.StartTimeUnixMilli) * time.Millisecond
+		}
+	}
+
+	symbolCount := len(symbols)
+	if conf.Universe != nil {
+		symbolCount = conf.Universe.Top
+	}
+
+	err = s.quota.CheckStream(ctx, symbolCount, played)
+	if err != nil {
+		return entity.CreateStreamRes{}, err
+	}
+
+	var delistedAt map[string]int64
+	var candidates []entity.SymbolInfo
+
+	if conf.Universe != nil {
+		symbolInfos, err := s.symbolsRepo.GetSymbols(ctx)
+		if err != nil {
+			return entity.CreateStreamRes{}, apperror.InternalServerError(apperror.AppErrorOpt{
+				Message: fmt.Sprintf("[service][stream][CreateStream][symbolsRepo.GetSymbols] error: %v", err),
+			})
+		}
+
+		candidates, delistedAt = universeCandidates(symbolInfos, *conf.Universe)
+	} else if market == nil {
+		symbolsAt := startTime
+		if streamType == entity.StreamTypeLive {
+			symbolsAt = time.Now()
+		}
+
+		plain, _ := splitSymbols(conf.Symbols)
+
+		delistedAt, err = resolveSymbols(ctx, s.symbolsRepo, plain, symbolsAt)
+		if err != nil {
+			return entity.CreateStreamRes{}, err
+		}
+
+		// the days of a bootstrapped path come from anywhere in the range, a delisting date says nothing of them
+		if scenario != nil && scenario.Mode == entity.ScenarioModeBlockBootstrap {
+			delistedAt = nil
+		}
+	}
+
+	_, continuous := splitSymbols(symbols)
+
+	instruments, err := s.stitchInstruments(ctx, conf.Instruments, continuous)
+	if err != nil {
+		return entity.CreateStreamRes{}, err
+	}
+
+	tokenTtl := s.tokenTtl
+	if req.TokenTtl > 0 {
+		tokenTtl = time.Duration(req.TokenTtl)
+	}
+	if tokenTtl > s.chTtl {
+		return entity.CreateStreamRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: fmt.Sprintf("the token ttl can not exceed %s", s.chTtl.String()),
+			Message:         fmt.Sprintf("[service][stream][CreateStream] token ttl '%s' exceeds the channel ttl", tokenTtl.String()),
 		})
 	}
 
-	channelHash := helper.HashSHA512(fmt.Sprintf("%s%v", time.Duration(req.CandleSize).String(), time.Now().UnixMilli()))
-	channel := fmt.Sprintf("ch:%s", channelHash)
+	channel := fmt.Sprintf("ch:%s", common.CreateRandomString(s.channelIdLen))
 
 	token := common.CreateRandomString(s.tokenLen)
+	tokenExpiresAt := time.Now().Add(tokenTtl)
+
+	user, _ := common.AuthUserFromContext(ctx)
+
+	tickSynthesis := resolveTickSynthesis(conf.TickSynthesis)
 
 	s.mu.Lock()
 	s.chMap[channel] = streamHandler{
-		interval:      interval,
-		symbols:       s.replayConfiguration.Symbols,
-		playbackSpeed: s.replayConfiguration.PlaybackSpeed,
-		startTime:     time.UnixMilli(s.replayConfiguration.StartTimeUnixMilli),
-		endTime:       time.UnixMilli(s.replayConfiguration.EndTimeUnixMilli),
-		token:         token,
+		preset:         presetName,
+		streamType:     streamType,
+		interval:       interval,
+		symbols:        symbols,
+		delistedAt:     delistedAt,
+		series:         conf.Series,
+		universe:       conf.Universe,
+		candidates:     candidates,
+		instruments:    instruments,
+		tickSynthesis:  tickSynthesis,
+		calendar:       conf.Calendar,
+		windows:        conf.Windows,
+		scenario:       scenario,
+		synthetic:      market,
+		source:         source,
+		spans:          spans,
+		playbackSpeed:  conf.PlaybackSpeed,
+		startTime:      startTime,
+		endTime:        endTime,
+		token:          token,
+		tokenExpiresAt: tokenExpiresAt,
+		oneTimeToken:   req.OneTimeToken,
+		owner:          user.UserId,
+		shared:         req.Shared,
+		liveUpdates:    req.LiveUpdates,
+		persist:        req.Persist,
+
+		state: newStreamState(),
 
 		cleanedAt: time.Now().Add(s.chTtl),
 	}
 	s.mu.Unlock()
 
 	return entity.CreateStreamRes{
-		Channel: channel,
-		Token:   token,
+		Channel:                 channel,
+		Token:                   token,
+		TokenExpiresAtUnixMilli: tokenExpiresAt.UnixMilli(),
+		TickSynthesis:           tickSynthesis,
+		Scenario:                scenario,
+		Synthetic:               market,
 	}, nil
 }
 
-func (s *replay) StreamReplay(ctx context.Context, ch chan []byte, channel, token string) error {
+func (s *replay) StreamReplay(ctx context.Context, ch chan []byte, auth entity.WsAuthData) error {
 	defer close(ch)
 
+	channel := auth.Channel
+
 	logrus.
 		WithField("channel", channel).
 		Info("[service][replay][StreamReplay] starting stream...")
@@ -144,58 +476,326 @@ func (s *replay) StreamReplay(ctx context.Context, ch chan []byte, channel, toke
 	streamHandler, ok := s.chMap[channel]
 	s.mu.Unlock()
 
-	if !ok {
+	// a stream of someone else is reported as missing, not as forbidden
+	if !ok || !canAccess(ctx, streamHandler) {
 		logrus.Warn("[service][replay][StreamCandles] stream not found")
 
+		sendStandaloneError(ctx, ch, "stream not found")
+
 		return apperror.BadRequestError(apperror.AppErrorOpt{
 			Code:    http.StatusNotFound,
 			Message: "[service][replay][StreamCandles] stream not found",
 		})
 	}
 
-	if streamHandler.token != token {
+	if subtle.ConstantTimeCompare([]byte(streamHandler.token), []byte(auth.Token)) != 1 {
 		logrus.Warn("[service][replay][StreamCandles] invalid token")
 
+		sendStandaloneError(ctx, ch, "invalid token")
+
 		return apperror.UnauthorizedError(apperror.AppErrorOpt{
 			Message: "[service][replay][StreamCandles] invalid token",
 		})
 	}
 
+	if time.Now().After(streamHandler.tokenExpiresAt) {
+		logrus.Warn("[service][replay][StreamCandles] token expired")
+
+		sendStandaloneError(ctx, ch, "token expired")
+
+		return apperror.UnauthorizedError(apperror.AppErrorOpt{
+			Message: "[service][replay][StreamCandles] token expired",
+		})
+	}
+
+	if streamHandler.oneTimeToken && !streamHandler.state.consumeToken() {
+		logrus.Warn("[service][replay][StreamCandles] token already used")
+
+		sendStandaloneError(ctx, ch, "token already used")
+
+		return apperror.UnauthorizedError(apperror.AppErrorOpt{
+			Message: "[service][replay][StreamCandles] token already used",
+		})
+	}
+
 	logrus.Info("[service][replay][StreamCandles] stream authenticated")
 
-	limit := 5000
-	var dbHandler func(cursor time.Time) ([]entity.Candle, error)
-	var interval time.Duration
+	release, err := s.quota.AcquireStream(ctx)
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("channel", channel).
+			Warn("[service][replay][StreamReplay][quota.AcquireStream]")
+
+		sendStandaloneError(ctx, ch, "too many concurrent streams")
+
+		return err
+	}
+	defer release()
 
-	switch streamHandler.interval {
-	case entity.CandleInterval1m:
-		dbHandler = func(cursor time.Time) ([]entity.Candle, error) {
-			candles, err := s.candles1mRepo.GetCandles(ctx, streamHandler.symbols, cursor, streamHandler.endTime, limit)
+	streamHandler.state.addClient(1)
+	defer streamHandler.state.addClient(-1)
+
+	if streamHandler.shared {
+		return s.subscribeSession(ctx, ch, channel, auth.CatchUp)
+	}
+
+	deliver := deliverTo(ch)
+
+	return s.runStream(ctx, channel, streamHandler, newStreamWriter(func(ctx context.Context, msg []byte) error {
+		err := deliver(ctx, msg)
+		if err != nil {
+			return err
+		}
+
+		streamHandler.state.recordSent(msg)
+
+		return nil
+	}))
+}
+
+// subscribeSession joins the shared session of the channel, starting it for the first subscriber,
+// and forwards the session messages to ch until the session ends or the client leaves.
+func (s *replay) subscribeSession(ctx context.Context, ch chan []byte, channel string, catchUp bool) error {
+	var streamHandler streamHandler
+	var session *broadcastSession
+	var backlog [][]byte
+	var sub *subscriber
+
+	for {
+		s.mu.Lock()
+		var ok bool
+		streamHandler, ok = s.chMap[channel]
+		if !ok {
+			s.mu.Unlock()
+
+			sendStandaloneError(ctx, ch, "stream not found")
+
+			return streamNotFoundError(channel, "subscribeSession")
+		}
+
+		// an abandoned session stopped with its last subscriber, the channel starts over
+		session = streamHandler.session
+		isFirst := session == nil || session.isAbandoned()
+		if isFirst {
+			session = newBroadcastSession(s.sessionHistoryLimit)
+			streamHandler.session = session
+			s.chMap[channel] = streamHandler
+		}
+		s.mu.Unlock()
+
+		var err error
+		backlog, sub, err = session.subscribe(catchUp)
+		if errors.Is(err, errSessionAbandoned) {
+			continue
+		}
+		if err != nil {
+			sendStandaloneError(ctx, ch, err.Error())
+
+			if errors.Is(err, errCatchUpUnavailable) {
+				// the session is still live, the subscriber joins without the history
+				backlog, sub, err = session.subscribe(false)
+			}
 			if err != nil {
-				return []entity.Candle{}, err
+				return nil
 			}
+		}
 
-			return candles, nil
+		// the session only runs once it has a subscriber, a session without any is abandoned
+		if isFirst {
+			go func() {
+				err := s.runStream(session.ctx, channel, streamHandler, newStreamWriter(session.publish))
+				if err != nil {
+					logrus.
+						WithError(err).
+						WithField("channel", channel).
+						Error("[service][replay][subscribeSession][runReplay]")
+				}
+
+				session.finish()
+			}()
 		}
-		interval = time.Minute
-	default:
+
+		break
+	}
+
+	logrus.
+		WithField("channel", channel).
+		WithField("catch_up", catchUp).
+		WithField("backlog", len(backlog)).
+		Info("[service][replay][subscribeSession] subscribed")
+
+	for _, msg := range backlog {
+		select {
+		case ch <- msg:
+			streamHandler.state.recordSent(msg)
+		case <-ctx.Done():
+			if sub != nil {
+				session.unsubscribe(sub)
+			}
+			return nil
+		}
+	}
+
+	if sub == nil {
+		return nil
+	}
+
+	for {
+		select {
+		case msg, ok := <-sub.ch:
+			if !ok {
+				if session.isDropped(sub) {
+					sendStandaloneError(ctx, ch, errSubscriberTooSlow.Error())
+				}
+
+				return nil
+			}
+
+			select {
+			case ch <- msg:
+				streamHandler.state.recordSent(msg)
+			case <-ctx.Done():
+				session.unsubscribe(sub)
+				return nil
+			}
+		case <-ctx.Done():
+			session.unsubscribe(sub)
+			return nil
+		}
+	}
+}
+
+// sendStandaloneError tells the client why its stream can not go on. It is sent outside
+// of any stream sequence, so it carries no seq.
+func sendStandaloneError(ctx context.Context, ch chan []byte, message string) {
+	data, _ := json.Marshal(entity.StreamErrorData{Message: message})
+	msg, _ := json.Marshal(entity.WsMessage{
+		Type: string(entity.WsMessageTypeError),
+		Data: data,
+	})
+
+	select {
+	case ch <- msg:
+	case <-ctx.Done():
+	}
+}
+
+// runStream runs one playback of the stream, it is ended early once the stream gets deleted.
+func (s *replay) runStream(ctx context.Context, channel string, streamHandler streamHandler, writer *streamWriter) error {
+	runCtx, done := streamHandler.state.startRun(ctx)
+	defer func() {
+		done(writer.hasEnded())
+	}()
+
+	writer.onCandle = streamHandler.state.recordCursor
+
+	var err error
+	if streamHandler.streamType == entity.StreamTypeLive {
+		err = s.runLive(runCtx, channel, streamHandler, writer)
+	} else {
+		err = s.runReplay(runCtx, channel, streamHandler, writer)
+	}
+
+	reason := entity.StreamEndReason("")
+	switch cause := context.Cause(runCtx); {
+	case errors.Is(cause, errStreamDeleted):
+		reason = entity.StreamEndReasonDeleted
+	case errors.Is(cause, errStreamExpired):
+		reason = entity.StreamEndReasonExpired
+	}
+
+	if reason != "" {
+		// runCtx is done, the clients still get told why the stream is over
+		endCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.deletedEndTimeout)
+		defer cancel()
+
+		writer.sendEnd(endCtx, reason)
+
+		logrus.
+			WithField("channel", channel).
+			WithField("reason", reason).
+			Info("[service][replay][runStream] stream ended early")
+	}
+
+	return err
+}
+
+// runReplay plays the stream from start to end into writer.
+func (s *replay) runReplay(ctx context.Context, channel string, streamHandler streamHandler, writer *streamWriter) error {
+	// the intervals above 1m are read from their rollup tables
+	interval := streamHandler.interval.Duration()
+	if interval == 0 {
+		writer.send(ctx, entity.WsMessageTypeError, entity.StreamErrorData{Message: fmt.Sprintf("interval of %s is unavailable", streamHandler.interval)})
+
 		return apperror.BadRequestError(apperror.AppErrorOpt{
 			Code:            http.StatusBadRequest,
 			ResponseMessage: fmt.Sprintf("interval of %s is unavailable", streamHandler.interval),
 		})
 	}
 
-	candlesBytesCh := make(chan [][]byte, limit)
-	pullCh := make(chan bool)
-	doneCh := make(chan bool, 5)
-	errCh := make(chan error, 5)
-	defer func() {
-		close(candlesBytesCh)
-		close(doneCh)
-		close(errCh)
-	}()
+	// a generator only moves forward, every run plays the market from its start
+	source := streamHandler.source
+	if streamHandler.synthetic != nil {
+		syntheticSource, err := newSyntheticSource(*streamHandler.synthetic, streamHandler.interval, streamHandler.startTime)
+		if err != nil {
+			writer.send(ctx, entity.WsMessageTypeError, entity.StreamErrorData{Message: "the synthetic market can not be generated"})
+
+			return fmt.Errorf("[service][replay][runReplay][newSyntheticSource] error: %w", err)
+		}
 
-	latency := interval / time.Duration(streamHandler.playbackSpeed)
+		source = syntheticSource
+	}
+
+	err := writer.send(ctx, entity.WsMessageTypeStart, entity.StreamStartData{
+		Channel:            channel,
+		Type:               entity.StreamTypeReplay,
+		Interval:           streamHandler.interval,
+		Symbols:            streamHandler.symbols,
+		Series:             streamHandler.series,
+		PlaybackSpeed:      streamHandler.playbackSpeed,
+		StartTimeUnixMilli: streamHandler.startTime.UnixMilli(),
+		EndTimeUnixMilli:   streamHandler.endTime.UnixMilli(),
+		TickSynthesis:      streamHandler.tickSynthesis,
+		Universe:           streamHandler.universe,
+		Calendar:           streamHandler.calendar,
+		Windows:            streamHandler.windows,
+		Scenario:           streamHandler.scenario,
+		Synthetic:          streamHandler.synthetic,
+	})
+	if err == nil {
+		err = writer.send(ctx, entity.WsMessageTypeStatus, entity.StreamStatusData{Status: entity.StreamStatusStreaming})
+	}
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("channel", channel).
+			Warn("[service][replay][StreamReplay][writer.send] client gone before start")
+
+		return nil
+	}
+
+	// speeds under 1 slow the replay down, the division stays in floats for them
+	latency := time.Duration(float64(interval) / float64(streamHandler.playbackSpeed))
+
+	// with synthesis the ticks carry the pacing, bars close right after their last tick
+	candleDelay := latency
+	var synthesizer *tickSynthesizer
+	if streamHandler.tickSynthesis != nil {
+		synthesizer = newTickSynthesizer(*streamHandler.tickSynthesis)
+		candleDelay = 0
+	}
+
+	// pipeCtx stops the puller once the emitter gave up, ctx stays usable for the end message
+	pipeCtx, cancelPipe := context.WithCancel(ctx)
+	defer cancelPipe()
+
+	pipeline := newReplayPipeline(s.pipelineConf, interval, streamHandler.startTime, streamHandler.spans)
+	streamHandler.state.setPipeline(pipeline)
+
+	stopHeartbeatCh := make(chan struct{})
+
+	var pullErr, emitErr error
 
 	var wg sync.WaitGroup
 
@@ -203,115 +803,393 @@ func (s *replay) StreamReplay(ctx context.Context, ch chan []byte, channel, toke
 	go func() {
 		defer wg.Done()
 
-		pullCh <- true
+		writer.runHeartbeat(ctx, s.heartbeatInterval, stopHeartbeatCh)
+	}()
+
+	wg.Add(1)
+	// emitter
+	go func() {
+		defer wg.Done()
+		defer close(stopHeartbeatCh)
 
 		logrus.Info("[service][replay][StreamCandles][emitter] ready to emit")
 
-	loop:
 		for {
-			pullSignalSent := false
-
-			select {
-			case <-doneCh:
-				break loop
-			case candlesBytes := <-candlesBytesCh:
-				candlesCount := len(candlesBytes)
-
-				logrus.WithField("candles_count", candlesCount).Info("[service][replay][StreamCandles][emitter] emiting candles...")
+			msg, ok := pipeline.next(pipeCtx)
+			if !ok {
+				return
+			}
 
-				for i, candleBytes := range candlesBytes {
-					if len(candleBytes) == 0 {
-						continue
-					}
+			if pausedCh := streamHandler.state.pausedCh(); pausedCh != nil {
+				emitErr = waitWhilePaused(ctx, writer, pausedCh)
+				if emitErr != nil {
+					cancelPipe()
+					return
+				}
+			}
 
-					ch <- candleBytes
+			emitErr = writer.sendReplayMessage(ctx, msg)
+			if emitErr != nil {
+				cancelPipe()
+				return
+			}
 
-					if !pullSignalSent && i > candlesCount/2 {
-						logrus.
-							WithField("candles_count", candlesCount).
-							WithField("i", i).
-							Info("[service][replay][StreamCandles][emitter] sending pull signal")
-						pullCh <- true
-						pullSignalSent = true
-					}
+			pipeline.emitted(msg.epoch)
 
-					time.Sleep(latency)
+			if msg.delay > 0 {
+				select {
+				case <-time.After(msg.delay):
+				case <-ctx.Done():
 				}
 			}
 		}
 	}()
 
 	wg.Add(1)
+	// puller
 	go func() {
 		defer wg.Done()
+		defer pipeline.close()
 
+		// pages are read past the key of the last candle sent, starting from cursor
 		cursor := streamHandler.startTime
+		var after *entity.CandleKey
+		var open openBar
+		seriesCursor := streamHandler.startTime
+		// the rolls still happen in the time a calendar skips, they are sent before its next bar
+		rollCursor := streamHandler.startTime
+		// segment is the window whose segment_start went out last
+		segment := -1
+
+		symbols, _ := splitSymbols(streamHandler.symbols)
+
+		// a universe stream reads one rebalance period at a time, with the members of that period
+		var universe *universeTracker
+		if streamHandler.universe != nil {
+			universe = newUniverseTracker(*streamHandler.universe, streamHandler.candidates, streamHandler.startTime)
+		}
 
-	loop:
 		for {
-			select {
-			case <-pullCh:
-				logrus.
-					WithField("cursor", cursor.String()).
-					Info("[service][replay][StreamReplay][puller] got pull signal. pulling candles...")
+			err := pipeline.waitForRoom(pipeCtx)
+			if err != nil {
+				return
+			}
 
-				candles, err := dbHandler(cursor)
-				if err != nil {
-					doneCh <- true
-					errCh <- fmt.Errorf("[service][replay][StreamReplay][puller] dbHandler error: %w", err)
-					break loop
-				}
+			logrus.
+				WithField("cursor", cursor.String()).
+				Debug("[service][replay][StreamReplay][puller] pulling candles...")
+
+			// the excluded time is jumped over, the bars after it follow right away
+			span, ok := spanFrom(streamHandler.spans, cursor.Unix())
+
+			nextWindow := len(streamHandler.windows)
+			if ok {
+				nextWindow = span.window
+			}
+
+			markers := streamHandler.segmentMarkers(&segment, nextWindow)
 
-				candlesBytes := [][]byte{}
-				for _, candle := range candles {
-					candle.Symbol = fmt.Sprintf("%s:%s", candle.Exchange, candle.Pair)
+			if !ok {
+				pipeline.push(pipeCtx, markers, cursor.Unix())
+				return
+			}
+
+			if cursor.Unix() < span.from {
+				cursor = time.Unix(span.from, 0)
+				seriesCursor = cursor
+			}
+
+			// nothing of the time between the windows is sent
+			if len(markers) > 0 {
+				rollCursor = cursor
+			}
+
+			batch := []replayMessage{}
+			segmentEnd := streamHandler.endTime
 
-					candleBytes, err := json.Marshal(candle)
+			if universe != nil {
+				if universe.due(cursor) {
+					changeMsg, err := universe.rebalanceAt(ctx, s.candles1mRepo, cursor)
 					if err != nil {
-						doneCh <- true
-						errCh <- fmt.Errorf("[service][replay][StreamReplay][json.Marshal(candle)] error: %w", err)
-						break loop
+						pullErr = fmt.Errorf("[service][replay][StreamReplay][puller] universe.rebalanceAt error: %w", err)
+						return
 					}
 
-					candlesBytes = append(candlesBytes, candleBytes)
+					if changeMsg != nil {
+						batch = append(batch, *changeMsg)
+					}
 				}
 
-				candlesBytesCh <- candlesBytes
+				symbols = universe.members
+				segmentEnd = universe.segmentEnd(streamHandler.endTime)
+			}
+
+			if spanEnd := time.Unix(span.to-1, 0); spanEnd.Before(segmentEnd) {
+				segmentEnd = spanEnd
+			}
+
+			// the legs of the continuous instruments are read alongside, as the stored series they are
+			storedSymbols := append(legSymbols(streamHandler.instruments, cursor, segmentEnd), symbols...)
 
-				if len(candles) < limit {
-					doneCh <- true
-					break loop
+			limit := pipeline.nextPageSize(len(storedSymbols))
+
+			candles := []entity.Candle{}
+			// an empty universe has nothing to read, an empty filter would read every symbol
+			if len(storedSymbols) > 0 {
+				fetchStart := time.Now()
+
+				candles, err = source.GetCandles(ctx, streamHandler.interval, storedSymbols, cursor, segmentEnd, after, limit)
+				if err != nil {
+					pullErr = fmt.Errorf("[service][replay][StreamReplay][puller] source.GetCandles error: %w", err)
+					return
 				}
 
-				lastUnix := candles[len(candles)-1].Epoch
-				cursor = time.Unix(lastUnix, 0)
-			case <-ctx.Done():
-				doneCh <- true
-				break loop
+				pipeline.recordPage(candles, limit, time.Since(fetchStart))
+			}
+
+			lastPage := len(candles) < limit
+
+			// a full page ends wherever the limit fell, the candles of its last epoch are
+			// read again with the next page unless that epoch is all the page holds
+			page := candles
+			closeLast := true
+			seriesEnd := segmentEnd.Add(time.Second)
+			if !lastPage {
+				if cut := lastEpochStart(candles); cut > 0 {
+					page = candles[:cut]
+				} else {
+					closeLast = false
+				}
+
+				key := page[len(page)-1].Key()
+				after = &key
+
+				// series events of an epoch still being read go with the rest of it
+				seriesEnd = time.Unix(key.Epoch, 0)
+				if closeLast {
+					seriesEnd = seriesEnd.Add(time.Second)
+				}
+			}
+
+			listed := mapInstruments(streamHandler.listedCandles(page), symbols, streamHandler.instruments)
+
+			batch = append(batch, candleMessages(listed, candleDelay, closeLast, &open)...)
+
+			if synthesizer != nil {
+				batch = append(batch, synthesizer.expand(listed, interval, latency)...)
+			}
+
+			if len(streamHandler.series) > 0 && len(symbols) > 0 {
+				seriesMsgs, err := s.pullSeries(ctx, streamHandler, symbols, seriesCursor, seriesEnd)
+				if err != nil {
+					pullErr = fmt.Errorf("[service][replay][StreamReplay][puller] pullSeries error: %w", err)
+					return
+				}
+
+				batch = append(batch, seriesMsgs...)
+			}
+
+			rollMsgs, err := rollMessages(streamHandler.instruments, rollCursor, seriesEnd)
+			if err != nil {
+				pullErr = fmt.Errorf("[service][replay][StreamReplay][puller] rollMessages error: %w", err)
+				return
+			}
+
+			batch = append(batch, rollMsgs...)
+
+			seriesCursor = seriesEnd
+			rollCursor = seriesEnd
+
+			sortReplayMessages(batch)
+
+			batch = append(markers, batch...)
+
+			err = pipeline.push(pipeCtx, batch, seriesEnd.Unix())
+			if err != nil {
+				return
+			}
+
+			// past the last span the next round sends the last segment_end and stops
+			if lastPage {
+				cursor = segmentEnd.Add(time.Second)
+				after = nil
+			} else {
+				cursor = time.Unix(after.Epoch, 0)
 			}
 		}
 	}()
 
 	wg.Wait()
 
-	err, ok := <-errCh
-	if ok && err != nil {
+	logrus.
+		WithField("channel", channel).
+		WithField("pipeline", pipeline.stats()).
+		Info("[service][replay][StreamReplay] pipeline done")
+
+	if pullErr != nil {
 		logrus.
-			WithError(err).
+			WithError(pullErr).
 			WithField("channel", channel).
 			Error("[service][replay][StreamReplay]")
 
+		writer.send(ctx, entity.WsMessageTypeError, entity.StreamErrorData{Message: "failed to read candles"})
+		writer.sendEnd(ctx, entity.StreamEndReasonError)
+
 		return apperror.InternalServerError(apperror.AppErrorOpt{
-			Message: fmt.Sprintf("[service][replay][StreamReplay] error: %v", err),
+			Message: fmt.Sprintf("[service][replay][StreamReplay] error: %v", pullErr),
 		})
 	}
 
+	if ctx.Err() != nil || emitErr != nil {
+		logrus.
+			WithField("channel", channel).Info("[service][replay][StreamReplay] client gone")
+
+		return nil
+	}
+
+	err = writer.send(ctx, entity.WsMessageTypeStatus, entity.StreamStatusData{Status: entity.StreamStatusFinished})
+	if err == nil {
+		writer.sendEnd(ctx, entity.StreamEndReasonFinished)
+	}
+
 	logrus.
 		WithField("channel", channel).Info("[service][replay][StreamReplay] done")
 
 	return nil
 }
 
-func (s *replay) GetListenedSymbols() []string {
-	return s.replayConfiguration.Symbols
+func (sh streamHandler) isDelisted(symbol string, epoch int64) bool {
+	delistedAt, ok := sh.delistedAt[symbol]
+	return ok && epoch >= delistedAt
+}
+
+// listedCandles drops the candles of symbols past their delisting.
+func (sh streamHandler) listedCandles(candles []entity.Candle) []entity.Candle {
+	if len(sh.delistedAt) == 0 {
+		return candles
+	}
+
+	listed := make([]entity.Candle, 0, len(candles))
+	for _, candle := range candles {
+		if !sh.isDelisted(candle.Symbol, candle.Epoch) {
+			listed = append(listed, candle)
+		}
+	}
+
+	return listed
+}
+
+// waitWhilePaused holds the emitter until the stream is resumed, telling the client about both.
+func waitWhilePaused(ctx context.Context, writer *streamWriter, pausedCh chan struct{}) error {
+	err := writer.send(ctx, entity.WsMessageTypeStatus, entity.StreamStatusData{Status: entity.StreamStatusPaused})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-pausedCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return writer.send(ctx, entity.WsMessageTypeStatus, entity.StreamStatusData{Status: entity.StreamStatusStreaming})
+}
+
+// segmentMarkers moves segment on to the window next, ending the windows before it and
+// starting the ones up to it. A window the calendar leaves nothing of still gets both.
+func (sh streamHandler) segmentMarkers(segment *int, next int) []replayMessage {
+	markers := []replayMessage{}
+
+	for len(sh.windows) > 0 && *segment < next {
+		if *segment >= 0 {
+			markers = append(markers, sh.segmentMarker(*segment, entity.WsMessageTypeSegmentEnd))
+		}
+
+		*segment++
+
+		if *segment < len(sh.windows) {
+			markers = append(markers, sh.segmentMarker(*segment, entity.WsMessageTypeSegmentStart))
+		}
+	}
+
+	return markers
+}
+
+func (sh streamHandler) segmentMarker(index int, msgType entity.WsMessageType) replayMessage {
+	window := sh.windows[index]
+
+	epoch := ceilSeconds(window.StartTimeUnixMilli)
+	if msgType == entity.WsMessageTypeSegmentEnd {
+		epoch = time.UnixMilli(window.EndTimeUnixMilli).Unix()
+	}
+
+	return replayMessage{epoch: epoch, rank: replayMessageRankUniverse, msgType: msgType, value: entity.SegmentData{
+		Index:              index,
+		Name:               window.Name,
+		StartTimeUnixMilli: window.StartTimeUnixMilli,
+		EndTimeUnixMilli:   window.EndTimeUnixMilli,
+	}}
+}
+
+// openBar is an epoch whose candles are split over pages, its bar_close counts them all.
+type openBar struct {
+	epoch   int64
+	candles int
+}
+
+// candleMessages turns a page of candles into candle messages, closing each epoch with
+// a bar_close once all of its candles are out. The bar_close carries the delay, so an
+// epoch takes one delay whatever its number of symbols. Unless closeLast, the last epoch
+// of the page goes on in the next one, open carries it over.
+func candleMessages(candles []entity.Candle, delay time.Duration, closeLast bool, open *openBar) []replayMessage {
+	msgs := []replayMessage{}
+
+	barClose := func() {
+		msgs = append(msgs, replayMessage{epoch: open.epoch, rank: replayMessageRankCandle, msgType: entity.WsMessageTypeBarClose, value: entity.BarCloseData{Epoch: open.epoch, Candles: open.candles}, delay: delay})
+		open.candles = 0
+	}
+
+	for i, candle := range candles {
+		// the epoch carried over ended right at the page boundary
+		if open.candles > 0 && open.epoch != candle.Epoch {
+			barClose()
+		}
+
+		open.epoch = candle.Epoch
+		open.candles++
+
+		candle.Symbol = fmt.Sprintf("%s:%s", candle.Exchange, candle.Pair)
+
+		msgs = append(msgs, replayMessage{epoch: candle.Epoch, rank: replayMessageRankCandle, msgType: entity.WsMessageTypeCandle, value: candle})
+
+		lastOfEpoch := i == len(candles)-1 || candles[i+1].Epoch != candle.Epoch
+		if lastOfEpoch && (i < len(candles)-1 || closeLast) {
+			barClose()
+		}
+	}
+
+	if closeLast && open.candles > 0 {
+		barClose()
+	}
+
+	return msgs
+}
+
+// lastEpochStart is the index of the first candle of the last epoch, candles ordered by epoch.
+func lastEpochStart(candles []entity.Candle) int {
+	i := len(candles) - 1
+	for i > 0 && candles[i-1].Epoch == candles[len(candles)-1].Epoch {
+		i--
+	}
+
+	return i
+}
+
+func (s *replay) GetListenedSymbols(ctx context.Context) ([]string, error) {
+	preset, err := s.GetPreset(ctx, entity.ReplayPresetDefault)
+	if err != nil {
+		return []string{}, err
+	}
+
+	return preset.Config.Symbols, nil
 }
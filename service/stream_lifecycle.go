@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"sort"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *replay) ListStreams(ctx context.Context) []entity.StreamInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streams := []entity.StreamInfo{}
+
+	for channel, streamHandler := range s.chMap {
+		if !canAccess(ctx, streamHandler) {
+			continue
+		}
+
+		streams = append(streams, streamHandler.state.info(channel, streamHandler))
+	}
+
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].CreatedAtUnixMilli < streams[j].CreatedAtUnixMilli
+	})
+
+	return streams
+}
+
+func (s *replay) GetStream(ctx context.Context, channel string) (entity.StreamInfo, error) {
+	streamHandler, err := s.getStreamHandler(ctx, channel, "GetStream")
+	if err != nil {
+		return entity.StreamInfo{}, err
+	}
+
+	return streamHandler.state.info(channel, streamHandler), nil
+}
+
+// DeleteStream drops the channel and ends every playback still running on it.
+func (s *replay) DeleteStream(ctx context.Context, channel string) error {
+	s.mu.Lock()
+	streamHandler, ok := s.chMap[channel]
+	ok = ok && canAccess(ctx, streamHandler)
+	if ok {
+		delete(s.chMap, channel)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return streamNotFoundError(channel, "DeleteStream")
+	}
+
+	streamHandler.state.cancelRuns(errStreamDeleted)
+
+	logrus.
+		WithField("channel", channel).
+		Info("[service][replay][DeleteStream] stream deleted")
+
+	return nil
+}
+
+func (s *replay) PauseStream(ctx context.Context, channel string) error {
+	streamHandler, err := s.getStreamHandler(ctx, channel, "PauseStream")
+	if err != nil {
+		return err
+	}
+
+	if streamHandler.streamType == entity.StreamTypeLive {
+		return apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: "live streams can not be paused",
+			Message:         fmt.Sprintf("[service][replay][PauseStream] channel '%s' is live", channel),
+		})
+	}
+
+	if !streamHandler.state.pause() {
+		return apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusConflict,
+			ResponseMessage: "the stream is already paused or finished",
+			Message:         fmt.Sprintf("[service][replay][PauseStream] channel '%s' can not be paused", channel),
+		})
+	}
+
+	return nil
+}
+
+func (s *replay) ResumeStream(ctx context.Context, channel string) error {
+	streamHandler, err := s.getStreamHandler(ctx, channel, "ResumeStream")
+	if err != nil {
+		return err
+	}
+
+	if !streamHandler.state.resume() {
+		return apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusConflict,
+			ResponseMessage: "the stream is not paused",
+			Message:         fmt.Sprintf("[service][replay][ResumeStream] channel '%s' is not paused", channel),
+		})
+	}
+
+	return nil
+}
+
+func (s *replay) getStreamHandler(ctx context.Context, channel, method string) (streamHandler, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streamHandler, ok := s.chMap[channel]
+	if !ok || !canAccess(ctx, streamHandler) {
+		return streamHandler, streamNotFoundError(channel, method)
+	}
+
+	return streamHandler, nil
+}
+
+// canAccess tells whether the user in ctx may see the stream, only its owner and admins can.
+func canAccess(ctx context.Context, streamHandler streamHandler) bool {
+	user, ok := common.AuthUserFromContext(ctx)
+	if !ok {
+		return streamHandler.owner == ""
+	}
+
+	return user.Role.Includes(entity.RoleAdmin) || user.UserId == streamHandler.owner
+}
+
+func streamNotFoundError(channel, method string) error {
+	return apperror.BadRequestError(apperror.AppErrorOpt{
+		Code:            http.StatusNotFound,
+		ResponseMessage: "stream not found",
+		Message:         fmt.Sprintf("[service][replay][%s] channel '%s' not found", method, channel),
+	})
+}
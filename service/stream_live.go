@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+// runLive passes the binance klines of the stream symbols through in the same
+// protocol as a replay, until the client leaves or binance can not be reached anymore.
+func (s *replay) runLive(ctx context.Context, channel string, streamHandler streamHandler, writer *streamWriter) error {
+	pairs := make([]string, len(streamHandler.symbols))
+	for i, symbol := range streamHandler.symbols {
+		pairs[i] = strings.TrimPrefix(symbol, "binance:")
+	}
+
+	err := writer.send(ctx, entity.WsMessageTypeStart, entity.StreamStartData{
+		Channel:       channel,
+		Type:          entity.StreamTypeLive,
+		Interval:      streamHandler.interval,
+		Symbols:       streamHandler.symbols,
+		PlaybackSpeed: 1,
+	})
+	if err == nil {
+		err = writer.send(ctx, entity.WsMessageTypeStatus, entity.StreamStatusData{Status: entity.StreamStatusStreaming})
+	}
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("channel", channel).
+			Warn("[service][replay][runLive][writer.send] client gone before start")
+
+		return nil
+	}
+
+	stopHeartbeatCh := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(stopHeartbeatCh)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		writer.runHeartbeat(ctx, s.heartbeatInterval, stopHeartbeatCh)
+	}()
+
+	// closed bars per epoch, the epoch is complete once every symbol closed
+	closedCount := map[int64]int{}
+	reconnecting := false
+
+	onKline := func(candle entity.Candle, closed bool) error {
+		if reconnecting {
+			reconnecting = false
+
+			err := writer.send(ctx, entity.WsMessageTypeStatus, entity.StreamStatusData{Status: entity.StreamStatusStreaming})
+			if err != nil {
+				return err
+			}
+		}
+
+		if !closed {
+			if !streamHandler.liveUpdates {
+				return nil
+			}
+
+			return writer.send(ctx, entity.WsMessageTypeCandleUpdate, candle)
+		}
+
+		if streamHandler.persist {
+			err := s.persistLiveCandle(ctx, candle)
+			if err != nil {
+				logrus.
+					WithError(err).
+					WithField("channel", channel).
+					WithField("symbol", candle.Symbol).
+					WithField("epoch", candle.Epoch).
+					Error("[service][replay][runLive][persistLiveCandle]")
+			}
+		}
+
+		candleBytes, err := json.Marshal(candle)
+		if err != nil {
+			return fmt.Errorf("[service][replay][runLive][json.Marshal(candle)] error: %w", err)
+		}
+
+		err = writer.sendReplayMessage(ctx, replayMessage{epoch: candle.Epoch, msgType: entity.WsMessageTypeCandle, data: candleBytes})
+		if err != nil {
+			return err
+		}
+
+		closedCount[candle.Epoch]++
+		if closedCount[candle.Epoch] < len(pairs) {
+			return nil
+		}
+
+		for epoch := range closedCount {
+			if epoch <= candle.Epoch {
+				delete(closedCount, epoch)
+			}
+		}
+
+		return writer.send(ctx, entity.WsMessageTypeBarClose, entity.BarCloseData{Epoch: candle.Epoch, Candles: len(pairs)})
+	}
+
+	failures := 0
+
+	for {
+		connectedAt := time.Now()
+
+		err := s.binanceWsAdapter.SubscribeKlines(ctx, pairs, string(streamHandler.interval), onKline)
+		if ctx.Err() != nil {
+			logrus.
+				WithField("channel", channel).Info("[service][replay][runLive] client gone")
+
+			return nil
+		}
+
+		// a connection that held for a while is a fresh start, binance drops them every 24h
+		if time.Since(connectedAt) > time.Minute {
+			failures = 0
+		}
+		failures++
+
+		if failures > s.liveMaxReconnects {
+			logrus.
+				WithError(err).
+				WithField("channel", channel).
+				Error("[service][replay][runLive] giving up reconnecting")
+
+			writer.send(ctx, entity.WsMessageTypeError, entity.StreamErrorData{Message: "live feed unavailable"})
+			writer.sendEnd(ctx, entity.StreamEndReasonError)
+
+			return apperror.InternalServerError(apperror.AppErrorOpt{
+				Message: fmt.Sprintf("[service][replay][runLive] error: %v", err),
+			})
+		}
+
+		logrus.
+			WithError(err).
+			WithField("channel", channel).
+			WithField("failures", failures).
+			Warn("[service][replay][runLive] live feed lost, reconnecting")
+
+		writer.send(ctx, entity.WsMessageTypeStatus, entity.StreamStatusData{Status: entity.StreamStatusReconnecting})
+		reconnecting = true
+
+		select {
+		case <-time.After(time.Duration(failures) * time.Second):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// persistLiveCandle stores a closed live bar once it passed the quality rules.
+func (s *replay) persistLiveCandle(ctx context.Context, candle entity.Candle) error {
+	valid, err := s.quality.ValidateCandles(ctx, entity.AnomalySourceLive, []entity.Candle{candle})
+	if err != nil {
+		return fmt.Errorf("[service][replay][persistLiveCandle][quality.ValidateCandles] error: %w", err)
+	}
+
+	if len(valid) == 0 {
+		return nil
+	}
+
+	err = s.candles1mRepo.InsertMany(ctx, valid)
+	if err != nil {
+		return fmt.Errorf("[service][replay][persistLiveCandle][candles1mRepo.InsertMany] error: %w", err)
+	}
+
+	return nil
+}
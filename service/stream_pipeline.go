@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sync"
+	"time"
+)
+
+const (
+	replayPipelineDefaultReadAhead   = 6 * time.Hour
+	replayPipelineDefaultMinPage     = 500
+	replayPipelineDefaultMaxPage     = 5000
+	replayPipelineDefaultMaxBuffered = 20000
+)
+
+// replayPipeline carries the messages the puller reads ahead to the emitter. The puller
+// reads on while it is less than readAhead of simulated time past the last emitted epoch,
+// and blocks once maxBuffered messages wait, so memory stays bounded whatever the speed.
+// The time a calendar excludes is not played, it does not count as read ahead.
+type replayPipeline struct {
+	msgCh chan replayMessage
+	// advanceCh wakes the puller up once the emitter moved on
+	advanceCh chan struct{}
+
+	readAhead time.Duration
+	spans     []calendarSpan
+	minPage   int
+	maxPage   int
+
+	pageSize     int
+	lastLimit    int
+	emittedEpoch int64
+	pulledEpoch  int64
+	emittedAny   bool
+
+	pages      int64
+	fetchTotal time.Duration
+	underruns  int64
+
+	mu sync.Mutex
+}
+
+func newReplayPipeline(conf entity.ReplayPipelineConfig, interval time.Duration, start time.Time, spans []calendarSpan) *replayPipeline {
+	readAhead := time.Duration(conf.ReadAhead)
+	if readAhead <= 0 {
+		readAhead = replayPipelineDefaultReadAhead
+	}
+	// with less than two bars read ahead the emitter would drain the buffer before every read
+	readAhead = max(readAhead, 2*interval)
+
+	minPage := conf.MinPageSize
+	if minPage <= 0 {
+		minPage = replayPipelineDefaultMinPage
+	}
+
+	maxPage := conf.MaxPageSize
+	if maxPage <= 0 {
+		maxPage = replayPipelineDefaultMaxPage
+	}
+	maxPage = max(maxPage, minPage)
+
+	maxBuffered := conf.MaxBufferedMessages
+	if maxBuffered <= 0 {
+		maxBuffered = replayPipelineDefaultMaxBuffered
+	}
+
+	return &replayPipeline{
+		msgCh:        make(chan replayMessage, maxBuffered),
+		advanceCh:    make(chan struct{}, 1),
+		readAhead:    readAhead,
+		spans:        spans,
+		minPage:      minPage,
+		maxPage:      maxPage,
+		pageSize:     minPage,
+		emittedEpoch: start.Unix(),
+		pulledEpoch:  start.Unix(),
+	}
+}
+
+// waitForRoom blocks the puller while it is readAhead or more past the emitter. A drained
+// buffer lets it read on whatever the distance, bars may be missing over long stretches.
+func (p *replayPipeline) waitForRoom(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		ahead := time.Duration(allowedSeconds(p.spans, p.emittedEpoch, p.pulledEpoch)) * time.Second
+		p.mu.Unlock()
+
+		if ahead < p.readAhead || len(p.msgCh) == 0 {
+			return nil
+		}
+
+		select {
+		case <-p.advanceCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// nextPageSize is the limit of the next read. A page has to hold more than one epoch of
+// every symbol to move the cursor, the size is raised to that whatever the bounds.
+func (p *replayPipeline) nextPageSize(symbols int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return max(p.pageSize, 2*symbols)
+}
+
+// recordPage sizes the next page to cover about half the read-ahead at the density of
+// the page just read, a short page says nothing about the density and keeps the size.
+func (p *replayPipeline) recordPage(candles []entity.Candle, limit int, took time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pages++
+	p.fetchTotal += took
+	p.lastLimit = limit
+
+	if len(candles) < limit {
+		return
+	}
+
+	span := candles[len(candles)-1].Epoch - candles[0].Epoch
+	if span <= 0 {
+		p.pageSize = min(p.pageSize*2, p.maxPage)
+		return
+	}
+
+	perSecond := float64(len(candles)) / float64(span)
+	size := int(perSecond * p.readAhead.Seconds() / 2)
+
+	p.pageSize = min(max(size, p.minPage), p.maxPage)
+}
+
+// push hands the messages over, pulledUntil is the epoch the puller has read up to.
+func (p *replayPipeline) push(ctx context.Context, msgs []replayMessage, pulledUntil int64) error {
+	for _, msg := range msgs {
+		select {
+		case p.msgCh <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	p.pulledEpoch = pulledUntil
+	p.mu.Unlock()
+
+	return nil
+}
+
+// close tells the emitter nothing more is coming, only the puller calls it.
+func (p *replayPipeline) close() {
+	close(p.msgCh)
+}
+
+// next returns the next message to emit, false once the puller is done and everything
+// got emitted or ctx is done.
+func (p *replayPipeline) next(ctx context.Context) (replayMessage, bool) {
+	select {
+	case msg, ok := <-p.msgCh:
+		return msg, ok
+	default:
+	}
+
+	p.mu.Lock()
+	if p.emittedAny {
+		p.underruns++
+	}
+	p.mu.Unlock()
+
+	select {
+	case msg, ok := <-p.msgCh:
+		return msg, ok
+	case <-ctx.Done():
+		return replayMessage{}, false
+	}
+}
+
+// emitted moves the emitter position on, making room for the puller.
+func (p *replayPipeline) emitted(epoch int64) {
+	p.mu.Lock()
+	p.emittedAny = true
+	moved := epoch > p.emittedEpoch
+	if moved {
+		p.emittedEpoch = epoch
+	}
+	p.mu.Unlock()
+
+	if !moved && len(p.msgCh) > 0 {
+		return
+	}
+
+	select {
+	case p.advanceCh <- struct{}{}:
+	default:
+	}
+}
+
+func (p *replayPipeline) stats() entity.ReplayPipelineStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := entity.ReplayPipelineStats{
+		ReadAheadMilli:   p.readAhead.Milliseconds(),
+		BufferedMilli:    allowedSeconds(p.spans, p.emittedEpoch, p.pulledEpoch) * 1000,
+		BufferedMessages: len(p.msgCh),
+		BufferCapacity:   cap(p.msgCh),
+		PageSize:         p.lastLimit,
+		Pages:            p.pages,
+		Underruns:        p.underruns,
+	}
+
+	if p.pages > 0 {
+		stats.AvgFetchMilli = (p.fetchTotal / time.Duration(p.pages)).Milliseconds()
+	}
+
+	return stats
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sort"
+	"time"
+)
+
+// replayMessage is one outbound stream message. The emitter waits for delay after
+// sending it, which is how candles and synthetic ticks advance the playback clock.
+type replayMessage struct {
+	epoch   int64
+	rank    int
+	msgType entity.WsMessageType
+	data    json.RawMessage
+	// value, when set, is marshalled as the data once the message is sent, so the
+	// read-ahead holds the bars rather than their json
+	value any
+	delay time.Duration
+}
+
+// Within the same epoch funding and open interest are known at the bar open,
+// so they go out before the candles, mark and index bars go out after them. Universe
+// changes and rolls come first of all since they say which symbols the epoch is about.
+const (
+	replayMessageRankUniverse = iota
+	replayMessageRankSnapshot
+	replayMessageRankTick
+	replayMessageRankCandle
+	replayMessageRankPriceCandle
+)
+
+// pullSeries reads the extra market series of symbols within [start, end).
+func (s *replay) pullSeries(ctx context.Context, sh streamHandler, symbols []string, start, end time.Time) ([]replayMessage, error) {
+	msgs := []replayMessage{}
+
+	for _, series := range sh.series {
+		switch series {
+		case entity.MarketSeriesFundingRate:
+			rates, err := s.fundingRatesRepo.GetFundingRates(ctx, symbols, start, end)
+			if err != nil {
+				return nil, fmt.Errorf("[service][replay][pullSeries][fundingRatesRepo.GetFundingRates] error: %w", err)
+			}
+
+			for _, rate := range rates {
+				if sh.isDelisted(rate.Symbol, rate.Epoch) {
+					continue
+				}
+
+				data, err := json.Marshal(rate)
+				if err != nil {
+					return nil, fmt.Errorf("[service][replay][pullSeries][json.Marshal(rate)] error: %w", err)
+				}
+
+				msgs = append(msgs, replayMessage{epoch: rate.Epoch, rank: replayMessageRankSnapshot, msgType: entity.WsMessageTypeFundingRate, data: data})
+			}
+		case entity.MarketSeriesOpenInterest:
+			openInterests, err := s.openInterestsRepo.GetOpenInterests(ctx, symbols, start, end)
+			if err != nil {
+				return nil, fmt.Errorf("[service][replay][pullSeries][openInterestsRepo.GetOpenInterests] error: %w", err)
+			}
+
+			for _, oi := range openInterests {
+				if sh.isDelisted(oi.Symbol, oi.Epoch) {
+					continue
+				}
+
+				data, err := json.Marshal(oi)
+				if err != nil {
+					return nil, fmt.Errorf("[service][replay][pullSeries][json.Marshal(oi)] error: %w", err)
+				}
+
+				msgs = append(msgs, replayMessage{epoch: oi.Epoch, rank: replayMessageRankSnapshot, msgType: entity.WsMessageTypeOpenInterest, data: data})
+			}
+		case entity.MarketSeriesMarkPrice, entity.MarketSeriesIndexPrice:
+			priceType := entity.PriceTypeMark
+			msgType := entity.WsMessageTypeMarkPrice
+			if series == entity.MarketSeriesIndexPrice {
+				priceType = entity.PriceTypeIndex
+				msgType = entity.WsMessageTypeIndexPrice
+			}
+
+			candles, err := s.priceCandles1mRepo.GetPriceCandles(ctx, priceType, symbols, start, end)
+			if err != nil {
+				return nil, fmt.Errorf("[service][replay][pullSeries][priceCandles1mRepo.GetPriceCandles] error: %w", err)
+			}
+
+			for _, candle := range candles {
+				if sh.isDelisted(candle.Symbol, candle.Epoch) {
+					continue
+				}
+
+				data, err := json.Marshal(candle)
+				if err != nil {
+					return nil, fmt.Errorf("[service][replay][pullSeries][json.Marshal(candle)] error: %w", err)
+				}
+
+				msgs = append(msgs, replayMessage{epoch: candle.Epoch, rank: replayMessageRankPriceCandle, msgType: msgType, data: data})
+			}
+		}
+	}
+
+	return msgs, nil
+}
+
+func sortReplayMessages(msgs []replayMessage) {
+	sort.SliceStable(msgs, func(i, j int) bool {
+		if msgs[i].epoch != msgs[j].epoch {
+			return msgs[i].epoch < msgs[j].epoch
+		}
+
+		return msgs[i].rank < msgs[j].rank
+	})
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sync"
+	"time"
+)
+
+var (
+	errStreamDeleted = errors.New("stream deleted")
+	errStreamExpired = errors.New("stream expired")
+)
+
+// streamState is the runtime side of a streamHandler, shared by every run of the channel.
+type streamState struct {
+	status       entity.StreamStatus
+	cursorEpoch  int64
+	clients      int
+	runs         int
+	bytesSent    int64
+	messagesSent int64
+	tokenUsed    bool
+
+	// pipeline is the read-ahead of the latest replay run
+	pipeline *replayPipeline
+
+	cancels      map[int]context.CancelCauseFunc
+	nextCancelId int
+
+	// resumeCh is open while paused and closed on resume
+	resumeCh chan struct{}
+
+	createdAt time.Time
+
+	mu sync.Mutex
+}
+
+func newStreamState() *streamState {
+	return &streamState{
+		status:    entity.StreamStatusCreated,
+		cancels:   map[int]context.CancelCauseFunc{},
+		createdAt: time.Now(),
+	}
+}
+
+// startRun registers a run of the stream, done must be called once it is over.
+func (st *streamState) startRun(ctx context.Context) (context.Context, func(finished bool)) {
+	runCtx, cancel := context.WithCancelCause(ctx)
+
+	st.mu.Lock()
+	id := st.nextCancelId
+	st.nextCancelId++
+	st.cancels[id] = cancel
+	st.runs++
+	if st.resumeCh == nil {
+		st.status = entity.StreamStatusStreaming
+	}
+	st.mu.Unlock()
+
+	return runCtx, func(finished bool) {
+		st.mu.Lock()
+		delete(st.cancels, id)
+		st.runs--
+		if st.runs == 0 {
+			switch {
+			case finished:
+				st.status = entity.StreamStatusFinished
+				if st.resumeCh != nil {
+					close(st.resumeCh)
+					st.resumeCh = nil
+				}
+			case st.resumeCh == nil:
+				// the client left midway, the stream can be started again
+				st.status = entity.StreamStatusCreated
+			}
+		}
+		st.mu.Unlock()
+
+		cancel(nil)
+	}
+}
+
+func (st *streamState) cancelRuns(cause error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, cancel := range st.cancels {
+		cancel(cause)
+	}
+
+	if st.resumeCh != nil {
+		close(st.resumeCh)
+		st.resumeCh = nil
+	}
+}
+
+// consumeToken marks a one-time token as used, false when it already was.
+func (st *streamState) consumeToken() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.tokenUsed {
+		return false
+	}
+
+	st.tokenUsed = true
+
+	return true
+}
+
+func (st *streamState) addClient(delta int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.clients += delta
+}
+
+func (st *streamState) recordSent(msg []byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.bytesSent += int64(len(msg))
+	st.messagesSent++
+}
+
+func (st *streamState) recordCursor(epoch int64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.cursorEpoch = epoch
+}
+
+func (st *streamState) setPipeline(pipeline *replayPipeline) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.pipeline = pipeline
+}
+
+func (st *streamState) pause() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.status == entity.StreamStatusFinished || st.resumeCh != nil {
+		return false
+	}
+
+	st.resumeCh = make(chan struct{})
+	st.status = entity.StreamStatusPaused
+
+	return true
+}
+
+func (st *streamState) resume() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.resumeCh == nil {
+		return false
+	}
+
+	close(st.resumeCh)
+	st.resumeCh = nil
+
+	st.status = entity.StreamStatusCreated
+	if st.runs > 0 {
+		st.status = entity.StreamStatusStreaming
+	}
+
+	return true
+}
+
+// pausedCh returns the channel to wait on while the stream is paused, nil otherwise.
+func (st *streamState) pausedCh() chan struct{} {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.resumeCh
+}
+
+func (st *streamState) info(channel string, sh streamHandler) entity.StreamInfo {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	info := entity.StreamInfo{
+		Channel:            channel,
+		Preset:             sh.preset,
+		Type:               sh.streamType,
+		Interval:           sh.interval,
+		Symbols:            sh.symbols,
+		Series:             sh.series,
+		Universe:           sh.universe,
+		PlaybackSpeed:      sh.playbackSpeed,
+		StartTimeUnixMilli: sh.startTime.UnixMilli(),
+		EndTimeUnixMilli:   sh.endTime.UnixMilli(),
+		Owner:              sh.owner,
+		Shared:             sh.shared,
+		Status:             st.status,
+		CursorEpoch:        st.cursorEpoch,
+		Clients:            st.clients,
+		BytesSent:          st.bytesSent,
+		MessagesSent:       st.messagesSent,
+		CreatedAtUnixMilli: st.createdAt.UnixMilli(),
+		ExpiresAtUnixMilli: sh.cleanedAt.UnixMilli(),
+	}
+
+	if st.pipeline != nil {
+		stats := st.pipeline.stats()
+		info.Pipeline = &stats
+	}
+
+	return info
+}
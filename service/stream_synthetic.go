@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"michaelyusak/go-quant-replay-engine.git/adapter/synthetic"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/rollup"
+	"net/http"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+)
+
+// resolveSynthetic fills in the seed and defaults of a market standing in for the
+// symbols of conf, the stream then plays it without reading any candles.
+func resolveSynthetic(market entity.SyntheticMarket, conf entity.ReplayConfiguration, scenario bool) (entity.SyntheticMarket, error) {
+	err := validateSyntheticStream(market, conf, scenario)
+	if err != nil {
+		return entity.SyntheticMarket{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: err.Error(),
+			Message:         fmt.Sprintf("[service][replay][resolveSynthetic][validateSyntheticStream] error: %v", err),
+		})
+	}
+
+	if market.Seed == 0 {
+		market.Seed = rand.Uint64()
+	}
+
+	return synthetic.WithDefaults(market), nil
+}
+
+func validateSyntheticStream(market entity.SyntheticMarket, conf entity.ReplayConfiguration, scenario bool) error {
+	// everything else of the history has nothing to do with a generated market
+	if conf.Universe != nil || len(conf.Instruments) > 0 || len(conf.Series) > 0 || scenario {
+		return errors.New("a synthetic market can not be combined with a universe, continuous instruments, series or a scenario")
+	}
+
+	return synthetic.Validate(synthetic.WithDefaults(market))
+}
+
+// syntheticSource generates the bars of a synthetic stream as the replay reads them.
+// Reads only ever move forward like the pages of the puller do, so the generator never
+// has to go back.
+type syntheticSource struct {
+	generator *synthetic.Generator
+	// pending are the bars generated and not read past yet, ordered by key
+	pending []entity.Candle
+}
+
+// newSyntheticSource starts market at the bar of interval holding start.
+func newSyntheticSource(market entity.SyntheticMarket, interval entity.CandleInterval, start time.Time) (*syntheticSource, error) {
+	size := int64(interval.Duration().Seconds())
+
+	generator, err := synthetic.NewGenerator(market, time.Unix(start.Unix()/size*size, 0))
+	if err != nil {
+		return nil, fmt.Errorf("[service][replay][newSyntheticSource][synthetic.NewGenerator] error: %w", err)
+	}
+
+	return &syntheticSource{generator: generator}, nil
+}
+
+func (s *syntheticSource) GetCandles(ctx context.Context, interval entity.CandleInterval, symbols []string, start, end time.Time, after *entity.CandleKey, limit int) ([]entity.Candle, error) {
+	wanted := map[string]bool{}
+	for _, symbol := range symbols {
+		wanted[symbol] = true
+	}
+
+	unread := func(candle entity.Candle) bool {
+		return candle.Epoch >= start.Unix() && (after == nil || keyAfter(candle.Key(), *after))
+	}
+
+	// what was read past is never asked for again
+	inRange := 0
+	pending := s.pending[:0]
+	for _, candle := range s.pending {
+		if unread(candle) {
+			pending = append(pending, candle)
+
+			if candle.Epoch <= end.Unix() {
+				inRange++
+			}
+		}
+	}
+	s.pending = pending
+
+	minutes := int(interval.Duration() / time.Minute)
+
+	for s.generator.Epoch() <= end.Unix() && (limit <= 0 || inRange < limit) {
+		bars := []entity.Candle{}
+		for i := 0; i < minutes; i++ {
+			bars = append(bars, s.generator.Next()...)
+		}
+
+		if minutes > 1 {
+			bars = rollup.Aggregate(bars, interval)
+		}
+
+		for _, bar := range bars {
+			if unread(bar) && wanted[fmt.Sprintf("%s:%s", bar.Exchange, bar.Pair)] {
+				s.pending = append(s.pending, bar)
+
+				if bar.Epoch <= end.Unix() {
+					inRange++
+				}
+			}
+		}
+	}
+
+	candles := []entity.Candle{}
+	for _, candle := range s.pending {
+		if candle.Epoch > end.Unix() || (limit > 0 && len(candles) == limit) {
+			break
+		}
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
+
+// keyAfter tells whether key comes after the key after in the order candles are paged in.
+func keyAfter(key, after entity.CandleKey) bool {
+	if key.Epoch != after.Epoch {
+		return key.Epoch > after.Epoch
+	}
+
+	if key.Exchange != after.Exchange {
+		return key.Exchange > after.Exchange
+	}
+
+	return key.Pair > after.Pair
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hEntity "github.com/michaelyusak/go-helper/entity"
+	"github.com/shopspring/decimal"
+)
+
+func TestCleanStreamHandlerEndsTheRunsOfExpiredChannels(t *testing.T) {
+	expired := streamHandler{state: newStreamState(), cleanedAt: time.Now().Add(-time.Minute)}
+	alive := streamHandler{state: newStreamState(), cleanedAt: time.Now().Add(time.Hour)}
+
+	s := &replay{chMap: map[string]streamHandler{
+		"ch:expired": expired,
+		"ch:alive":   alive,
+	}}
+
+	expiredCtx, expiredDone := expired.state.startRun(context.Background())
+	defer expiredDone(false)
+
+	aliveCtx, aliveDone := alive.state.startRun(context.Background())
+	defer aliveDone(false)
+
+	s.cleanStreamHandler()
+
+	if _, ok := s.chMap["ch:expired"]; ok {
+		t.Error("the expired channel is still mapped")
+	}
+
+	if _, ok := s.chMap["ch:alive"]; !ok {
+		t.Error("the alive channel was dropped")
+	}
+
+	select {
+	case <-expiredCtx.Done():
+		if cause := context.Cause(expiredCtx); !errors.Is(cause, errStreamExpired) {
+			t.Errorf("the expired run ended with %v, want %v", cause, errStreamExpired)
+		}
+	default:
+		t.Error("the run of the expired channel still runs")
+	}
+
+	if aliveCtx.Err() != nil {
+		t.Errorf("the run of the alive channel ended with %v", context.Cause(aliveCtx))
+	}
+}
+
+func TestSubscribeSessionOfADroppedChannel(t *testing.T) {
+	s := &replay{chMap: map[string]streamHandler{}}
+
+	// the channel was deleted between authenticating and joining its session
+	ch := make(chan []byte, 1)
+	err := s.subscribeSession(context.Background(), ch, "ch:deleted", false)
+	if err == nil {
+		t.Fatal("subscribeSession of a dropped channel returned no error")
+	}
+
+	if _, ok := s.chMap["ch:deleted"]; ok {
+		t.Error("subscribeSession put the dropped channel back")
+	}
+
+	if len(ch) != 1 {
+		t.Error("the client was not told the stream is gone")
+	}
+}
+
+func TestStreamReplayRefusesTheToken(t *testing.T) {
+	used := newStreamState()
+	used.consumeToken()
+
+	tests := []struct {
+		name    string
+		handler streamHandler
+		token   string
+		want    string
+	}{
+		{
+			name:    "a wrong token",
+			handler: streamHandler{token: "right", tokenExpiresAt: time.Now().Add(time.Hour), state: newStreamState()},
+			token:   "wrong",
+			want:    "invalid token",
+		},
+		{
+			name:    "a prefix of the token",
+			handler: streamHandler{token: "right", tokenExpiresAt: time.Now().Add(time.Hour), state: newStreamState()},
+			token:   "rig",
+			want:    "invalid token",
+		},
+		{
+			name:    "an expired token",
+			handler: streamHandler{token: "right", tokenExpiresAt: time.Now().Add(-time.Second), state: newStreamState()},
+			token:   "right",
+			want:    "token expired",
+		},
+		{
+			name:    "a one-time token used before",
+			handler: streamHandler{token: "right", tokenExpiresAt: time.Now().Add(time.Hour), oneTimeToken: true, state: used},
+			token:   "right",
+			want:    "token already used",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &replay{chMap: map[string]streamHandler{"ch:test": test.handler}}
+
+			ch := make(chan []byte, 1)
+			err := s.StreamReplay(context.Background(), ch, entity.WsAuthData{Channel: "ch:test", Token: test.token})
+			if err == nil {
+				t.Fatal("StreamReplay returned no error")
+			}
+
+			var msg entity.WsMessage
+			json.Unmarshal(<-ch, &msg)
+
+			var data entity.StreamErrorData
+			json.Unmarshal(msg.Data, &data)
+
+			if msg.Type != string(entity.WsMessageTypeError) || data.Message != test.want {
+				t.Errorf("sent %s %q, want error %q", msg.Type, data.Message, test.want)
+			}
+		})
+	}
+}
+
+func TestConsumeTokenOnlyOnce(t *testing.T) {
+	st := newStreamState()
+
+	var wg sync.WaitGroup
+	var consumed atomic.Int32
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if st.consumeToken() {
+				consumed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := consumed.Load(); got != 1 {
+		t.Fatalf("the token was consumed %d times, want once", got)
+	}
+}
+
+func TestCreateStreamRefusesAOneTimeTokenOnASharedStream(t *testing.T) {
+	s := newMemoryReplay(t)
+	ctx := context.Background()
+
+	err := s.SeedDefaultPreset(ctx, presetConf(1, "binance:BTCUSDT"))
+	if err != nil {
+		t.Fatalf("SeedDefaultPreset error: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		shared       bool
+		oneTimeToken bool
+		code         int
+	}{
+		{"a one-time token", false, true, 0},
+		{"a shared stream", true, false, 0},
+		{"a one-time token on a shared stream", true, true, http.StatusUnprocessableEntity},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.CreateStream(ctx, entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Shared: test.shared, OneTimeToken: test.oneTimeToken})
+			if code := appErrorCode(err); code != test.code {
+				t.Errorf("CreateStream gave %d (%v), want %d", code, err, test.code)
+			}
+		})
+	}
+}
+
+func TestCandleMessagesDelayEachEpochOnce(t *testing.T) {
+	delay := time.Second
+	bar := func(pair string, epoch int64) entity.Candle {
+		return entity.Candle{Epoch: epoch, Exchange: "binance", Pair: pair}
+	}
+
+	// the second epoch is split over the pages, its bar_close comes with the second one
+	var open openBar
+	msgs := candleMessages([]entity.Candle{bar("BTCUSDT", 60), bar("ETHUSDT", 60), bar("BTCUSDT", 120)}, delay, false, &open)
+	msgs = append(msgs, candleMessages([]entity.Candle{bar("ETHUSDT", 120), bar("BTCUSDT", 180), bar("ETHUSDT", 180)}, delay, true, &open)...)
+
+	want := []string{
+		"candle 60 0s", "candle 60 0s", "bar_close 60 1s",
+		"candle 120 0s", "candle 120 0s", "bar_close 120 1s",
+		"candle 180 0s", "candle 180 0s", "bar_close 180 1s",
+	}
+
+	got := []string{}
+	for _, msg := range msgs {
+		got = append(got, fmt.Sprintf("%s %d %s", msg.msgType, msg.epoch, msg.delay))
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("candleMessages = %q, want %q", got, want)
+	}
+}
+
+func TestRunReplayInterleavesTheSeriesWithTheCandles(t *testing.T) {
+	s := newMemoryReplay(t)
+	ctx := context.Background()
+
+	minute := func(m int64) int64 { return calendarMonday.Unix() + m*60 }
+	one := decimal.NewFromInt(1)
+
+	for m := int64(0); m < 3; m++ {
+		for _, pair := range []string{"BTCUSDT", "ETHUSDT"} {
+			err := s.candles1mRepo.InsertMany(ctx, []entity.Candle{{Epoch: minute(m), Exchange: "binance", Pair: pair, Open: one, High: one, Low: one, Close: one}})
+			if err != nil {
+				t.Fatalf("candles1mRepo.InsertMany error: %v", err)
+			}
+		}
+	}
+
+	err := s.fundingRatesRepo.InsertMany(ctx, []entity.FundingRate{{Epoch: minute(1), Exchange: "binance", Pair: "BTCUSDT", FundingRate: decimal.RequireFromString("0.0001"), MarkPrice: one}})
+	if err != nil {
+		t.Fatalf("fundingRatesRepo.InsertMany error: %v", err)
+	}
+
+	err = s.openInterestsRepo.InsertMany(ctx, []entity.OpenInterest{
+		{Epoch: minute(0), Exchange: "binance", Pair: "ETHUSDT", OpenInterest: one, OpenInterestValue: one},
+		{Epoch: minute(1), Exchange: "binance", Pair: "BTCUSDT", OpenInterest: one, OpenInterestValue: one},
+	})
+	if err != nil {
+		t.Fatalf("openInterestsRepo.InsertMany error: %v", err)
+	}
+
+	err = s.priceCandles1mRepo.InsertMany(ctx, []entity.PriceCandle{
+		{Epoch: minute(0), Exchange: "binance", Pair: "BTCUSDT", PriceType: entity.PriceTypeMark, Open: one, High: one, Low: one, Close: one},
+		{Epoch: minute(2), Exchange: "binance", Pair: "ETHUSDT", PriceType: entity.PriceTypeIndex, Open: one, High: one, Low: one, Close: one},
+		{Epoch: minute(2), Exchange: "binance", Pair: "ETHUSDT", PriceType: entity.PriceTypeMark, Open: one, High: one, Low: one, Close: one},
+	})
+	if err != nil {
+		t.Fatalf("priceCandles1mRepo.InsertMany error: %v", err)
+	}
+
+	conf := presetConf(6000, "binance:BTCUSDT", "binance:ETHUSDT")
+	conf.EndTimeUnixMilli = time.Unix(minute(2), 0).UnixMilli()
+	conf.Series = []entity.MarketSeries{entity.MarketSeriesMarkPrice, entity.MarketSeriesOpenInterest, entity.MarketSeriesIndexPrice, entity.MarketSeriesFundingRate}
+
+	_, err = s.CreatePreset(ctx, entity.ReplayPreset{Name: "series", Config: conf})
+	if err != nil {
+		t.Fatalf("CreatePreset error: %v", err)
+	}
+
+	res, err := s.CreateStream(ctx, entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Preset: "series"})
+	if err != nil {
+		t.Fatalf("CreateStream error: %v", err)
+	}
+
+	ch := make(chan []byte)
+	go s.StreamReplay(ctx, ch, entity.WsAuthData{Channel: res.Channel, Token: res.Token})
+
+	got := []string{}
+	for raw := range ch {
+		var msg entity.WsMessage
+		json.Unmarshal(raw, &msg)
+
+		var data struct {
+			Epoch  int64  `json:"epoch"`
+			Symbol string `json:"symbol"`
+		}
+		json.Unmarshal(msg.Data, &data)
+
+		switch entity.WsMessageType(msg.Type) {
+		case entity.WsMessageTypeCandle, entity.WsMessageTypeFundingRate, entity.WsMessageTypeOpenInterest, entity.WsMessageTypeMarkPrice, entity.WsMessageTypeIndexPrice:
+			got = append(got, fmt.Sprintf("%d %s %s", (data.Epoch-calendarMonday.Unix())/60, msg.Type, data.Symbol))
+		case entity.WsMessageTypeBarClose:
+			got = append(got, fmt.Sprintf("%d %s", (data.Epoch-calendarMonday.Unix())/60, msg.Type))
+		}
+	}
+
+	// funding and open interest open their epoch, mark and index bars follow its close,
+	// each rank in the order the series are configured
+	want := []string{
+		"0 open_interest binance:ETHUSDT",
+		"0 candle binance:BTCUSDT", "0 candle binance:ETHUSDT", "0 bar_close",
+		"0 mark_price binance:BTCUSDT",
+		"1 open_interest binance:BTCUSDT", "1 funding_rate binance:BTCUSDT",
+		"1 candle binance:BTCUSDT", "1 candle binance:ETHUSDT", "1 bar_close",
+		"2 candle binance:BTCUSDT", "2 candle binance:ETHUSDT", "2 bar_close",
+		"2 mark_price binance:ETHUSDT", "2 index_price binance:ETHUSDT",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sequence\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
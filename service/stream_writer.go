@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"sync"
+	"time"
+)
+
+// streamWriter wraps every outbound message of one stream in the ws envelope.
+// Sequence numbers are assigned under the lock that also covers the delivery,
+// so clients see them strictly increasing even with the heartbeat running alongside.
+type streamWriter struct {
+	deliver func(ctx context.Context, msg []byte) error
+
+	// onCandle, when set, is told the epoch of every candle sent
+	onCandle func(epoch int64)
+
+	ended bool
+
+	seq     int64
+	candles int64
+
+	firstEpoch int64
+	lastEpoch  int64
+
+	startedAt time.Time
+
+	mu sync.Mutex
+}
+
+func newStreamWriter(deliver func(ctx context.Context, msg []byte) error) *streamWriter {
+	return &streamWriter{
+		deliver:   deliver,
+		startedAt: time.Now(),
+	}
+}
+
+// deliverTo delivers straight into the channel of a single client.
+func deliverTo(ch chan []byte) func(ctx context.Context, msg []byte) error {
+	return func(ctx context.Context, msg []byte) error {
+		select {
+		case ch <- msg:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (w *streamWriter) send(ctx context.Context, msgType entity.WsMessageType, data any) error {
+	raw, ok := data.(json.RawMessage)
+	if !ok {
+		var err error
+		raw, err = json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("[service][replay][streamWriter][send][json.Marshal(data)] error: %w", err)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	msg, err := json.Marshal(entity.WsMessage{
+		Type: string(msgType),
+		Seq:  w.seq + 1,
+		Data: raw,
+	})
+	if err != nil {
+		return fmt.Errorf("[service][replay][streamWriter][send][json.Marshal(msg)] error: %w", err)
+	}
+
+	err = w.deliver(ctx, msg)
+	if err != nil {
+		return err
+	}
+
+	w.seq++
+
+	return nil
+}
+
+func (w *streamWriter) sendReplayMessage(ctx context.Context, msg replayMessage) error {
+	var data any = msg.data
+	if msg.value != nil {
+		data = msg.value
+	}
+
+	err := w.send(ctx, msg.msgType, data)
+	if err != nil {
+		return err
+	}
+
+	if msg.msgType == entity.WsMessageTypeCandle {
+		w.mu.Lock()
+		if w.candles == 0 {
+			w.firstEpoch = msg.epoch
+		}
+		w.candles++
+		w.lastEpoch = msg.epoch
+		w.mu.Unlock()
+
+		if w.onCandle != nil {
+			w.onCandle(msg.epoch)
+		}
+	}
+
+	return nil
+}
+
+func (w *streamWriter) sendEnd(ctx context.Context, reason entity.StreamEndReason) error {
+	w.mu.Lock()
+	data := entity.StreamEndData{
+		Reason: reason,
+		// the end message itself is counted
+		Messages:     w.seq + 1,
+		Candles:      w.candles,
+		FirstEpoch:   w.firstEpoch,
+		LastEpoch:    w.lastEpoch,
+		ElapsedMilli: time.Since(w.startedAt).Milliseconds(),
+	}
+	w.mu.Unlock()
+
+	err := w.send(ctx, entity.WsMessageTypeEnd, data)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.ended = true
+	w.mu.Unlock()
+
+	return nil
+}
+
+func (w *streamWriter) hasEnded() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.ended
+}
+
+// runHeartbeat sends a heartbeat every interval until stop is closed or ctx is done.
+func (w *streamWriter) runHeartbeat(ctx context.Context, interval time.Duration, stop chan struct{}) {
+	tic := time.NewTicker(interval)
+	defer tic.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case now := <-tic.C:
+			err := w.send(ctx, entity.WsMessageTypeHeartbeat, entity.HeartbeatData{
+				ServerTimeUnixMilli: now.UnixMilli(),
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
+}
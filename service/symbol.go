@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	binancehttp "michaelyusak/go-quant-replay-engine.git/adapter/binance_http"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+type symbol struct {
+	symbolsRepo        repository.Symbols
+	binanceHttpAdapter *binancehttp.Adapter
+	quota              Quota
+}
+
+func NewSymbol(
+	symbolsRepo repository.Symbols,
+	binanceHttpAdapter *binancehttp.Adapter,
+	quota Quota,
+) *symbol {
+	return &symbol{
+		symbolsRepo:        symbolsRepo,
+		binanceHttpAdapter: binanceHttpAdapter,
+		quota:              quota,
+	}
+}
+
+func (s *symbol) SyncFromBinance(ctx context.Context) (int, error) {
+	release, err := s.quota.AcquireImport(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	symbolInfos, err := s.binanceHttpAdapter.GetExchangeInfo(ctx)
+	if err != nil {
+		return 0, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][symbol][SyncFromBinance][binanceHttpAdapter.GetExchangeInfo] error: %v", err),
+		})
+	}
+
+	if len(symbolInfos) == 0 {
+		return 0, nil
+	}
+
+	err = s.symbolsRepo.InsertMany(ctx, symbolInfos)
+	if err != nil {
+		return 0, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][symbol][SyncFromBinance][symbolsRepo.InsertMany] error: %v", err),
+		})
+	}
+
+	logrus.
+		WithField("symbols", len(symbolInfos)).
+		Info("[service][symbol][SyncFromBinance] symbols synced")
+
+	return len(symbolInfos), nil
+}
+
+func (s *symbol) ListSymbols(ctx context.Context) ([]entity.SymbolInfo, error) {
+	symbolInfos, err := s.symbolsRepo.GetSymbols(ctx)
+	if err != nil {
+		return []entity.SymbolInfo{}, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][symbol][ListSymbols][symbolsRepo.GetSymbols] error: %v", err),
+		})
+	}
+
+	return symbolInfos, nil
+}
+
+func (s *symbol) GetSymbol(ctx context.Context, sym string) (entity.SymbolInfo, error) {
+	symbolInfos, err := s.ListSymbols(ctx)
+	if err != nil {
+		return entity.SymbolInfo{}, err
+	}
+
+	for _, info := range symbolInfos {
+		if info.Symbol == sym {
+			return info, nil
+		}
+	}
+
+	return entity.SymbolInfo{}, apperror.BadRequestError(apperror.AppErrorOpt{
+		Code:            http.StatusNotFound,
+		ResponseMessage: fmt.Sprintf("the symbol '%s' is not registered", sym),
+		Message:         fmt.Sprintf("[service][symbol][GetSymbol] symbol '%s' not found", sym),
+	})
+}
+
+// resolveSymbols checks every symbol against the registry and returns the delisting
+// epoch, in seconds, of the symbols that got delisted. Replays can not start after a
+// symbol is gone.
+func resolveSymbols(ctx context.Context, symbolsRepo repository.Symbols, symbols []string, start time.Time) (map[string]int64, error) {
+	for _, sym := range symbols {
+		if len(strings.Split(sym, ":")) != 2 {
+			return nil, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: fmt.Sprintf("the symbol '%s' is not in exchange:pair form", sym),
+				Message:         fmt.Sprintf("[service][replay][resolveSymbols] malformed symbol '%s'", sym),
+			})
+		}
+	}
+
+	symbolInfos, err := symbolsRepo.GetSymbols(ctx)
+	if err != nil {
+		return nil, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][replay][resolveSymbols][symbolsRepo.GetSymbols] error: %v", err),
+		})
+	}
+
+	registry := map[string]entity.SymbolInfo{}
+	for _, info := range symbolInfos {
+		registry[info.Symbol] = info
+	}
+
+	delistedAt := map[string]int64{}
+
+	for _, sym := range symbols {
+		info, ok := registry[sym]
+		if !ok {
+			return nil, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: fmt.Sprintf("the symbol '%s' is not registered", sym),
+				Message:         fmt.Sprintf("[service][replay][resolveSymbols] symbol '%s' not registered", sym),
+			})
+		}
+
+		if info.DelistedAtUnixMilli == 0 {
+			continue
+		}
+
+		delisted := time.UnixMilli(info.DelistedAtUnixMilli)
+		if !start.Before(delisted) {
+			return nil, apperror.BadRequestError(apperror.AppErrorOpt{
+				Code:            http.StatusUnprocessableEntity,
+				ResponseMessage: fmt.Sprintf("the symbol '%s' was delisted at %s", sym, delisted.UTC().Format(time.RFC3339)),
+				Message:         fmt.Sprintf("[service][replay][resolveSymbols] symbol '%s' delisted before the stream starts", sym),
+			})
+		}
+
+		delistedAt[sym] = delisted.Unix()
+	}
+
+	return delistedAt, nil
+}
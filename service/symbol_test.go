@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/memory"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResolveSymbols(t *testing.T) {
+	delisted := calendarMonday.Add(30 * 24 * time.Hour)
+
+	symbolsRepo := memory.NewSymbols()
+	err := symbolsRepo.InsertMany(context.Background(), []entity.SymbolInfo{
+		{Exchange: "binance", Pair: "BTCUSDT"},
+		{Exchange: "binance", Pair: "LUNAUSDT", DelistedAtUnixMilli: delisted.UnixMilli()},
+	})
+	if err != nil {
+		t.Fatalf("symbolsRepo.InsertMany error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		symbols []string
+		start   time.Time
+		code    int
+		want    map[string]int64
+	}{
+		{"a listed symbol", []string{"binance:BTCUSDT"}, calendarMonday, 0, map[string]int64{}},
+		{"a symbol delisted later keeps its cutoff", []string{"binance:BTCUSDT", "binance:LUNAUSDT"}, calendarMonday, 0, map[string]int64{"binance:LUNAUSDT": delisted.Unix()}},
+		{"a start a second before the delisting", []string{"binance:LUNAUSDT"}, delisted.Add(-time.Second), 0, map[string]int64{"binance:LUNAUSDT": delisted.Unix()}},
+		{"a start at the delisting", []string{"binance:LUNAUSDT"}, delisted, http.StatusUnprocessableEntity, nil},
+		{"a start after the delisting", []string{"binance:LUNAUSDT"}, delisted.Add(time.Hour), http.StatusUnprocessableEntity, nil},
+		{"an unregistered symbol", []string{"binance:DOGEUSDT"}, calendarMonday, http.StatusUnprocessableEntity, nil},
+		{"a symbol without an exchange", []string{"BTCUSDT"}, calendarMonday, http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := resolveSymbols(context.Background(), symbolsRepo, test.symbols, test.start)
+			if code := appErrorCode(err); code != test.code {
+				t.Fatalf("resolveSymbols gave %d (%v), want %d", code, err, test.code)
+			}
+
+			if test.code == 0 && fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("resolveSymbols = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListedCandlesDropTheBarsFromTheDelisting(t *testing.T) {
+	delisted := calendarMonday.Add(2 * time.Minute).Unix()
+	sh := streamHandler{delistedAt: map[string]int64{"binance:LUNAUSDT": delisted}}
+
+	candles := []entity.Candle{}
+	for i := int64(0); i < 4; i++ {
+		for _, symbol := range []string{"binance:BTCUSDT", "binance:LUNAUSDT"} {
+			candles = append(candles, entity.Candle{Symbol: symbol, Epoch: calendarMonday.Unix() + i*60})
+		}
+	}
+
+	got := []string{}
+	for _, candle := range sh.listedCandles(candles) {
+		got = append(got, fmt.Sprintf("%s %d", candle.Symbol, candle.Epoch-calendarMonday.Unix()))
+	}
+
+	want := []string{
+		"binance:BTCUSDT 0", "binance:LUNAUSDT 0",
+		"binance:BTCUSDT 60", "binance:LUNAUSDT 60",
+		"binance:BTCUSDT 120",
+		"binance:BTCUSDT 180",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("listedCandles = %v, want %v", got, want)
+	}
+}
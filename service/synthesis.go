@@ -0,0 +1,195 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"michaelyusak/go-quant-replay-engine.git/common"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	tickSynthesisMinPoints = 4
+	tickSynthesisMaxPoints = 1000
+)
+
+// tickSynthesizer expands bars into synthetic intra-bar price points.
+// It is stateful through its rng, so one synthesizer serves exactly one stream
+// to keep seeded runs reproducible.
+type tickSynthesizer struct {
+	mode   entity.TickSynthesisMode
+	points int
+	rng    *rand.Rand
+}
+
+func newTickSynthesizer(conf entity.TickSynthesis) *tickSynthesizer {
+	points := conf.PointsPerBar
+	if points < tickSynthesisMinPoints {
+		points = tickSynthesisMinPoints
+	}
+
+	return &tickSynthesizer{
+		mode:   conf.Mode,
+		points: points,
+		rng:    rand.New(rand.NewPCG(conf.Seed, conf.Seed)),
+	}
+}
+
+// resolveTickSynthesis fills a random seed into a copy of conf when it has none, the
+// stream keeps it so every run of it draws the same ticks.
+func resolveTickSynthesis(conf *entity.TickSynthesis) *entity.TickSynthesis {
+	if conf == nil {
+		return nil
+	}
+
+	resolved := *conf
+	if resolved.Seed == 0 {
+		resolved.Seed = rand.Uint64()
+	}
+
+	return &resolved
+}
+
+func validateTickSynthesis(conf *entity.TickSynthesis) error {
+	if conf == nil {
+		return nil
+	}
+
+	switch conf.Mode {
+	case entity.TickSynthesisModeOhlc, entity.TickSynthesisModeBrownianBridge:
+	default:
+		return fmt.Errorf("the tick synthesis mode '%s' is not supported", conf.Mode)
+	}
+
+	if conf.PointsPerBar > tickSynthesisMaxPoints {
+		return fmt.Errorf("points per bar must not exceed %v", tickSynthesisMaxPoints)
+	}
+
+	return nil
+}
+
+// expand emits every bar of the same epoch point by point side by side, spreading
+// the points over the scaled bar duration. candles must be ordered by epoch.
+func (t *tickSynthesizer) expand(candles []entity.Candle, interval, latency time.Duration) []replayMessage {
+	msgs := []replayMessage{}
+
+	stepDelay := latency / time.Duration(t.points)
+	stepMilli := interval.Milliseconds() / int64(t.points)
+
+	for start := 0; start < len(candles); {
+		end := start
+		for end < len(candles) && candles[end].Epoch == candles[start].Epoch {
+			end++
+		}
+		group := candles[start:end]
+
+		paths := make([][]decimal.Decimal, len(group))
+		for i, candle := range group {
+			paths[i] = t.path(candle)
+		}
+
+		for k := 0; k < t.points; k++ {
+			for i, candle := range group {
+				tick := entity.Tick{
+					EpochMilli: candle.Epoch*1000 + int64(k)*stepMilli,
+					BarEpoch:   candle.Epoch,
+					Pair:       candle.Pair,
+					Exchange:   candle.Exchange,
+					Symbol:     candle.Symbol,
+					Price:      paths[i][k],
+				}
+
+				msg := replayMessage{epoch: candle.Epoch, rank: replayMessageRankTick, msgType: entity.WsMessageTypeTick, value: tick}
+				if i == len(group)-1 {
+					msg.delay = stepDelay
+				}
+
+				msgs = append(msgs, msg)
+			}
+		}
+
+		start = end
+	}
+
+	return msgs
+}
+
+// path returns t.points prices starting at the open, touching the high and the low,
+// and ending at the close.
+func (t *tickSynthesizer) path(candle entity.Candle) []decimal.Decimal {
+	o, _ := candle.Open.Float64()
+	h, _ := candle.High.Float64()
+	l, _ := candle.Low.Float64()
+	c, _ := candle.Close.Float64()
+
+	highFirst := candle.Close.LessThan(candle.Open)
+	if t.mode == entity.TickSynthesisModeBrownianBridge {
+		highFirst = t.rng.IntN(2) == 0
+	}
+
+	waypoints := []float64{o, l, h, c}
+	if highFirst {
+		waypoints = []float64{o, h, l, c}
+	}
+
+	steps := t.points - 1
+	segmentSteps := []int{steps / 3, steps / 3, steps / 3}
+	for i := 0; i < steps%3; i++ {
+		segmentSteps[i]++
+	}
+
+	// noise is scaled so the bridge wanders noticeably but rarely needs the clamp
+	sigma := (h - l) / (2 * math.Sqrt(float64(steps)))
+
+	prices := make([]float64, 0, t.points)
+	prices = append(prices, o)
+
+	for seg, n := range segmentSteps {
+		from, to := waypoints[seg], waypoints[seg+1]
+
+		var bridge []float64
+		if t.mode == entity.TickSynthesisModeBrownianBridge {
+			bridge = t.brownianBridge(n, sigma)
+		}
+
+		for k := 1; k <= n; k++ {
+			p := from + (to-from)*float64(k)/float64(n)
+			if bridge != nil {
+				p += bridge[k]
+			}
+
+			prices = append(prices, math.Min(h, math.Max(l, p)))
+		}
+	}
+
+	places := common.DecimalPlaces(candle.Open, candle.High, candle.Low, candle.Close)
+
+	path := make([]decimal.Decimal, len(prices))
+	for i, p := range prices {
+		path[i] = decimal.NewFromFloat(p).Round(places)
+	}
+
+	// the waypoints are exact, not float round trips
+	path[0] = candle.Open
+	path[len(path)-1] = candle.Close
+
+	return path
+}
+
+// brownianBridge returns n+1 values of a random walk pinned to zero at both ends.
+func (t *tickSynthesizer) brownianBridge(n int, sigma float64) []float64 {
+	walk := make([]float64, n+1)
+	for k := 1; k <= n; k++ {
+		walk[k] = walk[k-1] + t.rng.NormFloat64()*sigma
+	}
+
+	bridge := make([]float64, n+1)
+	for k := range walk {
+		bridge[k] = walk[k] - walk[n]*float64(k)/float64(n)
+	}
+
+	return bridge
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"strings"
+	"testing"
+	"time"
+
+	hEntity "github.com/michaelyusak/go-helper/entity"
+	"github.com/shopspring/decimal"
+)
+
+func synthesisBar(symbol string, epoch int64, open, high, low, close string) entity.Candle {
+	exchange, pair, _ := strings.Cut(symbol, ":")
+
+	return entity.Candle{
+		Epoch:    epoch,
+		Exchange: exchange,
+		Pair:     pair,
+		Symbol:   symbol,
+		Open:     decimal.RequireFromString(open),
+		High:     decimal.RequireFromString(high),
+		Low:      decimal.RequireFromString(low),
+		Close:    decimal.RequireFromString(close),
+	}
+}
+
+func TestValidateTickSynthesis(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *entity.TickSynthesis
+		wantErr bool
+	}{
+		{"no synthesis", nil, false},
+		{"ohlc", &entity.TickSynthesis{Mode: entity.TickSynthesisModeOhlc}, false},
+		{"brownian bridge at the most points", &entity.TickSynthesis{Mode: entity.TickSynthesisModeBrownianBridge, PointsPerBar: tickSynthesisMaxPoints}, false},
+		{"an unknown mode", &entity.TickSynthesis{Mode: "random_walk"}, true},
+		{"too many points", &entity.TickSynthesis{Mode: entity.TickSynthesisModeOhlc, PointsPerBar: tickSynthesisMaxPoints + 1}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateTickSynthesis(test.conf)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validateTickSynthesis = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestTickPathOhlc(t *testing.T) {
+	tests := []struct {
+		name   string
+		points int
+		bar    entity.Candle
+		want   []string
+	}{
+		{"an up bar dips to the low first", 7, synthesisBar("binance:BTCUSDT", 0, "100.0", "110.0", "95.0", "105.0"), []string{"100", "97.5", "95", "102.5", "110", "107.5", "105"}},
+		{"a down bar rallies to the high first", 7, synthesisBar("binance:BTCUSDT", 0, "105.0", "110.0", "95.0", "100.0"), []string{"105", "107.5", "110", "102.5", "95", "97.5", "100"}},
+		{"too few points are raised to the waypoints", 1, synthesisBar("binance:BTCUSDT", 0, "100", "110", "95", "105"), []string{"100", "95", "110", "105"}},
+		{"the spare steps go to the first segments", 6, synthesisBar("binance:BTCUSDT", 0, "100.0", "110.0", "90.0", "100.0"), []string{"100", "95", "90", "100", "110", "100"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			synthesizer := newTickSynthesizer(entity.TickSynthesis{Mode: entity.TickSynthesisModeOhlc, PointsPerBar: test.points})
+
+			got := []string{}
+			for _, price := range synthesizer.path(test.bar) {
+				got = append(got, price.String())
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("path = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTickPathBrownianBridge(t *testing.T) {
+	bar := synthesisBar("binance:BTCUSDT", 0, "43000.10", "43100.00", "42900.00", "43005.70")
+	conf := entity.TickSynthesis{Mode: entity.TickSynthesisModeBrownianBridge, PointsPerBar: 60}
+
+	for seed := uint64(1); seed <= 20; seed++ {
+		conf.Seed = seed
+		path := newTickSynthesizer(conf).path(bar)
+
+		if len(path) != conf.PointsPerBar {
+			t.Fatalf("seed %d: %d points, want %d", seed, len(path), conf.PointsPerBar)
+		}
+
+		if !path[0].Equal(bar.Open) || !path[len(path)-1].Equal(bar.Close) {
+			t.Errorf("seed %d: the path runs from %s to %s, want the open to the close", seed, path[0], path[len(path)-1])
+		}
+
+		touchesHigh, touchesLow := false, false
+		for _, price := range path {
+			if price.GreaterThan(bar.High) || price.LessThan(bar.Low) {
+				t.Fatalf("seed %d: %s leaves the bar range", seed, price)
+			}
+			if -price.Exponent() > 2 {
+				t.Fatalf("seed %d: %s has more places than the bar", seed, price)
+			}
+
+			touchesHigh = touchesHigh || price.Equal(bar.High)
+			touchesLow = touchesLow || price.Equal(bar.Low)
+		}
+
+		if !touchesHigh || !touchesLow {
+			t.Errorf("seed %d: the path touches the high %v and the low %v, want both", seed, touchesHigh, touchesLow)
+		}
+
+		again := newTickSynthesizer(conf).path(bar)
+		if fmt.Sprint(again) != fmt.Sprint(path) {
+			t.Errorf("seed %d: the same seed gave a different path", seed)
+		}
+	}
+
+	conf.Seed = 1
+	first := newTickSynthesizer(conf).path(bar)
+	conf.Seed = 2
+	if fmt.Sprint(newTickSynthesizer(conf).path(bar)) == fmt.Sprint(first) {
+		t.Errorf("seeds 1 and 2 gave the same path")
+	}
+}
+
+func TestTickExpand(t *testing.T) {
+	synthesizer := newTickSynthesizer(entity.TickSynthesis{Mode: entity.TickSynthesisModeOhlc, PointsPerBar: 4})
+
+	candles := []entity.Candle{
+		synthesisBar("binance:BTCUSDT", 60, "100", "110", "95", "105"),
+		synthesisBar("binance:ETHUSDT", 60, "20", "22", "19", "21"),
+		synthesisBar("binance:BTCUSDT", 120, "105", "106", "100", "101"),
+	}
+
+	msgs := synthesizer.expand(candles, time.Minute, 4*time.Second)
+
+	// the bars of an epoch play side by side, the pause comes after the last of them
+	want := []string{
+		"60000 binance:BTCUSDT 100 0s", "60000 binance:ETHUSDT 20 1s",
+		"75000 binance:BTCUSDT 95 0s", "75000 binance:ETHUSDT 19 1s",
+		"90000 binance:BTCUSDT 110 0s", "90000 binance:ETHUSDT 22 1s",
+		"105000 binance:BTCUSDT 105 0s", "105000 binance:ETHUSDT 21 1s",
+		"120000 binance:BTCUSDT 105 1s",
+		"135000 binance:BTCUSDT 106 1s",
+		"150000 binance:BTCUSDT 100 1s",
+		"165000 binance:BTCUSDT 101 1s",
+	}
+
+	got := []string{}
+	for _, msg := range msgs {
+		tick, ok := msg.value.(entity.Tick)
+		if !ok {
+			t.Fatalf("message value is %T, want entity.Tick", msg.value)
+		}
+
+		if msg.msgType != entity.WsMessageTypeTick || msg.rank != replayMessageRankTick || msg.epoch != tick.BarEpoch {
+			t.Errorf("message %s rank %d at %d does not carry its tick of bar %d", msg.msgType, msg.rank, msg.epoch, tick.BarEpoch)
+		}
+
+		got = append(got, fmt.Sprintf("%d %s %s %s", tick.EpochMilli, tick.Symbol, tick.Price, msg.delay))
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expand =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCreateStreamDrawsTheTickSeed(t *testing.T) {
+	s := newMemoryReplay(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		seed uint64
+	}{
+		{"a zero seed is drawn", 0},
+		{"a seed is kept", 7},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := presetConf(1, "binance:BTCUSDT")
+			conf.TickSynthesis = &entity.TickSynthesis{Mode: entity.TickSynthesisModeBrownianBridge, PointsPerBar: 10, Seed: test.seed}
+
+			_, err := s.CreatePreset(ctx, entity.ReplayPreset{Name: fmt.Sprintf("ticks-%d", test.seed), Config: conf})
+			if err != nil {
+				t.Fatalf("CreatePreset error: %v", err)
+			}
+
+			res, err := s.CreateStream(ctx, entity.CreateStreamReq{CandleSize: hEntity.Duration(time.Minute), Preset: fmt.Sprintf("ticks-%d", test.seed)})
+			if err != nil {
+				t.Fatalf("CreateStream error: %v", err)
+			}
+
+			if res.TickSynthesis == nil || res.TickSynthesis.Seed == 0 || (test.seed != 0 && res.TickSynthesis.Seed != test.seed) {
+				t.Fatalf("CreateStream tick synthesis = %+v, want seed %d or a drawn one", res.TickSynthesis, test.seed)
+			}
+
+			if handler := s.chMap[res.Channel]; handler.tickSynthesis == nil || *handler.tickSynthesis != *res.TickSynthesis {
+				t.Errorf("the stream plays %+v, want the tick synthesis it echoed %+v", handler.tickSynthesis, res.TickSynthesis)
+			}
+
+			if conf.TickSynthesis.Seed != test.seed {
+				t.Errorf("the configured seed became %d", conf.TickSynthesis.Seed)
+			}
+		})
+	}
+}
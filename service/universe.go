@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultUniverseLookback  = 30 * 24 * time.Hour
+	defaultUniverseRebalance = 24 * time.Hour
+)
+
+// universeTracker holds the membership of a universe stream as the replay moves on.
+// It is owned by the puller of a single run.
+type universeTracker struct {
+	universe   entity.Universe
+	candidates []entity.SymbolInfo
+	lookback   time.Duration
+	rebalance  time.Duration
+
+	members       []string
+	nextRebalance time.Time
+}
+
+func newUniverseTracker(universe entity.Universe, candidates []entity.SymbolInfo, start time.Time) *universeTracker {
+	lookback := time.Duration(universe.Lookback)
+	if lookback <= 0 {
+		lookback = defaultUniverseLookback
+	}
+
+	rebalance := time.Duration(universe.Rebalance)
+	if rebalance <= 0 {
+		rebalance = defaultUniverseRebalance
+	}
+
+	return &universeTracker{
+		universe:   universe,
+		candidates: candidates,
+		lookback:   lookback,
+		rebalance:  rebalance,
+
+		// the first membership is taken at the start itself
+		nextRebalance: start,
+	}
+}
+
+func (t *universeTracker) due(cursor time.Time) bool {
+	return !cursor.Before(t.nextRebalance)
+}
+
+// segmentEnd is the last second the current membership is valid for, capped at end.
+func (t *universeTracker) segmentEnd(end time.Time) time.Time {
+	last := t.nextRebalance.Add(-time.Second)
+	if last.Before(end) {
+		return last
+	}
+
+	return end
+}
+
+// rebalanceAt recomputes the membership as of at from the lookback window before it and
+// returns the universe_change message, nil when the membership did not change.
+func (t *universeTracker) rebalanceAt(ctx context.Context, candles1mRepo repository.Candles1m, at time.Time) (*replayMessage, error) {
+	isFirst := t.members == nil
+
+	volumes, err := candles1mRepo.GetQuoteVolumes(ctx, t.universe.Exchange, at.Add(-t.lookback), at)
+	if err != nil {
+		return nil, fmt.Errorf("[service][replay][universeTracker][rebalanceAt][candles1mRepo.GetQuoteVolumes] error: %w", err)
+	}
+
+	type ranked struct {
+		symbol string
+		volume decimal.Decimal
+	}
+
+	eligible := []ranked{}
+	for _, info := range t.candidates {
+		if !isListedAt(info, at) {
+			continue
+		}
+
+		volume, ok := volumes[info.Symbol]
+		if !ok || !volume.IsPositive() {
+			continue
+		}
+
+		eligible = append(eligible, ranked{symbol: info.Symbol, volume: volume})
+	}
+
+	sort.Slice(eligible, func(i, j int) bool {
+		if !eligible[i].volume.Equal(eligible[j].volume) {
+			return eligible[i].volume.GreaterThan(eligible[j].volume)
+		}
+
+		return eligible[i].symbol < eligible[j].symbol
+	})
+
+	if len(eligible) > t.universe.Top {
+		eligible = eligible[:t.universe.Top]
+	}
+
+	members := make([]string, 0, len(eligible))
+	for _, r := range eligible {
+		members = append(members, r.symbol)
+	}
+	sort.Strings(members)
+
+	added, removed := diffMembers(t.members, members)
+
+	t.members = members
+	t.nextRebalance = at.Truncate(t.rebalance).Add(t.rebalance)
+
+	if !isFirst && len(added) == 0 && len(removed) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(entity.UniverseChangeData{
+		Epoch:   at.Unix(),
+		Members: members,
+		Added:   added,
+		Removed: removed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[service][replay][universeTracker][rebalanceAt][json.Marshal] error: %w", err)
+	}
+
+	return &replayMessage{epoch: at.Unix(), rank: replayMessageRankUniverse, msgType: entity.WsMessageTypeUniverseChange, data: data}, nil
+}
+
+func diffMembers(prev, next []string) ([]string, []string) {
+	prevSet := map[string]bool{}
+	for _, symbol := range prev {
+		prevSet[symbol] = true
+	}
+
+	nextSet := map[string]bool{}
+	for _, symbol := range next {
+		nextSet[symbol] = true
+	}
+
+	added := []string{}
+	for _, symbol := range next {
+		if !prevSet[symbol] {
+			added = append(added, symbol)
+		}
+	}
+
+	removed := []string{}
+	for _, symbol := range prev {
+		if !nextSet[symbol] {
+			removed = append(removed, symbol)
+		}
+	}
+
+	return added, removed
+}
+
+func isListedAt(info entity.SymbolInfo, at time.Time) bool {
+	if info.ListedAtUnixMilli > 0 && at.UnixMilli() < info.ListedAtUnixMilli {
+		return false
+	}
+
+	return info.DelistedAtUnixMilli == 0 || at.UnixMilli() < info.DelistedAtUnixMilli
+}
+
+// universeCandidates takes the registry symbols the universe can pick from, including the
+// ones delisted since so that the replay does not inherit a survivorship bias.
+func universeCandidates(symbolInfos []entity.SymbolInfo, universe entity.Universe) ([]entity.SymbolInfo, map[string]int64) {
+	candidates := []entity.SymbolInfo{}
+	delistedAt := map[string]int64{}
+
+	for _, info := range symbolInfos {
+		if info.Exchange != universe.Exchange {
+			continue
+		}
+		if universe.QuoteAsset != "" && info.QuoteAsset != universe.QuoteAsset {
+			continue
+		}
+		if universe.ContractType != "" && info.ContractType != universe.ContractType {
+			continue
+		}
+
+		candidates = append(candidates, info)
+
+		if info.DelistedAtUnixMilli > 0 {
+			delistedAt[info.Symbol] = time.UnixMilli(info.DelistedAtUnixMilli).Unix()
+		}
+	}
+
+	return candidates, delistedAt
+}
+
+func validateUniverse(universe entity.Universe) error {
+	if universe.Exchange == "" {
+		return errors.New("the universe exchange is required")
+	}
+
+	switch universe.Rank {
+	case entity.UniverseRankQuoteVolume:
+	default:
+		return fmt.Errorf("the universe rank '%s' is not supported", universe.Rank)
+	}
+
+	if universe.Top <= 0 {
+		return errors.New("the universe top must be positive")
+	}
+
+	if universe.Lookback < 0 {
+		return errors.New("the universe lookback can not be negative")
+	}
+
+	if universe.Rebalance != 0 && time.Duration(universe.Rebalance) < time.Minute {
+		return errors.New("the universe rebalance must be at least a minute")
+	}
+
+	return nil
+}
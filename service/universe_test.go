@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/memory"
+	"testing"
+	"time"
+
+	hEntity "github.com/michaelyusak/go-helper/entity"
+	"github.com/shopspring/decimal"
+)
+
+func TestUniverseRebalance(t *testing.T) {
+	ctx := context.Background()
+	hour := time.Hour
+
+	candles1mRepo := memory.NewCandles1m()
+
+	// the quote volume of every pair traded half way into each hour, close is 1
+	volumes := []map[string]int64{
+		{"AUSDT": 10, "BUSDT": 20, "CUSDT": 5, "DUSDT": 30},
+		{"AUSDT": 50, "BUSDT": 20, "DUSDT": 30, "EUSDT": 40},
+		{"AUSDT": 50, "DUSDT": 100, "EUSDT": 40},
+		{"AUSDT": 10, "CUSDT": 10, "EUSDT": 10},
+	}
+	for i, byPair := range volumes {
+		for pair, volume := range byPair {
+			err := candles1mRepo.InsertMany(ctx, []entity.Candle{{
+				Epoch:    calendarMonday.Add(time.Duration(i)*hour + 30*time.Minute).Unix(),
+				Exchange: "binance",
+				Pair:     pair,
+				Open:     decimal.NewFromInt(1),
+				High:     decimal.NewFromInt(1),
+				Low:      decimal.NewFromInt(1),
+				Close:    decimal.NewFromInt(1),
+				Volume:   entity.CandleVolume{Total: decimal.NewFromInt(volume), Buy: decimal.NewFromInt(volume)},
+			}})
+			if err != nil {
+				t.Fatalf("InsertMany error: %v", err)
+			}
+		}
+	}
+
+	candidates := []entity.SymbolInfo{
+		{Symbol: "binance:AUSDT"},
+		{Symbol: "binance:BUSDT"},
+		{Symbol: "binance:CUSDT"},
+		{Symbol: "binance:DUSDT", DelistedAtUnixMilli: calendarMonday.Add(2*hour + 30*time.Minute).UnixMilli()},
+		{Symbol: "binance:EUSDT", ListedAtUnixMilli: calendarMonday.Add(hour).UnixMilli()},
+	}
+
+	universe := entity.Universe{Exchange: "binance", Rank: entity.UniverseRankQuoteVolume, Top: 2, Lookback: hEntity.Duration(hour), Rebalance: hEntity.Duration(hour)}
+	tracker := newUniverseTracker(universe, candidates, calendarMonday.Add(hour))
+
+	steps := []struct {
+		name string
+		at   time.Duration
+		// want is the universe_change sent, empty when the membership holds
+		want string
+	}{
+		{"the first membership is always sent", hour, "[binance:BUSDT binance:DUSDT] +[binance:BUSDT binance:DUSDT] -[]"},
+		{"a newly listed pair can rank", 2 * hour, "[binance:AUSDT binance:EUSDT] +[binance:AUSDT binance:EUSDT] -[binance:BUSDT binance:DUSDT]"},
+		{"a delisted pair drops out whatever it traded", 3 * hour, ""},
+		{"ties go to the lower symbol", 4 * hour, "[binance:AUSDT binance:CUSDT] +[binance:CUSDT] -[binance:EUSDT]"},
+	}
+
+	for _, step := range steps {
+		at := calendarMonday.Add(step.at)
+
+		if !tracker.due(at) {
+			t.Fatalf("%s: the tracker is not due at %s", step.name, at)
+		}
+
+		msg, err := tracker.rebalanceAt(ctx, candles1mRepo, at)
+		if err != nil {
+			t.Fatalf("%s: rebalanceAt error: %v", step.name, err)
+		}
+
+		got := ""
+		if msg != nil {
+			var change entity.UniverseChangeData
+			json.Unmarshal(msg.data, &change)
+
+			got = fmt.Sprintf("%v +%v -%v", change.Members, change.Added, change.Removed)
+		}
+
+		if got != step.want {
+			t.Errorf("%s: universe_change %q, want %q", step.name, got, step.want)
+		}
+
+		// the membership holds up to the next rebalance
+		if tracker.due(at.Add(hour-time.Second)) || !tracker.due(at.Add(hour)) {
+			t.Errorf("%s: the next rebalance is at %s, want an hour on", step.name, tracker.nextRebalance)
+		}
+
+		if end := tracker.segmentEnd(at.Add(24 * hour)); !end.Equal(at.Add(hour - time.Second)) {
+			t.Errorf("%s: segmentEnd = %s, want the second before the next rebalance", step.name, end)
+		}
+	}
+}
+
+func TestUniverseCandidates(t *testing.T) {
+	symbolInfos := []entity.SymbolInfo{
+		{Symbol: "binance:BTCUSDT", Exchange: "binance", QuoteAsset: "USDT", ContractType: "PERPETUAL"},
+		{Symbol: "binance:LUNAUSDT", Exchange: "binance", QuoteAsset: "USDT", ContractType: "PERPETUAL", DelistedAtUnixMilli: 1652400000000},
+		{Symbol: "binance:BTCUSDC", Exchange: "binance", QuoteAsset: "USDC", ContractType: "PERPETUAL"},
+		{Symbol: "binance:BTCUSDT_240329", Exchange: "binance", QuoteAsset: "USDT", ContractType: "CURRENT_QUARTER"},
+		{Symbol: "bybit:BTCUSDT", Exchange: "bybit", QuoteAsset: "USDT", ContractType: "PERPETUAL"},
+	}
+
+	tests := []struct {
+		name     string
+		universe entity.Universe
+		want     string
+	}{
+		{"every pair of the exchange", entity.Universe{Exchange: "binance"}, "[binance:BTCUSDT binance:LUNAUSDT binance:BTCUSDC binance:BTCUSDT_240329]"},
+		{"a quote asset", entity.Universe{Exchange: "binance", QuoteAsset: "USDT"}, "[binance:BTCUSDT binance:LUNAUSDT binance:BTCUSDT_240329]"},
+		{"a contract type", entity.Universe{Exchange: "binance", QuoteAsset: "USDT", ContractType: "PERPETUAL"}, "[binance:BTCUSDT binance:LUNAUSDT]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candidates, delistedAt := universeCandidates(symbolInfos, test.universe)
+
+			got := []string{}
+			for _, info := range candidates {
+				got = append(got, info.Symbol)
+			}
+
+			if fmt.Sprint(got) != test.want {
+				t.Errorf("candidates = %v, want %s", got, test.want)
+			}
+
+			// the delisted pairs stay candidates, they only stop at their delisting
+			if delistedAt["binance:LUNAUSDT"] != 1652400000 {
+				t.Errorf("delistedAt = %v", delistedAt)
+			}
+		})
+	}
+}
+
+func TestValidateUniverse(t *testing.T) {
+	valid := entity.Universe{Exchange: "binance", Rank: entity.UniverseRankQuoteVolume, Top: 10}
+
+	tests := []struct {
+		name     string
+		universe func(u *entity.Universe)
+		ok       bool
+	}{
+		{"a top 10 by quote volume", func(u *entity.Universe) {}, true},
+		{"no exchange", func(u *entity.Universe) { u.Exchange = "" }, false},
+		{"an unknown rank", func(u *entity.Universe) { u.Rank = "market_cap" }, false},
+		{"no top", func(u *entity.Universe) { u.Top = 0 }, false},
+		{"a negative lookback", func(u *entity.Universe) { u.Lookback = hEntity.Duration(-time.Hour) }, false},
+		{"a rebalance under a minute", func(u *entity.Universe) { u.Rebalance = hEntity.Duration(time.Second) }, false},
+		{"an hourly rebalance", func(u *entity.Universe) { u.Rebalance = hEntity.Duration(time.Hour) }, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			universe := valid
+			test.universe(&universe)
+
+			err := validateUniverse(universe)
+			if test.ok != (err == nil) {
+				t.Errorf("validateUniverse error = %v, want ok %v", err, test.ok)
+			}
+		})
+	}
+}
@@ -3,32 +3,68 @@ package service
 import (
 	"context"
 	"fmt"
+	"math/rand/v2"
 	binancehttp "michaelyusak/go-quant-replay-engine.git/adapter/binance_http"
+	"michaelyusak/go-quant-replay-engine.git/adapter/synthetic"
 	"michaelyusak/go-quant-replay-engine.git/entity"
 	"michaelyusak/go-quant-replay-engine.git/repository"
 	"net/http"
 	"time"
 
 	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
 type write struct {
+	candlesRepo        repository.Candles
 	candles1mRepo      repository.Candles1m
+	fundingRatesRepo   repository.FundingRates
+	openInterestsRepo  repository.OpenInterests
+	priceCandles1mRepo repository.PriceCandles1m
+	symbolsRepo        repository.Symbols
 	binanceHttpAdapter *binancehttp.Adapter
+	quota              Quota
+	quality            Quality
 }
 
+const (
+	// a synthetic market is written a chunk of minutes at a time
+	syntheticChunkMinutes = 1000
+	maxSyntheticWindow    = 366 * 24 * time.Hour
+)
+
 func NewWrite(
+	candlesRepo repository.Candles,
 	candles1mRepo repository.Candles1m,
+	fundingRatesRepo repository.FundingRates,
+	openInterestsRepo repository.OpenInterests,
+	priceCandles1mRepo repository.PriceCandles1m,
+	symbolsRepo repository.Symbols,
 	binanceHttpAdapter *binancehttp.Adapter,
+	quota Quota,
+	quality Quality,
 ) *write {
 	return &write{
+		candlesRepo:        candlesRepo,
 		candles1mRepo:      candles1mRepo,
+		fundingRatesRepo:   fundingRatesRepo,
+		openInterestsRepo:  openInterestsRepo,
+		priceCandles1mRepo: priceCandles1mRepo,
+		symbolsRepo:        symbolsRepo,
 		binanceHttpAdapter: binanceHttpAdapter,
+		quota:              quota,
+		quality:            quality,
 	}
 }
 
 func (s *write) ImportFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error {
+	release, err := s.quota.AcquireImport(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	intervalSeconds := map[string]int64{
 		"1m": 60,
 	}
@@ -62,9 +98,22 @@ func (s *write) ImportFromBinance(ctx context.Context, req entity.ImportFromBina
 			break
 		}
 
+		// paging goes on from the fetched candles, the rejected ones included
+		valid, err := s.quality.ValidateCandles(ctx, entity.AnomalySourceImport, candles)
+		if err != nil {
+			return apperror.InternalServerError(apperror.AppErrorOpt{
+				Message: fmt.Sprintf("[service][write][ImportFromBinance][quality.ValidateCandles] error: %v", err),
+			})
+		}
+
 		switch req.Interval {
 		case "1m":
-			err = s.candles1mRepo.InsertMany(ctx, candles)
+			// every candle of the page got rejected, there is nothing to insert
+			if len(valid) == 0 {
+				break
+			}
+
+			err = s.candles1mRepo.InsertMany(ctx, valid)
 			if err != nil {
 				logrus.
 					WithError(err).
@@ -131,3 +180,150 @@ func (s *write) ImportFromBinance(ctx context.Context, req entity.ImportFromBina
 
 	return nil
 }
+
+// RebuildRollups recomputes the rollups of the whole days within the window from the
+// stored 1m candles, for history stored before the rollups were kept or repaired since.
+func (s *write) RebuildRollups(ctx context.Context, req entity.RebuildRollupsReq) (entity.RebuildRollupsRes, error) {
+	if req.StartTimeUnixMilli <= 0 || req.EndTimeUnixMilli < req.StartTimeUnixMilli {
+		return entity.RebuildRollupsRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: "the rebuild needs a start time and an end time after it",
+			Message:         "[service][write][RebuildRollups] invalid window",
+		})
+	}
+
+	release, err := s.quota.AcquireImport(ctx)
+	if err != nil {
+		return entity.RebuildRollupsRes{}, err
+	}
+	defer release()
+
+	start := time.UnixMilli(req.StartTimeUnixMilli)
+	end := time.UnixMilli(req.EndTimeUnixMilli)
+
+	written, err := s.candlesRepo.RebuildRollups(ctx, start, end)
+	if err != nil {
+		return entity.RebuildRollupsRes{}, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][write][RebuildRollups][candlesRepo.RebuildRollups] error: %v", err),
+		})
+	}
+
+	logrus.
+		WithField("start", start.String()).
+		WithField("end", end.String()).
+		WithField("candles", written).
+		Info("[service][write][RebuildRollups] rollups rebuilt")
+
+	return entity.RebuildRollupsRes{Candles: written}, nil
+}
+
+// WriteSynthetic generates a synthetic market over the window into the 1m candles, its
+// pairs listed under the exchange of the market, to replay it like any stored history.
+func (s *write) WriteSynthetic(ctx context.Context, req entity.WriteSyntheticReq) (entity.WriteSyntheticRes, error) {
+	if req.StartTimeUnixMilli <= 0 || req.EndTimeUnixMilli < req.StartTimeUnixMilli {
+		return entity.WriteSyntheticRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: "the synthetic market needs a start time and an end time after it",
+			Message:         "[service][write][WriteSynthetic] invalid window",
+		})
+	}
+
+	start := time.UnixMilli(req.StartTimeUnixMilli)
+	end := time.UnixMilli(req.EndTimeUnixMilli)
+
+	if end.Sub(start) > maxSyntheticWindow {
+		return entity.WriteSyntheticRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: fmt.Sprintf("a synthetic market is written at most %s at a time", maxSyntheticWindow),
+			Message:         "[service][write][WriteSynthetic] window too long",
+		})
+	}
+
+	market := req.Market
+	if market.Seed == 0 {
+		market.Seed = rand.Uint64()
+	}
+	market = synthetic.WithDefaults(market)
+
+	generator, err := synthetic.NewGenerator(market, start)
+	if err != nil {
+		return entity.WriteSyntheticRes{}, apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: err.Error(),
+			Message:         fmt.Sprintf("[service][write][WriteSynthetic][synthetic.NewGenerator] error: %v", err),
+		})
+	}
+
+	release, err := s.quota.AcquireImport(ctx)
+	if err != nil {
+		return entity.WriteSyntheticRes{}, err
+	}
+	defer release()
+
+	symbols := synthetic.Symbols(market)
+
+	infos := make([]entity.SymbolInfo, 0, len(market.Pairs))
+	for _, pair := range market.Pairs {
+		infos = append(infos, entity.SymbolInfo{
+			Symbol:             fmt.Sprintf("%s:%s", market.Exchange, pair),
+			Exchange:           market.Exchange,
+			Pair:               pair,
+			BaseAsset:          pair,
+			TickSize:           decimal.New(1, -market.PriceDecimals),
+			ContractType:       entity.SyntheticContractType,
+			Status:             entity.SyntheticStatus,
+			ListedAtUnixMilli:  generator.Epoch() * 1000,
+			UpdatedAtUnixMilli: time.Now().UnixMilli(),
+		})
+	}
+
+	err = s.symbolsRepo.InsertMany(ctx, infos)
+	if err != nil {
+		return entity.WriteSyntheticRes{}, apperror.InternalServerError(apperror.AppErrorOpt{
+			Message: fmt.Sprintf("[service][write][WriteSynthetic][symbolsRepo.InsertMany] error: %v", err),
+		})
+	}
+
+	var written int64
+	for generator.Epoch() <= end.Unix() {
+		candles := []entity.Candle{}
+		for i := 0; i < syntheticChunkMinutes && generator.Epoch() <= end.Unix(); i++ {
+			candles = append(candles, generator.Next()...)
+		}
+
+		// generated bars are held to the same rules as imported ones
+		valid, err := s.quality.ValidateCandles(ctx, entity.AnomalySourceSynthetic, candles)
+		if err != nil {
+			return entity.WriteSyntheticRes{}, apperror.InternalServerError(apperror.AppErrorOpt{
+				Message: fmt.Sprintf("[service][write][WriteSynthetic][quality.ValidateCandles] error: %v", err),
+			})
+		}
+
+		if len(valid) == 0 {
+			continue
+		}
+
+		err = s.candles1mRepo.InsertMany(ctx, valid)
+		if err != nil {
+			return entity.WriteSyntheticRes{}, apperror.InternalServerError(apperror.AppErrorOpt{
+				Message: fmt.Sprintf("[service][write][WriteSynthetic][candles1mRepo.InsertMany] error: %v", err),
+			})
+		}
+
+		written += int64(len(valid))
+	}
+
+	logrus.
+		WithField("exchange", market.Exchange).
+		WithField("seed", market.Seed).
+		WithField("start", start.String()).
+		WithField("end", end.String()).
+		WithField("candles", written).
+		Info("[service][write][WriteSynthetic] synthetic market written")
+
+	return entity.WriteSyntheticRes{
+		Market:  market,
+		Symbols: symbols,
+		Candles: written,
+	}, nil
+}
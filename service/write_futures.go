@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"net/http"
+	"time"
+
+	"github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *write) ImportFundingRateFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error {
+	release, err := s.quota.AcquireImport(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return importPaged(ctx, "ImportFundingRateFromBinance", req,
+		func(start int64) ([]entity.FundingRate, error) {
+			return s.binanceHttpAdapter.GetFundingRateHistory(ctx, start, req.EndTimeUnixMilli, req.Limit, req.Symbol)
+		},
+		func(rates []entity.FundingRate) error {
+			return s.fundingRatesRepo.InsertMany(ctx, rates)
+		},
+		func(rate entity.FundingRate) int64 {
+			return rate.Epoch
+		},
+	)
+}
+
+func (s *write) ImportOpenInterestFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error {
+	if req.Interval == "" {
+		return apperror.BadRequestError(apperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			ResponseMessage: "interval is required as the open interest period",
+			Message:         "[service][write][ImportOpenInterestFromBinance] empty interval",
+		})
+	}
+
+	release, err := s.quota.AcquireImport(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return importPaged(ctx, "ImportOpenInterestFromBinance", req,
+		func(start int64) ([]entity.OpenInterest, error) {
+			return s.binanceHttpAdapter.GetOpenInterestHistory(ctx, start, req.EndTimeUnixMilli, req.Limit, req.Symbol, req.Interval)
+		},
+		func(openInterests []entity.OpenInterest) error {
+			return s.openInterestsRepo.InsertMany(ctx, openInterests)
+		},
+		func(oi entity.OpenInterest) int64 {
+			return oi.Epoch
+		},
+	)
+}
+
+func (s *write) ImportMarkPriceFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error {
+	err := validatePriceKlineInterval("ImportMarkPriceFromBinance", req.Interval)
+	if err != nil {
+		return err
+	}
+
+	release, err := s.quota.AcquireImport(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return importPaged(ctx, "ImportMarkPriceFromBinance", req,
+		func(start int64) ([]entity.PriceCandle, error) {
+			return s.binanceHttpAdapter.GetMarkPriceKlines(ctx, start, req.EndTimeUnixMilli, req.Limit, req.Symbol, req.Interval)
+		},
+		func(candles []entity.PriceCandle) error {
+			return s.insertPriceCandles(ctx, entity.AnomalySourceMarkPrice, candles)
+		},
+		func(candle entity.PriceCandle) int64 {
+			return candle.Epoch
+		},
+	)
+}
+
+func (s *write) ImportIndexPriceFromBinance(ctx context.Context, req entity.ImportFromBinanceReq) error {
+	err := validatePriceKlineInterval("ImportIndexPriceFromBinance", req.Interval)
+	if err != nil {
+		return err
+	}
+
+	release, err := s.quota.AcquireImport(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return importPaged(ctx, "ImportIndexPriceFromBinance", req,
+		func(start int64) ([]entity.PriceCandle, error) {
+			return s.binanceHttpAdapter.GetIndexPriceKlines(ctx, start, req.EndTimeUnixMilli, req.Limit, req.Symbol, req.Interval)
+		},
+		func(candles []entity.PriceCandle) error {
+			return s.insertPriceCandles(ctx, entity.AnomalySourceIndexPrice, candles)
+		},
+		func(candle entity.PriceCandle) int64 {
+			return candle.Epoch
+		},
+	)
+}
+
+func (s *write) insertPriceCandles(ctx context.Context, source entity.AnomalySource, candles []entity.PriceCandle) error {
+	valid, err := s.quality.ValidatePriceCandles(ctx, source, candles)
+	if err != nil {
+		return err
+	}
+
+	if len(valid) == 0 {
+		return nil
+	}
+
+	return s.priceCandles1mRepo.InsertMany(ctx, valid)
+}
+
+func validatePriceKlineInterval(method, interval string) error {
+	if interval == entity.CandleInterval1m {
+		return nil
+	}
+
+	return apperror.BadRequestError(apperror.AppErrorOpt{
+		Code:            http.StatusUnprocessableEntity,
+		ResponseMessage: fmt.Sprintf("the interval '%s' is not supported", interval),
+		Message:         fmt.Sprintf("[service][write][%s] the interval '%s' is not supported", method, interval),
+	})
+}
+
+// importPaged walks binance pages forward from req.StartTimeUnixMilli until an empty page
+// or req.EndTimeUnixMilli is reached, inserting each page as it arrives.
+func importPaged[T any](
+	ctx context.Context,
+	method string,
+	req entity.ImportFromBinanceReq,
+	fetch func(start int64) ([]T, error),
+	insert func(rows []T) error,
+	epochOf func(row T) int64,
+) error {
+	log := logrus.
+		WithField("end", time.UnixMilli(req.EndTimeUnixMilli).String()).
+		WithField("limit", req.Limit).
+		WithField("symbol", req.Symbol).
+		WithField("interval", req.Interval)
+
+	log.
+		WithField("start", time.UnixMilli(req.StartTimeUnixMilli).String()).
+		Infof("[service][write][%s] import started", method)
+
+	start := req.StartTimeUnixMilli
+
+	for {
+		rows, err := fetch(start)
+		if err != nil {
+			log.
+				WithError(err).
+				WithField("start", time.UnixMilli(start).String()).
+				Errorf("[service][write][%s][fetch]", method)
+
+			return apperror.InternalServerError(apperror.AppErrorOpt{
+				Message: fmt.Sprintf("[service][write][%s][fetch] error: %v", method, err),
+			})
+		}
+
+		if len(rows) == 0 {
+			break
+		}
+
+		err = insert(rows)
+		if err != nil {
+			log.
+				WithError(err).
+				WithField("start", time.UnixMilli(start).String()).
+				Errorf("[service][write][%s][insert]", method)
+
+			return apperror.InternalServerError(apperror.AppErrorOpt{
+				Message: fmt.Sprintf("[service][write][%s][insert] error: %v", method, err),
+			})
+		}
+
+		var lastEpoch int64
+		for _, row := range rows {
+			if epoch := epochOf(row); epoch > lastEpoch {
+				lastEpoch = epoch
+			}
+		}
+
+		start = (lastEpoch + 1) * 1000
+
+		if req.EndTimeUnixMilli != 0 && start > req.EndTimeUnixMilli {
+			log.
+				WithField("last_imported", time.Unix(lastEpoch, 0).String()).
+				Infof("[service][write][%s] import done", method)
+			break
+		}
+
+		log.
+			WithField("last_imported", time.Unix(lastEpoch, 0).String()).
+			WithField("next", time.UnixMilli(start).String()).
+			Infof("[service][write][%s] import in progress", method)
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return nil
+}
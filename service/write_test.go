@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"michaelyusak/go-quant-replay-engine.git/entity"
+	"michaelyusak/go-quant-replay-engine.git/repository/memory"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestWriteSyntheticValidatesTheCandles(t *testing.T) {
+	ctx := context.Background()
+	start := calendarMonday
+
+	tests := []struct {
+		name   string
+		policy entity.AnomalyPolicy
+		stored int64
+	}{
+		{"flagged bars are stored dirty", entity.AnomalyPolicyFlag, 4},
+		{"rejected bars are not stored", entity.AnomalyPolicyReject, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candles1mRepo := memory.NewCandles1m()
+			candlesRepo := memory.NewCandles(candles1mRepo)
+			anomaliesRepo := memory.NewAnomalies()
+
+			// every generated bar moves more than the tiny wick ratio allows
+			quality := NewQuality(anomaliesRepo, entity.QualityConfig{
+				Rules:            map[entity.AnomalyRule]entity.AnomalyPolicy{entity.AnomalyRuleExtremeWick: test.policy},
+				ExtremeWickRatio: decimal.RequireFromString("0.000000001"),
+			})
+
+			s := NewWrite(candlesRepo, candles1mRepo, memory.NewFundingRates(), memory.NewOpenInterests(), memory.NewPriceCandles1m(), memory.NewSymbols(), nil, NewQuota(entity.Quota{}, nil), quality)
+
+			res, err := s.WriteSynthetic(ctx, entity.WriteSyntheticReq{
+				Market:             entity.SyntheticMarket{Model: entity.SyntheticModelGbm, Seed: 11, Exchange: "sim", Pairs: []string{"AAA"}, Volatility: 0.5},
+				StartTimeUnixMilli: start.UnixMilli(),
+				EndTimeUnixMilli:   start.Add(3 * time.Minute).UnixMilli(),
+			})
+			if err != nil {
+				t.Fatalf("WriteSynthetic error: %v", err)
+			}
+
+			if res.Candles != test.stored {
+				t.Errorf("WriteSynthetic stored %d candles, want %d", res.Candles, test.stored)
+			}
+
+			stored, err := candlesRepo.GetCandles(ctx, entity.CandleInterval1m, []string{"sim:AAA"}, start, start.Add(3*time.Minute), nil, 0)
+			if err != nil {
+				t.Fatalf("GetCandles error: %v", err)
+			}
+
+			if int64(len(stored)) != test.stored {
+				t.Fatalf("GetCandles read %d candles, want %d", len(stored), test.stored)
+			}
+			for _, candle := range stored {
+				if !candle.Dirty {
+					t.Errorf("the flagged bar at %d is not dirty", candle.Epoch)
+				}
+			}
+
+			anomalies, err := anomaliesRepo.GetAnomalies(ctx, "sim:AAA", start, start.Add(4*time.Minute), 0)
+			if err != nil {
+				t.Fatalf("GetAnomalies error: %v", err)
+			}
+
+			if len(anomalies) != 4 {
+				t.Fatalf("%d anomalies logged, want 4", len(anomalies))
+			}
+			for _, anomaly := range anomalies {
+				if anomaly.Source != entity.AnomalySourceSynthetic || anomaly.Rule != entity.AnomalyRuleExtremeWick || anomaly.Policy != test.policy {
+					t.Errorf("anomaly = %+v, want a synthetic extreme wick %s", anomaly, test.policy)
+				}
+			}
+		})
+	}
+}